@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/meagar/rsvp/db"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	sessionCookie = "rsvp_admin_session"
+	sessionTTL    = 12 * time.Hour
+)
+
+type AdminHandler struct {
+	cfg *Config
+	db  *db.Pool
+	// reads is used for listings, which may lag slightly behind db when
+	// it's a read replica.
+	reads     *db.Pool
+	mailer    Mailer
+	reminders *reminders
+	path      string
+	sessions  signer
+	logins    *loginGuard
+	mux       *http.ServeMux
+}
+
+var _ http.Handler = &AdminHandler{}
+
+// newAdminHandler returns the admin site mounted at ADMIN_PATH, which ends in
+// a slash.
+func newAdminHandler(cfg *Config, pool, reads *db.Pool, mailer Mailer, reminders *reminders, sessions signer, logins *loginGuard) *AdminHandler {
+	path := cfg.AdminPath
+	h := &AdminHandler{
+		cfg:       cfg,
+		db:        pool,
+		reads:     reads,
+		mailer:    mailer,
+		reminders: reminders,
+		path:      path,
+		sessions:  sessions,
+		logins:    logins,
+		mux:       http.NewServeMux(),
+	}
+
+	h.mux.HandleFunc("GET "+path+"login", h.loginForm)
+	h.mux.HandleFunc("POST "+path+"login", h.login)
+	h.mux.HandleFunc("POST "+path+"logout", h.logout)
+	h.mux.HandleFunc("GET "+path+"{$}", h.index)
+	h.mux.HandleFunc("GET "+path+"events/new", h.newEvent)
+	h.mux.HandleFunc("POST "+path+"events", h.createEvent)
+	h.mux.HandleFunc("GET "+path+"events/{slug}/edit", h.editEvent)
+	h.mux.HandleFunc("POST "+path+"events/{slug}/edit", h.updateEvent)
+	h.mux.HandleFunc("GET "+path+"events/{slug}/guests", h.guests)
+	h.mux.HandleFunc("GET "+path+"events/{slug}/export", h.export)
+	h.mux.HandleFunc("GET "+path+"events/{slug}/export.csv", h.exportCSV)
+	h.mux.HandleFunc("GET "+path+"events/{slug}/printout", h.printout)
+	h.mux.HandleFunc("GET "+path+"events/{slug}/seating", h.seating)
+	h.mux.HandleFunc("POST "+path+"events/{slug}/seating", h.assignTables)
+	h.mux.HandleFunc("POST "+path+"events/{slug}/import", h.importGuests)
+	h.mux.HandleFunc("POST "+path+"events/{slug}/remind", h.remind)
+	h.mux.HandleFunc("POST "+path+"events/{slug}/close", h.closeEvent)
+	h.mux.HandleFunc("POST "+path+"events/{slug}/clone", h.cloneEvent)
+	h.mux.HandleFunc("GET "+path+"password", h.passwordForm)
+	h.mux.HandleFunc("POST "+path+"password", h.changePassword)
+	h.mux.HandleFunc("GET "+path+"audit", h.auditLog)
+	h.mux.HandleFunc("GET "+path+"stats", h.stats)
+	h.mux.HandleFunc("GET "+path+"search", h.search)
+	h.mux.HandleFunc("GET "+path+"guests/{code}/qr.png", h.guestQR)
+	h.mux.HandleFunc("GET "+path+"guests/{id}", h.showGuest)
+	h.mux.HandleFunc("GET "+path+"guests/{id}/preview", h.previewGuest)
+	h.mux.HandleFunc("POST "+path+"guests/{id}", h.updateGuest)
+	h.mux.HandleFunc("GET "+path+"guests/{id}/history", h.guestHistory)
+	h.mux.HandleFunc("POST "+path+"guests/{id}/delete", h.deleteGuest)
+	h.mux.HandleFunc("POST "+path+"guests/{id}/restore", h.restoreGuest)
+	h.mux.Handle(path, methodFallback(h.mux))
+	return h
+}
+
+// ServeHTTP requires a valid session for everything but logging in and out.
+// Sessions started with a password that has since been changed aren't
+// valid.
+func (h *AdminHandler) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	if req.URL.Path != h.path+"login" && req.URL.Path != h.path+"logout" {
+		user, ok, err := adminSession(req, h.cfg, h.db, h.sessions)
+		if err != nil {
+			serverError(rw, req, err)
+			return
+		}
+		if !ok {
+			http.Redirect(rw, req, h.path+"login", http.StatusSeeOther)
+			return
+		}
+		req = req.WithContext(context.WithValue(req.Context(), adminUserKey, user))
+	}
+
+	h.mux.ServeHTTP(rw, req)
+}
+
+// adminPage holds the fields every admin template needs.
+type adminPage struct {
+	User      string
+	AdminPath string
+}
+
+func (h *AdminHandler) page(req *http.Request) adminPage {
+	user, _ := req.Context().Value(adminUserKey).(string)
+	return adminPage{User: user, AdminPath: h.path}
+}
+
+func (h *AdminHandler) index(rw http.ResponseWriter, req *http.Request) {
+	ctx, cancel := h.cfg.queryContext(req)
+	defer cancel()
+
+	events, err := db.ListEventSummaries(ctx, h.reads)
+	if err != nil {
+		serverError(rw, req, err)
+		return
+	}
+
+	renderPage(rw, req, http.StatusOK, "admin/index", struct {
+		adminPage
+		Events []*db.EventSummary
+		Now    time.Time
+	}{adminPage: h.page(req), Events: events, Now: time.Now()})
+}
+
+func (h *AdminHandler) loginForm(rw http.ResponseWriter, req *http.Request) {
+	renderPage(rw, req, http.StatusOK, "admin/login", struct{ Error string }{})
+}
+
+// checkCredentials reports whether user and password match the configured
+// admin account, returning the current password hash. The bcrypt comparison
+// always runs so that a wrong user name takes as long to reject as a wrong
+// password.
+func (h *AdminHandler) checkCredentials(req *http.Request, user, password string) (hash []byte, ok bool, err error) {
+	ctx, cancel := h.cfg.queryContext(req)
+	defer cancel()
+
+	hash, err = currentPasswordHash(ctx, h.db, []byte(h.cfg.AdminPasswordHash))
+	if err != nil {
+		return nil, false, err
+	}
+	userOK := subtle.ConstantTimeCompare([]byte(user), []byte(h.cfg.AdminUser)) == 1
+	passwordOK := bcrypt.CompareHashAndPassword(hash, []byte(password)) == nil
+	return hash, userOK && passwordOK && h.cfg.AdminUser != "", nil
+}
+
+// startSession logs user in, with a session bound to the password hash they
+// logged in with.
+func (h *AdminHandler) startSession(rw http.ResponseWriter, req *http.Request, user string, hash []byte) {
+	expires := time.Now().Add(sessionTTL)
+	cookie := h.cfg.newCookie(req, sessionCookie, h.sessions.signSession(user, h.sessions.passwordFingerprint(hash), expires))
+	cookie.Expires = expires
+	http.SetCookie(rw, cookie)
+}
+
+// login checks the submitted credentials and starts a session. Clients with
+// too many failed attempts in a row are locked out for a while, without their
+// credentials being checked at all.
+func (h *AdminHandler) login(rw http.ResponseWriter, req *http.Request) {
+	if err := req.ParseForm(); err != nil {
+		bodyError(rw, err)
+		return
+	}
+
+	logger := loggerFrom(req.Context())
+	ip := h.cfg.clientIP(req)
+	if wait, locked := h.logins.lockedOut(ip, time.Now()); locked {
+		logger.Warn("Admin login refused: locked out", "ip", ip, "remaining", wait.Round(time.Second).String())
+		h.lockedOut(rw, req, wait)
+		return
+	}
+
+	user := req.PostForm.Get("user")
+	hash, ok, err := h.checkCredentials(req, user, req.PostForm.Get("password"))
+	if err != nil {
+		serverError(rw, req, err)
+		return
+	}
+	if !ok {
+		failures, locked := h.logins.fail(ip, time.Now())
+		logger.Warn("Admin login failed", "user", user, "ip", ip, "failures", failures)
+		if locked {
+			logger.Warn("Locking out admin logins", "ip", ip, "for", h.logins.lockout.String())
+			h.lockedOut(rw, req, h.logins.lockout)
+			return
+		}
+		renderPage(rw, req, http.StatusUnauthorized, "admin/login", struct{ Error string }{Error: "Invalid user name or password."})
+		return
+	}
+	h.logins.succeed(ip)
+
+	h.startSession(rw, req, user, hash)
+	http.Redirect(rw, req, h.path, http.StatusSeeOther)
+}
+
+// lockedOut tells a client it can't try logging in again for wait.
+func (h *AdminHandler) lockedOut(rw http.ResponseWriter, req *http.Request, wait time.Duration) {
+	minutes := int(math.Ceil(wait.Minutes()))
+	rw.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	renderPage(rw, req, http.StatusTooManyRequests, "admin/login", struct{ Error string }{
+		Error: "Too many failed logins. Please try again in " + pluralize(minutes, "minute", "minutes") + ".",
+	})
+}
+
+func (h *AdminHandler) logout(rw http.ResponseWriter, req *http.Request) {
+	cookie := h.cfg.newCookie(req, sessionCookie, "")
+	cookie.MaxAge = -1
+	http.SetCookie(rw, cookie)
+	h.setFlash(rw, req, "You've been logged out.")
+	http.Redirect(rw, req, h.path+"login", http.StatusSeeOther)
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/meagar/rsvp/db"
+)
+
+func TestAdminRequiresSession(t *testing.T) {
+	site := newTestSite(t, unreachablePool(t))
+
+	for _, path := range []string{"/admin/", "/admin/events/new", "/admin/audit"} {
+		rec := site.get(path)
+		if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/admin/login" {
+			t.Errorf("GET %s: got %d to %q, want a redirect to the login page", path, rec.Code, rec.Header().Get("Location"))
+		}
+	}
+}
+
+func TestAdminLogin(t *testing.T) {
+	pool := testPool(t)
+	site := newTestSite(t, pool)
+
+	rec := site.post("/admin/login", url.Values{"user": {testAdminUser}, "password": {testAdminPassword}})
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/admin/" {
+		t.Fatalf("got %d to %q, want a redirect to the admin site", rec.Code, rec.Header().Get("Location"))
+	}
+	session := responseCookie(rec, sessionCookie)
+	if session == nil {
+		t.Fatal("no session cookie was set")
+	}
+
+	if rec := site.get("/admin/", session); rec.Code != http.StatusOK {
+		t.Errorf("GET /admin/ with the session: status = %d, want %d", rec.Code, http.StatusOK)
+	}
+}
+
+func TestAdminLoginWrongPassword(t *testing.T) {
+	pool := testPool(t)
+	site := newTestSite(t, pool)
+
+	rec := site.post("/admin/login", url.Values{"user": {testAdminUser}, "password": {"wrong password"}})
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+	if session := responseCookie(rec, sessionCookie); session != nil {
+		t.Errorf("a session cookie was set: %v", session)
+	}
+}
+
+// dashboardCells matches the table cells on the dashboard that hold plain
+// text rather than links or forms.
+var dashboardCells = regexp.MustCompile(`<td>([^<]*)</td>`)
+
+// dashboardRow returns the text cells of the dashboard's row for the event
+// titled title.
+func dashboardRow(t *testing.T, body, title string) []string {
+	t.Helper()
+	_, row, ok := strings.Cut(body, ">"+title+"</a></td>")
+	if !ok {
+		t.Fatalf("the dashboard has no row for %q", title)
+	}
+	row, _, _ = strings.Cut(row, "</tr>")
+	var cells []string
+	for _, match := range dashboardCells.FindAllStringSubmatch(row, -1) {
+		cells = append(cells, match[1])
+	}
+	return cells
+}
+
+func TestAdminDashboardCounts(t *testing.T) {
+	pool := testPool(t)
+	site := newTestSite(t, pool)
+	party := createTestEvent(t, pool, &db.Event{Title: "Garden Party", Capacity: ptr(3)})
+	createTestEvent(t, pool, &db.Event{Title: "Book Club"})
+
+	respond := func(name string, attendance db.Attendance, partySize int) {
+		guest := createTestGuest(t, pool, &db.Guest{Name: name, EventId: &party.Id, MaxPartySize: 2})
+		recordTestResponse(t, pool, guest, db.Response{Attendance: attendance, PartySize: partySize})
+	}
+	respond("Ada", db.AttendanceYes, 2)
+	respond("Grace", db.AttendanceYes, 1)
+	// The party is full by now, so Alan is waitlisted.
+	respond("Alan", db.AttendanceYes, 1)
+	respond("Edsger", db.AttendanceNo, 1)
+	createTestGuest(t, pool, &db.Guest{Name: "Barbara", EventId: &party.Id})
+	// Deleted guests aren't counted.
+	deleted := createTestGuest(t, pool, &db.Guest{Name: "Donald", EventId: &party.Id})
+	if _, _, err := db.DeleteGuest(context.Background(), pool, deleted.Id); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := site.get("/admin/", site.adminSession())
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	body := rec.Body.String()
+
+	tests := []struct {
+		title string
+		// want is the invited, responded, attending, waitlisted, declined,
+		// maybe, pending and headcount columns.
+		want []string
+	}{
+		{title: "Garden Party", want: []string{"5", "4", "2", "1", "1", "0", "1", "3 / 3"}},
+		{title: "Book Club", want: []string{"0", "0", "0", "0", "0", "0", "0", "0"}},
+	}
+	for _, tt := range tests {
+		// The first cell is the event's date.
+		if cells := dashboardRow(t, body, tt.title); len(cells) == 0 || !slices.Equal(cells[1:], tt.want) {
+			t.Errorf("%s: counts = %q, want %q", tt.title, cells, tt.want)
+		}
+	}
+}
+
+func TestAdminDashboardCountsMaybe(t *testing.T) {
+	pool := testPool(t)
+	site := newTestSite(t, pool)
+	event := createTestEvent(t, pool, &db.Event{Title: "Garden Party", AllowMaybe: true})
+
+	respond := func(name string, attendance db.Attendance, partySize int) {
+		guest := createTestGuest(t, pool, &db.Guest{Name: name, EventId: &event.Id, MaxPartySize: 2})
+		recordTestResponse(t, pool, guest, db.Response{Attendance: attendance, PartySize: partySize})
+	}
+	respond("Ada", db.AttendanceYes, 1)
+	respond("Grace", db.AttendanceMaybe, 2)
+	respond("Alan", db.AttendanceMaybe, 1)
+	respond("Edsger", db.AttendanceNo, 1)
+
+	rec := site.get("/admin/", site.adminSession())
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	// Maybes count as responses but not towards attending or the headcount.
+	want := []string{"4", "4", "1", "0", "1", "2", "0", "1"}
+	if cells := dashboardRow(t, rec.Body.String(), event.Title); len(cells) == 0 || !slices.Equal(cells[1:], want) {
+		t.Errorf("counts = %q, want %q", cells, want)
+	}
+}
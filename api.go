@@ -0,0 +1,315 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/meagar/rsvp/db"
+)
+
+// apiError is the body of every error response from the JSON API.
+type apiError struct {
+	Error string `json:"error"`
+	Code  string `json:"code"`
+}
+
+// rsvpState is a guest's current response as reported by the JSON API.
+type rsvpState struct {
+	Code     string         `json:"code"`
+	Name     string         `json:"name"`
+	Response *db.Attendance `json:"response"`
+	// Attending is kept for clients that predate Response. It's null for a
+	// maybe, as for no response at all.
+	Attending     *bool      `json:"attending"`
+	PartySize     int        `json:"party_size"`
+	MaxPartySize  int        `json:"max_party_size"`
+	Companions    []string   `json:"companions"`
+	Dietary       string     `json:"dietary"`
+	Notes         string     `json:"notes"`
+	DeclineReason string     `json:"decline_reason"`
+	RespondedAt   *time.Time `json:"responded_at"`
+	Waitlisted    bool       `json:"waitlisted"`
+}
+
+// newRSVPState reports guest's response to event, which may be nil.
+func newRSVPState(guest *db.Guest, event *db.Event, companions []string) rsvpState {
+	if companions == nil {
+		companions = []string{}
+	}
+	var attending *bool
+	if guest.IsAttending() || guest.IsDeclined() {
+		yes := guest.IsAttending()
+		attending = &yes
+	}
+	return rsvpState{
+		Code:          guest.InviteCode,
+		Name:          guest.Name,
+		Response:      guest.Attendance,
+		Attending:     attending,
+		PartySize:     guest.PartySize,
+		MaxPartySize:  event.PartySizeFor(guest),
+		Companions:    companions,
+		Dietary:       guest.Dietary,
+		Notes:         guest.Notes,
+		DeclineReason: guest.DeclineReason,
+		RespondedAt:   guest.RespondedAt,
+		Waitlisted:    guest.IsWaitlisted(),
+	}
+}
+
+func writeJSON(rw http.ResponseWriter, status int, v any) {
+	rw.Header().Set("Content-Type", "application/json; charset=utf-8")
+	rw.WriteHeader(status)
+	json.NewEncoder(rw).Encode(v)
+}
+
+func writeAPIError(rw http.ResponseWriter, status int, code, msg string) {
+	writeJSON(rw, status, apiError{Error: msg, Code: code})
+}
+
+// wantsJSON reports whether errors for req should be reported as JSON rather
+// than as a page: it's for the JSON API, it has a JSON body, or the client
+// accepts JSON but not HTML.
+func wantsJSON(req *http.Request) bool {
+	if strings.HasPrefix(req.URL.Path, "/api/") || isJSON(req) {
+		return true
+	}
+
+	var jsonOK, htmlOK bool
+	for _, part := range strings.Split(req.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		switch mediaType {
+		case "application/json":
+			jsonOK = true
+		case "text/html", "text/*", "*/*":
+			htmlOK = true
+		}
+	}
+	return jsonOK && !htmlOK
+}
+
+// statusError reports a failure that needs no explanation beyond its status,
+// as JSON with the given code if the client wants JSON and as plain text
+// otherwise.
+func statusError(rw http.ResponseWriter, req *http.Request, status int, code string) {
+	if wantsJSON(req) {
+		writeAPIError(rw, status, code, http.StatusText(status))
+		return
+	}
+	http.Error(rw, http.StatusText(status), status)
+}
+
+// acceptsJSON reports whether the client will accept a JSON response.
+func acceptsJSON(req *http.Request) bool {
+	accept := req.Header.Get("Accept")
+	if accept == "" {
+		return true
+	}
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		switch mediaType {
+		case "application/json", "application/*", "*/*":
+			return true
+		}
+	}
+	return false
+}
+
+// isJSON reports whether the request body is declared to be JSON.
+func isJSON(req *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	return err == nil && mediaType == "application/json"
+}
+
+// rsvpRequest is a JSON response posted to /rsvp, which names the guest the
+// same way as the form's code and event fields. The code may be left out when
+// posting to /rsvp/{code}.
+type rsvpRequest struct {
+	Code  string `json:"code"`
+	Event string `json:"event,omitempty"`
+	Sig   string `json:"sig,omitempty"`
+	rsvpSubmission
+}
+
+// decodeSubmission reads a JSON request body into v, writing an error and
+// returning false if it can't.
+func decodeSubmission(rw http.ResponseWriter, req *http.Request, v any) bool {
+	if !acceptsJSON(req) {
+		writeAPIError(rw, http.StatusNotAcceptable, "not_acceptable", "responses are only available as application/json")
+		return false
+	}
+	if !isJSON(req) {
+		writeAPIError(rw, http.StatusUnsupportedMediaType, "unsupported_media_type", "request body must be application/json")
+		return false
+	}
+
+	dec := json.NewDecoder(req.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); tooLarge(err) {
+		writeAPIError(rw, http.StatusRequestEntityTooLarge, "too_large", "request body is too large")
+		return false
+	} else if err != nil {
+		writeAPIError(rw, http.StatusBadRequest, "invalid_json", err.Error())
+		return false
+	}
+	return true
+}
+
+// apiFindGuest loads the guest named by the request's code path value using
+// q, writing a JSON error and returning nil if it can't. The code's signature
+// is taken from the sig query parameter.
+func (h *RSVPHandler) apiFindGuest(rw http.ResponseWriter, req *http.Request, q db.Querier) (*db.Guest, []string) {
+	code := req.PathValue("code")
+	if !h.sessions.validInviteSignature(code, req.URL.Query().Get("sig"), h.cfg.RequireSignedInvites) {
+		writeAPIError(rw, http.StatusForbidden, "invalid_signature", "the invitation's signature is missing or invalid")
+		return nil, nil
+	}
+
+	ctx, cancel := h.cfg.queryContext(req)
+	defer cancel()
+
+	guest, err := db.FindGuestByInviteCode(ctx, q, code)
+	if errors.Is(err, db.ErrNotFound) {
+		writeAPIError(rw, http.StatusNotFound, "not_found", "invitation not found")
+		return nil, nil
+	}
+	if err != nil {
+		serverError(rw, req, err)
+		return nil, nil
+	}
+
+	companions, err := db.ListPlusOneNames(ctx, q, guest.Id)
+	if err != nil {
+		serverError(rw, req, err)
+		return nil, nil
+	}
+	return guest, companions
+}
+
+// guestEvent loads the event guest is invited to, if any, using q.
+func (h *RSVPHandler) guestEvent(req *http.Request, q db.Querier, guest *db.Guest) (*db.Event, error) {
+	if guest.EventId == nil {
+		return nil, nil
+	}
+
+	ctx, cancel := h.cfg.queryContext(req)
+	defer cancel()
+
+	event, err := db.FindEventById(ctx, q, *guest.EventId)
+	if errors.Is(err, db.ErrNotFound) {
+		return nil, nil
+	}
+	return event, err
+}
+
+// apiShow reports a guest's current response.
+func (h *RSVPHandler) apiShow(rw http.ResponseWriter, req *http.Request) {
+	if !acceptsJSON(req) {
+		writeAPIError(rw, http.StatusNotAcceptable, "not_acceptable", "responses are only available as application/json")
+		return
+	}
+
+	guest, companions := h.apiFindGuest(rw, req, h.reads)
+	if guest == nil {
+		return
+	}
+
+	event, err := h.guestEvent(req, h.reads, guest)
+	if err != nil {
+		serverError(rw, req, err)
+		return
+	}
+
+	writeJSON(rw, http.StatusOK, newRSVPState(guest, event, companions))
+}
+
+// apiSubmit records a guest's response from a JSON body and reports the
+// resulting state.
+func (h *RSVPHandler) apiSubmit(rw http.ResponseWriter, req *http.Request) {
+	var sub rsvpSubmission
+	if !decodeSubmission(rw, req, &sub) {
+		return
+	}
+
+	guest, _ := h.apiFindGuest(rw, req, h.db)
+	if guest == nil {
+		return
+	}
+
+	event, err := h.guestEvent(req, h.db, guest)
+	if err != nil {
+		serverError(rw, req, err)
+		return
+	}
+	h.apiRecord(rw, req, guest, event, sub)
+}
+
+// submitJSON records a response posted to /rsvp as an rsvpRequest. Household
+// members each respond with their own invite code.
+func (h *RSVPHandler) submitJSON(rw http.ResponseWriter, req *http.Request) {
+	var body rsvpRequest
+	if !decodeSubmission(rw, req, &body) {
+		return
+	}
+
+	code := cmp.Or(req.PathValue("code"), body.Code)
+	if !h.sessions.validInviteSignature(code, cmp.Or(req.URL.Query().Get("sig"), body.Sig), h.cfg.RequireSignedInvites) {
+		writeAPIError(rw, http.StatusForbidden, "invalid_signature", "the invitation's signature is missing or invalid")
+		return
+	}
+
+	guest, event, err := lookupGuest(req, h.cfg, h.db, code, body.Event)
+	if errors.Is(err, db.ErrNoEvent) {
+		writeAPIError(rw, http.StatusGone, "no_event", "the event for this invitation no longer exists")
+		return
+	}
+	if errors.Is(err, db.ErrNotFound) {
+		writeAPIError(rw, http.StatusNotFound, "not_found", "invitation not found")
+		return
+	}
+	if err != nil {
+		serverError(rw, req, err)
+		return
+	}
+	h.apiRecord(rw, req, guest, event, body.rsvpSubmission)
+}
+
+// apiRecord validates and records sub as guest's response, reporting the
+// resulting state as JSON.
+func (h *RSVPHandler) apiRecord(rw http.ResponseWriter, req *http.Request, guest *db.Guest, event *db.Event, sub rsvpSubmission) {
+	if event != nil && event.ResponsesClosed(time.Now()) {
+		_, admin, err := adminSession(req, h.cfg, h.db, h.sessions)
+		if err != nil {
+			serverError(rw, req, err)
+			return
+		}
+		if !admin {
+			writeAPIError(rw, http.StatusForbidden, "closed", "responses for this event are closed")
+			return
+		}
+	}
+
+	response, err := sub.validate(guest, event)
+	if err != nil {
+		writeAPIError(rw, http.StatusUnprocessableEntity, "invalid", err.Error())
+		return
+	}
+
+	if err := h.record(req, guest, event, response); err != nil {
+		serverError(rw, req, err)
+		return
+	}
+
+	writeJSON(rw, http.StatusOK, newRSVPState(guest, event, response.PlusOnes))
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/meagar/rsvp/db"
+)
+
+// apiPath returns the JSON API's path for guest's RSVP.
+func (s *testSite) apiPath(guest *db.Guest) string {
+	return "/api/rsvp/" + url.PathEscape(guest.InviteCode) + "?sig=" + s.sessions.inviteSignature(guest.InviteCode)
+}
+
+// decodeJSON decodes rec's body into a map after checking that it's JSON.
+func decodeJSON(t *testing.T, rec *httptest.ResponseRecorder) map[string]any {
+	t.Helper()
+	if got := rec.Header().Get("Content-Type"); !strings.HasPrefix(got, "application/json") {
+		t.Fatalf("Content-Type = %q, want application/json", got)
+	}
+	var body map[string]any
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("decoding the response: %v", err)
+	}
+	return body
+}
+
+func TestAPIShowRSVP(t *testing.T) {
+	pool := testPool(t)
+	site := newTestSite(t, pool)
+	event := createTestEvent(t, pool, &db.Event{})
+	guest := createTestGuest(t, pool, &db.Guest{Name: "Ada Lovelace", EventId: &event.Id, MaxPartySize: 3})
+
+	rec := site.get(site.apiPath(guest))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d\n%s", rec.Code, http.StatusOK, rec.Body)
+	}
+	want := map[string]any{
+		"code":           guest.InviteCode,
+		"name":           "Ada Lovelace",
+		"response":       nil,
+		"attending":      nil,
+		"party_size":     1.0,
+		"max_party_size": 3.0,
+		"companions":     []any{},
+		"dietary":        "",
+		"notes":          "",
+		"decline_reason": "",
+		"responded_at":   nil,
+		"waitlisted":     false,
+	}
+	if got := decodeJSON(t, rec); !reflect.DeepEqual(got, want) {
+		t.Errorf("body = %v, want %v", got, want)
+	}
+}
+
+func TestAPISubmitRSVP(t *testing.T) {
+	pool := testPool(t)
+	site := newTestSite(t, pool)
+	event := createTestEvent(t, pool, &db.Event{})
+	guest := createTestGuest(t, pool, &db.Guest{EventId: &event.Id, MaxPartySize: 3})
+
+	req := httptest.NewRequest(http.MethodPost, site.apiPath(guest), strings.NewReader(`{"attending": true, "party_size": 2, "dietary": "Vegan"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec := site.serve(req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d\n%s", rec.Code, http.StatusOK, rec.Body)
+	}
+	body := decodeJSON(t, rec)
+	if body["response"] != "yes" || body["attending"] != true || body["party_size"] != 2.0 || body["dietary"] != "Vegan" || body["responded_at"] == nil {
+		t.Errorf("body = %v, want the new response", body)
+	}
+
+	saved := reloadGuest(t, pool, guest.Id)
+	if !saved.IsAttending() || saved.PartySize != 2 || saved.Dietary != "Vegan" {
+		t.Errorf("saved attendance %v, party size %d and dietary %q", deref(saved.Attendance), saved.PartySize, saved.Dietary)
+	}
+	if got := decodeJSON(t, site.get(site.apiPath(guest))); got["response"] != "yes" || got["party_size"] != 2.0 {
+		t.Errorf("GET after the POST = %v", got)
+	}
+}
+
+func TestAPIRSVPErrors(t *testing.T) {
+	pool := testPool(t)
+	site := newTestSite(t, pool)
+	event := createTestEvent(t, pool, &db.Event{})
+	guest := createTestGuest(t, pool, &db.Guest{EventId: &event.Id})
+
+	tests := []struct {
+		name     string
+		path     string
+		body     string
+		wantCode string
+		want     int
+	}{
+		{name: "unknown invitation", path: "/api/rsvp/NOSUCHCODE", body: `{"attending": true, "party_size": 1}`, wantCode: "not_found", want: http.StatusNotFound},
+		{name: "party too large", path: site.apiPath(guest), body: `{"attending": true, "party_size": 5}`, wantCode: "invalid", want: http.StatusUnprocessableEntity},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			rec := site.serve(req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+			if body := decodeJSON(t, rec); body["code"] != tt.wantCode || body["error"] == "" {
+				t.Errorf("body = %v, want an error with code %q", body, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestAPIRSVPRejectsBadRequests(t *testing.T) {
+	site := newTestSite(t, unreachablePool(t))
+
+	tests := []struct {
+		name        string
+		method      string
+		contentType string
+		accept      string
+		body        string
+		wantCode    string
+		want        int
+	}{
+		{name: "form body", method: http.MethodPost, contentType: "application/x-www-form-urlencoded", body: "attending=yes", wantCode: "unsupported_media_type", want: http.StatusUnsupportedMediaType},
+		{name: "malformed JSON", method: http.MethodPost, contentType: "application/json", body: `{"attending": `, wantCode: "invalid_json", want: http.StatusBadRequest},
+		{name: "unknown field", method: http.MethodPost, contentType: "application/json", body: `{"attending": true, "plus_ones": 3}`, wantCode: "invalid_json", want: http.StatusBadRequest},
+		{name: "HTML only", method: http.MethodGet, accept: "text/html", wantCode: "not_acceptable", want: http.StatusNotAcceptable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/api/rsvp/ABC123", strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			// A form is only accepted as far as the API with a CSRF token.
+			req.Header.Set(csrfHeader, testCSRFToken)
+			req.AddCookie(&http.Cookie{Name: csrfCookie, Value: testCSRFToken})
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			rec := site.serve(req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+			if body := decodeJSON(t, rec); body["code"] != tt.wantCode {
+				t.Errorf("body = %v, want an error with code %q", body, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestWantsJSON(t *testing.T) {
+	tests := []struct {
+		path, contentType, accept string
+		want                      bool
+	}{
+		{path: "/api/rsvp/ABC123", want: true},
+		{path: "/api/rsvp/ABC123", accept: "text/html", want: true},
+		{path: "/rsvp", want: false},
+		{path: "/rsvp", contentType: "application/json", want: true},
+		{path: "/rsvp", accept: "application/json", want: true},
+		{path: "/rsvp", accept: "text/html,application/json;q=0.9", want: false},
+		{path: "/rsvp", accept: "*/*", want: false},
+		{path: "/apiary", want: false},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		if tt.contentType != "" {
+			req.Header.Set("Content-Type", tt.contentType)
+		}
+		if tt.accept != "" {
+			req.Header.Set("Accept", tt.accept)
+		}
+		if got := wantsJSON(req); got != tt.want {
+			t.Errorf("wantsJSON(%s, Content-Type %q, Accept %q) = %v, want %v", tt.path, tt.contentType, tt.accept, got, tt.want)
+		}
+	}
+}
+
+// The same failure is reported as JSON to the API and as a page to browsers.
+func TestErrorsMatchTheRoute(t *testing.T) {
+	site := newTestSite(t, unreachablePool(t))
+	guest := &db.Guest{InviteCode: "ABC123"}
+
+	tests := []struct {
+		name     string
+		apiPath  string
+		pagePath string
+		wantCode string
+		want     int
+	}{
+		{name: "database down", apiPath: site.apiPath(guest), pagePath: site.sessions.rsvpPath(guest, nil), wantCode: "server_error", want: http.StatusServiceUnavailable},
+		{name: "no such route", apiPath: "/api/nothing", pagePath: "/nothing", wantCode: "not_found", want: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := site.get(tt.apiPath)
+			if rec.Code != tt.want {
+				t.Errorf("API: status = %d, want %d", rec.Code, tt.want)
+			}
+			if body := decodeJSON(t, rec); body["code"] != tt.wantCode || body["error"] == "" {
+				t.Errorf("API: body = %v, want an error with code %q", body, tt.wantCode)
+			}
+
+			rec = site.get(tt.pagePath)
+			if rec.Code != tt.want {
+				t.Errorf("page: status = %d, want %d", rec.Code, tt.want)
+			}
+			if got := rec.Header().Get("Content-Type"); !strings.HasPrefix(got, "text/html") || !strings.Contains(rec.Body.String(), "<html") {
+				t.Errorf("page: got a %s response, want an error page:\n%s", got, rec.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/meagar/rsvp/db"
+)
+
+// auditPageSize is how many of the latest audit log entries are shown.
+const auditPageSize = 200
+
+// audit records an admin action in the audit log. The action has already
+// happened, so a failure to record it is logged rather than reported.
+func (h *AdminHandler) audit(req *http.Request, action, target, details string) {
+	ctx, cancel := h.cfg.queryContext(req)
+	defer cancel()
+
+	user := h.page(req).User
+	if err := db.RecordAudit(ctx, h.db, user, action, target, details); err != nil {
+		loggerFrom(req.Context()).Error("Writing audit log failed", "action", action, "target", target, "error", err)
+	}
+}
+
+func (h *AdminHandler) auditLog(rw http.ResponseWriter, req *http.Request) {
+	ctx, cancel := h.cfg.queryContext(req)
+	defer cancel()
+
+	entries, err := db.ListAuditEntries(ctx, h.reads, auditPageSize)
+	if err != nil {
+		serverError(rw, req, err)
+		return
+	}
+
+	renderPage(rw, req, http.StatusOK, "admin/audit", struct {
+		adminPage
+		Entries []*db.AuditEntry
+	}{adminPage: h.page(req), Entries: entries})
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/meagar/rsvp/db"
+)
+
+func TestEditEventIsAudited(t *testing.T) {
+	pool := testPool(t)
+	site := newTestSite(t, pool)
+	event := createTestEvent(t, pool, &db.Event{Title: "Summer Picnic"})
+
+	form := eventFormValues(event)
+	form.Set("title", "Summer Picnic (Rescheduled)")
+	if rec := site.post("/admin/events/"+event.Slug+"/edit", form, site.adminSession()); rec.Code != http.StatusSeeOther {
+		t.Fatalf("status = %d, want %d\n%s", rec.Code, http.StatusSeeOther, rec.Body)
+	}
+	// An edit that fails validation changes nothing, so isn't recorded.
+	form.Set("title", "")
+	if rec := site.post("/admin/events/"+event.Slug+"/edit", form, site.adminSession()); rec.Code == http.StatusSeeOther {
+		t.Fatal("an edit with no title was saved")
+	}
+
+	entries, err := db.ListAuditEntries(context.Background(), pool, auditPageSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("got %d audit entries, want 1", len(entries))
+	}
+	entry := entries[0]
+	if entry.AdminUser != testAdminUser || entry.Action != "event.update" || entry.Target != "event "+event.Slug || entry.Details != "Summer Picnic (Rescheduled)" {
+		t.Errorf("entry = %s %s %q %q, want %s event.update %q %q",
+			entry.AdminUser, entry.Action, entry.Target, entry.Details, testAdminUser, "event "+event.Slug, "Summer Picnic (Rescheduled)")
+	}
+	if entry.CreatedAt.IsZero() {
+		t.Error("the entry has no timestamp")
+	}
+
+	rec := site.get("/admin/audit", site.adminSession())
+	if rec.Code != http.StatusOK {
+		t.Fatalf("audit log: status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	if want := "<td>event.update</td>\n      <td>event " + event.Slug + "</td>"; !strings.Contains(rec.Body.String(), want) {
+		t.Errorf("the audit log doesn't contain %q:\n%s", want, rec.Body)
+	}
+}
+
+func TestAuditLogNeedsAdmin(t *testing.T) {
+	site := newTestSite(t, unreachablePool(t))
+	rec := site.get("/admin/audit")
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/admin/login" {
+		t.Errorf("status = %d, Location = %q, want a redirect to the login page", rec.Code, rec.Header().Get("Location"))
+	}
+}
+
+func TestAuditFailureIsLogged(t *testing.T) {
+	logs := captureLogs(t)
+	site := newTestSite(t, unreachablePool(t))
+	h := newAdminHandler(site.cfg, site.pool, site.pool, site.mailer, site.reminders, site.sessions, nil)
+
+	req := httptest.NewRequest(http.MethodPost, "/admin/events/picnic/edit", nil)
+	req = req.WithContext(context.WithValue(req.Context(), adminUserKey, testAdminUser))
+	h.audit(req, "event.update", "event picnic", "Summer Picnic")
+
+	for _, line := range logLines(t, logs) {
+		if line["msg"] == "Writing audit log failed" {
+			if line["action"] != "event.update" || line["target"] != "event picnic" {
+				t.Errorf("logged %v, want the action and target", line)
+			}
+			return
+		}
+	}
+	t.Errorf("the failure wasn't logged:\n%s", logs)
+}
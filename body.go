@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+)
+
+// maxUploadMemory is how much of a multipart body is held in memory while
+// it's parsed. Files past it are spooled to disk.
+const maxUploadMemory = 1 << 20
+
+func isMultipart(req *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	return err == nil && mediaType == "multipart/form-data"
+}
+
+// uploadRoutes matches the routes that take uploads.
+type uploadRoutes struct {
+	mux *http.ServeMux
+}
+
+// newUploadRoutes returns the upload routes matching patterns, in the form
+// http.ServeMux takes.
+func newUploadRoutes(patterns ...string) uploadRoutes {
+	mux := http.NewServeMux()
+	for _, pattern := range patterns {
+		mux.Handle(pattern, http.NotFoundHandler())
+	}
+	return uploadRoutes{mux: mux}
+}
+
+func (u uploadRoutes) match(req *http.Request) bool {
+	_, pattern := u.mux.Handler(req)
+	return pattern != ""
+}
+
+// limitBodies stops reading request bodies once they pass limit bytes, which
+// is MAX_BODY_SIZE. Reads past the limit fail with an *http.MaxBytesError,
+// which bodyError reports as a 413. Routes that take uploads, which only the
+// guest import does, are allowed more once their handler has checked the
+// admin's session, so on those the unlimited body is kept for parseUpload.
+func limitBodies(limit int64, uploads uploadRoutes, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		body := req.Body
+		req.Body = http.MaxBytesReader(rw, body, limit)
+		if uploads.match(req) {
+			req = req.WithContext(context.WithValue(req.Context(), uploadBodyKey, body))
+		}
+		next.ServeHTTP(rw, req)
+	})
+}
+
+// isUpload reports whether req is to an upload route, as kept by limitBodies.
+func isUpload(req *http.Request) bool {
+	return req.Context().Value(uploadBodyKey) != nil
+}
+
+// tooLarge reports whether err came from reading past limitBodies' limit.
+func tooLarge(err error) bool {
+	var maxBytes *http.MaxBytesError
+	return errors.As(err, &maxBytes)
+}
+
+// parseBody parses the form in the request body, whether it's URL-encoded or
+// multipart.
+func parseBody(req *http.Request) error {
+	if isMultipart(req) {
+		return req.ParseMultipartForm(maxUploadMemory)
+	}
+	return req.ParseForm()
+}
+
+// parseUpload parses the form on an upload route, allowing a body of up to
+// limit bytes, which is MAX_UPLOAD_SIZE. It must only be called once the
+// admin's session has been checked. csrfProtect leaves the CSRF token in a multipart form for
+// parseUpload to check, since that means reading the body. It writes an error
+// response and returns false if it can't parse the form or the token is
+// wrong.
+func parseUpload(rw http.ResponseWriter, req *http.Request, limit int64) bool {
+	if body, ok := req.Context().Value(uploadBodyKey).(io.ReadCloser); ok {
+		req.Body = http.MaxBytesReader(rw, body, limit)
+	}
+	if err := parseBody(req); err != nil {
+		bodyError(rw, err)
+		return false
+	}
+
+	if req.Header.Get(csrfHeader) == "" && isMultipart(req) {
+		submitted := req.PostForm.Get(csrfField)
+		if submitted == "" || subtle.ConstantTimeCompare([]byte(submitted), []byte(csrfTokenFrom(req.Context()))) != 1 {
+			loggerFrom(req.Context()).Warn("CSRF token mismatch", "method", req.Method, "path", req.URL.Path)
+			http.Error(rw, "Invalid or missing CSRF token", http.StatusForbidden)
+			return false
+		}
+	}
+	return true
+}
+
+// bodyError reports a request body that couldn't be read or parsed, with a
+// 413 if it was too large.
+func bodyError(rw http.ResponseWriter, err error) {
+	if tooLarge(err) {
+		http.Error(rw, "The request is too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	http.Error(rw, err.Error(), http.StatusBadRequest)
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/meagar/rsvp/db"
+)
+
+// useBodyLimits sets MAX_BODY_SIZE and MAX_UPLOAD_SIZE for the test sites
+// created during the rest of t.
+func useBodyLimits(t *testing.T, body, upload int) {
+	t.Helper()
+	t.Setenv("MAX_BODY_SIZE", strconv.Itoa(body))
+	t.Setenv("MAX_UPLOAD_SIZE", strconv.Itoa(upload))
+}
+
+func TestLimitBodies(t *testing.T) {
+	handler := limitBodies(100, newUploadRoutes(), http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if _, err := io.ReadAll(req.Body); err != nil {
+			bodyError(rw, err)
+		}
+	}))
+
+	tests := []struct {
+		name        string
+		contentType string
+		size        int
+		want        int
+	}{
+		{name: "form within the limit", contentType: "application/x-www-form-urlencoded", size: 100, want: http.StatusOK},
+		{name: "form over the limit", contentType: "application/x-www-form-urlencoded", size: 101, want: http.StatusRequestEntityTooLarge},
+		{name: "JSON over the limit", contentType: "application/json", size: 101, want: http.StatusRequestEntityTooLarge},
+		// Only upload routes take more.
+		{name: "upload over the limit", contentType: "multipart/form-data; boundary=x", size: 101, want: http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(strings.Repeat("a", tt.size)))
+			req.Header.Set("Content-Type", tt.contentType)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
+
+// uploadRequest returns a multipart POST to path with a CSRF token of token
+// and a file of size bytes.
+func uploadRequest(t *testing.T, path, token string, size int) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	form.WriteField(csrfField, token)
+	file, err := form.CreateFormFile("file", "guests.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(file, strings.Repeat("a", size))
+	if err := form.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, path, &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	req.AddCookie(&http.Cookie{Name: csrfCookie, Value: testCSRFToken})
+	return req
+}
+
+func TestParseUpload(t *testing.T) {
+	mux := http.NewServeMux()
+	parse := func(rw http.ResponseWriter, req *http.Request) {
+		if parseUpload(rw, req, 4<<10) {
+			io.WriteString(rw, req.PostForm.Get(csrfField))
+		}
+	}
+	mux.HandleFunc("POST /upload", parse)
+	mux.HandleFunc("POST /other", parse)
+	handler := limitBodies(1<<10, newUploadRoutes("POST /upload"), csrfProtect(&Config{}, mux))
+
+	tests := []struct {
+		name  string
+		path  string
+		token string
+		size  int
+		want  int
+	}{
+		{name: "within the upload limit", path: "/upload", token: testCSRFToken, size: 2 << 10, want: http.StatusOK},
+		{name: "over the upload limit", path: "/upload", token: testCSRFToken, size: 5 << 10, want: http.StatusRequestEntityTooLarge},
+		{name: "wrong token", path: "/upload", token: "forged", size: 10, want: http.StatusForbidden},
+		{name: "not an upload route", path: "/other", token: testCSRFToken, size: 2 << 10, want: http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, uploadRequest(t, tt.path, tt.token, tt.size))
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d\n%s", rec.Code, tt.want, rec.Body)
+			}
+		})
+	}
+}
+
+func TestOversizedBodiesAreRejected(t *testing.T) {
+	useBodyLimits(t, 1<<10, 4<<10)
+	site := newTestSite(t, unreachablePool(t))
+	large := strings.Repeat("a", 2<<10)
+
+	t.Run("form", func(t *testing.T) {
+		if rec := site.post("/rsvp", url.Values{"notes": {large}}); rec.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("status = %d, want %d", rec.Code, http.StatusRequestEntityTooLarge)
+		}
+	})
+
+	t.Run("JSON", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/rsvp", strings.NewReader(`{"code": "ABC123", "notes": "`+large+`"}`))
+		req.Header.Set("Content-Type", "application/json")
+		rec := site.serve(req)
+		if rec.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("status = %d, want %d", rec.Code, http.StatusRequestEntityTooLarge)
+		}
+		if body := decodeJSON(t, rec); body["code"] != "too_large" {
+			t.Errorf("body = %v, want a too_large error", body)
+		}
+	})
+}
+
+func TestOversizedImportIsRejected(t *testing.T) {
+	useBodyLimits(t, 1<<10, 4<<10)
+	pool := testPool(t)
+	site := newTestSite(t, pool)
+	event := createTestEvent(t, pool, &db.Event{})
+	path := "/admin/events/" + event.Slug + "/import"
+
+	req := uploadRequest(t, path, testCSRFToken, 8<<10)
+	req.AddCookie(site.adminSession())
+	if rec := site.serve(req); rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusRequestEntityTooLarge)
+	}
+
+	// Without a session, the upload isn't read at all.
+	req = uploadRequest(t, path, testCSRFToken, 2<<10)
+	if rec := site.serve(req); rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/admin/login" {
+		t.Errorf("without a session: status = %d, Location = %q, want a redirect to the login page", rec.Code, rec.Header().Get("Location"))
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/meagar/rsvp/db"
+)
+
+// cancelToken returns a signed token letting whoever holds it decline on
+// guest's behalf, for the link in their confirmation email. It's tied to the
+// guest's invite code, so regenerating the code revokes it.
+func (s signer) cancelToken(guest *db.Guest) string {
+	return s.sign(strings.Join([]string{"cancel", strconv.Itoa(guest.Id), guest.InviteCode}, "|"))
+}
+
+// validCancelToken reports whether token is guest's cancel token.
+func (s signer) validCancelToken(token string, guest *db.Guest) bool {
+	value, ok := s.verify(token)
+	if !ok {
+		return false
+	}
+	parts := strings.SplitN(value, "|", 3)
+	return len(parts) == 3 && parts[0] == "cancel" && parts[1] == strconv.Itoa(guest.Id) && parts[2] == guest.InviteCode
+}
+
+// cancelPath returns the path of guest's cancel link, scoped to event if it
+// isn't nil.
+func (s signer) cancelPath(guest *db.Guest, event *db.Event) string {
+	params := url.Values{"token": {s.cancelToken(guest)}}
+	if event != nil {
+		params.Set("event", event.Slug)
+	}
+	return "/rsvp/" + url.PathEscape(guest.InviteCode) + "/cancel?" + params.Encode()
+}
+
+// findCancellingGuest loads the guest named by a cancel link, rendering an
+// error page and returning a nil guest if the link is invalid or responses
+// have closed.
+func (h *RSVPHandler) findCancellingGuest(rw http.ResponseWriter, req *http.Request) (*db.Guest, *db.Event) {
+	guest, event, err := lookupGuest(req, h.cfg, h.db, req.PathValue("code"), req.FormValue("event"))
+	if errors.Is(err, db.ErrNoEvent) {
+		renderPage(rw, req, http.StatusGone, "rsvp/no_event", nil)
+		return nil, nil
+	}
+	if errors.Is(err, db.ErrNotFound) {
+		renderPage(rw, req, http.StatusNotFound, "rsvp/not_found", nil)
+		return nil, nil
+	}
+	if err != nil {
+		serverError(rw, req, err)
+		return nil, nil
+	}
+	if !h.sessions.validCancelToken(req.FormValue("token"), guest) {
+		loggerFrom(req.Context()).Warn("Invalid cancel token", "guest", guest.Id)
+		renderPage(rw, req, http.StatusForbidden, "rsvp/not_found", nil)
+		return nil, nil
+	}
+
+	if closed, _ := h.responsesClosed(rw, req, event, http.StatusForbidden); closed {
+		return nil, nil
+	}
+	return guest, event
+}
+
+// confirmCancel asks a guest who followed the cancel link in their
+// confirmation email to confirm that they can no longer attend, so that a
+// link opened by a mail scanner, or by accident, changes nothing.
+func (h *RSVPHandler) confirmCancel(rw http.ResponseWriter, req *http.Request) {
+	guest, event := h.findCancellingGuest(rw, req)
+	if guest == nil {
+		return
+	}
+	if guest.IsDeclined() {
+		http.Redirect(rw, req, "/rsvp/thanks?"+h.sessions.rsvpParams(guest, event), http.StatusSeeOther)
+		return
+	}
+
+	renderPage(rw, req, http.StatusOK, "rsvp/cancel", struct {
+		Guest    *db.Guest
+		Event    *db.Event
+		Token    string
+		RSVPPath string
+	}{Guest: guest, Event: event, Token: req.FormValue("token"), RSVPPath: h.sessions.rsvpPath(guest, event)})
+}
+
+// cancel declines on behalf of a guest who confirmed that they can no longer
+// attend. Their place goes to the waitlist, if there is one.
+func (h *RSVPHandler) cancel(rw http.ResponseWriter, req *http.Request) {
+	if err := req.ParseForm(); err != nil {
+		bodyError(rw, err)
+		return
+	}
+	guest, event := h.findCancellingGuest(rw, req)
+	if guest == nil {
+		return
+	}
+
+	if !guest.IsDeclined() {
+		response := db.Response{
+			Attendance: db.AttendanceNo,
+			PartySize:  guest.PartySize,
+			Dietary:    guest.Dietary,
+			Notes:      guest.Notes,
+		}
+		if err := h.record(req, guest, event, response); err != nil {
+			serverError(rw, req, err)
+			return
+		}
+		loggerFrom(req.Context()).Info("Guest cancelled their RSVP", "guest", guest.Id)
+	}
+
+	http.Redirect(rw, req, "/rsvp/thanks?"+h.sessions.rsvpParams(guest, event), http.StatusSeeOther)
+}
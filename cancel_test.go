@@ -0,0 +1,114 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/meagar/rsvp/db"
+)
+
+func TestCancelToken(t *testing.T) {
+	sessions := newSigner(testSessionSecret)
+	guest := &db.Guest{Id: 7, InviteCode: "ABC123"}
+	token := sessions.cancelToken(guest)
+	if !sessions.validCancelToken(token, guest) {
+		t.Fatal("the guest's own cancel token was rejected")
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		guest *db.Guest
+	}{
+		{name: "another guest's", token: sessions.cancelToken(&db.Guest{Id: 8, InviteCode: "ABC123"}), guest: guest},
+		{name: "regenerated code", token: token, guest: &db.Guest{Id: 7, InviteCode: "XYZ789"}},
+		{name: "other secret", token: newSigner("another secret of at least thirty-two bytes").cancelToken(guest), guest: guest},
+		{name: "tampered", token: token + "x", guest: guest},
+		{name: "invite signature", token: sessions.inviteSignature(guest.InviteCode), guest: guest},
+		{name: "empty", guest: guest},
+	}
+	for _, tt := range tests {
+		if sessions.validCancelToken(tt.token, tt.guest) {
+			t.Errorf("%s token was accepted", tt.name)
+		}
+	}
+}
+
+func TestCancel(t *testing.T) {
+	pool := testPool(t)
+	site := newTestSite(t, pool)
+	event := createTestEvent(t, pool, &db.Event{Title: "Garden Party", Capacity: ptr(2)})
+	ada := createTestGuest(t, pool, &db.Guest{Name: "Ada", EventId: &event.Id, MaxPartySize: 2})
+	alan := createTestGuest(t, pool, &db.Guest{Name: "Alan", EventId: &event.Id})
+	recordTestResponse(t, pool, ada, db.Response{Attendance: db.AttendanceYes, PartySize: 2})
+	recordTestResponse(t, pool, alan, db.Response{Attendance: db.AttendanceYes, PartySize: 1})
+	if !reloadGuest(t, pool, alan.Id).IsWaitlisted() {
+		t.Fatal("Alan isn't on the waitlist")
+	}
+	ada = reloadGuest(t, pool, ada.Id)
+	link := site.sessions.cancelPath(ada, event)
+
+	// Following the link only asks for confirmation.
+	rec := site.get(link)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	if body := rec.Body.String(); !strings.Contains(body, "Ada, please confirm that you can no longer attend.") {
+		t.Errorf("the page doesn't ask Ada to confirm:\n%s", body)
+	}
+	if !reloadGuest(t, pool, ada.Id).IsAttending() {
+		t.Fatal("following the link declined without confirmation")
+	}
+
+	path, query, _ := strings.Cut(link, "?")
+	form, _ := url.ParseQuery(query)
+	rec = site.post(path, form)
+	if rec.Code != http.StatusSeeOther || !strings.HasPrefix(rec.Header().Get("Location"), "/rsvp/thanks?") {
+		t.Fatalf("status = %d, Location = %q, want a redirect to the thanks page", rec.Code, rec.Header().Get("Location"))
+	}
+	if saved := reloadGuest(t, pool, ada.Id); !saved.IsDeclined() || saved.PartySize != 2 {
+		t.Errorf("Ada's response = %v with a party of %d, want declined with her party kept", deref(saved.Attendance), saved.PartySize)
+	}
+	if reloadGuest(t, pool, alan.Id).IsWaitlisted() {
+		t.Error("Alan wasn't promoted when Ada cancelled")
+	}
+
+	// A second visit, once declined, goes straight to the thanks page.
+	if rec := site.get(link); rec.Code != http.StatusSeeOther {
+		t.Errorf("status after cancelling = %d, want %d", rec.Code, http.StatusSeeOther)
+	}
+}
+
+func TestCancelRejectsInvalidTokens(t *testing.T) {
+	pool := testPool(t)
+	site := newTestSite(t, pool)
+	event := createTestEvent(t, pool, &db.Event{})
+	ada := createTestGuest(t, pool, &db.Guest{Name: "Ada", EventId: &event.Id})
+	grace := createTestGuest(t, pool, &db.Guest{Name: "Grace", EventId: &event.Id})
+	recordTestResponse(t, pool, ada, db.Response{Attendance: db.AttendanceYes, PartySize: 1})
+
+	path := "/rsvp/" + ada.InviteCode + "/cancel"
+	for name, token := range map[string]string{
+		"missing":         "",
+		"forged":          "nonsense",
+		"another guest's": site.sessions.cancelToken(grace),
+	} {
+		t.Run(name, func(t *testing.T) {
+			form := url.Values{"event": {event.Slug}}
+			if token != "" {
+				form.Set("token", token)
+			}
+			if rec := site.get(path + "?" + form.Encode()); rec.Code != http.StatusForbidden {
+				t.Errorf("GET status = %d, want %d", rec.Code, http.StatusForbidden)
+			}
+			if rec := site.post(path, form); rec.Code != http.StatusForbidden {
+				t.Errorf("POST status = %d, want %d", rec.Code, http.StatusForbidden)
+			}
+			if !reloadGuest(t, pool, ada.Id).IsAttending() {
+				t.Fatal("an invalid token declined for Ada")
+			}
+		})
+	}
+}
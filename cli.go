@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/meagar/rsvp/db"
+)
+
+// cliUser is who the audit log credits with changes made by commands.
+const cliUser = "cli"
+
+// commands are the one-shot admin tasks that run instead of the server when
+// named on the command line, as in "rsvp migrate". Each parses its own flags
+// from args.
+var commands = map[string]func(cfg *Config, args []string) error{
+	"migrate":       migrateCommand,
+	"create-event":  createEventCommand,
+	"import-guests": importGuestsCommand,
+}
+
+// runCommand runs the named command with the arguments after its name.
+func runCommand(cfg *Config, name string, args []string) error {
+	command, ok := commands[name]
+	if !ok {
+		names := make([]string, 0, len(commands))
+		for name := range commands {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		return fmt.Errorf("unknown command %q: must be one of %s, or none to start the server", name, strings.Join(names, ", "))
+	}
+
+	err := command(cfg, args)
+	if errors.Is(err, flag.ErrHelp) {
+		return nil
+	}
+	return err
+}
+
+// commandContext bounds a command's database work like a request's.
+func commandContext(cfg *Config) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), cfg.DBQueryTimeout)
+}
+
+// migrateCommand applies any pending migrations, whatever RUN_MIGRATIONS is
+// set to.
+func migrateCommand(cfg *Config, args []string) error {
+	flags := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	pool := connectDB(cfg, "DATABASE_URL", cfg.DatabaseURL)
+	defer pool.Close()
+	// Migrations can take longer than a query, so they aren't given a timeout.
+	return runMigrations(context.Background(), pool.Pool)
+}
+
+// createEventCommand creates an event from flags named after the event form's
+// fields, validating them the same way.
+func createEventCommand(cfg *Config, args []string) error {
+	flags := flag.NewFlagSet("create-event", flag.ContinueOnError)
+	var form eventForm
+	flags.StringVar(&form.Title, "title", "", "the event's title (required)")
+	flags.StringVar(&form.Slug, "slug", "", "the event's slug, if not made from the title")
+	flags.StringVar(&form.Date, "date", "", "when the event starts, as 2006-01-02T15:04 (required)")
+	flags.StringVar(&form.EndsAt, "ends-at", "", "when the event ends, as 2006-01-02T15:04")
+	flags.StringVar(&form.Deadline, "rsvp-deadline", "", "when RSVPs close, as 2006-01-02T15:04")
+	flags.StringVar(&form.Timezone, "timezone", "", "the time zone of the times, like America/Toronto, if not the server's")
+	flags.StringVar(&form.Location, "location", "", "where the event is")
+	flags.StringVar(&form.Description, "description", "", "a description shown to guests")
+	flags.StringVar(&form.Capacity, "capacity", "", "the most people who can attend")
+	flags.StringVar(&form.MaxPartySize, "max-party-size", "", "the most any one guest may bring, themselves included")
+	flags.BoolVar(&form.AllowMaybe, "allow-maybe", false, "let guests answer maybe")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() > 0 {
+		return fmt.Errorf("create-event: unexpected argument %q", flags.Arg(0))
+	}
+
+	event := &db.Event{}
+	if err := form.apply(event, time.Now()); err != nil {
+		return err
+	}
+
+	pool := connectDB(cfg, "DATABASE_URL", cfg.DatabaseURL)
+	defer pool.Close()
+	ctx, cancel := commandContext(cfg)
+	defer cancel()
+
+	err := db.CreateEvent(ctx, pool, event)
+	if db.IsUniqueViolation(err, "events_slug_key") {
+		return errDuplicateSlug
+	}
+	if err != nil {
+		return err
+	}
+	if err := db.RecordAudit(ctx, pool, cliUser, "event.create", "event "+event.Slug, event.Title); err != nil {
+		slog.Error("Writing audit log failed", "error", err)
+	}
+	slog.Info("Created event", "slug", event.Slug, "id", event.Id)
+	return nil
+}
+
+// importGuestsCommand imports guests into an event from a CSV file in the
+// format the admin site's import accepts.
+func importGuestsCommand(cfg *Config, args []string) error {
+	flags := flag.NewFlagSet("import-guests", flag.ContinueOnError)
+	slug := flags.String("event", "", "the slug of the event to import into (required)")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: rsvp import-guests -event SLUG FILE")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *slug == "" || flags.NArg() != 1 {
+		flags.Usage()
+		return errors.New("import-guests needs an event and a file")
+	}
+
+	file, err := os.Open(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	pool := connectDB(cfg, "DATABASE_URL", cfg.DatabaseURL)
+	defer pool.Close()
+	// A large import makes many queries, so it isn't held to the timeout for
+	// one request.
+	ctx := context.Background()
+
+	event, err := db.FindEventBySlug(ctx, pool, *slug)
+	if errors.Is(err, db.ErrNotFound) {
+		return fmt.Errorf("no event has the slug %q", *slug)
+	}
+	if err != nil {
+		return err
+	}
+
+	imported, failures, err := importCSV(ctx, pool, event, file, cfg.InviteCodeLength)
+	if err != nil {
+		return err
+	}
+	for _, failure := range failures {
+		slog.Warn("Skipped row", "line", failure.Line, "error", failure.Error)
+	}
+	details := fmt.Sprintf("imported %d, skipped %d", imported, len(failures))
+	if err := db.RecordAudit(ctx, pool, cliUser, "event.import", "event "+event.Slug, details); err != nil {
+		slog.Error("Writing audit log failed", "error", err)
+	}
+	slog.Info("Imported guests", "event", event.Slug, "imported", imported, "skipped", len(failures))
+	return nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/meagar/rsvp/db"
+)
+
+func TestRunUnknownCommand(t *testing.T) {
+	err := runCommand(testConfig(t), "serve", nil)
+	if err == nil || !strings.Contains(err.Error(), `unknown command "serve": must be one of create-event, import-guests, migrate`) {
+		t.Errorf("err = %v, want one listing the commands", err)
+	}
+}
+
+// create-event rejects bad flags before it connects to the database, so
+// these run without one.
+func TestCreateEventCommandValidates(t *testing.T) {
+	cfg := testConfig(t)
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr string
+	}{
+		{name: "no title", args: []string{"-date", "2030-06-15T18:00"}, wantErr: "Please enter a title."},
+		{name: "no date", args: []string{"-title", "Garden Party"}, wantErr: "Please enter the date of the event."},
+		{name: "past date", args: []string{"-title", "Garden Party", "-date", "2000-06-15T18:00"}, wantErr: "The date must be in the future."},
+		{name: "argument", args: []string{"-title", "Garden Party", "-date", "2030-06-15T18:00", "extra"}, wantErr: `create-event: unexpected argument "extra"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := runCommand(cfg, "create-event", tt.args); err == nil || err.Error() != tt.wantErr {
+				t.Errorf("err = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMigrateCommand(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.DatabaseURL = emptySchemaURL(t)
+	if err := runCommand(cfg, "migrate", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	pool, err := pgxpool.New(context.Background(), cfg.DatabaseURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+	migrations, err := loadMigrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if applied := appliedMigrations(t, pool); len(applied) != len(migrations) {
+		t.Errorf("%d migrations were applied, want %d", len(applied), len(migrations))
+	}
+	if _, err := db.ListEventSummaries(context.Background(), &db.Pool{Pool: pool}); err != nil {
+		t.Errorf("listing events in the migrated schema: %v", err)
+	}
+}
+
+func TestCreateEventCommand(t *testing.T) {
+	pool := testPool(t)
+	cfg := testConfig(t)
+	cfg.DatabaseURL = os.Getenv("TEST_DATABASE_URL")
+	ctx := context.Background()
+
+	args := []string{"-title", "Garden Party", "-date", "2030-06-15T18:00", "-timezone", "America/Toronto", "-capacity", "40", "-allow-maybe"}
+	if err := runCommand(cfg, "create-event", args); err != nil {
+		t.Fatal(err)
+	}
+
+	event, err := db.FindEventBySlug(ctx, pool, "garden-party")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event.Title != "Garden Party" || event.TZ != "America/Toronto" || deref(event.Capacity) != 40 || !event.AllowMaybe {
+		t.Errorf("created %+v", event)
+	}
+	if got := event.Date.In(eventLocation(event.TZ)).Format("2006-01-02T15:04"); got != "2030-06-15T18:00" {
+		t.Errorf("date = %s, want 2030-06-15T18:00 in America/Toronto", got)
+	}
+
+	entries, err := db.ListAuditEntries(ctx, pool, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].AdminUser != cliUser || entries[0].Action != "event.create" || entries[0].Target != "event garden-party" {
+		t.Errorf("audit log = %+v, want the event's creation by %s", entries, cliUser)
+	}
+
+	if err := runCommand(cfg, "create-event", args); !errors.Is(err, errDuplicateSlug) {
+		t.Errorf("creating it again: err = %v, want %v", err, errDuplicateSlug)
+	}
+}
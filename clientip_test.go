@@ -0,0 +1,78 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"slices"
+	"testing"
+)
+
+// testProxies parses value as TRUSTED_PROXIES would be.
+func testProxies(t *testing.T, value string) []netip.Prefix {
+	t.Helper()
+	prefixes, err := parseTrustedProxies(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return prefixes
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	got, err := parseTrustedProxies(" 10.1.2.3/8, 192.0.2.1,,::1 ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("192.0.2.1/32"),
+		netip.MustParsePrefix("::1/128"),
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	for _, value := range []string{"10.0.0.0/33", "proxy.internal", "10.0.0/8"} {
+		if _, err := parseTrustedProxies(value); err == nil {
+			t.Errorf("parseTrustedProxies(%q) succeeded", value)
+		}
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	cfg := &Config{TrustedProxies: testProxies(t, "10.0.0.0/8, 192.0.2.1")}
+
+	tests := []struct {
+		name      string
+		peer      string
+		forwarded []string
+		realIP    string
+		want      string
+	}{
+		{name: "direct", peer: "203.0.113.9:51234", want: "203.0.113.9"},
+		{name: "untrusted peer's headers are ignored", peer: "203.0.113.9:51234", forwarded: []string{"198.51.100.7"}, realIP: "198.51.100.8", want: "203.0.113.9"},
+		{name: "trusted proxy", peer: "10.0.0.1:8080", forwarded: []string{"198.51.100.7"}, want: "198.51.100.7"},
+		{name: "spoofed entries before the proxies", peer: "10.0.0.1:8080", forwarded: []string{"6.6.6.6, 198.51.100.7, 10.0.0.2"}, want: "198.51.100.7"},
+		{name: "repeated headers", peer: "10.0.0.1:8080", forwarded: []string{"6.6.6.6", "198.51.100.7"}, want: "198.51.100.7"},
+		{name: "only proxies", peer: "10.0.0.1:8080", forwarded: []string{"10.0.0.3, 10.0.0.2"}, want: "10.0.0.3"},
+		{name: "real IP", peer: "192.0.2.1:443", realIP: "198.51.100.8", want: "198.51.100.8"},
+		{name: "malformed header", peer: "10.0.0.1:8080", forwarded: []string{"unknown"}, want: "10.0.0.1"},
+		{name: "mapped IPv4 peer", peer: "[::ffff:10.0.0.1]:8080", forwarded: []string{"::ffff:198.51.100.7"}, want: "198.51.100.7"},
+		{name: "untrusted IPv6 peer", peer: "[2001:db8::1]:8080", forwarded: []string{"198.51.100.7"}, want: "2001:db8::1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.peer
+			for _, value := range tt.forwarded {
+				req.Header.Add("X-Forwarded-For", value)
+			}
+			if tt.realIP != "" {
+				req.Header.Set("X-Real-IP", tt.realIP)
+			}
+			if got := cfg.clientIP(req); got != tt.want {
+				t.Errorf("clientIP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/meagar/rsvp/db"
+)
+
+// maxCloneSlugAttempts bounds the search for a free slug for a cloned event.
+const maxCloneSlugAttempts = 100
+
+// cloneEvent creates a copy of an event's settings, without its guests, for
+// hosts who run the same event again. The copy's slug is the original's with
+// -copy, numbered if that's taken, and its title is marked as a copy. The
+// admin is sent to edit the copy, since it usually needs a new date.
+func (h *AdminHandler) cloneEvent(rw http.ResponseWriter, req *http.Request) {
+	event := findEvent(rw, req, h.cfg, h.db)
+	if event == nil {
+		return
+	}
+
+	clone := *event
+	clone.Id = 0
+	clone.Title = event.Title + " (copy)"
+	clone.ClosedAt = nil
+
+	ctx, cancel := h.cfg.queryContext(req)
+	defer cancel()
+
+	var err error
+	for attempt := 1; attempt <= maxCloneSlugAttempts; attempt++ {
+		clone.Slug = event.Slug + "-copy"
+		if attempt > 1 {
+			clone.Slug += "-" + strconv.Itoa(attempt)
+		}
+		err = db.CreateEvent(ctx, h.db, &clone)
+		if !db.IsUniqueViolation(err, "events_slug_key") {
+			break
+		}
+	}
+	if db.IsUniqueViolation(err, "events_slug_key") {
+		http.Error(rw, "Every slug tried for the copy is taken", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		serverError(rw, req, err)
+		return
+	}
+
+	h.audit(req, "event.clone", "event "+clone.Slug, "copied from "+event.Slug)
+	h.setFlash(rw, req, "Created "+clone.Title+". Check its date and details before inviting guests.")
+	http.Redirect(rw, req, h.path+"events/"+clone.Slug+"/edit", http.StatusSeeOther)
+}
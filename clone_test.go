@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/meagar/rsvp/db"
+)
+
+func TestCloneEvent(t *testing.T) {
+	pool := testPool(t)
+	site := newTestSite(t, pool)
+	ctx := context.Background()
+
+	original := createTestEvent(t, pool, &db.Event{
+		Title:        "Garden Party",
+		Location:     "The back garden",
+		Description:  "Bring a hat.",
+		TZ:           "America/Toronto",
+		Capacity:     ptr(40),
+		MaxPartySize: ptr(3),
+		PrimaryColor: "#6b4f9e",
+		Font:         "Palatino, serif",
+		AllowMaybe:   true,
+	})
+	createTestGuest(t, pool, &db.Guest{EventId: &original.Id, Name: "Ada Lovelace"})
+	if _, err := db.CloseEvent(ctx, pool, original.Id); err != nil {
+		t.Fatal(err)
+	}
+	original, err := db.FindEventById(ctx, pool, original.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := site.post("/admin/events/"+original.Slug+"/clone", nil, site.adminSession())
+	if rec.Code != http.StatusSeeOther {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusSeeOther)
+	}
+	if got, want := rec.Header().Get("Location"), "/admin/events/garden-party-copy/edit"; got != want {
+		t.Errorf("Location = %q, want %q", got, want)
+	}
+
+	clone, err := db.FindEventBySlug(ctx, pool, "garden-party-copy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := *original
+	want.Id, want.Slug, want.Title, want.ClosedAt = clone.Id, "garden-party-copy", "Garden Party (copy)", nil
+	want.CreatedAt, want.UpdatedAt = clone.CreatedAt, clone.UpdatedAt
+	if !reflect.DeepEqual(*clone, want) {
+		t.Errorf("clone = %+v\nwant %+v", *clone, want)
+	}
+	if guests, err := db.ListEventGuests(ctx, pool, clone.Id); err != nil || len(guests) != 0 {
+		t.Errorf("the clone has guests %v (%v), want none", guests, err)
+	}
+	if guests, err := db.ListEventGuests(ctx, pool, original.Id); err != nil || len(guests) != 1 {
+		t.Errorf("the original has guests %v (%v), want its one", guests, err)
+	}
+
+	// A second copy gets the next free slug.
+	if rec := site.post("/admin/events/"+original.Slug+"/clone", nil, site.adminSession()); rec.Header().Get("Location") != "/admin/events/garden-party-copy-2/edit" {
+		t.Errorf("second clone: status = %d, Location = %q", rec.Code, rec.Header().Get("Location"))
+	}
+}
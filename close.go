@@ -0,0 +1,36 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/meagar/rsvp/db"
+)
+
+// closeEvent stops an event taking responses and declines for every guest
+// who hasn't responded, so that the counts can be used for planning. It's
+// only allowed once the RSVP deadline has passed.
+func (h *AdminHandler) closeEvent(rw http.ResponseWriter, req *http.Request) {
+	event := findEvent(rw, req, h.cfg, h.db)
+	if event == nil {
+		return
+	}
+	if !event.DeadlinePassed(time.Now()) {
+		http.Error(rw, "An event can only be closed after its RSVP deadline has passed", http.StatusConflict)
+		return
+	}
+
+	ctx, cancel := h.cfg.queryContext(req)
+	defer cancel()
+
+	declined, err := db.CloseEvent(ctx, h.db, event.Id)
+	if err != nil {
+		serverError(rw, req, err)
+		return
+	}
+	h.audit(req, "event.close", "event "+event.Slug, "declined "+strconv.Itoa(declined))
+	h.setFlash(rw, req, "Closed "+event.Title+", declining for "+pluralize(declined, "guest", "guests")+" who hadn't responded.")
+
+	http.Redirect(rw, req, h.path, http.StatusSeeOther)
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/meagar/rsvp/db"
+)
+
+func TestCloseEvent(t *testing.T) {
+	pool := testPool(t)
+	site := newTestSite(t, pool)
+	event := createTestEvent(t, pool, &db.Event{Title: "Garden Party", RSVPDeadline: ptr(time.Now().Add(-time.Hour))})
+	pending := createTestGuest(t, pool, &db.Guest{EventId: &event.Id, Name: "Pending"})
+	attending := createTestGuest(t, pool, &db.Guest{EventId: &event.Id, Name: "Attending", MaxPartySize: 2})
+	recordTestResponse(t, pool, attending, db.Response{Attendance: db.AttendanceYes, PartySize: 2})
+	declined := createTestGuest(t, pool, &db.Guest{EventId: &event.Id, Name: "Declined"})
+	recordTestResponse(t, pool, declined, db.Response{Attendance: db.AttendanceNo, PartySize: 1, DeclineReason: "Away"})
+	deleted := createTestGuest(t, pool, &db.Guest{EventId: &event.Id, Name: "Deleted"})
+	if _, _, err := db.DeleteGuest(context.Background(), pool, deleted.Id); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := site.post("/admin/events/"+event.Slug+"/close", nil, site.adminSession())
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/admin/" {
+		t.Fatalf("status = %d, Location = %q, want a redirect to the dashboard\n%s", rec.Code, rec.Header().Get("Location"), rec.Body)
+	}
+
+	if saved := reloadGuest(t, pool, pending.Id); !saved.IsDeclined() || saved.RespondedAt != nil {
+		t.Errorf("pending guest: attendance %v, responded at %v, want declined without having responded", saved.Attendance, saved.RespondedAt)
+	}
+	if saved := reloadGuest(t, pool, attending.Id); !saved.IsAttending() || saved.PartySize != 2 || !saved.RespondedAt.Equal(*attending.RespondedAt) {
+		t.Errorf("attending guest was changed: %v for %d at %v", saved.Attendance, saved.PartySize, saved.RespondedAt)
+	}
+	if saved := reloadGuest(t, pool, declined.Id); !saved.IsDeclined() || saved.DeclineReason != "Away" || !saved.RespondedAt.Equal(*declined.RespondedAt) {
+		t.Errorf("declined guest was changed: %v because %q at %v", saved.Attendance, saved.DeclineReason, saved.RespondedAt)
+	}
+	if saved := reloadGuest(t, pool, deleted.Id); saved.Attendance != nil {
+		t.Errorf("deleted guest was declined: %v", *saved.Attendance)
+	}
+
+	closed, err := db.FindEventById(context.Background(), pool, event.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if closed.ClosedAt == nil {
+		t.Error("the event wasn't marked closed")
+	}
+}
+
+func TestCloseEventBeforeDeadline(t *testing.T) {
+	pool := testPool(t)
+	site := newTestSite(t, pool)
+
+	tests := []struct {
+		name     string
+		deadline *time.Time
+	}{
+		{name: "deadline to come", deadline: ptr(time.Now().Add(time.Hour))},
+		{name: "no deadline"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event := createTestEvent(t, pool, &db.Event{Title: tt.name, RSVPDeadline: tt.deadline})
+			pending := createTestGuest(t, pool, &db.Guest{EventId: &event.Id})
+
+			if rec := site.post("/admin/events/"+event.Slug+"/close", nil, site.adminSession()); rec.Code != http.StatusConflict {
+				t.Errorf("status = %d, want %d", rec.Code, http.StatusConflict)
+			}
+			if saved := reloadGuest(t, pool, pending.Id); saved.Attendance != nil {
+				t.Errorf("the pending guest was declined: %v", *saved.Attendance)
+			}
+			if saved, err := db.FindEventById(context.Background(), pool, event.Id); err != nil || saved.ClosedAt != nil {
+				t.Errorf("the event was closed: %v, %v", saved.ClosedAt, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config holds every setting read from the environment. It is loaded and
+// validated once at startup by LoadConfig.
+type Config struct {
+	Port     int
+	BindAddr string
+
+	DatabaseURL        string
+	DatabaseReplicaURL string
+	DBSSLMode          string
+	DBMaxConns         int
+	DBConnectTimeout   time.Duration
+	DBConnectAttempts  int
+	DBConnectMaxDelay  time.Duration
+	DBQueryTimeout     time.Duration
+	RunMigrations      bool
+
+	LogLevel       string
+	LogFormat      string
+	TemplateDir    string
+	TemplateReload bool
+	StaticPath     string
+	StaticOrigin   string
+
+	AdminPath         string
+	AdminUser         string
+	AdminPasswordHash string
+	SessionSecret     string
+	CookieSecure      bool
+	LoginMaxFailures  int
+	LoginLockout      time.Duration
+
+	BaseURL        string
+	TrustedProxies []netip.Prefix
+	RateLimit      int
+	MaxBodySize    int
+	MaxUploadSize  int
+
+	MetricsPath  string
+	MetricsToken string
+
+	InviteCodeLength     int
+	RequireSignedInvites bool
+	ReminderInterval     time.Duration
+
+	SMTPHost    string
+	SMTPPort    string
+	SMTPUser    string
+	SMTPPass    string
+	SMTPFrom    string
+	SMTPTimeout time.Duration
+
+	WebhookURL      string
+	WebhookSecret   string
+	WebhookAttempts int
+	WebhookTimeout  time.Duration
+
+	ShutdownTimeout   time.Duration
+	ReadHeaderTimeout time.Duration
+	ReadTimeout       time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+}
+
+// envReader reads typed ENV variables, collecting a description of each one
+// that's missing or invalid so they can all be reported together.
+type envReader struct {
+	errs []error
+}
+
+func (r *envReader) fail(name, value, problem string) {
+	r.errs = append(r.errs, fmt.Errorf("%s=%q: %s", name, value, problem))
+}
+
+// required returns the variable name, which is missing if it's unset or empty.
+func (r *envReader) required(name string) string {
+	value := os.Getenv(name)
+	if value == "" {
+		r.errs = append(r.errs, fmt.Errorf("%s is required", name))
+	}
+	return value
+}
+
+func (r *envReader) string(name, def string) string {
+	if value, ok := os.LookupEnv(name); ok {
+		return value
+	}
+	return def
+}
+
+// int reads an integer from min to max inclusive.
+func (r *envReader) int(name string, def, min, max int) int {
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return def
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < min || n > max {
+		r.fail(name, value, fmt.Sprintf("must be a whole number from %d to %d", min, max))
+		return def
+	}
+	return n
+}
+
+func (r *envReader) bool(name string, def bool) bool {
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return def
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		r.fail(name, value, "must be true or false")
+		return def
+	}
+	return b
+}
+
+// duration reads a positive duration like "5s" or "1h30m".
+func (r *envReader) duration(name string, def time.Duration) time.Duration {
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return def
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		r.fail(name, value, "must be a positive duration like 5s or 1h30m")
+		return def
+	}
+	return d
+}
+
+// path reads a URL path, which must begin with a slash and, if dir is set,
+// end with one.
+func (r *envReader) path(name, def string, dir bool) string {
+	value := r.string(name, def)
+	if !strings.HasPrefix(value, "/") || (dir && !strings.HasSuffix(value, "/")) {
+		problem := "must begin with /"
+		if dir {
+			problem = "must begin and end with /"
+		}
+		r.fail(name, value, problem)
+		return def
+	}
+	return value
+}
+
+// validBindAddr reports whether addr is empty, for every interface, or an IP
+// address or host name to listen on. IPv6 addresses may be bracketed.
+func validBindAddr(addr string) bool {
+	if addr == "" {
+		return true
+	}
+	if _, err := netip.ParseAddr(strings.TrimSuffix(strings.TrimPrefix(addr, "["), "]")); err == nil {
+		return true
+	}
+	return !strings.ContainsAny(addr, ":/[] ")
+}
+
+// readCommandSettings reads the settings that commands share with the
+// server: the database connection, logging and invite codes.
+func (c *Config) readCommandSettings(r *envReader) {
+	c.DatabaseURL = r.required("DATABASE_URL")
+	c.DatabaseReplicaURL = r.string("DATABASE_REPLICA_URL", "")
+	c.DBSSLMode = r.string("DB_SSLMODE", "")
+	if c.DBSSLMode != "" && !slices.Contains(sslModes, c.DBSSLMode) {
+		r.fail("DB_SSLMODE", c.DBSSLMode, "must be one of "+strings.Join(sslModes, ", "))
+	}
+	c.DBMaxConns = r.int("DB_MAX_CONNS", 10, 1, 1000)
+	c.DBConnectTimeout = r.duration("DB_CONNECT_TIMEOUT", 0)
+	c.DBConnectAttempts = r.int("DB_CONNECT_ATTEMPTS", 5, 1, 1000)
+	c.DBConnectMaxDelay = r.duration("DB_CONNECT_MAX_DELAY", 30*time.Second)
+	c.DBQueryTimeout = r.duration("DB_QUERY_TIMEOUT", 5*time.Second)
+
+	c.LogLevel = r.string("LOG_LEVEL", "info")
+	c.LogFormat = r.string("LOG_FORMAT", "json")
+
+	c.InviteCodeLength = r.int("INVITE_CODE_LENGTH", 10, 6, 32)
+}
+
+// LoadCommandConfig reads only what commands need from the environment, so
+// that they can be run without the server's settings, like PORT. It returns
+// an error describing every variable that's missing or invalid.
+func LoadCommandConfig() (*Config, error) {
+	var r envReader
+	c := &Config{}
+	c.readCommandSettings(&r)
+
+	if len(r.errs) > 0 {
+		return nil, errors.Join(r.errs...)
+	}
+	return c, nil
+}
+
+// LoadConfig reads the server's configuration from the environment,
+// returning an error describing every variable that's missing or invalid.
+func LoadConfig() (*Config, error) {
+	var r envReader
+	c := &Config{}
+
+	port := r.required("PORT")
+	if n, err := strconv.Atoi(port); err == nil && n > 0 && n <= 65535 {
+		c.Port = n
+	} else if port != "" {
+		r.fail("PORT", port, "must be a port number")
+	}
+	c.BindAddr = r.string("BIND_ADDR", "")
+	if !validBindAddr(c.BindAddr) {
+		r.fail("BIND_ADDR", c.BindAddr, "must be an IP address or host name, without a port")
+	}
+
+	c.readCommandSettings(&r)
+	c.RunMigrations = r.bool("RUN_MIGRATIONS", false)
+
+	c.TemplateDir = r.string("TEMPLATE_DIR", "")
+	c.TemplateReload = r.bool("TEMPLATE_RELOAD", c.TemplateDir != "")
+	if c.TemplateReload && c.TemplateDir == "" {
+		c.TemplateDir = "templates"
+	}
+	c.StaticPath = r.path("STATIC_PATH", "/static/", true)
+
+	c.AdminPath = r.path("ADMIN_PATH", "/admin/", true)
+	c.AdminUser = r.string("ADMIN_USER", "")
+	c.AdminPasswordHash = r.string("ADMIN_PASSWORD_HASH", "")
+	c.SessionSecret = r.string("SESSION_SECRET", "")
+	c.CookieSecure = r.bool("COOKIE_SECURE", false)
+	c.LoginMaxFailures = r.int("LOGIN_MAX_FAILURES", 5, 1, 1000)
+	c.LoginLockout = r.duration("LOGIN_LOCKOUT", 15*time.Minute)
+
+	var err error
+	if c.BaseURL, err = parseBaseURL(r.string("BASE_URL", "")); err != nil {
+		r.fail("BASE_URL", os.Getenv("BASE_URL"), err.Error())
+	}
+	if c.StaticOrigin, err = parseStaticOrigin(r.string("STATIC_ORIGIN", "")); err != nil {
+		r.fail("STATIC_ORIGIN", os.Getenv("STATIC_ORIGIN"), err.Error())
+	}
+	if c.TrustedProxies, err = parseTrustedProxies(r.string("TRUSTED_PROXIES", "")); err != nil {
+		r.fail("TRUSTED_PROXIES", os.Getenv("TRUSTED_PROXIES"), err.Error())
+	}
+	c.RateLimit = r.int("RATE_LIMIT", 30, 1, 100000)
+	c.MaxBodySize = r.int("MAX_BODY_SIZE", 1<<20, 1<<10, 1<<30)
+	c.MaxUploadSize = r.int("MAX_UPLOAD_SIZE", 10<<20, 1<<10, 1<<30)
+
+	c.MetricsPath = r.path("METRICS_PATH", "/metrics", false)
+	c.MetricsToken = r.string("METRICS_TOKEN", "")
+
+	c.RequireSignedInvites = r.bool("REQUIRE_SIGNED_INVITES", false)
+	if c.RequireSignedInvites && c.SessionSecret == "" {
+		r.fail("REQUIRE_SIGNED_INVITES", os.Getenv("REQUIRE_SIGNED_INVITES"), "needs SESSION_SECRET, so that invite links survive restarts")
+	}
+	c.ReminderInterval = r.duration("REMINDER_INTERVAL", 72*time.Hour)
+
+	c.SMTPHost = r.string("SMTP_HOST", "")
+	c.SMTPPort = r.string("SMTP_PORT", "587")
+	c.SMTPUser = r.string("SMTP_USER", "")
+	c.SMTPPass = r.string("SMTP_PASS", "")
+	c.SMTPFrom = r.string("SMTP_FROM", c.SMTPUser)
+	c.SMTPTimeout = r.duration("SMTP_TIMEOUT", 30*time.Second)
+
+	if c.WebhookURL, err = parseWebhookURL(r.string("WEBHOOK_URL", "")); err != nil {
+		r.fail("WEBHOOK_URL", os.Getenv("WEBHOOK_URL"), err.Error())
+	}
+	c.WebhookSecret = r.string("WEBHOOK_SECRET", "")
+	if c.WebhookURL != "" && c.WebhookSecret == "" {
+		r.errs = append(r.errs, errors.New("WEBHOOK_SECRET is required when WEBHOOK_URL is set"))
+	}
+	c.WebhookAttempts = r.int("WEBHOOK_ATTEMPTS", 5, 1, 20)
+	c.WebhookTimeout = r.duration("WEBHOOK_TIMEOUT", 10*time.Second)
+
+	c.ShutdownTimeout = r.duration("SHUTDOWN_TIMEOUT", 10*time.Second)
+	c.ReadHeaderTimeout = r.duration("READ_HEADER_TIMEOUT", 5*time.Second)
+	c.ReadTimeout = r.duration("READ_TIMEOUT", 15*time.Second)
+	c.WriteTimeout = r.duration("WRITE_TIMEOUT", 30*time.Second)
+	c.IdleTimeout = r.duration("IDLE_TIMEOUT", 120*time.Second)
+
+	if len(r.errs) > 0 {
+		return nil, errors.Join(r.errs...)
+	}
+	return c, nil
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadConfigReportsMissingVariables(t *testing.T) {
+	tests := []struct {
+		name    string
+		set     map[string]string
+		missing []string
+	}{
+		{name: "none set", missing: []string{"PORT", "DATABASE_URL"}},
+		{name: "PORT set", set: map[string]string{"PORT": "8080"}, missing: []string{"DATABASE_URL"}},
+		{name: "DATABASE_URL set", set: map[string]string{"DATABASE_URL": "postgres://localhost/rsvp"}, missing: []string{"PORT"}},
+		{name: "PORT empty", set: map[string]string{"PORT": "", "DATABASE_URL": "postgres://localhost/rsvp"}, missing: []string{"PORT"}},
+		{name: "DATABASE_URL empty", set: map[string]string{"PORT": "8080", "DATABASE_URL": ""}, missing: []string{"DATABASE_URL"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			unsetenv(t, "PORT")
+			unsetenv(t, "DATABASE_URL")
+			for name, value := range tt.set {
+				t.Setenv(name, value)
+			}
+
+			_, err := LoadConfig()
+			if err == nil {
+				t.Fatal("LoadConfig succeeded")
+			}
+			lines := strings.Split(err.Error(), "\n")
+			if len(lines) != len(tt.missing) {
+				t.Errorf("error %q has %d problems, want %d", err, len(lines), len(tt.missing))
+			}
+			for _, name := range tt.missing {
+				if !strings.Contains(err.Error(), name+" is required") {
+					t.Errorf("error %q doesn't name %s", err, name)
+				}
+			}
+			for name, value := range tt.set {
+				if value != "" && strings.Contains(err.Error(), name) {
+					t.Errorf("error %q names %s, which is set", err, name)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	for _, name := range []string{"ADMIN_PATH", "RATE_LIMIT", "SHUTDOWN_TIMEOUT", "LOG_LEVEL"} {
+		unsetenv(t, name)
+	}
+	t.Setenv("PORT", "8080")
+	t.Setenv("DATABASE_URL", "postgres://localhost/rsvp")
+	t.Setenv("DB_QUERY_TIMEOUT", "2s")
+	t.Setenv("RUN_MIGRATIONS", "true")
+	t.Setenv("METRICS_PATH", "/internal/metrics")
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	if cfg.Port != 8080 || cfg.DatabaseURL != "postgres://localhost/rsvp" {
+		t.Errorf("Port = %d, DatabaseURL = %q", cfg.Port, cfg.DatabaseURL)
+	}
+	if cfg.DBQueryTimeout != 2*time.Second || !cfg.RunMigrations || cfg.MetricsPath != "/internal/metrics" {
+		t.Errorf("DBQueryTimeout = %v, RunMigrations = %v, MetricsPath = %q, want the values set", cfg.DBQueryTimeout, cfg.RunMigrations, cfg.MetricsPath)
+	}
+	if cfg.AdminPath != "/admin/" || cfg.RateLimit != 30 || cfg.ShutdownTimeout != 10*time.Second || cfg.LogLevel != "info" {
+		t.Errorf("AdminPath = %q, RateLimit = %d, ShutdownTimeout = %v, LogLevel = %q, want the defaults", cfg.AdminPath, cfg.RateLimit, cfg.ShutdownTimeout, cfg.LogLevel)
+	}
+}
+
+func TestLoadCommandConfig(t *testing.T) {
+	// Commands don't read the server's settings, so these don't matter.
+	unsetenv(t, "PORT")
+	t.Setenv("RATE_LIMIT", "many")
+	t.Setenv("WEBHOOK_URL", "https://hooks.example.com/rsvp")
+	unsetenv(t, "WEBHOOK_SECRET")
+
+	unsetenv(t, "DATABASE_URL")
+	if _, err := LoadCommandConfig(); err == nil || err.Error() != "DATABASE_URL is required" {
+		t.Errorf("without DATABASE_URL, err = %v, want only it reported missing", err)
+	}
+
+	t.Setenv("DATABASE_URL", "postgres://localhost/rsvp")
+	t.Setenv("DB_QUERY_TIMEOUT", "2s")
+	t.Setenv("INVITE_CODE_LENGTH", "12")
+	cfg, err := LoadCommandConfig()
+	if err != nil {
+		t.Fatalf("LoadCommandConfig: %v", err)
+	}
+	if cfg.DatabaseURL != "postgres://localhost/rsvp" || cfg.DBQueryTimeout != 2*time.Second || cfg.InviteCodeLength != 12 {
+		t.Errorf("DatabaseURL = %q, DBQueryTimeout = %v, InviteCodeLength = %d, want the values set", cfg.DatabaseURL, cfg.DBQueryTimeout, cfg.InviteCodeLength)
+	}
+
+	t.Setenv("DB_MAX_CONNS", "lots")
+	if _, err := LoadCommandConfig(); err == nil || !strings.Contains(err.Error(), `DB_MAX_CONNS="lots"`) {
+		t.Errorf("err = %v, want DB_MAX_CONNS reported invalid", err)
+	}
+}
+
+func TestLoadConfigTemplateReload(t *testing.T) {
+	tests := []struct {
+		dir, reload string
+		wantDir     string
+		wantReload  bool
+	}{
+		{},
+		{reload: "true", wantDir: "templates", wantReload: true},
+		{dir: "/srv/templates", wantDir: "/srv/templates", wantReload: true},
+		{dir: "/srv/templates", reload: "false", wantDir: "/srv/templates"},
+	}
+	t.Setenv("PORT", "8080")
+	t.Setenv("DATABASE_URL", "postgres://localhost/rsvp")
+	setOrUnset := func(name, value string) {
+		if value == "" {
+			unsetenv(t, name)
+		} else {
+			t.Setenv(name, value)
+		}
+	}
+	for _, tt := range tests {
+		setOrUnset("TEMPLATE_DIR", tt.dir)
+		setOrUnset("TEMPLATE_RELOAD", tt.reload)
+		cfg, err := LoadConfig()
+		if err != nil {
+			t.Fatalf("LoadConfig: %v", err)
+		}
+		if cfg.TemplateDir != tt.wantDir || cfg.TemplateReload != tt.wantReload {
+			t.Errorf("TEMPLATE_DIR=%q TEMPLATE_RELOAD=%q: TemplateDir = %q, TemplateReload = %v, want %q and %v",
+				tt.dir, tt.reload, cfg.TemplateDir, cfg.TemplateReload, tt.wantDir, tt.wantReload)
+		}
+	}
+}
+
+func TestLoadConfigRejectsInvalidValues(t *testing.T) {
+	tests := []struct {
+		name, value string
+		want        string
+	}{
+		{name: "PORT", value: "eighty", want: `PORT="eighty": must be a port number`},
+		{name: "PORT", value: "0", want: `PORT="0": must be a port number`},
+		{name: "PORT", value: "65536", want: `PORT="65536": must be a port number`},
+		{name: "DB_MAX_CONNS", value: "lots", want: `DB_MAX_CONNS="lots": must be a whole number from 1 to 1000`},
+		{name: "DB_QUERY_TIMEOUT", value: "5", want: `DB_QUERY_TIMEOUT="5": must be a positive duration`},
+		{name: "DB_QUERY_TIMEOUT", value: "-1s", want: `DB_QUERY_TIMEOUT="-1s": must be a positive duration`},
+		{name: "RUN_MIGRATIONS", value: "sometimes", want: `RUN_MIGRATIONS="sometimes": must be true or false`},
+		{name: "ADMIN_PATH", value: "/admin", want: `ADMIN_PATH="/admin": must begin and end with /`},
+		{name: "METRICS_PATH", value: "metrics", want: `METRICS_PATH="metrics": must begin with /`},
+		{name: "BIND_ADDR", value: "127.0.0.1:8080", want: `BIND_ADDR="127.0.0.1:8080": must be an IP address or host name`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name+"="+tt.value, func(t *testing.T) {
+			t.Setenv("PORT", "8080")
+			t.Setenv("DATABASE_URL", "postgres://localhost/rsvp")
+			t.Setenv(tt.name, tt.value)
+
+			_, err := LoadConfig()
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("err = %v, want %q", err, tt.want)
+			}
+		})
+	}
+
+	t.Run("several", func(t *testing.T) {
+		t.Setenv("PORT", "eighty")
+		t.Setenv("DATABASE_URL", "postgres://localhost/rsvp")
+		t.Setenv("RATE_LIMIT", "many")
+		_, err := LoadConfig()
+		if err == nil || !strings.Contains(err.Error(), "PORT=") || !strings.Contains(err.Error(), "RATE_LIMIT=") {
+			t.Errorf("err = %v, want both problems", err)
+		}
+	})
+}
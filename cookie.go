@@ -0,0 +1,34 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+// isHTTPS reports whether req reached us over HTTPS, either directly or via a
+// trusted proxy that says so in X-Forwarded-Proto.
+func (c *Config) isHTTPS(req *http.Request) bool {
+	if req.TLS != nil {
+		return true
+	}
+	if !c.fromTrustedProxy(req) {
+		return false
+	}
+	proto, _, _ := strings.Cut(req.Header.Get("X-Forwarded-Proto"), ",")
+	return strings.EqualFold(strings.TrimSpace(proto), "https")
+}
+
+// newCookie returns a cookie scoped to the whole site that scripts can't
+// read, which is only sent on same-site requests and top-level navigation,
+// and over HTTPS when the request was made that way or COOKIE_SECURE is set,
+// for deployments where HTTPS is terminated somewhere the app can't detect.
+func (c *Config) newCookie(req *http.Request, name, value string) *http.Cookie {
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   c.CookieSecure || c.isHTTPS(req),
+		SameSite: http.SameSiteLaxMode,
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func TestNewCookie(t *testing.T) {
+	proxies := testProxies(t, "10.0.0.0/8")
+
+	tests := []struct {
+		name       string
+		secure     bool
+		tls        bool
+		peer       string
+		proto      string
+		wantSecure bool
+	}{
+		{name: "plain HTTP", peer: "203.0.113.9:1234"},
+		{name: "COOKIE_SECURE", secure: true, peer: "203.0.113.9:1234", wantSecure: true},
+		{name: "TLS", tls: true, peer: "203.0.113.9:1234", wantSecure: true},
+		{name: "trusted proxy over HTTPS", peer: "10.0.0.1:1234", proto: "https", wantSecure: true},
+		{name: "trusted proxy chain over HTTPS", peer: "10.0.0.1:1234", proto: "HTTPS, http", wantSecure: true},
+		{name: "trusted proxy over HTTP", peer: "10.0.0.1:1234", proto: "http"},
+		{name: "untrusted peer claiming HTTPS", peer: "203.0.113.9:1234", proto: "https"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{CookieSecure: tt.secure, TrustedProxies: proxies}
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.peer
+			if tt.tls {
+				req.TLS = &tls.ConnectionState{}
+			}
+			if tt.proto != "" {
+				req.Header.Set("X-Forwarded-Proto", tt.proto)
+			}
+
+			cookie := cfg.newCookie(req, "name", "value")
+			if cookie.Secure != tt.wantSecure {
+				t.Errorf("Secure = %v, want %v", cookie.Secure, tt.wantSecure)
+			}
+			if !cookie.HttpOnly || cookie.SameSite != http.SameSiteLaxMode || cookie.Path != "/" {
+				t.Errorf("got HttpOnly %v, SameSite %v and Path %q, want an HttpOnly, SameSite=Lax cookie for /", cookie.HttpOnly, cookie.SameSite, cookie.Path)
+			}
+		})
+	}
+}
+
+func TestSiteCookieFlags(t *testing.T) {
+	for _, secure := range []bool{false, true} {
+		t.Setenv("COOKIE_SECURE", strconv.FormatBool(secure))
+		site := newTestSite(t, unreachablePool(t))
+		cookie := responseCookie(site.get("/healthz"), csrfCookie)
+		if cookie == nil {
+			t.Fatal("no CSRF cookie was set")
+		}
+		if cookie.Secure != secure || !cookie.HttpOnly || cookie.SameSite != http.SameSiteLaxMode {
+			t.Errorf("with COOKIE_SECURE %v, got Secure %v, HttpOnly %v and SameSite %v", secure, cookie.Secure, cookie.HttpOnly, cookie.SameSite)
+		}
+	}
+}
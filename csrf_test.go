@@ -0,0 +1,72 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestCSRFProtect(t *testing.T) {
+	handler := csrfProtect(&Config{}, http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		io.WriteString(rw, csrfTokenFrom(req.Context()))
+	}))
+
+	tests := []struct {
+		name       string
+		cookie     string
+		field      string
+		header     string
+		wantStatus int
+	}{
+		{name: "valid field", cookie: "token", field: "token", wantStatus: http.StatusOK},
+		{name: "valid header", cookie: "token", header: "token", wantStatus: http.StatusOK},
+		{name: "missing token", cookie: "token", wantStatus: http.StatusForbidden},
+		{name: "mismatched token", cookie: "token", field: "other", wantStatus: http.StatusForbidden},
+		{name: "mismatched header", cookie: "token", header: "other", field: "token", wantStatus: http.StatusForbidden},
+		{name: "no cookie", field: "token", wantStatus: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{"name": {"Ada"}}
+			if tt.field != "" {
+				form.Set(csrfField, tt.field)
+			}
+			req := httptest.NewRequest(http.MethodPost, "/rsvp", strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			if tt.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: csrfCookie, Value: tt.cookie})
+			}
+			if tt.header != "" {
+				req.Header.Set(csrfHeader, tt.header)
+			}
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestCSRFProtectIssuesToken(t *testing.T) {
+	handler := csrfProtect(&Config{}, http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		io.WriteString(rw, csrfTokenFrom(req.Context()))
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/rsvp", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	cookie := responseCookie(rec, csrfCookie)
+	if cookie == nil || cookie.Value == "" {
+		t.Fatal("no CSRF cookie was set")
+	}
+	if rec.Body.String() != cookie.Value {
+		t.Errorf("the request's token %q isn't the cookie's %q", rec.Body, cookie.Value)
+	}
+}
@@ -0,0 +1,30 @@
+package db
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// AdminPasswordHash is the admin setting holding the bcrypt hash of the admin
+// password, which takes precedence over ADMIN_PASSWORD_HASH once set.
+const AdminPasswordHash = "password_hash"
+
+// GetAdminSetting loads the value of an admin setting. It returns ErrNotFound
+// if the setting has never been saved.
+func GetAdminSetting(ctx context.Context, q Querier, key string) (string, error) {
+	var value string
+	err := q.QueryRow(ctx, "select value from admin_settings where key = $1", key).Scan(&value)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", ErrNotFound
+	}
+	return value, err
+}
+
+// SetAdminSetting saves the value of an admin setting.
+func SetAdminSetting(ctx context.Context, q Querier, key, value string) error {
+	_, err := q.Exec(ctx, `insert into admin_settings (key, value) values ($1, $2)
+		on conflict (key) do update set value = excluded.value, updated_at = now()`, key, value)
+	return err
+}
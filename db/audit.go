@@ -0,0 +1,42 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// AuditEntry records a change made by an admin.
+type AuditEntry struct {
+	Id        int
+	AdminUser string
+	Action    string
+	Target    string
+	Details   string
+	CreatedAt time.Time
+}
+
+// RecordAudit appends an entry to the audit log.
+func RecordAudit(ctx context.Context, q Querier, user, action, target, details string) error {
+	_, err := q.Exec(ctx, "insert into audit_log (admin_user, action, target, details) values ($1, $2, $3, $4)",
+		user, action, target, details)
+	return err
+}
+
+// ListAuditEntries loads up to limit of the most recent audit log entries,
+// newest first.
+func ListAuditEntries(ctx context.Context, q Querier, limit int) ([]*AuditEntry, error) {
+	rows, err := q.Query(ctx, `select id, admin_user, action, target, details, created_at
+		from audit_log
+		order by created_at desc, id desc
+		limit $1`, limit)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (*AuditEntry, error) {
+		e := &AuditEntry{}
+		err := row.Scan(&e.Id, &e.AdminUser, &e.Action, &e.Target, &e.Details, &e.CreatedAt)
+		return e, err
+	})
+}
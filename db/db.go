@@ -0,0 +1,49 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// ErrNotFound is returned when a lookup matches no rows.
+var ErrNotFound = errors.New("not found")
+
+// Querier is satisfied by *pgxpool.Pool, *pgx.Conn and pgx.Tx.
+type Querier interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// TxStarter is satisfied by *pgxpool.Pool and *pgx.Conn.
+type TxStarter interface {
+	Begin(ctx context.Context) (pgx.Tx, error)
+}
+
+// ErrInviteCodeTaken is returned by CreateGuest when another guest already
+// has the new guest's invite code.
+var ErrInviteCodeTaken = errors.New("invite code is taken")
+
+// ErrNoEvent is returned when a guest isn't invited to any event.
+var ErrNoEvent = errors.New("guest has no event")
+
+// qualify prefixes each of a comma-separated list of columns with a table
+// alias, for use in joins.
+func qualify(alias, columns string) string {
+	parts := strings.Split(columns, ", ")
+	for i, column := range parts {
+		parts[i] = alias + "." + column
+	}
+	return strings.Join(parts, ", ")
+}
+
+// IsUniqueViolation reports whether err was caused by violating the named
+// unique constraint.
+func IsUniqueViolation(err error, constraint string) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505" && pgErr.ConstraintName == constraint
+}
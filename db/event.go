@@ -0,0 +1,220 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+type Event struct {
+	Id           int
+	Slug         string
+	Title        string
+	Date         time.Time
+	EndsAt       *time.Time
+	RSVPDeadline *time.Time
+	Location     string
+	Description  string
+
+	// TZ is the IANA name of the time zone the event takes place in, like
+	// America/Toronto. Empty means the server's time zone.
+	TZ string
+
+	// Capacity caps the event's headcount; nil means unlimited.
+	Capacity *int
+
+	// AllowMaybe lets guests answer maybe as well as yes or no.
+	AllowMaybe bool
+
+	// MaxPartySize is the party size given to imported guests without one
+	// of their own, and caps every guest's party; nil means no cap.
+	MaxPartySize *int
+
+	// SeatsPerTable is how many people fit at each of the event's tables;
+	// nil means tables aren't limited.
+	SeatsPerTable *int
+
+	// ClosedAt is set when an admin closes the event after its deadline,
+	// declining for everyone who hadn't responded.
+	ClosedAt *time.Time
+
+	// ThankYouAttending and ThankYouDeclining are shown to guests after they
+	// respond, replacing the default messages when set.
+	ThankYouAttending string
+	ThankYouDeclining string
+
+	// PrimaryColor, BackgroundImageURL and Font theme the event's pages,
+	// replacing the stylesheet's defaults when set.
+	PrimaryColor       string
+	BackgroundImageURL string
+	Font               string
+
+	// CreatedAt and UpdatedAt are set by the database when the event is
+	// inserted and whenever it's changed.
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+const eventColumns = "id, slug, title, date, ends_at, rsvp_deadline, location, description, timezone, capacity, thank_you_attending, thank_you_declining, closed_at, primary_color, background_image_url, font, max_party_size, seats_per_table, allow_maybe, created_at, updated_at"
+
+// fields returns pointers to e's fields in the order of eventColumns, for
+// scanning.
+func (e *Event) fields() []any {
+	return []any{&e.Id, &e.Slug, &e.Title, &e.Date, &e.EndsAt, &e.RSVPDeadline, &e.Location, &e.Description, &e.TZ, &e.Capacity, &e.ThankYouAttending, &e.ThankYouDeclining, &e.ClosedAt, &e.PrimaryColor, &e.BackgroundImageURL, &e.Font, &e.MaxPartySize, &e.SeatsPerTable, &e.AllowMaybe, &e.CreatedAt, &e.UpdatedAt}
+}
+
+func scanEvent(row pgx.Row) (*Event, error) {
+	e := &Event{}
+	err := row.Scan(e.fields()...)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// FindEventById loads the event with the given id.
+func FindEventById(ctx context.Context, q Querier, id int) (*Event, error) {
+	return scanEvent(q.QueryRow(ctx, "select "+eventColumns+" from events where id = $1", id))
+}
+
+// FindEventBySlug loads the event with the given slug.
+func FindEventBySlug(ctx context.Context, q Querier, slug string) (*Event, error) {
+	return scanEvent(q.QueryRow(ctx, "select "+eventColumns+" from events where slug = $1", slug))
+}
+
+// CreateEvent inserts a new event, filling in e.Id.
+func CreateEvent(ctx context.Context, q Querier, e *Event) error {
+	return q.QueryRow(ctx, `insert into events (slug, title, date, ends_at, rsvp_deadline, location, description, capacity, thank_you_attending, thank_you_declining, timezone,
+			primary_color, background_image_url, font, max_party_size, seats_per_table, allow_maybe)
+		values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17)
+		returning id, created_at, updated_at`, e.Slug, e.Title, e.Date, e.EndsAt, e.RSVPDeadline, e.Location, e.Description, e.Capacity,
+		e.ThankYouAttending, e.ThankYouDeclining, e.TZ, e.PrimaryColor, e.BackgroundImageURL, e.Font, e.MaxPartySize, e.SeatsPerTable, e.AllowMaybe).Scan(&e.Id, &e.CreatedAt, &e.UpdatedAt)
+}
+
+// UpdateEvent saves every field of an existing event, refreshing
+// e.UpdatedAt. If the event's capacity leaves room for waitlisted guests,
+// they're given places, and returned.
+func UpdateEvent(ctx context.Context, pool TxStarter, e *Event) ([]*Guest, error) {
+	var promoted []*Guest
+	err := pgx.BeginFunc(ctx, pool, func(tx pgx.Tx) error {
+		// The update locks the event until the waitlist has been promoted,
+		// as RecordResponse's lock does.
+		err := tx.QueryRow(ctx, `update events
+			set slug = $2, title = $3, date = $4, ends_at = $5, rsvp_deadline = $6, location = $7, description = $8, capacity = $9,
+			thank_you_attending = $10, thank_you_declining = $11, timezone = $12,
+			primary_color = $13, background_image_url = $14, font = $15, max_party_size = $16, seats_per_table = $17, allow_maybe = $18
+			where id = $1
+			returning updated_at`, e.Id, e.Slug, e.Title, e.Date, e.EndsAt, e.RSVPDeadline, e.Location, e.Description, e.Capacity,
+			e.ThankYouAttending, e.ThankYouDeclining, e.TZ, e.PrimaryColor, e.BackgroundImageURL, e.Font, e.MaxPartySize, e.SeatsPerTable, e.AllowMaybe).Scan(&e.UpdatedAt)
+		if err != nil {
+			return err
+		}
+
+		if e.Capacity != nil {
+			promoted, err = promoteWaitlisted(ctx, tx, e.Id, *e.Capacity)
+		}
+		return err
+	})
+	return promoted, err
+}
+
+// PartySizeFor returns the largest party g may respond with: their own
+// allotment, capped by the event's maximum if it has one. It may be called on
+// a nil event.
+func (e *Event) PartySizeFor(g *Guest) int {
+	if e == nil || e.MaxPartySize == nil {
+		return g.MaxPartySize
+	}
+	return min(g.MaxPartySize, *e.MaxPartySize)
+}
+
+// Themed reports whether any of the event's theme settings are set.
+func (e *Event) Themed() bool {
+	return e.PrimaryColor != "" || e.BackgroundImageURL != "" || e.Font != ""
+}
+
+// DeadlinePassed reports whether the event's RSVP deadline has passed.
+func (e *Event) DeadlinePassed(now time.Time) bool {
+	return e.RSVPDeadline != nil && now.After(*e.RSVPDeadline)
+}
+
+// ResponsesClosed reports whether the event has stopped taking responses,
+// because its RSVP deadline has passed or it has been closed.
+func (e *Event) ResponsesClosed(now time.Time) bool {
+	return e.ClosedAt != nil || e.DeadlinePassed(now)
+}
+
+// CloseEvent marks an event closed, declining on behalf of every guest who
+// hasn't responded. It returns how many guests were declined. Their
+// responded_at is left unset, since they never responded themselves.
+func CloseEvent(ctx context.Context, pool TxStarter, id int) (int, error) {
+	var declined int
+	err := pgx.BeginFunc(ctx, pool, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx, `update guests set attending = 'no'
+			where event_id = $1 and responded_at is null and attending is null and deleted_at is null`, id)
+		if err != nil {
+			return err
+		}
+		declined = int(tag.RowsAffected())
+
+		_, err = tx.Exec(ctx, "update events set closed_at = coalesce(closed_at, now()) where id = $1", id)
+		return err
+	})
+	return declined, err
+}
+
+// defaultEventDuration is assumed for events without an end time.
+const defaultEventDuration = 2 * time.Hour
+
+// End returns when the event finishes, assuming defaultEventDuration if no
+// end time was set.
+func (e *Event) End() time.Time {
+	if e.EndsAt != nil {
+		return *e.EndsAt
+	}
+	return e.Date.Add(defaultEventDuration)
+}
+
+// EventSummary is an event along with counts of its guests' responses.
+type EventSummary struct {
+	Event
+	Invited    int
+	Responded  int
+	Attending  int
+	Waitlisted int
+	Declined   int
+	Maybe      int
+	Pending    int
+	Headcount  int
+}
+
+// ListEventSummaries loads every event, soonest first, with response counts.
+func ListEventSummaries(ctx context.Context, q Querier) ([]*EventSummary, error) {
+	rows, err := q.Query(ctx, "select "+qualify("e", eventColumns)+`,
+		count(g.id),
+		count(g.responded_at),
+		count(g.id) filter (where g.attending = 'yes' and g.waitlisted_at is null),
+		count(g.id) filter (where g.waitlisted_at is not null),
+		count(g.id) filter (where g.attending = 'no'),
+		count(g.id) filter (where g.attending = 'maybe'),
+		count(g.id) filter (where g.attending is null),
+		coalesce(sum(g.party_size) filter (where g.attending = 'yes' and g.waitlisted_at is null), 0)
+		from events e
+		left join guests g on g.event_id = e.id and g.deleted_at is null
+		group by e.id
+		order by e.date, e.id`)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (*EventSummary, error) {
+		s := &EventSummary{}
+		err := row.Scan(append(s.Event.fields(),
+			&s.Invited, &s.Responded, &s.Attending, &s.Waitlisted, &s.Declined, &s.Maybe, &s.Pending, &s.Headcount)...)
+		return s, err
+	})
+}
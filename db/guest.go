@@ -0,0 +1,584 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Attendance is a guest's answer to whether they're coming.
+type Attendance string
+
+const (
+	AttendanceYes Attendance = "yes"
+	AttendanceNo  Attendance = "no"
+	// AttendanceMaybe is a tentative answer, for events that allow one.
+	// Tentative guests don't take a place.
+	AttendanceMaybe Attendance = "maybe"
+)
+
+// Valid reports whether a is one of the possible answers.
+func (a Attendance) Valid() bool {
+	return a == AttendanceYes || a == AttendanceNo || a == AttendanceMaybe
+}
+
+type Guest struct {
+	Id           int
+	EventId      *int
+	InviteCode   string
+	Name         string
+	Email        string
+	PartySize    int
+	MaxPartySize int
+	RespondedAt  *time.Time
+	// Attendance is nil until the guest responds.
+	Attendance *Attendance
+	Dietary    string
+	Notes      string
+
+	// DeclineReason is why the guest said no, if they said. It's always
+	// empty for a guest who's attending.
+	DeclineReason string
+
+	// EmailVerifiedAt is set once the guest's email address is known to be
+	// theirs. Addresses entered by an admin are trusted; ones guests enter
+	// themselves must be confirmed with a link sent to them.
+	EmailVerifiedAt *time.Time
+
+	// WaitlistedAt is set when the guest said yes after their event was
+	// full, until a place opens up for them.
+	WaitlistedAt *time.Time
+
+	// HouseholdId is the household the guest shares an invitation with, if
+	// any.
+	HouseholdId *int
+
+	// DeletedAt is set when an admin removes the guest. Deleted guests are
+	// left out of every lookup and list except FindGuestById and
+	// ListDeletedEventGuests, so that admins can still find and restore them.
+	DeletedAt *time.Time
+
+	// TableAssignment is the table the guest is seated at, or empty if they
+	// haven't been given one.
+	TableAssignment string
+
+	// CreatedAt and UpdatedAt are set by the database when the guest is
+	// inserted and whenever they're changed.
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+const guestColumns = "id, event_id, invite_code, name, email, party_size, max_party_size, responded_at, attending, dietary, notes, decline_reason, email_verified_at, waitlisted_at, household_id, deleted_at, table_assignment, created_at, updated_at"
+
+// fields returns pointers to g's fields in the order of guestColumns, for
+// scanning.
+func (g *Guest) fields() []any {
+	return []any{&g.Id, &g.EventId, &g.InviteCode, &g.Name, &g.Email, &g.PartySize, &g.MaxPartySize, &g.RespondedAt, &g.Attendance, &g.Dietary, &g.Notes, &g.DeclineReason, &g.EmailVerifiedAt, &g.WaitlistedAt, &g.HouseholdId, &g.DeletedAt, &g.TableAssignment, &g.CreatedAt, &g.UpdatedAt}
+}
+
+func scanGuest(row pgx.Row) (*Guest, error) {
+	g := &Guest{}
+	err := row.Scan(g.fields()...)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// FindGuestByInviteCode loads the guest holding the given invite code.
+func FindGuestByInviteCode(ctx context.Context, q Querier, code string) (*Guest, error) {
+	return scanGuest(q.QueryRow(ctx, "select "+guestColumns+" from guests where invite_code = $1 and deleted_at is null", code))
+}
+
+// FindGuestById loads the guest with the given id, even if they've been
+// deleted.
+func FindGuestById(ctx context.Context, q Querier, id int) (*Guest, error) {
+	return scanGuest(q.QueryRow(ctx, "select "+guestColumns+" from guests where id = $1", id))
+}
+
+// FindGuestWithEvent loads the guest holding the given invite code together
+// with the event they're invited to. It returns ErrNoEvent if the guest
+// exists but has no event, which happens when their event is deleted.
+func FindGuestWithEvent(ctx context.Context, q Querier, code string) (*Guest, *Event, error) {
+	g, e := &Guest{}, &Event{}
+	err := q.QueryRow(ctx, "select "+qualify("g", guestColumns)+", "+qualify("e", eventColumns)+`
+		from guests g
+		join events e on e.id = g.event_id
+		where g.invite_code = $1 and g.deleted_at is null`, code).Scan(append(g.fields(), e.fields()...)...)
+	if errors.Is(err, pgx.ErrNoRows) {
+		if _, err := FindGuestByInviteCode(ctx, q, code); err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, ErrNoEvent
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return g, e, nil
+}
+
+// FindEventGuestByInviteCode loads the guest holding the given invite code,
+// provided they are invited to the given event.
+func FindEventGuestByInviteCode(ctx context.Context, q Querier, eventId int, code string) (*Guest, error) {
+	return scanGuest(q.QueryRow(ctx, "select "+guestColumns+" from guests where event_id = $1 and invite_code = $2 and deleted_at is null", eventId, code))
+}
+
+// IsAttending reports whether the guest has responded yes, whether or not
+// they have a place yet.
+func (g *Guest) IsAttending() bool {
+	return g.Attendance != nil && *g.Attendance == AttendanceYes
+}
+
+// IsWaitlisted reports whether the guest responded yes but is waiting for a
+// place at their event.
+func (g *Guest) IsWaitlisted() bool {
+	return g.IsAttending() && g.WaitlistedAt != nil
+}
+
+// EmailVerified reports whether the guest has an email address that's safe
+// to send to.
+func (g *Guest) EmailVerified() bool {
+	return g.Email != "" && g.EmailVerifiedAt != nil
+}
+
+// IsDeclined reports whether the guest has responded no.
+func (g *Guest) IsDeclined() bool {
+	return g.Attendance != nil && *g.Attendance == AttendanceNo
+}
+
+// IsTentative reports whether the guest has responded maybe.
+func (g *Guest) IsTentative() bool {
+	return g.Attendance != nil && *g.Attendance == AttendanceMaybe
+}
+
+// Response is a guest's answer to their invitation.
+type Response struct {
+	Attendance Attendance
+	PartySize  int
+	PlusOnes   []string
+	Dietary    string
+	Notes      string
+
+	// DeclineReason is only saved when Attendance is AttendanceNo.
+	DeclineReason string
+
+	// Email, if not nil, replaces the guest's email address. A changed
+	// address is unverified until the guest confirms it.
+	Email *string
+
+	// Nonce identifies the form submission the response came from, so that
+	// a repeated submission can be recognized. It may be empty.
+	Nonce string
+}
+
+// ResponseNonceWindow is how long a response's nonce is remembered.
+const ResponseNonceWindow = 10 * time.Minute
+
+// ResponseResult describes the effect of recording a response on the
+// event's waitlist.
+type ResponseResult struct {
+	// Duplicate is set if the response repeated the guest's last nonce, in
+	// which case nothing was saved.
+	Duplicate bool
+
+	// Waitlisted is set if the guest said yes but the event is full.
+	Waitlisted bool
+
+	// Promoted holds the waitlisted guests given a place as a result of the
+	// response, for example because the guest declined.
+	Promoted []*Guest
+}
+
+// RecordResponse saves a guest's RSVP, including their companions, and stamps
+// responded_at. If the guest's event has a capacity, a yes that doesn't fit
+// puts the guest on the waitlist, and any places freed up are given to
+// waitlisted guests in the order they joined it.
+func RecordResponse(ctx context.Context, pool TxStarter, id int, r Response) (ResponseResult, error) {
+	var result ResponseResult
+	err := pgx.BeginFunc(ctx, pool, func(tx pgx.Tx) error {
+		if r.Nonce != "" {
+			claimed, err := claimResponseNonce(ctx, tx, id, r.Nonce)
+			if err != nil {
+				return err
+			}
+			if !claimed {
+				result.Duplicate = true
+				return nil
+			}
+		}
+
+		var eventId *int
+		if err := tx.QueryRow(ctx, "select event_id from guests where id = $1", id).Scan(&eventId); err != nil {
+			return err
+		}
+
+		capacity, err := lockEventCapacity(ctx, tx, eventId)
+		if err != nil {
+			return err
+		}
+		result.Waitlisted, err = overCapacity(ctx, tx, eventId, capacity, id, &r.Attendance, r.PartySize)
+		if err != nil {
+			return err
+		}
+
+		if r.Attendance != AttendanceNo {
+			r.DeclineReason = ""
+		}
+		_, err = tx.Exec(ctx, `update guests
+			set attending = $2, party_size = $3, dietary = $4, notes = $5, decline_reason = $6, responded_at = now(),
+			waitlisted_at = case when $7 then coalesce(waitlisted_at, now()) end
+			where id = $1`, id, r.Attendance, r.PartySize, r.Dietary, r.Notes, r.DeclineReason, result.Waitlisted)
+		if err != nil {
+			return err
+		}
+		if r.Email != nil {
+			_, err := tx.Exec(ctx, `update guests
+				set email = $2, email_verified_at = case when email = $2 then email_verified_at end
+				where id = $1`, id, *r.Email)
+			if err != nil {
+				return err
+			}
+		}
+		if err := ReplacePlusOnes(ctx, tx, id, r.PlusOnes); err != nil {
+			return err
+		}
+		if err := recordRSVPEvent(ctx, tx, id, r, result.Waitlisted); err != nil {
+			return err
+		}
+
+		if capacity != nil {
+			result.Promoted, err = promoteWaitlisted(ctx, tx, *eventId, *capacity)
+		}
+		return err
+	})
+	return result, err
+}
+
+// claimResponseNonce stores nonce as the guest's latest, reporting false if
+// it already was within ResponseNonceWindow.
+func claimResponseNonce(ctx context.Context, q Querier, id int, nonce string) (bool, error) {
+	tag, err := q.Exec(ctx, `update guests set response_nonce = $2, response_nonce_at = now()
+		where id = $1
+		and (response_nonce is distinct from $2 or response_nonce_at < now() - $3::interval)`,
+		id, nonce, ResponseNonceWindow.String())
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// lockEventCapacity returns the capacity of the event with id eventId, which
+// may be nil for a guest without an event, and locks the event until the end
+// of the transaction. Locking the event serializes changes to its guest list,
+// so that two guests can't both take the last place.
+func lockEventCapacity(ctx context.Context, tx pgx.Tx, eventId *int) (*int, error) {
+	if eventId == nil {
+		return nil, nil
+	}
+	var capacity *int
+	err := tx.QueryRow(ctx, "select capacity from events where id = $1 for update", *eventId).Scan(&capacity)
+	return capacity, err
+}
+
+// overCapacity reports whether the guest with id, attending with a party of
+// partySize, would take the event past its capacity and so belongs on the
+// waitlist.
+func overCapacity(ctx context.Context, q Querier, eventId, capacity *int, id int, attendance *Attendance, partySize int) (bool, error) {
+	if capacity == nil || attendance == nil || *attendance != AttendanceYes {
+		return false, nil
+	}
+	headcount, err := eventHeadcount(ctx, q, *eventId, id)
+	if err != nil {
+		return false, err
+	}
+	return headcount+partySize > *capacity, nil
+}
+
+// eventHeadcount totals the party sizes of an event's confirmed guests,
+// leaving out the guest with id except.
+func eventHeadcount(ctx context.Context, q Querier, eventId, except int) (int, error) {
+	var headcount int
+	err := q.QueryRow(ctx, `select coalesce(sum(party_size), 0) from guests
+		where event_id = $1 and attending = 'yes' and waitlisted_at is null and deleted_at is null and id <> $2`, eventId, except).Scan(&headcount)
+	return headcount, err
+}
+
+// promoteWaitlisted gives places at an event to waitlisted guests, first come
+// first served, until the next guest in line doesn't fit.
+func promoteWaitlisted(ctx context.Context, q Querier, eventId, capacity int) ([]*Guest, error) {
+	headcount, err := eventHeadcount(ctx, q, eventId, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := q.Query(ctx, "select "+guestColumns+` from guests
+		where event_id = $1 and attending = 'yes' and waitlisted_at is not null and deleted_at is null
+		order by waitlisted_at, id`, eventId)
+	if err != nil {
+		return nil, err
+	}
+	waiting, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (*Guest, error) {
+		return scanGuest(row)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var promoted []*Guest
+	for _, g := range waiting {
+		if headcount+g.PartySize > capacity {
+			break
+		}
+		if _, err := q.Exec(ctx, "update guests set waitlisted_at = null where id = $1", g.Id); err != nil {
+			return nil, err
+		}
+		g.WaitlistedAt = nil
+		headcount += g.PartySize
+		promoted = append(promoted, g)
+	}
+	return promoted, nil
+}
+
+// ListEventGuests loads every guest invited to an event, ordered by name.
+func ListEventGuests(ctx context.Context, q Querier, eventId int) ([]*Guest, error) {
+	rows, err := q.Query(ctx, "select "+guestColumns+" from guests where event_id = $1 and deleted_at is null order by name, id", eventId)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (*Guest, error) {
+		return scanGuest(row)
+	})
+}
+
+// likePattern returns a pattern for ilike matching s anywhere, with any
+// wildcard characters in s escaped.
+func likePattern(s string) string {
+	return "%" + strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s) + "%"
+}
+
+// CountEventGuests counts an event's guests whose name contains search,
+// ignoring case. An empty search counts every guest.
+func CountEventGuests(ctx context.Context, q Querier, eventId int, search string) (int, error) {
+	var count int
+	err := q.QueryRow(ctx, "select count(*) from guests where event_id = $1 and name ilike $2 and deleted_at is null",
+		eventId, likePattern(search)).Scan(&count)
+	return count, err
+}
+
+// ListEventGuestsPage loads up to limit of an event's guests whose name
+// contains search, ordered by name and skipping the first offset.
+func ListEventGuestsPage(ctx context.Context, q Querier, eventId int, search string, limit, offset int) ([]*Guest, error) {
+	rows, err := q.Query(ctx, "select "+guestColumns+` from guests
+		where event_id = $1 and name ilike $2 and deleted_at is null
+		order by name, id
+		limit $3 offset $4`, eventId, likePattern(search), limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (*Guest, error) {
+		return scanGuest(row)
+	})
+}
+
+// CreateGuest inserts a new guest, filling in g.Id, or returns
+// ErrInviteCodeTaken if another guest has g's invite code. The guest's email
+// address, having been entered by an admin, counts as verified.
+func CreateGuest(ctx context.Context, q Querier, g *Guest) error {
+	// A taken code skips the insert rather than violating the constraint,
+	// which would abort the transaction q may be part of.
+	err := q.QueryRow(ctx, `insert into guests (event_id, invite_code, name, email, party_size, max_party_size, household_id, email_verified_at)
+		values ($1, $2, $3, $4, $5, $6, $7, case when $4 <> '' then now() end)
+		on conflict (invite_code) do nothing
+		returning id, created_at, updated_at`, g.EventId, g.InviteCode, g.Name, g.Email, g.PartySize, g.MaxPartySize, g.HouseholdId).Scan(&g.Id, &g.CreatedAt, &g.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrInviteCodeTaken
+	}
+	return err
+}
+
+// UpdateGuest saves an admin's changes to a guest's name, email, party sizes
+// and response. A changed email address counts as verified. The guest's place
+// at the event is decided as RecordResponse decides it, refreshing
+// g.WaitlistedAt, and the waitlisted guests given places as a result are
+// returned.
+func UpdateGuest(ctx context.Context, pool TxStarter, g *Guest) ([]*Guest, error) {
+	var promoted []*Guest
+	err := pgx.BeginFunc(ctx, pool, func(tx pgx.Tx) error {
+		capacity, err := lockEventCapacity(ctx, tx, g.EventId)
+		if err != nil {
+			return err
+		}
+		waitlisted, err := overCapacity(ctx, tx, g.EventId, capacity, g.Id, g.Attendance, g.PartySize)
+		if err != nil {
+			return err
+		}
+
+		err = tx.QueryRow(ctx, `update guests
+			set name = $2, email = $3, party_size = $4, max_party_size = $5, attending = $6, decline_reason = $7,
+			waitlisted_at = case when $8 then coalesce(waitlisted_at, now()) end,
+			email_verified_at = case when $3 = '' then null when email = $3 then email_verified_at else now() end
+			where id = $1
+			returning updated_at, waitlisted_at`, g.Id, g.Name, g.Email, g.PartySize, g.MaxPartySize, g.Attendance, g.DeclineReason, waitlisted).Scan(&g.UpdatedAt, &g.WaitlistedAt)
+		if err != nil {
+			return err
+		}
+
+		if capacity != nil {
+			promoted, err = promoteWaitlisted(ctx, tx, *g.EventId, *capacity)
+		}
+		return err
+	})
+	return promoted, err
+}
+
+// ListGuestsToRemind loads an event's guests who have a verified email
+// address but haven't responded, skipping any who were already reminded
+// after since.
+func ListGuestsToRemind(ctx context.Context, q Querier, eventId int, since time.Time) ([]*Guest, error) {
+	rows, err := q.Query(ctx, "select "+guestColumns+` from guests
+		where event_id = $1
+		and deleted_at is null
+		and responded_at is null
+		and attending is null
+		and email <> ''
+		and email_verified_at is not null
+		and (reminder_sent_at is null or reminder_sent_at < $2)
+		order by name, id`, eventId, since)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (*Guest, error) {
+		return scanGuest(row)
+	})
+}
+
+// VerifyGuestEmail marks the guest's email address verified, provided it's
+// still email. It reports whether it was.
+func VerifyGuestEmail(ctx context.Context, q Querier, id int, email string) (bool, error) {
+	tag, err := q.Exec(ctx, `update guests set email_verified_at = coalesce(email_verified_at, now())
+		where id = $1 and email = $2 and email <> '' and deleted_at is null`, id, email)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// MarkReminderSent records that a guest was just sent a reminder.
+func MarkReminderSent(ctx context.Context, q Querier, id int) error {
+	_, err := q.Exec(ctx, "update guests set reminder_sent_at = now() where id = $1", id)
+	return err
+}
+
+// ListEventAttendees loads an event's guests who are attending and have a
+// place, ordered by name. Waitlisted guests are left out.
+func ListEventAttendees(ctx context.Context, q Querier, eventId int) ([]*Guest, error) {
+	rows, err := q.Query(ctx, "select "+guestColumns+` from guests
+		where event_id = $1 and attending = 'yes' and waitlisted_at is null and deleted_at is null
+		order by name, id`, eventId)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (*Guest, error) {
+		return scanGuest(row)
+	})
+}
+
+// AssignTables seats an event's guests, mapping guest ids to table names. An
+// empty name clears the guest's table. Guests of other events are left alone.
+// Guests are updated in id order, so that concurrent assignments lock their
+// rows in the same order.
+func AssignTables(ctx context.Context, pool TxStarter, eventId int, tables map[int]string) error {
+	ids := make([]int, 0, len(tables))
+	for id := range tables {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+
+	return pgx.BeginFunc(ctx, pool, func(tx pgx.Tx) error {
+		for _, id := range ids {
+			_, err := tx.Exec(ctx, "update guests set table_assignment = $3 where id = $1 and event_id = $2", id, eventId, tables[id])
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// ListDeletedEventGuests loads an event's deleted guests, most recently
+// deleted first.
+func ListDeletedEventGuests(ctx context.Context, q Querier, eventId int) ([]*Guest, error) {
+	rows, err := q.Query(ctx, "select "+guestColumns+` from guests
+		where event_id = $1 and deleted_at is not null
+		order by deleted_at desc, id`, eventId)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (*Guest, error) {
+		return scanGuest(row)
+	})
+}
+
+// DeleteGuest marks a guest as deleted, returning them as they are now along
+// with the waitlisted guests given the place they freed up. It returns
+// ErrNotFound if there's no such guest or they were already deleted.
+func DeleteGuest(ctx context.Context, pool TxStarter, id int) (*Guest, []*Guest, error) {
+	return changeGuestPlace(ctx, pool, id, func(tx pgx.Tx, _ bool) (*Guest, error) {
+		return scanGuest(tx.QueryRow(ctx, "update guests set deleted_at = now() where id = $1 and deleted_at is null returning "+guestColumns, id))
+	})
+}
+
+// RestoreGuest undoes DeleteGuest. A restored guest whose place has been
+// taken in the meantime goes on the waitlist. It returns ErrNotFound if
+// there's no such deleted guest.
+func RestoreGuest(ctx context.Context, pool TxStarter, id int) (*Guest, []*Guest, error) {
+	return changeGuestPlace(ctx, pool, id, func(tx pgx.Tx, waitlisted bool) (*Guest, error) {
+		return scanGuest(tx.QueryRow(ctx, `update guests
+			set deleted_at = null, waitlisted_at = case when $2 then coalesce(waitlisted_at, now()) end
+			where id = $1 and deleted_at is not null
+			returning `+guestColumns, id, waitlisted))
+	})
+}
+
+// changeGuestPlace applies change, which adds the guest with id to their
+// event's headcount or takes them out of it, with the event locked. change is
+// told whether the guest would be over the event's capacity. The waitlisted
+// guests given any room that was made are returned alongside the changed
+// guest.
+func changeGuestPlace(ctx context.Context, pool TxStarter, id int, change func(tx pgx.Tx, waitlisted bool) (*Guest, error)) (*Guest, []*Guest, error) {
+	var guest *Guest
+	var promoted []*Guest
+	err := pgx.BeginFunc(ctx, pool, func(tx pgx.Tx) error {
+		current, err := scanGuest(tx.QueryRow(ctx, "select "+guestColumns+" from guests where id = $1", id))
+		if err != nil {
+			return err
+		}
+		capacity, err := lockEventCapacity(ctx, tx, current.EventId)
+		if err != nil {
+			return err
+		}
+		waitlisted, err := overCapacity(ctx, tx, current.EventId, capacity, id, current.Attendance, current.PartySize)
+		if err != nil {
+			return err
+		}
+		if guest, err = change(tx, waitlisted); err != nil {
+			return err
+		}
+
+		if capacity != nil {
+			promoted, err = promoteWaitlisted(ctx, tx, *current.EventId, *capacity)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return guest, promoted, nil
+}
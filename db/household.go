@@ -0,0 +1,85 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"slices"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Household groups guests who share an invitation, like a family. Any
+// member's invite code lets them respond for the whole household.
+type Household struct {
+	Id      int
+	EventId int
+	Name    string
+}
+
+// FindOrCreateHousehold loads the event's household with the given name,
+// creating it if there isn't one.
+func FindOrCreateHousehold(ctx context.Context, q Querier, eventId int, name string) (*Household, error) {
+	h := &Household{EventId: eventId, Name: name}
+	err := q.QueryRow(ctx, `insert into households (event_id, name) values ($1, $2)
+		on conflict (event_id, name) do update set name = excluded.name
+		returning id`, eventId, name).Scan(&h.Id)
+	if err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// FindHouseholdById loads the household with the given id.
+func FindHouseholdById(ctx context.Context, q Querier, id int) (*Household, error) {
+	h := &Household{}
+	err := q.QueryRow(ctx, "select id, event_id, name from households where id = $1", id).Scan(&h.Id, &h.EventId, &h.Name)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// ListHouseholdMembers loads the guests in a household, in the order they
+// were added.
+func ListHouseholdMembers(ctx context.Context, q Querier, householdId int) ([]*Guest, error) {
+	rows, err := q.Query(ctx, "select "+guestColumns+" from guests where household_id = $1 and deleted_at is null order by id", householdId)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (*Guest, error) {
+		return scanGuest(row)
+	})
+}
+
+// RecordHouseholdResponse saves the responses of several household members
+// at once, keyed by guest id, so that either all of them are recorded or
+// none are. The results are keyed the same way. Members are recorded in id
+// order, so that which of them are waitlisted when the event fills up
+// doesn't depend on map order, and concurrent submissions lock their rows in
+// the same order.
+func RecordHouseholdResponse(ctx context.Context, pool TxStarter, responses map[int]Response) (map[int]ResponseResult, error) {
+	ids := make([]int, 0, len(responses))
+	for id := range responses {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+
+	results := make(map[int]ResponseResult, len(responses))
+	err := pgx.BeginFunc(ctx, pool, func(tx pgx.Tx) error {
+		for _, id := range ids {
+			result, err := RecordResponse(ctx, tx, id, responses[id])
+			if err != nil {
+				return err
+			}
+			results[id] = result
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
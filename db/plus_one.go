@@ -0,0 +1,57 @@
+package db
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ListPlusOneNames loads the names of a guest's companions in the order they
+// were entered.
+func ListPlusOneNames(ctx context.Context, q Querier, guestId int) ([]string, error) {
+	rows, err := q.Query(ctx, "select name from plus_ones where guest_id = $1 order by position", guestId)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowTo[string])
+}
+
+// ListEventPlusOneNames loads the names of the companions of every guest of
+// an event, keyed by guest id, each in the order they were entered.
+func ListEventPlusOneNames(ctx context.Context, q Querier, eventId int) (map[int][]string, error) {
+	rows, err := q.Query(ctx, `select p.guest_id, p.name
+		from plus_ones p
+		join guests g on g.id = p.guest_id
+		where g.event_id = $1
+		order by p.guest_id, p.position`, eventId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	names := map[int][]string{}
+	for rows.Next() {
+		var guestId int
+		var name string
+		if err := rows.Scan(&guestId, &name); err != nil {
+			return nil, err
+		}
+		names[guestId] = append(names[guestId], name)
+	}
+	return names, rows.Err()
+}
+
+// ReplacePlusOnes replaces a guest's companions with names. It should be run
+// inside a transaction.
+func ReplacePlusOnes(ctx context.Context, q Querier, guestId int, names []string) error {
+	if _, err := q.Exec(ctx, "delete from plus_ones where guest_id = $1", guestId); err != nil {
+		return err
+	}
+	for i, name := range names {
+		_, err := q.Exec(ctx, "insert into plus_ones (guest_id, position, name) values ($1, $2, $3)", guestId, i, name)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
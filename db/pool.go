@@ -0,0 +1,63 @@
+package db
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Pool is a connection pool that retries queries once when they fail on a
+// connection that turns out to be dead, as happens after the database
+// restarts or a network blip: the pool hands out a fresh connection for the
+// retry. Only failures that pgconn.SafeToRetry guarantees happened before
+// anything reached the server are retried, so a query never runs twice.
+// Exec, which is only used for writes, isn't retried, and neither are
+// transactions.
+type Pool struct {
+	*pgxpool.Pool
+}
+
+var _ Querier = &Pool{}
+
+// retryable reports whether a query that failed with err should be retried.
+func retryable(ctx context.Context, err error) bool {
+	if err == nil || ctx.Err() != nil || !pgconn.SafeToRetry(err) {
+		return false
+	}
+	slog.Warn("Retrying query after connection failure", "error", err)
+	return true
+}
+
+func (p *Pool) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	rows, err := p.Pool.Query(ctx, sql, args...)
+	if retryable(ctx, err) {
+		rows, err = p.Pool.Query(ctx, sql, args...)
+	}
+	return rows, err
+}
+
+func (p *Pool) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	return &retryRow{pool: p.Pool, ctx: ctx, sql: sql, args: args, row: p.Pool.QueryRow(ctx, sql, args...)}
+}
+
+// retryRow reruns its query if scanning its row fails in a way that's safe
+// to retry. QueryRow's errors only come out of Scan, so it can't retry
+// sooner.
+type retryRow struct {
+	pool *pgxpool.Pool
+	ctx  context.Context
+	sql  string
+	args []any
+	row  pgx.Row
+}
+
+func (r *retryRow) Scan(dest ...any) error {
+	err := r.row.Scan(dest...)
+	if retryable(r.ctx, err) {
+		err = r.pool.QueryRow(r.ctx, r.sql, r.args...).Scan(dest...)
+	}
+	return err
+}
@@ -0,0 +1,95 @@
+package db
+
+import (
+	"context"
+	"os"
+	"sync/atomic"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// droppingPool returns a Pool connected to TEST_DATABASE_URL whose first drops
+// connections are closed as they're handed out, as if the database had
+// dropped them while they sat idle, and a count of the connections handed out.
+func droppingPool(t *testing.T, drops int32) (*Pool, *atomic.Int32) {
+	t.Helper()
+	conn := os.Getenv("TEST_DATABASE_URL")
+	if conn == "" {
+		t.Skip("TEST_DATABASE_URL is unset")
+	}
+
+	config, err := pgxpool.ParseConfig(conn)
+	if err != nil {
+		t.Fatalf("parsing TEST_DATABASE_URL: %v", err)
+	}
+	var acquired atomic.Int32
+	config.BeforeAcquire = func(ctx context.Context, conn *pgx.Conn) bool {
+		if acquired.Add(1) <= drops {
+			conn.Close(ctx)
+		}
+		return true
+	}
+	pool, err := pgxpool.NewWithConfig(context.Background(), config)
+	if err != nil {
+		t.Fatalf("connecting to TEST_DATABASE_URL: %v", err)
+	}
+	t.Cleanup(pool.Close)
+	return &Pool{Pool: pool}, &acquired
+}
+
+func TestPoolRetriesDroppedConnections(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("QueryRow", func(t *testing.T) {
+		pool, acquired := droppingPool(t, 1)
+		var n int
+		if err := pool.QueryRow(ctx, "select 1").Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		if n != 1 || acquired.Load() != 2 {
+			t.Errorf("got %d after %d attempts, want 1 after 2", n, acquired.Load())
+		}
+	})
+
+	t.Run("Query", func(t *testing.T) {
+		pool, acquired := droppingPool(t, 1)
+		rows, err := pool.Query(ctx, "select generate_series(1, 3)")
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := pgx.CollectRows(rows, pgx.RowTo[int])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != 3 || acquired.Load() != 2 {
+			t.Errorf("got %v after %d attempts, want 3 rows after 2", got, acquired.Load())
+		}
+	})
+}
+
+func TestPoolRetriesOnlyOnce(t *testing.T) {
+	ctx := context.Background()
+	pool, acquired := droppingPool(t, 2)
+
+	var n int
+	if err := pool.QueryRow(ctx, "select 1").Scan(&n); err == nil {
+		t.Error("a query on two dropped connections succeeded")
+	}
+	if got := acquired.Load(); got != 2 {
+		t.Errorf("made %d attempts, want 2", got)
+	}
+}
+
+func TestPoolDoesNotRetryExec(t *testing.T) {
+	ctx := context.Background()
+	pool, acquired := droppingPool(t, 1)
+
+	if _, err := pool.Exec(ctx, "select 1"); err == nil {
+		t.Error("Exec on a dropped connection succeeded")
+	}
+	if got := acquired.Load(); got != 1 {
+		t.Errorf("made %d attempts, want 1", got)
+	}
+}
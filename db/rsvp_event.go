@@ -0,0 +1,51 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// RSVPEvent is one response in a guest's history. Rows are only ever
+// appended, one per recorded response.
+type RSVPEvent struct {
+	Id            int
+	GuestId       int
+	Attendance    Attendance
+	PartySize     int
+	PlusOnes      []string
+	Dietary       string
+	Notes         string
+	DeclineReason string
+	Waitlisted    bool
+
+	CreatedAt time.Time
+}
+
+// recordRSVPEvent appends a response to the guest's history.
+func recordRSVPEvent(ctx context.Context, q Querier, guestId int, r Response, waitlisted bool) error {
+	plusOnes := r.PlusOnes
+	if plusOnes == nil {
+		plusOnes = []string{}
+	}
+	_, err := q.Exec(ctx, `insert into rsvp_events (guest_id, attending, party_size, plus_ones, dietary, notes, decline_reason, waitlisted)
+		values ($1, $2, $3, $4, $5, $6, $7, $8)`, guestId, r.Attendance, r.PartySize, plusOnes, r.Dietary, r.Notes, r.DeclineReason, waitlisted)
+	return err
+}
+
+// ListRSVPEvents loads a guest's responses, oldest first.
+func ListRSVPEvents(ctx context.Context, q Querier, guestId int) ([]*RSVPEvent, error) {
+	rows, err := q.Query(ctx, `select id, guest_id, attending, party_size, plus_ones, dietary, notes, decline_reason, waitlisted, created_at
+		from rsvp_events
+		where guest_id = $1
+		order by created_at, id`, guestId)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (*RSVPEvent, error) {
+		e := &RSVPEvent{}
+		err := row.Scan(&e.Id, &e.GuestId, &e.Attendance, &e.PartySize, &e.PlusOnes, &e.Dietary, &e.Notes, &e.DeclineReason, &e.Waitlisted, &e.CreatedAt)
+		return e, err
+	})
+}
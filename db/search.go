@@ -0,0 +1,48 @@
+package db
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// GuestMatch is a guest found by SearchGuests, with the event they're
+// invited to.
+type GuestMatch struct {
+	Guest *Guest
+	Event *Event
+}
+
+// SearchEvents loads up to limit events whose title or slug contains search,
+// ignoring case, soonest first.
+func SearchEvents(ctx context.Context, q Querier, search string, limit int) ([]*Event, error) {
+	rows, err := q.Query(ctx, "select "+eventColumns+` from events
+		where title ilike $1 or slug ilike $1
+		order by date, id
+		limit $2`, likePattern(search), limit)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (*Event, error) {
+		return scanEvent(row)
+	})
+}
+
+// SearchGuests loads up to limit guests, across every event, whose name or
+// email address contains search, ignoring case, ordered by name.
+func SearchGuests(ctx context.Context, q Querier, search string, limit int) ([]GuestMatch, error) {
+	rows, err := q.Query(ctx, "select "+qualify("g", guestColumns)+", "+qualify("e", eventColumns)+`
+		from guests g
+		join events e on e.id = g.event_id
+		where (g.name ilike $1 or g.email ilike $1) and g.deleted_at is null
+		order by g.name, g.id
+		limit $2`, likePattern(search), limit)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (GuestMatch, error) {
+		m := GuestMatch{Guest: &Guest{}, Event: &Event{}}
+		err := row.Scan(append(m.Guest.fields(), m.Event.fields()...)...)
+		return m, err
+	})
+}
@@ -0,0 +1,383 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/meagar/rsvp/db"
+)
+
+// eventFormTime is the format of datetime-local inputs.
+const eventFormTime = "2006-01-02T15:04"
+
+// errDuplicateSlug is reported when an event's slug is already taken.
+var errDuplicateSlug = errors.New("Another event already uses that slug.")
+
+var validSlug = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// validColor matches the CSS colors an event may be themed with: hex colors
+// like #6b4f9e or #fff, and named colors like teal.
+var validColor = regexp.MustCompile(`^(#[0-9a-fA-F]{3}|#[0-9a-fA-F]{6}|[a-zA-Z]{3,30})$`)
+
+// validFont matches a comma-separated list of font family names, like
+// Palatino, serif. Quotes aren't allowed, so names are written bare.
+var validFont = regexp.MustCompile(`^[A-Za-z0-9 -]+(, *[A-Za-z0-9 -]+)*$`)
+
+// maxThemeURLLength and maxFontLength cap the length of an event's background
+// image URL and font.
+const (
+	maxThemeURLLength = 2000
+	maxFontLength     = 200
+)
+
+// eventForm holds the event form's fields as entered, so that they can be
+// redisplayed if they don't validate.
+type eventForm struct {
+	Title       string
+	Slug        string
+	Date        string
+	EndsAt      string
+	Deadline    string
+	Location    string
+	Description string
+	Capacity    string
+	Timezone    string
+
+	MaxPartySize  string
+	SeatsPerTable string
+	AllowMaybe    bool
+
+	ThankYouAttending string
+	ThankYouDeclining string
+
+	PrimaryColor       string
+	BackgroundImageURL string
+	Font               string
+}
+
+type eventFormData struct {
+	adminPage
+	// Event is the event being edited, or nil for a new one.
+	Event *db.Event
+	Form  eventForm
+	Error string
+}
+
+func (eventFormData) PartySizeLimit() int {
+	return partySizeLimit
+}
+
+func formatFormTime(t *time.Time, loc *time.Location) string {
+	if t == nil {
+		return ""
+	}
+	return t.In(loc).Format(eventFormTime)
+}
+
+// newEventForm fills the form in from an existing event. Times are shown in
+// the event's time zone.
+func newEventForm(e *db.Event) eventForm {
+	loc := eventLocation(e.TZ)
+	f := eventForm{
+		Title:       e.Title,
+		Slug:        e.Slug,
+		Date:        formatFormTime(&e.Date, loc),
+		EndsAt:      formatFormTime(e.EndsAt, loc),
+		Deadline:    formatFormTime(e.RSVPDeadline, loc),
+		Location:    e.Location,
+		Description: e.Description,
+		Timezone:    e.TZ,
+		AllowMaybe:  e.AllowMaybe,
+
+		ThankYouAttending: e.ThankYouAttending,
+		ThankYouDeclining: e.ThankYouDeclining,
+
+		PrimaryColor:       e.PrimaryColor,
+		BackgroundImageURL: e.BackgroundImageURL,
+		Font:               e.Font,
+	}
+	if e.Capacity != nil {
+		f.Capacity = strconv.Itoa(*e.Capacity)
+	}
+	if e.MaxPartySize != nil {
+		f.MaxPartySize = strconv.Itoa(*e.MaxPartySize)
+	}
+	if e.SeatsPerTable != nil {
+		f.SeatsPerTable = strconv.Itoa(*e.SeatsPerTable)
+	}
+	return f
+}
+
+func parseEventForm(form url.Values) eventForm {
+	return eventForm{
+		Title:       strings.TrimSpace(form.Get("title")),
+		Slug:        strings.TrimSpace(form.Get("slug")),
+		Date:        form.Get("date"),
+		EndsAt:      form.Get("ends_at"),
+		Deadline:    form.Get("rsvp_deadline"),
+		Location:    strings.TrimSpace(form.Get("location")),
+		Description: strings.TrimSpace(form.Get("description")),
+		Capacity:    strings.TrimSpace(form.Get("capacity")),
+		Timezone:    strings.TrimSpace(form.Get("timezone")),
+
+		MaxPartySize:  strings.TrimSpace(form.Get("max_party_size")),
+		SeatsPerTable: strings.TrimSpace(form.Get("seats_per_table")),
+		AllowMaybe:    form.Get("allow_maybe") == "yes",
+
+		ThankYouAttending: strings.TrimSpace(form.Get("thank_you_attending")),
+		ThankYouDeclining: strings.TrimSpace(form.Get("thank_you_declining")),
+
+		PrimaryColor:       strings.TrimSpace(form.Get("primary_color")),
+		BackgroundImageURL: strings.TrimSpace(form.Get("background_image_url")),
+		Font:               strings.TrimSpace(form.Get("font")),
+	}
+}
+
+// slugify turns a title into a slug of lowercase letters, digits and dashes.
+// Apostrophes are dropped rather than becoming dashes.
+func slugify(title string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(title) {
+		if r == '\'' || r == '’' {
+			continue
+		}
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash = false
+		} else {
+			dash = true
+		}
+	}
+	return b.String()
+}
+
+// parseFormTime parses an optional datetime-local value in the time zone loc.
+func parseFormTime(value, field string, loc *time.Location) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.ParseInLocation(eventFormTime, value, loc)
+	if err != nil {
+		return nil, errors.New(field + " must be a date and time.")
+	}
+	return &t, nil
+}
+
+// validateTheme checks the theme fields, which end up in the event pages'
+// stylesheet, so they're held to formats that are safe there.
+func (f *eventForm) validateTheme() error {
+	if f.PrimaryColor != "" && !validColor.MatchString(f.PrimaryColor) {
+		return errors.New("The primary color must be a hex color like #6b4f9e or a color name like teal.")
+	}
+	if f.BackgroundImageURL != "" {
+		u, err := url.Parse(f.BackgroundImageURL)
+		if err != nil || u.Scheme != "https" || u.Host == "" || len(f.BackgroundImageURL) > maxThemeURLLength {
+			return errors.New("The background image must be an https:// URL.")
+		}
+	}
+	if f.Font != "" && (len(f.Font) > maxFontLength || !validFont.MatchString(f.Font)) {
+		return errors.New("The font must be a list of font names like Palatino, serif, without quotes.")
+	}
+	return nil
+}
+
+// apply validates the form and copies it onto e. The start date must be in
+// the future, unless it's unchanged from an existing event's.
+func (f *eventForm) apply(e *db.Event, now time.Time) error {
+	if f.Title == "" {
+		return errors.New("Please enter a title.")
+	}
+	if f.Slug == "" {
+		f.Slug = slugify(f.Title)
+	}
+	if !validSlug.MatchString(f.Slug) {
+		return errors.New("The slug may only contain lowercase letters, digits and dashes.")
+	}
+
+	// Times are entered in the event's time zone.
+	loc := time.Local
+	if f.Timezone != "" {
+		var err error
+		if loc, err = time.LoadLocation(f.Timezone); err != nil {
+			return errors.New("The time zone must be a name like America/Toronto, or blank for the server's.")
+		}
+	}
+
+	date, err := parseFormTime(f.Date, "The date", loc)
+	if err != nil {
+		return err
+	}
+	if date == nil {
+		return errors.New("Please enter the date of the event.")
+	}
+	if !date.Equal(e.Date) && !date.After(now) {
+		return errors.New("The date must be in the future.")
+	}
+
+	endsAt, err := parseFormTime(f.EndsAt, "The end time", loc)
+	if err != nil {
+		return err
+	}
+	if endsAt != nil && !endsAt.After(*date) {
+		return errors.New("The event must end after it starts.")
+	}
+
+	deadline, err := parseFormTime(f.Deadline, "The RSVP deadline", loc)
+	if err != nil {
+		return err
+	}
+	if deadline != nil && deadline.After(*date) {
+		return errors.New("The RSVP deadline must not be after the event starts.")
+	}
+
+	var capacity *int
+	if f.Capacity != "" {
+		n, err := strconv.Atoi(f.Capacity)
+		if err != nil || n < 1 {
+			return errors.New("Capacity must be a number of at least 1, or blank for no limit.")
+		}
+		capacity = &n
+	}
+
+	var maxPartySize *int
+	if f.MaxPartySize != "" {
+		n, err := strconv.Atoi(f.MaxPartySize)
+		if err != nil || n < 1 || n > partySizeLimit {
+			return fmt.Errorf("The maximum party size must be a number from 1 to %d, or blank for no limit.", partySizeLimit)
+		}
+		maxPartySize = &n
+	}
+
+	var seatsPerTable *int
+	if f.SeatsPerTable != "" {
+		n, err := strconv.Atoi(f.SeatsPerTable)
+		if err != nil || n < 1 {
+			return errors.New("Seats per table must be a number of at least 1, or blank for no limit.")
+		}
+		seatsPerTable = &n
+	}
+
+	if err := f.validateTheme(); err != nil {
+		return err
+	}
+
+	e.Title = f.Title
+	e.Slug = f.Slug
+	e.Date = *date
+	e.EndsAt = endsAt
+	e.RSVPDeadline = deadline
+	e.Location = f.Location
+	e.Description = f.Description
+	e.Capacity = capacity
+	e.MaxPartySize = maxPartySize
+	e.SeatsPerTable = seatsPerTable
+	e.AllowMaybe = f.AllowMaybe
+	e.TZ = f.Timezone
+	e.ThankYouAttending = f.ThankYouAttending
+	e.ThankYouDeclining = f.ThankYouDeclining
+	e.PrimaryColor = f.PrimaryColor
+	e.BackgroundImageURL = f.BackgroundImageURL
+	e.Font = f.Font
+	return nil
+}
+
+func (h *AdminHandler) newEvent(rw http.ResponseWriter, req *http.Request) {
+	renderPage(rw, req, http.StatusOK, "admin/event_form", eventFormData{adminPage: h.page(req)})
+}
+
+func (h *AdminHandler) createEvent(rw http.ResponseWriter, req *http.Request) {
+	h.saveEvent(rw, req, nil)
+}
+
+func (h *AdminHandler) editEvent(rw http.ResponseWriter, req *http.Request) {
+	event := findEvent(rw, req, h.cfg, h.db)
+	if event == nil {
+		return
+	}
+
+	renderPage(rw, req, http.StatusOK, "admin/event_form", eventFormData{
+		adminPage: h.page(req),
+		Event:     event,
+		Form:      newEventForm(event),
+	})
+}
+
+func (h *AdminHandler) updateEvent(rw http.ResponseWriter, req *http.Request) {
+	event := findEvent(rw, req, h.cfg, h.db)
+	if event == nil {
+		return
+	}
+	h.saveEvent(rw, req, event)
+}
+
+// saveEvent validates the submitted form and creates an event from it, or
+// updates existing if it isn't nil. Invalid forms are redisplayed with the
+// problem.
+func (h *AdminHandler) saveEvent(rw http.ResponseWriter, req *http.Request, existing *db.Event) {
+	if err := req.ParseForm(); err != nil {
+		bodyError(rw, err)
+		return
+	}
+
+	form := parseEventForm(req.PostForm)
+	// Work on a copy so that a failed save redisplays the form against the
+	// event as it was.
+	event := &db.Event{}
+	if existing != nil {
+		*event = *existing
+	}
+
+	invalid := func(err error) {
+		renderPage(rw, req, http.StatusUnprocessableEntity, "admin/event_form", eventFormData{
+			adminPage: h.page(req),
+			Event:     existing,
+			Form:      form,
+			Error:     err.Error(),
+		})
+	}
+
+	if err := form.apply(event, time.Now()); err != nil {
+		invalid(err)
+		return
+	}
+
+	ctx, cancel := h.cfg.queryContext(req)
+	defer cancel()
+
+	var err error
+	var promoted []*db.Guest
+	if existing == nil {
+		err = db.CreateEvent(ctx, h.db, event)
+	} else {
+		promoted, err = db.UpdateEvent(ctx, h.db, event)
+	}
+	if db.IsUniqueViolation(err, "events_slug_key") {
+		invalid(errDuplicateSlug)
+		return
+	}
+	if err != nil {
+		serverError(rw, req, err)
+		return
+	}
+
+	action, flash := "event.update", "Saved changes to "+event.Title+"."
+	if existing == nil {
+		action, flash = "event.create", "Created "+event.Title+"."
+	}
+	h.audit(req, action, "event "+event.Slug, event.Title)
+	for _, g := range promoted {
+		sendPromotion(req, h.cfg, h.mailer, h.sessions, g, event)
+	}
+	h.setFlash(rw, req, flash)
+	http.Redirect(rw, req, h.path, http.StatusSeeOther)
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/meagar/rsvp/db"
+)
+
+func TestCreateEvent(t *testing.T) {
+	pool := testPool(t)
+	site := newTestSite(t, pool)
+
+	date := time.Now().Add(30 * 24 * time.Hour).UTC().Truncate(time.Minute)
+	rec := site.post("/admin/events", url.Values{
+		"title":         {"Summer Picnic"},
+		"date":          {date.Format(eventFormTime)},
+		"rsvp_deadline": {date.Add(-7 * 24 * time.Hour).Format(eventFormTime)},
+		"timezone":      {"UTC"},
+		"location":      {"High Park"},
+		"capacity":      {"40"},
+	}, site.adminSession())
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/admin/" {
+		t.Fatalf("got %d to %q, want a redirect to the dashboard\n%s", rec.Code, rec.Header().Get("Location"), rec.Body)
+	}
+
+	event, err := db.FindEventBySlug(context.Background(), pool, "summer-picnic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event.Title != "Summer Picnic" || !event.Date.Equal(date) || event.Location != "High Park" || deref(event.Capacity) != 40 {
+		t.Errorf("saved %q on %v at %q for %v", event.Title, event.Date, event.Location, event.Capacity)
+	}
+	if event.RSVPDeadline == nil || !event.RSVPDeadline.Equal(date.Add(-7*24*time.Hour)) {
+		t.Errorf("saved deadline %v", event.RSVPDeadline)
+	}
+}
+
+func TestCreateEventRejectsDuplicateSlug(t *testing.T) {
+	pool := testPool(t)
+	site := newTestSite(t, pool)
+	existing := createTestEvent(t, pool, &db.Event{Title: "Summer Picnic"})
+
+	form := eventFormValues(&db.Event{Title: "Summer Picnic", Date: existing.Date.Add(24 * time.Hour)})
+	rec := site.post("/admin/events", form, site.adminSession())
+	if rec.Code != http.StatusUnprocessableEntity || !strings.Contains(rec.Body.String(), "Another event already uses that slug.") {
+		t.Errorf("got %d, want %d and the duplicate slug error\n%s", rec.Code, http.StatusUnprocessableEntity, rec.Body)
+	}
+
+	events, err := db.ListEventSummaries(context.Background(), pool)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 {
+		t.Errorf("there are %d events, want 1", len(events))
+	}
+}
+
+func TestEditEvent(t *testing.T) {
+	pool := testPool(t)
+	site := newTestSite(t, pool)
+	event := createTestEvent(t, pool, &db.Event{Title: "Summer Picnic", Location: "High Park"})
+
+	rec := site.get("/admin/events/"+event.Slug+"/edit", site.adminSession())
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `value="High Park"`) {
+		t.Errorf("the edit form doesn't show the event's location:\n%s", rec.Body)
+	}
+
+	form := eventFormValues(event)
+	form.Set("title", "Summer Picnic (Rescheduled)")
+	form.Set("location", "Trinity Bellwoods")
+	if rec := site.post("/admin/events/"+event.Slug+"/edit", form, site.adminSession()); rec.Code != http.StatusSeeOther {
+		t.Fatalf("status = %d, want %d\n%s", rec.Code, http.StatusSeeOther, rec.Body)
+	}
+	saved, err := db.FindEventById(context.Background(), pool, event.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.Title != "Summer Picnic (Rescheduled)" || saved.Location != "Trinity Bellwoods" || saved.Slug != event.Slug {
+		t.Errorf("saved %q at %q with slug %q", saved.Title, saved.Location, saved.Slug)
+	}
+}
+
+func TestEventFormApply(t *testing.T) {
+	now := time.Date(2030, time.May, 1, 12, 0, 0, 0, time.UTC)
+	past := time.Date(2030, time.April, 1, 18, 0, 0, 0, time.UTC)
+	valid := eventForm{Title: "Summer Picnic", Date: "2030-06-01T18:00", Timezone: "America/Toronto"}
+
+	tests := []struct {
+		name     string
+		change   func(f *eventForm)
+		existing db.Event
+		wantErr  string
+	}{
+		{name: "valid", change: func(f *eventForm) {}},
+		{name: "no title", change: func(f *eventForm) { f.Title = "" }, wantErr: "enter a title"},
+		{name: "bad slug", change: func(f *eventForm) { f.Slug = "Summer Picnic" }, wantErr: "The slug"},
+		{name: "no date", change: func(f *eventForm) { f.Date = "" }, wantErr: "enter the date"},
+		{name: "malformed date", change: func(f *eventForm) { f.Date = "June 1st" }, wantErr: "must be a date and time"},
+		{name: "past date", change: func(f *eventForm) { f.Date = "2030-04-01T14:00" }, wantErr: "in the future"},
+		{name: "unchanged past date", change: func(f *eventForm) { f.Date = "2030-04-01T14:00" }, existing: db.Event{Date: past}},
+		{name: "unknown time zone", change: func(f *eventForm) { f.Timezone = "Mars/Olympus_Mons" }, wantErr: "time zone"},
+		{name: "ends before it starts", change: func(f *eventForm) { f.EndsAt = "2030-06-01T17:00" }, wantErr: "end after it starts"},
+		{name: "deadline after it starts", change: func(f *eventForm) { f.Deadline = "2030-06-02T00:00" }, wantErr: "deadline must not be after"},
+		{name: "zero capacity", change: func(f *eventForm) { f.Capacity = "0" }, wantErr: "Capacity must be"},
+		{name: "huge party", change: func(f *eventForm) { f.MaxPartySize = "1000" }, wantErr: "maximum party size"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := valid
+			tt.change(&f)
+			event := tt.existing
+			err := f.apply(&event, now)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("apply returned %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("apply returned %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	var event db.Event
+	f := valid
+	if err := f.apply(&event, now); err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Date(2030, time.June, 1, 22, 0, 0, 0, time.UTC); event.Slug != "summer-picnic" || !event.Date.Equal(want) {
+		t.Errorf("applied slug %q and date %v, want %q and %v", event.Slug, event.Date, "summer-picnic", want)
+	}
+}
+
+func TestEventFormValidatesTheme(t *testing.T) {
+	tests := []struct {
+		name    string
+		theme   eventForm
+		wantErr string
+	}{
+		{name: "none"},
+		{name: "hex color", theme: eventForm{PrimaryColor: "#6b4f9e"}},
+		{name: "short hex color", theme: eventForm{PrimaryColor: "#fc0"}},
+		{name: "named color", theme: eventForm{PrimaryColor: "teal"}},
+		{name: "five-digit hex color", theme: eventForm{PrimaryColor: "#6b4f9"}, wantErr: "primary color"},
+		{name: "injected declaration", theme: eventForm{PrimaryColor: "red; background: url(https://example.com/x)"}, wantErr: "primary color"},
+		{name: "closing the style", theme: eventForm{PrimaryColor: "red}</style>"}, wantErr: "primary color"},
+		{name: "background image", theme: eventForm{BackgroundImageURL: "https://example.com/garden.jpg"}},
+		{name: "insecure background image", theme: eventForm{BackgroundImageURL: "http://example.com/garden.jpg"}, wantErr: "background image"},
+		{name: "javascript background image", theme: eventForm{BackgroundImageURL: "javascript:alert(1)"}, wantErr: "background image"},
+		{name: "fonts", theme: eventForm{Font: "Palatino, Georgia, serif"}},
+		{name: "quoted font", theme: eventForm{Font: `"Comic Sans MS", cursive`}, wantErr: "font"},
+		{name: "injected font", theme: eventForm{Font: "serif; color: red"}, wantErr: "font"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.theme.validateTheme()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("validateTheme returned %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("validateTheme returned %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestEventPageTheme(t *testing.T) {
+	page := func(event *db.Event) string {
+		return renderString(t, "events/show", struct {
+			Event     *db.Event
+			CodeEntry bool
+		}{Event: event})
+	}
+
+	themed := page(&db.Event{Title: "Summer Picnic", PrimaryColor: "#6b4f9e", Font: "Palatino, serif"})
+	for _, want := range []string{"--primary-color: #6b4f9e;", "--font-family: Palatino, serif;"} {
+		if !strings.Contains(themed, want) {
+			t.Errorf("the themed page doesn't contain %q:\n%s", want, themed)
+		}
+	}
+	if strings.Contains(themed, "--background-image") {
+		t.Error("the page sets a background image the event doesn't have")
+	}
+
+	if plain := page(&db.Event{Title: "Summer Picnic"}); strings.Contains(plain, ":root") {
+		t.Errorf("an event without a theme overrides the stylesheet:\n%s", plain)
+	}
+}
+
+func TestEditEventRejectsInvalidTheme(t *testing.T) {
+	pool := testPool(t)
+	site := newTestSite(t, pool)
+	event := createTestEvent(t, pool, &db.Event{PrimaryColor: "#6b4f9e"})
+
+	form := eventFormValues(event)
+	form.Set("primary_color", "red; background: url(https://example.com/x)")
+	rec := site.post("/admin/events/"+event.Slug+"/edit", form, site.adminSession())
+	if rec.Code != http.StatusUnprocessableEntity || !strings.Contains(rec.Body.String(), "The primary color must be") {
+		t.Errorf("got %d, want %d and the color error\n%s", rec.Code, http.StatusUnprocessableEntity, rec.Body)
+	}
+	saved, err := db.FindEventById(context.Background(), pool, event.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.PrimaryColor != "#6b4f9e" {
+		t.Errorf("saved primary color %q", saved.PrimaryColor)
+	}
+}
+
+func TestSlugify(t *testing.T) {
+	tests := map[string]string{
+		"Summer Picnic":           "summer-picnic",
+		"  Ada's 40th Birthday! ": "adas-40th-birthday",
+		"Rock’n’Roll -- Night":    "rocknroll-night",
+		"Café Lumière":            "caf-lumi-re",
+		"???":                     "",
+	}
+	for title, want := range tests {
+		if got := slugify(title); got != want {
+			t.Errorf("slugify(%q) = %q, want %q", title, got, want)
+		}
+	}
+}
+
+func TestEventTimestamps(t *testing.T) {
+	pool := testPool(t)
+	site := newTestSite(t, pool)
+	event := createTestEvent(t, pool, &db.Event{Title: "Summer Picnic"})
+	if event.CreatedAt.IsZero() || !event.UpdatedAt.Equal(event.CreatedAt) {
+		t.Fatalf("created at %v and updated at %v, want both set", event.CreatedAt, event.UpdatedAt)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	form := eventFormValues(event)
+	form.Set("location", "Trinity Bellwoods")
+	site.post("/admin/events/"+event.Slug+"/edit", form, site.adminSession())
+	saved, err := db.FindEventById(context.Background(), pool, event.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !saved.UpdatedAt.After(event.UpdatedAt) || !saved.CreatedAt.Equal(event.CreatedAt) {
+		t.Errorf("after an edit, created at %v and updated at %v, want only updated at to move on from %v", saved.CreatedAt, saved.UpdatedAt, event.UpdatedAt)
+	}
+
+	if body := site.get("/admin/events/"+event.Slug+"/edit", site.adminSession()).Body.String(); !strings.Contains(body, "Created ") || !strings.Contains(body, "last changed") {
+		t.Errorf("the edit form doesn't show when the event was created and changed:\n%s", body)
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/meagar/rsvp/db"
+)
+
+type EventHandler struct {
+	cfg *Config
+	db  *db.Pool
+}
+
+// findEvent loads the event named by the request's slug path value, writing
+// a 404 or 500 response and returning nil if it can't.
+func findEvent(rw http.ResponseWriter, req *http.Request, cfg *Config, q db.Querier) *db.Event {
+	ctx, cancel := cfg.queryContext(req)
+	defer cancel()
+
+	event, err := db.FindEventBySlug(ctx, q, req.PathValue("slug"))
+	if errors.Is(err, db.ErrNotFound) {
+		notFound(rw, req)
+		return nil
+	}
+	if err != nil {
+		serverError(rw, req, err)
+		return nil
+	}
+	return event
+}
+
+func (h *EventHandler) show(rw http.ResponseWriter, req *http.Request) {
+	event := findEvent(rw, req, h.cfg, h.db)
+	if event == nil {
+		return
+	}
+
+	// Codes typed in by hand have no signature, so they can only be looked
+	// up when signatures aren't required.
+	renderPage(rw, req, http.StatusOK, "events/show", struct {
+		Event     *db.Event
+		CodeEntry bool
+	}{Event: event, CodeEntry: !h.cfg.RequireSignedInvites})
+}
+
+// ics serves the event as an iCalendar file guests can add to their calendar.
+func (h *EventHandler) ics(rw http.ResponseWriter, req *http.Request) {
+	event := findEvent(rw, req, h.cfg, h.db)
+	if event == nil {
+		return
+	}
+
+	rw.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	rw.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", event.Slug+".ics"))
+	io.WriteString(rw, eventICS(event, h.cfg.absoluteURL(req, "/e/"+event.Slug), time.Now()))
+}
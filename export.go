@@ -0,0 +1,195 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/meagar/rsvp/db"
+	"github.com/xuri/excelize/v2"
+)
+
+var exportColumns = []string{"name", "email", "attending", "party_size", "waitlisted", "responded_at", "dietary", "notes", "decline_reason"}
+
+// exportGuest is a guest as exported in JSON, with the same fields as
+// exportColumns.
+type exportGuest struct {
+	Name          string         `json:"name"`
+	Email         string         `json:"email"`
+	Attending     *db.Attendance `json:"attending"`
+	PartySize     int            `json:"party_size"`
+	Waitlisted    bool           `json:"waitlisted"`
+	RespondedAt   *time.Time     `json:"responded_at"`
+	Dietary       string         `json:"dietary"`
+	Notes         string         `json:"notes"`
+	DeclineReason string         `json:"decline_reason"`
+}
+
+// exportFormats maps each format export accepts to the content type it's
+// sent with.
+var exportFormats = map[string]string{
+	"csv":  "text/csv; charset=utf-8",
+	"json": "application/json; charset=utf-8",
+	"xlsx": "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+}
+
+// export sends every guest of an event as an attachment in the format named
+// by ?format=, which is csv if it's omitted.
+func (h *AdminHandler) export(rw http.ResponseWriter, req *http.Request) {
+	h.exportAs(rw, req, req.URL.Query().Get("format"))
+}
+
+// exportCSV is export in CSV, for links made before there was a choice.
+func (h *AdminHandler) exportCSV(rw http.ResponseWriter, req *http.Request) {
+	h.exportAs(rw, req, "csv")
+}
+
+func (h *AdminHandler) exportAs(rw http.ResponseWriter, req *http.Request, format string) {
+	if format == "" {
+		format = "csv"
+	}
+	contentType, ok := exportFormats[format]
+	if !ok {
+		http.Error(rw, "The export format must be csv, json or xlsx", http.StatusBadRequest)
+		return
+	}
+
+	event := findEvent(rw, req, h.cfg, h.db)
+	if event == nil {
+		return
+	}
+
+	ctx, cancel := h.cfg.queryContext(req)
+	defer cancel()
+
+	guests, err := db.ListEventGuests(ctx, h.reads, event.Id)
+	if err != nil {
+		serverError(rw, req, err)
+		return
+	}
+
+	rw.Header().Set("Content-Type", contentType)
+	rw.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", event.Slug+"."+format))
+
+	switch format {
+	case "csv":
+		err = writeCSVExport(rw, guests)
+	case "json":
+		err = writeJSONExport(rw, guests)
+	case "xlsx":
+		err = writeXLSXExport(rw, guests)
+	}
+	if err != nil {
+		loggerFrom(req.Context()).Error("Writing export failed", "event", event.Slug, "format", format, "error", err)
+	}
+}
+
+func writeCSVExport(rw http.ResponseWriter, guests []*db.Guest) error {
+	w := csv.NewWriter(rw)
+	w.Write(exportColumns)
+	for _, g := range guests {
+		w.Write(exportRow(g))
+	}
+	w.Flush()
+	return w.Error()
+}
+
+func writeJSONExport(rw http.ResponseWriter, guests []*db.Guest) error {
+	rows := make([]exportGuest, len(guests))
+	for i, g := range guests {
+		rows[i] = exportGuest{
+			Name:          g.Name,
+			Email:         g.Email,
+			Attending:     g.Attendance,
+			PartySize:     g.PartySize,
+			Waitlisted:    g.IsWaitlisted(),
+			RespondedAt:   g.RespondedAt,
+			Dietary:       g.Dietary,
+			Notes:         g.Notes,
+			DeclineReason: g.DeclineReason,
+		}
+	}
+	return json.NewEncoder(rw).Encode(rows)
+}
+
+// writeXLSXExport writes guests as a spreadsheet with a header row. Numbers,
+// booleans and times are written as such, so that they can be sorted and
+// summed.
+func writeXLSXExport(rw http.ResponseWriter, guests []*db.Guest) error {
+	f := excelize.NewFile()
+	defer f.Close()
+
+	sheet := f.GetSheetName(0)
+	sw, err := f.NewStreamWriter(sheet)
+	if err != nil {
+		return err
+	}
+	bold, err := f.NewStyle(&excelize.Style{Font: &excelize.Font{Bold: true}})
+	if err != nil {
+		return err
+	}
+	dateFormat := "yyyy-mm-dd hh:mm"
+	dateTime, err := f.NewStyle(&excelize.Style{CustomNumFmt: &dateFormat})
+	if err != nil {
+		return err
+	}
+
+	header := make([]any, len(exportColumns))
+	for i, name := range exportColumns {
+		header[i] = excelize.Cell{StyleID: bold, Value: name}
+	}
+	if err := sw.SetRow("A1", header); err != nil {
+		return err
+	}
+
+	for i, g := range guests {
+		var attending, respondedAt any
+		if g.Attendance != nil {
+			attending = string(*g.Attendance)
+		}
+		if g.RespondedAt != nil {
+			respondedAt = excelize.Cell{StyleID: dateTime, Value: g.RespondedAt.UTC()}
+		}
+		row := []any{g.Name, g.Email, attending, g.PartySize, g.IsWaitlisted(), respondedAt, g.Dietary, g.Notes, g.DeclineReason}
+
+		cell, err := excelize.CoordinatesToCellName(1, i+2)
+		if err != nil {
+			return err
+		}
+		if err := sw.SetRow(cell, row); err != nil {
+			return err
+		}
+	}
+	if err := sw.Flush(); err != nil {
+		return err
+	}
+	return f.Write(rw)
+}
+
+func exportRow(g *db.Guest) []string {
+	attending := ""
+	if g.Attendance != nil {
+		attending = string(*g.Attendance)
+	}
+
+	respondedAt := ""
+	if g.RespondedAt != nil {
+		respondedAt = g.RespondedAt.UTC().Format(time.RFC3339)
+	}
+
+	return []string{neutralizeCell(g.Name), neutralizeCell(g.Email), attending, strconv.Itoa(g.PartySize), strconv.FormatBool(g.IsWaitlisted()), respondedAt, neutralizeCell(g.Dietary), neutralizeCell(g.Notes), neutralizeCell(g.DeclineReason)}
+}
+
+// neutralizeCell prefixes value with a ' if it starts with a character that
+// would make a spreadsheet treat it as a formula. Guests choose most of what's
+// exported, and shouldn't be able to run formulas on the host's computer.
+func neutralizeCell(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/meagar/rsvp/db"
+	"github.com/xuri/excelize/v2"
+)
+
+// seedExportGuests creates an event with one guest who has responded and one
+// who hasn't, returning the event and the rows they should be exported as.
+func seedExportGuests(t *testing.T, pool *db.Pool) (*db.Event, [][]string) {
+	t.Helper()
+	event := createTestEvent(t, pool, &db.Event{})
+	ada := createTestGuest(t, pool, &db.Guest{EventId: &event.Id, Name: "Ada Lovelace", Email: "ada@example.com", MaxPartySize: 2})
+	createTestGuest(t, pool, &db.Guest{EventId: &event.Id, Name: "Grace Hopper"})
+	recordTestResponse(t, pool, ada, db.Response{Attendance: db.AttendanceYes, PartySize: 2, Dietary: "Vegetarian", Notes: "See you there, \"finally\""})
+
+	return event, [][]string{
+		exportColumns,
+		{"Ada Lovelace", "ada@example.com", "yes", "2", "false", ada.RespondedAt.UTC().Format(time.RFC3339), "Vegetarian", "See you there, \"finally\"", ""},
+		{"Grace Hopper", "", "", "1", "false", "", "", "", ""},
+	}
+}
+
+func TestExportCSV(t *testing.T) {
+	pool := testPool(t)
+	site := newTestSite(t, pool)
+	event, want := seedExportGuests(t, pool)
+
+	rec := site.get("/admin/events/"+event.Slug+"/export.csv", site.adminSession())
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	if got, want := rec.Header().Get("Content-Type"), "text/csv; charset=utf-8"; got != want {
+		t.Errorf("Content-Type = %q, want %q", got, want)
+	}
+	if got := rec.Header().Get("Content-Disposition"); !strings.Contains(got, event.Slug+".csv") {
+		t.Errorf("Content-Disposition = %q, want it to name %s.csv", got, event.Slug)
+	}
+
+	rows, err := csv.NewReader(rec.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("export isn't valid CSV: %v", err)
+	}
+	if !slices.EqualFunc(rows, want, slices.Equal) {
+		t.Errorf("export rows = %q, want %q", rows, want)
+	}
+}
+
+// exportRows reads an export in any format back into rows of strings, as
+// they'd be written to CSV.
+func exportRows(t *testing.T, format string, body []byte) [][]string {
+	t.Helper()
+	switch format {
+	case "csv":
+		rows, err := csv.NewReader(bytes.NewReader(body)).ReadAll()
+		if err != nil {
+			t.Fatalf("the export isn't valid CSV: %v", err)
+		}
+		return rows
+	case "json":
+		var guests []map[string]any
+		if err := json.Unmarshal(body, &guests); err != nil {
+			t.Fatalf("the export isn't valid JSON: %v", err)
+		}
+		rows := [][]string{exportColumns}
+		for _, guest := range guests {
+			var row []string
+			for _, column := range exportColumns {
+				value := guest[column]
+				if value == nil {
+					value = ""
+				}
+				row = append(row, fmt.Sprint(value))
+			}
+			rows = append(rows, row)
+		}
+		return rows
+	case "xlsx":
+		f, err := excelize.OpenReader(bytes.NewReader(body))
+		if err != nil {
+			t.Fatalf("the export isn't a valid spreadsheet: %v", err)
+		}
+		defer f.Close()
+		rows, err := f.GetRows(f.GetSheetName(0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Trailing empty cells are left out of each row.
+		for i := range rows {
+			for len(rows[i]) < len(exportColumns) {
+				rows[i] = append(rows[i], "")
+			}
+		}
+		return rows
+	}
+	t.Fatalf("unknown format %q", format)
+	return nil
+}
+
+func TestExportFormats(t *testing.T) {
+	respondedAt := time.Date(2030, time.May, 1, 12, 30, 0, 0, time.UTC)
+	guests := []*db.Guest{
+		{Name: "Ada Lovelace", Email: "ada@example.com", Attendance: ptr(db.AttendanceYes), PartySize: 2, RespondedAt: &respondedAt, Dietary: "Vegetarian", Notes: `See you there, "finally"`},
+		{Name: "Grace Hopper", PartySize: 1},
+	}
+	writers := map[string]func(http.ResponseWriter, []*db.Guest) error{
+		"csv":  writeCSVExport,
+		"json": writeJSONExport,
+		"xlsx": writeXLSXExport,
+	}
+	want := map[string][]string{
+		"csv":  {"Ada Lovelace", "ada@example.com", "yes", "2", "false", "2030-05-01T12:30:00Z", "Vegetarian", `See you there, "finally"`, ""},
+		"json": {"Ada Lovelace", "ada@example.com", "yes", "2", "false", "2030-05-01T12:30:00Z", "Vegetarian", `See you there, "finally"`, ""},
+		// Spreadsheets hold a boolean and a date, which read back formatted.
+		"xlsx": {"Ada Lovelace", "ada@example.com", "yes", "2", "FALSE", "2030-05-01 12:30", "Vegetarian", `See you there, "finally"`, ""},
+	}
+
+	for format, write := range writers {
+		t.Run(format, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			if err := write(rec, guests); err != nil {
+				t.Fatal(err)
+			}
+			rows := exportRows(t, format, rec.Body.Bytes())
+			if len(rows) != 3 || !slices.Equal(rows[0], exportColumns) {
+				t.Fatalf("rows = %q, want a header and 2 guests", rows)
+			}
+			if !slices.Equal(rows[1], want[format]) {
+				t.Errorf("Ada Lovelace = %q, want %q", rows[1], want[format])
+			}
+			if rows[2][0] != "Grace Hopper" || rows[2][2] != "" || rows[2][5] != "" {
+				t.Errorf("Grace Hopper = %q, want no response", rows[2])
+			}
+		})
+	}
+}
+
+func TestExportNeutralizesFormulas(t *testing.T) {
+	guests := []*db.Guest{{Name: "=1+1", PartySize: 1, Notes: "@SUM(A1:A2)", DeclineReason: "-2"}}
+	writers := map[string]func(http.ResponseWriter, []*db.Guest) error{
+		"csv":  writeCSVExport,
+		"xlsx": writeXLSXExport,
+	}
+	// Spreadsheets hold text cells, which are never run as formulas, so their
+	// values are left as they are.
+	want := map[string][]string{
+		"csv":  {"'=1+1", "'@SUM(A1:A2)", "'-2"},
+		"xlsx": {"=1+1", "@SUM(A1:A2)", "-2"},
+	}
+
+	for format, write := range writers {
+		t.Run(format, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			if err := write(rec, guests); err != nil {
+				t.Fatal(err)
+			}
+			rows := exportRows(t, format, rec.Body.Bytes())
+			if len(rows) != 2 {
+				t.Fatalf("rows = %q, want a header and 1 guest", rows)
+			}
+			got := []string{rows[1][0], rows[1][7], rows[1][8]}
+			if !slices.Equal(got, want[format]) {
+				t.Errorf("name, notes and decline reason = %q, want %q", got, want[format])
+			}
+		})
+	}
+}
+
+func TestNeutralizeCell(t *testing.T) {
+	tests := map[string]string{
+		"":             "",
+		"Ada Lovelace": "Ada Lovelace",
+		"=1+1":         "'=1+1",
+		"+1":           "'+1",
+		"-1":           "'-1",
+		"@SUM(A1)":     "'@SUM(A1)",
+		"\t=1":         "'\t=1",
+		"\r=1":         "'\r=1",
+		"a=1":          "a=1",
+	}
+	for value, want := range tests {
+		if got := neutralizeCell(value); got != want {
+			t.Errorf("neutralizeCell(%q) = %q, want %q", value, got, want)
+		}
+	}
+}
+
+func TestExport(t *testing.T) {
+	pool := testPool(t)
+	site := newTestSite(t, pool)
+	event, want := seedExportGuests(t, pool)
+
+	for _, format := range []string{"", "csv", "json", "xlsx"} {
+		t.Run(format, func(t *testing.T) {
+			rec := site.get("/admin/events/"+event.Slug+"/export?format="+format, site.adminSession())
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+			}
+			format := cmp.Or(format, "csv")
+			if got := rec.Header().Get("Content-Type"); got != exportFormats[format] {
+				t.Errorf("Content-Type = %q, want %q", got, exportFormats[format])
+			}
+			if got := rec.Header().Get("Content-Disposition"); !strings.Contains(got, event.Slug+"."+format) {
+				t.Errorf("Content-Disposition = %q, want it to name %s.%s", got, event.Slug, format)
+			}
+			rows := exportRows(t, format, rec.Body.Bytes())
+			if len(rows) != len(want) || rows[1][0] != want[1][0] || rows[2][0] != want[2][0] {
+				t.Errorf("rows = %q, want %q", rows, want)
+			}
+		})
+	}
+}
+
+func TestExportRejectsUnknownFormat(t *testing.T) {
+	site := newTestSite(t, testPool(t))
+	if rec := site.get("/admin/events/garden-party/export?format=pdf", site.adminSession()); rec.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
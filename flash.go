@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"net/http"
+)
+
+// flashCookie carries a message across a redirect, to be shown once on the
+// next page.
+const flashCookie = "rsvp_flash"
+
+// setFlash arranges for msg to be shown on the next page the admin sees.
+func (h *AdminHandler) setFlash(rw http.ResponseWriter, req *http.Request, msg string) {
+	http.SetCookie(rw, h.cfg.newCookie(req, flashCookie, h.sessions.sign(msg)))
+}
+
+// getFlash returns the message left by setFlash, if any, and clears it so
+// that it's only shown once.
+func (s signer) getFlash(rw http.ResponseWriter, req *http.Request, cfg *Config) string {
+	cookie, err := req.Cookie(flashCookie)
+	if err != nil {
+		return ""
+	}
+
+	expired := cfg.newCookie(req, flashCookie, "")
+	expired.MaxAge = -1
+	http.SetCookie(rw, expired)
+
+	msg, _ := s.verify(cookie.Value)
+	return msg
+}
+
+// flashFrom returns the flash message stored in ctx by loadFlash.
+func flashFrom(ctx context.Context) string {
+	msg, _ := ctx.Value(flashKey).(string)
+	return msg
+}
+
+// loadFlash reads any flash message into the request's context for the
+// layout to show. A response that sets a new flash replaces the cleared
+// cookie, since its Set-Cookie header comes later.
+func (s signer) loadFlash(cfg *Config, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if msg := s.getFlash(rw, req, cfg); msg != "" {
+			req = req.WithContext(context.WithValue(req.Context(), flashKey, msg))
+		}
+		next.ServeHTTP(rw, req)
+	})
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestFlashIsShownOnce(t *testing.T) {
+	site := newTestSite(t, unreachablePool(t))
+	const shown = `<p class="flash">You&#39;ve been logged out.</p>`
+
+	rec := site.post("/admin/logout", url.Values{}, site.adminSession())
+	if rec.Code != http.StatusSeeOther {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusSeeOther)
+	}
+	flash := responseCookie(rec, flashCookie)
+	if flash == nil {
+		t.Fatalf("logging out set no %s cookie", flashCookie)
+	}
+
+	rec = site.get("/admin/login", flash)
+	if !strings.Contains(rec.Body.String(), shown) {
+		t.Errorf("the next page doesn't show the flash:\n%s", rec.Body)
+	}
+	if cleared := responseCookie(rec, flashCookie); cleared == nil || cleared.MaxAge >= 0 {
+		t.Errorf("showing the flash didn't clear its cookie: %v", cleared)
+	}
+
+	if body := site.get("/admin/login").Body.String(); strings.Contains(body, `class="flash"`) {
+		t.Errorf("the flash was shown again:\n%s", body)
+	}
+}
+
+func TestFlashRejectsForgedCookies(t *testing.T) {
+	site := newTestSite(t, unreachablePool(t))
+	forged := &http.Cookie{Name: flashCookie, Value: signer{key: []byte("another secret")}.sign("Your account is suspended.")}
+
+	rec := site.get("/admin/login", forged)
+	if strings.Contains(rec.Body.String(), `class="flash"`) {
+		t.Errorf("a forged flash was shown:\n%s", rec.Body)
+	}
+	if cleared := responseCookie(rec, flashCookie); cleared == nil || cleared.MaxAge >= 0 {
+		t.Errorf("the forged cookie wasn't cleared: %v", cleared)
+	}
+}
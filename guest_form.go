@@ -0,0 +1,210 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/meagar/rsvp/db"
+)
+
+// partySizeLimit is the largest party an admin can invite a guest to bring.
+const partySizeLimit = 50
+
+// guestForm holds the guest form's fields as entered, so that they can be
+// redisplayed if they don't validate.
+type guestForm struct {
+	Name         string
+	Email        string
+	MaxPartySize string
+	// Response is "yes", "no", "maybe", or empty for a guest who hasn't
+	// responded.
+	Response string
+}
+
+type guestData struct {
+	adminPage
+	Guest      *db.Guest
+	Event      *db.Event
+	Companions []string
+	Household  *db.Household
+	Members    []*db.Guest
+	Form       guestForm
+	Error      string
+}
+
+func (guestData) PartySizeLimit() int {
+	return partySizeLimit
+}
+
+// newGuestForm fills the form in from an existing guest.
+func newGuestForm(g *db.Guest) guestForm {
+	f := guestForm{Name: g.Name, Email: g.Email, MaxPartySize: strconv.Itoa(g.MaxPartySize)}
+	if g.IsAttending() {
+		f.Response = "yes"
+	} else if g.IsDeclined() {
+		f.Response = "no"
+	} else if g.IsTentative() {
+		f.Response = "maybe"
+	}
+	return f
+}
+
+func parseGuestForm(form url.Values) guestForm {
+	return guestForm{
+		Name:         strings.TrimSpace(form.Get("name")),
+		Email:        strings.TrimSpace(form.Get("email")),
+		MaxPartySize: strings.TrimSpace(form.Get("max_party_size")),
+		Response:     form.Get("response"),
+	}
+}
+
+// apply validates the form and copies it onto g, keeping their party size
+// within the new maximum. Whether they're waitlisted is left to
+// db.UpdateGuest.
+func (f *guestForm) apply(g *db.Guest) error {
+	if f.Name == "" {
+		return errors.New("Please enter a name.")
+	}
+
+	email := ""
+	if f.Email != "" {
+		addr, err := mail.ParseAddress(f.Email)
+		if err != nil {
+			return errors.New("Please enter a valid email address, or leave it blank.")
+		}
+		email = addr.Address
+	}
+
+	maxPartySize, err := strconv.Atoi(f.MaxPartySize)
+	if err != nil || maxPartySize < 1 || maxPartySize > partySizeLimit {
+		return fmt.Errorf("The party size must be a number from 1 to %d.", partySizeLimit)
+	}
+
+	var attendance *db.Attendance
+	if answer := db.Attendance(f.Response); answer.Valid() {
+		attendance = &answer
+	} else if f.Response != "" {
+		return errors.New("Please choose a response.")
+	}
+
+	g.Name = f.Name
+	g.Email = email
+	g.MaxPartySize = maxPartySize
+	g.PartySize = min(max(g.PartySize, 1), maxPartySize)
+	g.Attendance = attendance
+	if !g.IsDeclined() {
+		g.DeclineReason = ""
+	}
+	return nil
+}
+
+// findGuest loads the guest whose id is in the path, rendering a 404 if
+// there isn't one. The guest's event is loaded too, if they still have one.
+func (h *AdminHandler) findGuest(rw http.ResponseWriter, req *http.Request) (*db.Guest, *db.Event) {
+	id, err := strconv.Atoi(req.PathValue("id"))
+	if err != nil {
+		notFound(rw, req)
+		return nil, nil
+	}
+
+	ctx, cancel := h.cfg.queryContext(req)
+	defer cancel()
+
+	guest, err := db.FindGuestById(ctx, h.db, id)
+	if errors.Is(err, db.ErrNotFound) {
+		notFound(rw, req)
+		return nil, nil
+	}
+	if err != nil {
+		serverError(rw, req, err)
+		return nil, nil
+	}
+
+	var event *db.Event
+	if guest.EventId != nil {
+		if event, err = db.FindEventById(ctx, h.db, *guest.EventId); err != nil {
+			serverError(rw, req, err)
+			return nil, nil
+		}
+	}
+	return guest, event
+}
+
+// showGuest shows everything about a guest, with a form to correct their
+// details.
+func (h *AdminHandler) showGuest(rw http.ResponseWriter, req *http.Request) {
+	guest, event := h.findGuest(rw, req)
+	if guest == nil {
+		return
+	}
+
+	h.renderGuest(rw, req, http.StatusOK, guestData{Guest: guest, Event: event, Form: newGuestForm(guest)})
+}
+
+// renderGuest renders the guest page, loading the guest's companions and
+// household.
+func (h *AdminHandler) renderGuest(rw http.ResponseWriter, req *http.Request, status int, data guestData) {
+	ctx, cancel := h.cfg.queryContext(req)
+	defer cancel()
+
+	companions, err := db.ListPlusOneNames(ctx, h.db, data.Guest.Id)
+	if err != nil {
+		serverError(rw, req, err)
+		return
+	}
+
+	if id := data.Guest.HouseholdId; id != nil {
+		if data.Household, err = db.FindHouseholdById(ctx, h.db, *id); err != nil {
+			serverError(rw, req, err)
+			return
+		}
+		if data.Members, err = db.ListHouseholdMembers(ctx, h.db, *id); err != nil {
+			serverError(rw, req, err)
+			return
+		}
+	}
+
+	data.adminPage = h.page(req)
+	data.Companions = companions
+	renderPage(rw, req, status, "admin/guest", data)
+}
+
+// updateGuest saves the guest form. Invalid forms are redisplayed with the
+// problem.
+func (h *AdminHandler) updateGuest(rw http.ResponseWriter, req *http.Request) {
+	existing, event := h.findGuest(rw, req)
+	if existing == nil {
+		return
+	}
+	if err := req.ParseForm(); err != nil {
+		bodyError(rw, err)
+		return
+	}
+
+	form := parseGuestForm(req.PostForm)
+	guest := *existing
+	if err := form.apply(&guest); err != nil {
+		h.renderGuest(rw, req, http.StatusUnprocessableEntity, guestData{Guest: existing, Event: event, Form: form, Error: err.Error()})
+		return
+	}
+
+	ctx, cancel := h.cfg.queryContext(req)
+	defer cancel()
+
+	promoted, err := db.UpdateGuest(ctx, h.db, &guest)
+	if err != nil {
+		serverError(rw, req, err)
+		return
+	}
+	h.audit(req, "guest.update", "guest "+strconv.Itoa(guest.Id), guest.Name)
+	for _, g := range promoted {
+		sendPromotion(req, h.cfg, h.mailer, h.sessions, g, event)
+	}
+	h.setFlash(rw, req, "Saved changes to "+guest.Name+".")
+	http.Redirect(rw, req, h.path+"guests/"+strconv.Itoa(guest.Id), http.StatusSeeOther)
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/meagar/rsvp/db"
+)
+
+func TestShowGuest(t *testing.T) {
+	pool := testPool(t)
+	site := newTestSite(t, pool)
+	event := createTestEvent(t, pool, &db.Event{Title: "Garden Party"})
+	guest := createTestGuest(t, pool, &db.Guest{EventId: &event.Id, Name: "Ada Lovelace", Email: "ada@example.com", MaxPartySize: 3})
+	recordTestResponse(t, pool, guest, db.Response{Attendance: db.AttendanceYes, PartySize: 2, Dietary: "vegetarian"})
+
+	rec := site.get("/admin/guests/"+strconv.Itoa(guest.Id), site.adminSession())
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	body := rec.Body.String()
+	for _, want := range []string{
+		"<h1>Guest: Ada Lovelace</h1>",
+		"<tr><th>Event</th><td>Garden Party</td></tr>",
+		"<td>" + guest.InviteCode + " (",
+		"<tr><th>Response</th><td>Attending</td></tr>",
+		"<tr><th>Party size</th><td>2 of 3</td></tr>",
+		"<tr><th>Dietary</th><td>vegetarian</td></tr>",
+		`name="email" value="ada@example.com"`,
+		`name="max_party_size" min="1" max="50" value="3"`,
+		`value="yes" checked`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("the page doesn't contain %q:\n%s", want, body)
+		}
+	}
+
+	for _, id := range []string{"0", "ada"} {
+		if rec := site.get("/admin/guests/"+id, site.adminSession()); rec.Code != http.StatusNotFound {
+			t.Errorf("guest %s: status = %d, want %d", id, rec.Code, http.StatusNotFound)
+		}
+	}
+}
+
+func TestUpdateGuest(t *testing.T) {
+	pool := testPool(t)
+	site := newTestSite(t, pool)
+	event := createTestEvent(t, pool, &db.Event{})
+	guest := createTestGuest(t, pool, &db.Guest{EventId: &event.Id, Name: "Ada Lovelace", MaxPartySize: 2})
+	path := "/admin/guests/" + strconv.Itoa(guest.Id)
+	form := url.Values{"name": {" Ada King "}, "email": {"Ada <ada@example.com>"}, "max_party_size": {"4"}, "response": {"no"}}
+
+	rec := site.post(path, form, site.adminSession())
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != path {
+		t.Fatalf("status = %d, Location = %q, want a redirect to the guest\n%s", rec.Code, rec.Header().Get("Location"), rec.Body)
+	}
+	saved := reloadGuest(t, pool, guest.Id)
+	if saved.Name != "Ada King" || saved.Email != "ada@example.com" || saved.MaxPartySize != 4 || !saved.IsDeclined() {
+		t.Errorf("saved %q <%s>, max party %d, declined %v", saved.Name, saved.Email, saved.MaxPartySize, saved.IsDeclined())
+	}
+
+	t.Run("invalid", func(t *testing.T) {
+		invalid := url.Values{"name": {"Ada Lovelace"}, "email": {"not an address"}, "max_party_size": {"4"}}
+		rec := site.post(path, invalid, site.adminSession())
+		if rec.Code != http.StatusUnprocessableEntity || !strings.Contains(rec.Body.String(), "Please enter a valid email address") {
+			t.Errorf("status = %d, want %d and the problem:\n%s", rec.Code, http.StatusUnprocessableEntity, rec.Body)
+		}
+		// The form is redisplayed as entered.
+		if !strings.Contains(rec.Body.String(), `value="not an address"`) {
+			t.Errorf("the form doesn't show the email as entered:\n%s", rec.Body)
+		}
+		if unchanged := reloadGuest(t, pool, guest.Id); unchanged.Name != "Ada King" || unchanged.Email != "ada@example.com" {
+			t.Errorf("saved %q <%s> from an invalid form", unchanged.Name, unchanged.Email)
+		}
+	})
+}
+
+func TestGuestFormApply(t *testing.T) {
+	valid := guestForm{Name: "Ada Lovelace", Email: "ada@example.com", MaxPartySize: "3", Response: "yes"}
+
+	tests := []struct {
+		name    string
+		change  func(f *guestForm)
+		wantErr string
+	}{
+		{name: "valid", change: func(f *guestForm) {}},
+		{name: "no email", change: func(f *guestForm) { f.Email = "" }},
+		{name: "pending", change: func(f *guestForm) { f.Response = "" }},
+		{name: "no name", change: func(f *guestForm) { f.Name = "" }, wantErr: "Please enter a name."},
+		{name: "bad email", change: func(f *guestForm) { f.Email = "ada@" }, wantErr: "valid email address"},
+		{name: "party of none", change: func(f *guestForm) { f.MaxPartySize = "0" }, wantErr: "from 1 to 50"},
+		{name: "party too big", change: func(f *guestForm) { f.MaxPartySize = "51" }, wantErr: "from 1 to 50"},
+		{name: "party not a number", change: func(f *guestForm) { f.MaxPartySize = "three" }, wantErr: "from 1 to 50"},
+		{name: "unknown response", change: func(f *guestForm) { f.Response = "perhaps" }, wantErr: "Please choose a response."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := valid
+			tt.change(&form)
+			guest := &db.Guest{Name: "Before", PartySize: 1, MaxPartySize: 1}
+			err := form.apply(guest)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("err = %v, want %q", err, tt.wantErr)
+				}
+				if guest.Name != "Before" {
+					t.Errorf("the guest was changed to %q by an invalid form", guest.Name)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if guest.Name != form.Name || guest.Email != form.Email || strconv.Itoa(guest.MaxPartySize) != form.MaxPartySize {
+				t.Errorf("guest = %q <%s> max %d, want the form's values", guest.Name, guest.Email, guest.MaxPartySize)
+			}
+		})
+	}
+}
+
+func TestGuestFormApplyKeepsPartyWithinMaximum(t *testing.T) {
+	guest := &db.Guest{Name: "Ada", PartySize: 4, MaxPartySize: 4, Attendance: ptr(db.AttendanceNo), DeclineReason: "Away"}
+	form := guestForm{Name: "Ada", MaxPartySize: "2", Response: "yes"}
+	if err := form.apply(guest); err != nil {
+		t.Fatal(err)
+	}
+	if guest.PartySize != 2 || guest.DeclineReason != "" {
+		t.Errorf("PartySize = %d, DeclineReason = %q, want 2 and none", guest.PartySize, guest.DeclineReason)
+	}
+}
+
+func TestGuestTimestamps(t *testing.T) {
+	pool := testPool(t)
+	site := newTestSite(t, pool)
+	event := createTestEvent(t, pool, &db.Event{})
+	before := time.Now().Add(-time.Minute)
+	guest := createTestGuest(t, pool, &db.Guest{EventId: &event.Id, Name: "Ada Lovelace"})
+
+	created := reloadGuest(t, pool, guest.Id)
+	if created.CreatedAt.Before(before) || !created.UpdatedAt.Equal(created.CreatedAt) {
+		t.Fatalf("created at %v and updated at %v, want both set to now", created.CreatedAt, created.UpdatedAt)
+	}
+	if !guest.CreatedAt.Equal(created.CreatedAt) {
+		t.Errorf("createGuest set CreatedAt to %v, but %v was saved", guest.CreatedAt, created.CreatedAt)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	path := "/admin/guests/" + strconv.Itoa(guest.Id)
+	site.post(path, url.Values{"name": {"Ada King"}, "max_party_size": {"1"}}, site.adminSession())
+	edited := reloadGuest(t, pool, guest.Id)
+	if !edited.UpdatedAt.After(created.UpdatedAt) || !edited.CreatedAt.Equal(created.CreatedAt) {
+		t.Errorf("after an edit, created at %v and updated at %v, want only updated at to move on from %v", edited.CreatedAt, edited.UpdatedAt, created.UpdatedAt)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	recordTestResponse(t, pool, guest, db.Response{Attendance: db.AttendanceYes, PartySize: 1})
+	if responded := reloadGuest(t, pool, guest.Id); !responded.UpdatedAt.After(edited.UpdatedAt) {
+		t.Errorf("responding left updated at %v", responded.UpdatedAt)
+	}
+
+	body := site.get(path, site.adminSession()).Body.String()
+	for _, want := range []string{"<th>Added</th>", "<th>Last changed</th>"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("the guest page doesn't show %q:\n%s", want, body)
+		}
+	}
+}
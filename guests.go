@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/meagar/rsvp/db"
+)
+
+// guestsPerPage is how many guests the admin guest list shows at once.
+const guestsPerPage = 25
+
+type guestListData struct {
+	adminPage
+	Event      *db.Event
+	Guests     []*db.Guest
+	Deleted    []*db.Guest
+	Search     string
+	Total      int
+	Page       int
+	TotalPages int
+}
+
+// pageURL links to another page of the list, keeping the current search.
+func (d guestListData) pageURL(page int) string {
+	params := url.Values{"page": {strconv.Itoa(page)}}
+	if d.Search != "" {
+		params.Set("q", d.Search)
+	}
+	return d.AdminPath + "events/" + d.Event.Slug + "/guests?" + params.Encode()
+}
+
+func (d guestListData) PrevURL() string {
+	if d.Page <= 1 {
+		return ""
+	}
+	return d.pageURL(d.Page - 1)
+}
+
+func (d guestListData) NextURL() string {
+	if d.Page >= d.TotalPages {
+		return ""
+	}
+	return d.pageURL(d.Page + 1)
+}
+
+// guests lists an event's guests a page at a time, optionally filtered by a
+// name search in q. Pages past either end are clamped to the first or last.
+func (h *AdminHandler) guests(rw http.ResponseWriter, req *http.Request) {
+	event := findEvent(rw, req, h.cfg, h.db)
+	if event == nil {
+		return
+	}
+
+	search := strings.TrimSpace(req.URL.Query().Get("q"))
+	page, err := strconv.Atoi(req.URL.Query().Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	ctx, cancel := h.cfg.queryContext(req)
+	defer cancel()
+
+	total, err := db.CountEventGuests(ctx, h.reads, event.Id, search)
+	if err != nil {
+		serverError(rw, req, err)
+		return
+	}
+	totalPages := max((total+guestsPerPage-1)/guestsPerPage, 1)
+	page = min(page, totalPages)
+
+	guests, err := db.ListEventGuestsPage(ctx, h.reads, event.Id, search, guestsPerPage, (page-1)*guestsPerPage)
+	if err != nil {
+		serverError(rw, req, err)
+		return
+	}
+
+	deleted, err := db.ListDeletedEventGuests(ctx, h.reads, event.Id)
+	if err != nil {
+		serverError(rw, req, err)
+		return
+	}
+
+	renderPage(rw, req, http.StatusOK, "admin/guests", guestListData{
+		adminPage:  h.page(req),
+		Event:      event,
+		Guests:     guests,
+		Deleted:    deleted,
+		Search:     search,
+		Total:      total,
+		Page:       page,
+		TotalPages: totalPages,
+	})
+}
+
+// deleteGuest removes a guest from their event. Deletion is soft, so that a
+// guest removed by mistake can be restored.
+func (h *AdminHandler) deleteGuest(rw http.ResponseWriter, req *http.Request) {
+	h.changeGuest(rw, req, "guest.delete", "Deleted", db.DeleteGuest)
+}
+
+// restoreGuest brings back a deleted guest.
+func (h *AdminHandler) restoreGuest(rw http.ResponseWriter, req *http.Request) {
+	h.changeGuest(rw, req, "guest.restore", "Restored", db.RestoreGuest)
+}
+
+// changeGuest applies change to the guest whose id is in the path, recording
+// it in the audit log as action, then redirects to their event's guest list
+// with a message saying what was done, like "Deleted".
+func (h *AdminHandler) changeGuest(rw http.ResponseWriter, req *http.Request, action, done string, change func(context.Context, db.TxStarter, int) (*db.Guest, []*db.Guest, error)) {
+	id, err := strconv.Atoi(req.PathValue("id"))
+	if err != nil {
+		notFound(rw, req)
+		return
+	}
+
+	ctx, cancel := h.cfg.queryContext(req)
+	defer cancel()
+
+	guest, promoted, err := change(ctx, h.db, id)
+	if errors.Is(err, db.ErrNotFound) {
+		notFound(rw, req)
+		return
+	}
+	if err != nil {
+		serverError(rw, req, err)
+		return
+	}
+	h.audit(req, action, "guest "+strconv.Itoa(guest.Id), guest.Name)
+	h.setFlash(rw, req, done+" "+guest.Name+".")
+
+	if guest.EventId == nil {
+		http.Redirect(rw, req, h.path, http.StatusSeeOther)
+		return
+	}
+	event, err := db.FindEventById(ctx, h.db, *guest.EventId)
+	if err != nil {
+		serverError(rw, req, err)
+		return
+	}
+	for _, g := range promoted {
+		sendPromotion(req, h.cfg, h.mailer, h.sessions, g, event)
+	}
+	http.Redirect(rw, req, h.path+"events/"+event.Slug+"/guests", http.StatusSeeOther)
+}
+
+// historyEntry is one of a guest's responses, alongside the response it
+// replaced.
+type historyEntry struct {
+	*db.RSVPEvent
+	Previous *db.RSVPEvent
+}
+
+// Changes lists the fields that differ from the previous response.
+func (e historyEntry) Changes() []string {
+	if e.Previous == nil {
+		return nil
+	}
+	var changes []string
+	if e.Attendance != e.Previous.Attendance {
+		changes = append(changes, "attending")
+	}
+	if e.PartySize != e.Previous.PartySize {
+		changes = append(changes, "party size")
+	}
+	if strings.Join(e.PlusOnes, "\n") != strings.Join(e.Previous.PlusOnes, "\n") {
+		changes = append(changes, "companions")
+	}
+	if e.Dietary != e.Previous.Dietary {
+		changes = append(changes, "dietary")
+	}
+	if e.Notes != e.Previous.Notes {
+		changes = append(changes, "notes")
+	}
+	if e.DeclineReason != e.Previous.DeclineReason {
+		changes = append(changes, "decline reason")
+	}
+	if e.Waitlisted != e.Previous.Waitlisted {
+		changes = append(changes, "waitlist")
+	}
+	return changes
+}
+
+// guestHistory shows every response a guest has made, newest first.
+func (h *AdminHandler) guestHistory(rw http.ResponseWriter, req *http.Request) {
+	id, err := strconv.Atoi(req.PathValue("id"))
+	if err != nil {
+		notFound(rw, req)
+		return
+	}
+
+	ctx, cancel := h.cfg.queryContext(req)
+	defer cancel()
+
+	guest, err := db.FindGuestById(ctx, h.db, id)
+	if errors.Is(err, db.ErrNotFound) {
+		notFound(rw, req)
+		return
+	}
+	if err != nil {
+		serverError(rw, req, err)
+		return
+	}
+
+	events, err := db.ListRSVPEvents(ctx, h.reads, guest.Id)
+	if err != nil {
+		serverError(rw, req, err)
+		return
+	}
+
+	history := make([]historyEntry, len(events))
+	for i, e := range events {
+		entry := historyEntry{RSVPEvent: e}
+		if i > 0 {
+			entry.Previous = events[i-1]
+		}
+		history[len(events)-1-i] = entry
+	}
+
+	renderPage(rw, req, http.StatusOK, "admin/history", struct {
+		adminPage
+		Guest   *db.Guest
+		History []historyEntry
+	}{adminPage: h.page(req), Guest: guest, History: history})
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/meagar/rsvp/db"
+)
+
+// guestListNames matches the names in the admin guest list.
+var guestListNames = regexp.MustCompile(`<td><a href="/admin/guests/\d+">([^<]*)</a></td>`)
+
+// listGuests returns the names on a page of event's guest list, requested
+// with params.
+func (s *testSite) listGuests(t *testing.T, event *db.Event, params url.Values) []string {
+	t.Helper()
+	rec := s.get("/admin/events/"+event.Slug+"/guests?"+params.Encode(), s.adminSession())
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	var names []string
+	for _, match := range guestListNames.FindAllStringSubmatch(rec.Body.String(), -1) {
+		names = append(names, match[1])
+	}
+	return names
+}
+
+// guestNames returns the test guest names numbered from to to.
+func guestNames(from, to int) []string {
+	var names []string
+	for i := from; i <= to; i++ {
+		names = append(names, fmt.Sprintf("Guest %02d", i))
+	}
+	return names
+}
+
+func TestGuestListPages(t *testing.T) {
+	pool := testPool(t)
+	site := newTestSite(t, pool)
+	event := createTestEvent(t, pool, &db.Event{})
+	// Insert out of order, to check that the list is sorted by name.
+	for i := range 50 {
+		createTestGuest(t, pool, &db.Guest{Name: fmt.Sprintf("Guest %02d", i*7%50+1), EventId: &event.Id})
+	}
+
+	tests := []struct {
+		name   string
+		params url.Values
+		want   []string
+	}{
+		{name: "first page", params: url.Values{}, want: guestNames(1, 25)},
+		{name: "second page", params: url.Values{"page": {"2"}}, want: guestNames(26, 50)},
+		{name: "past the end", params: url.Values{"page": {"9"}}, want: guestNames(26, 50)},
+		{name: "before the start", params: url.Values{"page": {"-1"}}, want: guestNames(1, 25)},
+		{name: "not a number", params: url.Values{"page": {"two"}}, want: guestNames(1, 25)},
+		{name: "search", params: url.Values{"q": {"guest 1"}}, want: guestNames(10, 19)},
+		{name: "search past the end", params: url.Values{"q": {"guest 1"}, "page": {"2"}}, want: guestNames(10, 19)},
+		{name: "search for a wildcard", params: url.Values{"q": {"%"}}, want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := site.listGuests(t, event, tt.params); !slices.Equal(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGuestListPageURLs(t *testing.T) {
+	data := guestListData{
+		adminPage:  adminPage{AdminPath: "/admin/"},
+		Event:      &db.Event{Slug: "garden-party"},
+		Search:     "ada lovelace",
+		Page:       2,
+		TotalPages: 3,
+	}
+	if got, want := data.PrevURL(), "/admin/events/garden-party/guests?page=1&q=ada+lovelace"; got != want {
+		t.Errorf("PrevURL() = %q, want %q", got, want)
+	}
+	if got, want := data.NextURL(), "/admin/events/garden-party/guests?page=3&q=ada+lovelace"; got != want {
+		t.Errorf("NextURL() = %q, want %q", got, want)
+	}
+
+	data.Page = 1
+	if got := data.PrevURL(); got != "" {
+		t.Errorf("on the first page, PrevURL() = %q", got)
+	}
+	data.Page = 3
+	if got := data.NextURL(); got != "" {
+		t.Errorf("on the last page, NextURL() = %q", got)
+	}
+}
+
+func TestDeleteAndRestoreGuest(t *testing.T) {
+	pool := testPool(t)
+	site := newTestSite(t, pool)
+	event := createTestEvent(t, pool, &db.Event{})
+	ada := createTestGuest(t, pool, &db.Guest{EventId: &event.Id, Name: "Ada Lovelace"})
+	createTestGuest(t, pool, &db.Guest{EventId: &event.Id, Name: "Grace Hopper"})
+	guestPath := "/admin/guests/" + strconv.Itoa(ada.Id)
+
+	lookups := map[string]string{
+		"scoped":   site.sessions.rsvpPath(ada, event),
+		"unscoped": site.sessions.rsvpPath(ada, nil),
+		"query":    "/rsvp?" + site.sessions.rsvpParams(ada, nil),
+	}
+	checkLookups := func(t *testing.T, want int) {
+		t.Helper()
+		for name, path := range lookups {
+			if rec := site.get(path); rec.Code != want {
+				t.Errorf("%s lookup: status = %d, want %d", name, rec.Code, want)
+			}
+		}
+	}
+
+	t.Run("deleted", func(t *testing.T) {
+		rec := site.post(guestPath+"/delete", nil, site.adminSession())
+		if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/admin/events/"+event.Slug+"/guests" {
+			t.Fatalf("status = %d, Location = %q, want a redirect to the guest list", rec.Code, rec.Header().Get("Location"))
+		}
+		checkLookups(t, http.StatusNotFound)
+		if got := site.listGuests(t, event, nil); !slices.Equal(got, []string{"Grace Hopper"}) {
+			t.Errorf("guest list = %v, want only Grace Hopper", got)
+		}
+		// The guest is kept, so that they can be restored.
+		if saved := reloadGuest(t, pool, ada.Id); saved.DeletedAt == nil {
+			t.Error("deleted_at wasn't set")
+		}
+	})
+
+	t.Run("restored", func(t *testing.T) {
+		if rec := site.post(guestPath+"/restore", nil, site.adminSession()); rec.Code != http.StatusSeeOther {
+			t.Fatalf("status = %d, want %d", rec.Code, http.StatusSeeOther)
+		}
+		checkLookups(t, http.StatusOK)
+		if got := site.listGuests(t, event, nil); !slices.Equal(got, []string{"Ada Lovelace", "Grace Hopper"}) {
+			t.Errorf("guest list = %v, want both guests", got)
+		}
+		if saved := reloadGuest(t, pool, ada.Id); saved.DeletedAt != nil {
+			t.Errorf("deleted_at = %v, want it cleared", *saved.DeletedAt)
+		}
+	})
+
+	t.Run("unknown guest", func(t *testing.T) {
+		for _, action := range []string{"delete", "restore"} {
+			if rec := site.post("/admin/guests/0/"+action, nil, site.adminSession()); rec.Code != http.StatusNotFound {
+				t.Errorf("%s: status = %d, want %d", action, rec.Code, http.StatusNotFound)
+			}
+		}
+	})
+}
+
+func TestGuestHistory(t *testing.T) {
+	pool := testPool(t)
+	site := newTestSite(t, pool)
+	event := createTestEvent(t, pool, &db.Event{})
+	guest := createTestGuest(t, pool, &db.Guest{EventId: &event.Id, Name: "Ada Lovelace", MaxPartySize: 2})
+
+	responses := []url.Values{
+		{"attending": {"yes"}, "party_size": {"2"}, "companion": {"Charles Babbage"}, "dietary": {"vegetarian"}},
+		{"attending": {"no"}, "decline_reason": {"Out of town"}},
+	}
+	for _, fields := range responses {
+		if rec := site.post("/rsvp", rsvpForm(site, guest, event, fields)); rec.Code != http.StatusSeeOther {
+			t.Fatalf("status = %d, want %d\n%s", rec.Code, http.StatusSeeOther, rec.Body)
+		}
+	}
+
+	events, err := db.ListRSVPEvents(context.Background(), pool, guest.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("got %d history rows, want 2", len(events))
+	}
+	first, second := events[0], events[1]
+	if first.Attendance != db.AttendanceYes || first.PartySize != 2 || !slices.Equal(first.PlusOnes, []string{"Charles Babbage"}) || first.Dietary != "vegetarian" {
+		t.Errorf("first row = %+v, want yes for 2 with Charles Babbage, vegetarian", first)
+	}
+	// Declining keeps the party size, but not the companions.
+	if second.Attendance != db.AttendanceNo || second.PartySize != 2 || second.DeclineReason != "Out of town" || len(second.PlusOnes) != 0 {
+		t.Errorf("second row = %+v, want no for 2, out of town", second)
+	}
+	if second.CreatedAt.Before(first.CreatedAt) {
+		t.Errorf("second row was created at %v, before the first at %v", second.CreatedAt, first.CreatedAt)
+	}
+
+	rec := site.get("/admin/guests/"+strconv.Itoa(guest.Id)+"/history", site.adminSession())
+	if rec.Code != http.StatusOK {
+		t.Fatalf("history page: status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	body := rec.Body.String()
+	declined := strings.Index(body, "<td>Declined</td>")
+	attending := strings.Index(body, "<td>Attending</td>")
+	if declined < 0 || attending < 0 || declined > attending {
+		t.Errorf("the history page doesn't list the decline before the acceptance:\n%s", body)
+	}
+	for _, want := range []string{"<td>attending, companions, dietary, decline reason</td>", "<td>first response</td>"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("the history page doesn't contain %q:\n%s", want, body)
+		}
+	}
+}
+
+func TestHistoryEntryChanges(t *testing.T) {
+	previous := &db.RSVPEvent{Attendance: db.AttendanceYes, PartySize: 2, PlusOnes: []string{"Charles Babbage"}, Dietary: "vegetarian"}
+
+	tests := []struct {
+		name    string
+		current db.RSVPEvent
+		want    []string
+	}{
+		{name: "nothing", current: *previous, want: nil},
+		{name: "companion renamed", current: db.RSVPEvent{Attendance: db.AttendanceYes, PartySize: 2, PlusOnes: []string{"Mary Somerville"}, Dietary: "vegetarian"}, want: []string{"companions"}},
+		{name: "notes added", current: db.RSVPEvent{Attendance: db.AttendanceYes, PartySize: 2, PlusOnes: []string{"Charles Babbage"}, Dietary: "vegetarian", Notes: "Running late"}, want: []string{"notes"}},
+		{name: "waitlisted", current: db.RSVPEvent{Attendance: db.AttendanceYes, PartySize: 2, PlusOnes: []string{"Charles Babbage"}, Dietary: "vegetarian", Waitlisted: true}, want: []string{"waitlist"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry := historyEntry{RSVPEvent: &tt.current, Previous: previous}
+			if got := entry.Changes(); !slices.Equal(got, tt.want) {
+				t.Errorf("Changes() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if got := (historyEntry{RSVPEvent: previous}).Changes(); got != nil {
+		t.Errorf("the first response's Changes() = %v, want none", got)
+	}
+}
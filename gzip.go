@@ -0,0 +1,132 @@
+package main
+
+import (
+	"compress/gzip"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// compressibleTypes are the media types worth gzipping, matched as prefixes.
+// Everything else, like images and fonts, is assumed to be compressed
+// already.
+var compressibleTypes = []string{
+	"text/",
+	"application/json",
+	"application/javascript",
+	"application/xml",
+	"image/svg+xml",
+}
+
+func compressible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, t := range compressibleTypes {
+		if strings.HasPrefix(mediaType, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// acceptsGzip reports whether the client will accept a gzipped response.
+func acceptsGzip(req *http.Request) bool {
+	for _, part := range strings.Split(req.Header.Get("Accept-Encoding"), ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if !strings.EqualFold(strings.TrimSpace(coding), "gzip") {
+			continue
+		}
+		q, ok := strings.CutPrefix(strings.TrimSpace(params), "q=")
+		if !ok {
+			return true
+		}
+		weight, err := strconv.ParseFloat(q, 64)
+		return err == nil && weight > 0
+	}
+	return false
+}
+
+// gzipWriter decides whether to compress a response once its headers are
+// complete, which is when the status is written.
+type gzipWriter struct {
+	http.ResponseWriter
+	accepted bool
+	decided  bool
+	gz       *gzip.Writer
+}
+
+func (w *gzipWriter) WriteHeader(status int) {
+	if !w.decided {
+		w.decided = true
+		w.decide(status)
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *gzipWriter) decide(status int) {
+	h := w.Header()
+	if !compressible(h.Get("Content-Type")) {
+		return
+	}
+	h.Add("Vary", "Accept-Encoding")
+
+	switch {
+	case !w.accepted, h.Get("Content-Encoding") != "", h.Get("Content-Range") != "":
+	case status < http.StatusOK, status == http.StatusNoContent, status == http.StatusNotModified:
+	default:
+		h.Del("Content-Length")
+		h.Set("Content-Encoding", "gzip")
+		w.gz = gzip.NewWriter(w.ResponseWriter)
+	}
+}
+
+func (w *gzipWriter) Write(b []byte) (int, error) {
+	if !w.decided {
+		// Without a Content-Type, the server would sniff one from the
+		// body, so do the same here to judge whether it's compressible.
+		if w.Header().Get("Content-Type") == "" {
+			w.Header().Set("Content-Type", http.DetectContentType(b))
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.gz != nil {
+		return w.gz.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (w *gzipWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// started reports whether the response's status has been written.
+func (w *gzipWriter) started() bool {
+	return w.decided
+}
+
+// close flushes the rest of a compressed response.
+func (w *gzipWriter) close() error {
+	if w.gz == nil {
+		return nil
+	}
+	return w.gz.Close()
+}
+
+// gzipResponses compresses responses for clients that accept gzip, if their
+// content type is compressible and they aren't encoded already. Responses
+// that could be compressed say so with Vary, so caches keep both versions.
+func gzipResponses(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		gw := &gzipWriter{ResponseWriter: rw, accepted: acceptsGzip(req)}
+		defer func() {
+			if err := gw.close(); err != nil {
+				loggerFrom(req.Context()).Warn("Finishing compressed response failed", "error", err)
+			}
+		}()
+		next.ServeHTTP(gw, req)
+	})
+}
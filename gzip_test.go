@@ -0,0 +1,118 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAcceptsGzip(t *testing.T) {
+	tests := []struct {
+		header string
+		want   bool
+	}{
+		{header: "", want: false},
+		{header: "gzip", want: true},
+		{header: "deflate, gzip;q=0.8, br", want: true},
+		{header: "GZIP", want: true},
+		{header: "gzip;q=0", want: false},
+		{header: "gzip;q=nonsense", want: false},
+		{header: "br, deflate", want: false},
+		{header: "x-gzip", want: false},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Accept-Encoding", tt.header)
+		if got := acceptsGzip(req); got != tt.want {
+			t.Errorf("acceptsGzip(%q) = %v, want %v", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestGzipResponses(t *testing.T) {
+	page := strings.Repeat("<p>You're invited!</p>\n", 100)
+
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		header         http.Header
+		status         int
+		wantGzip       bool
+		wantVary       bool
+	}{
+		{name: "accepted", acceptEncoding: "gzip", header: http.Header{"Content-Type": {"text/html; charset=utf-8"}}, wantGzip: true, wantVary: true},
+		{name: "not accepted", header: http.Header{"Content-Type": {"text/html; charset=utf-8"}}, wantVary: true},
+		{name: "sniffed type", acceptEncoding: "gzip", header: http.Header{}, wantGzip: true, wantVary: true},
+		{name: "image", acceptEncoding: "gzip", header: http.Header{"Content-Type": {"image/png"}}},
+		{name: "already encoded", acceptEncoding: "gzip", header: http.Header{"Content-Type": {"text/css"}, "Content-Encoding": {"br"}}, wantVary: true},
+		{name: "not modified", acceptEncoding: "gzip", header: http.Header{"Content-Type": {"text/css"}}, status: http.StatusNotModified, wantVary: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := gzipResponses(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+				for name, values := range tt.header {
+					rw.Header()[name] = values
+				}
+				if tt.status != 0 {
+					rw.WriteHeader(tt.status)
+					return
+				}
+				io.WriteString(rw, page)
+			}))
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			gzipped := rec.Header().Get("Content-Encoding") == "gzip"
+			if gzipped != tt.wantGzip {
+				t.Errorf("Content-Encoding = %q, want gzip: %v", rec.Header().Get("Content-Encoding"), tt.wantGzip)
+			}
+			if vary := rec.Header().Get("Vary") == "Accept-Encoding"; vary != tt.wantVary {
+				t.Errorf("Vary = %q, want Accept-Encoding: %v", rec.Header().Get("Vary"), tt.wantVary)
+			}
+			if tt.status != 0 {
+				return
+			}
+
+			var body io.Reader = rec.Body
+			if gzipped {
+				gz, err := gzip.NewReader(rec.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				body = gz
+			}
+			if got, err := io.ReadAll(body); err != nil || string(got) != page {
+				t.Errorf("body = %q, %v, want the page", got, err)
+			}
+		})
+	}
+}
+
+func TestPagesAreGzipped(t *testing.T) {
+	site := newTestSite(t, unreachablePool(t))
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/login", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := site.serve(req)
+	if rec.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("Content-Encoding = %q, want gzip", rec.Header().Get("Content-Encoding"))
+	}
+	gz, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body, _ := io.ReadAll(gz); !strings.Contains(string(body), "<form") {
+		t.Errorf("the decompressed page has no login form:\n%s", body)
+	}
+
+	if rec := site.get("/admin/login"); rec.Header().Get("Content-Encoding") != "" || !strings.Contains(rec.Body.String(), "<form") {
+		t.Errorf("without Accept-Encoding: Content-Encoding = %q, want an uncompressed page", rec.Header().Get("Content-Encoding"))
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// contentSecurityPolicy builds the Content-Security-Policy header. Everything
+// is limited to this site, except that scripts, styles, images and fonts may
+// also come from staticOrigin when static assets are served from elsewhere.
+// Images may also come from any HTTPS URL, for events' background images, and
+// inline styles carrying styleNonce are allowed, for events' themes.
+func contentSecurityPolicy(staticOrigin, styleNonce string) string {
+	assets := "'self'"
+	if staticOrigin != "" {
+		assets += " " + staticOrigin
+	}
+	return strings.Join([]string{
+		"default-src 'self'",
+		"script-src " + assets,
+		"style-src " + assets + " 'nonce-" + styleNonce + "'",
+		"img-src " + assets + " data: https:",
+		"font-src " + assets,
+		"object-src 'none'",
+		"base-uri 'self'",
+		"form-action 'self'",
+		"frame-ancestors 'none'",
+	}, "; ")
+}
+
+// styleNonceFrom returns the nonce stored in ctx by securityHeaders, which
+// inline <style> elements must carry.
+func styleNonceFrom(ctx context.Context) string {
+	nonce, _ := ctx.Value(styleNonceKey).(string)
+	return nonce
+}
+
+// securityHeaders sets headers on every response that tell browsers to
+// enforce the content security policy, not to sniff content types, never to
+// frame the site, and to send only the origin when following links off it.
+// Each response gets its own style nonce.
+func securityHeaders(staticOrigin string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		nonce, err := newNonce()
+		if err != nil {
+			serverError(rw, req, err)
+			return
+		}
+
+		h := rw.Header()
+		h.Set("Content-Security-Policy", contentSecurityPolicy(staticOrigin, nonce))
+		h.Set("X-Content-Type-Options", "nosniff")
+		h.Set("X-Frame-Options", "DENY")
+		h.Set("Referrer-Policy", "strict-origin-when-cross-origin")
+		next.ServeHTTP(rw, req.WithContext(context.WithValue(req.Context(), styleNonceKey, nonce)))
+	})
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// cspDirectives splits a Content-Security-Policy header into each directive's
+// sources.
+func cspDirectives(header string) map[string][]string {
+	directives := map[string][]string{}
+	for _, directive := range strings.Split(header, ";") {
+		fields := strings.Fields(directive)
+		if len(fields) > 0 {
+			directives[fields[0]] = fields[1:]
+		}
+	}
+	return directives
+}
+
+func TestSecurityHeaders(t *testing.T) {
+	site := newTestSite(t, unreachablePool(t))
+	want := map[string]string{
+		"X-Content-Type-Options": "nosniff",
+		"X-Frame-Options":        "DENY",
+		"Referrer-Policy":        "strict-origin-when-cross-origin",
+	}
+
+	for _, path := range []string{"/admin/login", "/static/css/style.css", "/no/such/page"} {
+		t.Run(path, func(t *testing.T) {
+			rec := site.get(path)
+			for name, value := range want {
+				if got := rec.Header().Get(name); got != value {
+					t.Errorf("%s = %q, want %q", name, got, value)
+				}
+			}
+			csp := cspDirectives(rec.Header().Get("Content-Security-Policy"))
+			if !slices.Equal(csp["default-src"], []string{"'self'"}) || !slices.Equal(csp["frame-ancestors"], []string{"'none'"}) {
+				t.Errorf("Content-Security-Policy = %q", rec.Header().Get("Content-Security-Policy"))
+			}
+		})
+	}
+}
+
+func TestContentSecurityPolicy(t *testing.T) {
+	tests := []struct {
+		name         string
+		staticOrigin string
+		wantAssets   []string
+	}{
+		{name: "this site", wantAssets: []string{"'self'"}},
+		{name: "CDN", staticOrigin: "https://cdn.example.com", wantAssets: []string{"'self'", "https://cdn.example.com"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			csp := cspDirectives(contentSecurityPolicy(tt.staticOrigin, "abc123"))
+			for _, directive := range []string{"script-src", "style-src", "img-src", "font-src"} {
+				for _, source := range tt.wantAssets {
+					if !slices.Contains(csp[directive], source) {
+						t.Errorf("%s = %v, want it to allow %s", directive, csp[directive], source)
+					}
+				}
+			}
+			if !slices.Contains(csp["style-src"], "'nonce-abc123'") {
+				t.Errorf("style-src = %v, want the nonce", csp["style-src"])
+			}
+			if slices.Contains(csp["script-src"], "'unsafe-inline'") || slices.Contains(csp["style-src"], "'unsafe-inline'") {
+				t.Errorf("the policy allows any inline code: %v", csp)
+			}
+			if !slices.Equal(csp["default-src"], []string{"'self'"}) || !slices.Equal(csp["object-src"], []string{"'none'"}) {
+				t.Errorf("default-src = %v, object-src = %v", csp["default-src"], csp["object-src"])
+			}
+		})
+	}
+}
+
+// The stylesheet linked from every page has to be allowed by the policy sent
+// with it, whether it's served from /static/ here or by a CDN.
+func TestContentSecurityPolicyAllowsStaticAssets(t *testing.T) {
+	tests := []struct {
+		name         string
+		staticOrigin string
+		wantHref     string
+		wantSource   string
+	}{
+		{name: "this site", wantHref: "/static/css/style.css", wantSource: "'self'"},
+		{name: "CDN", staticOrigin: "https://cdn.example.com", wantHref: "https://cdn.example.com/static/css/style.css", wantSource: "https://cdn.example.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("STATIC_ORIGIN", tt.staticOrigin)
+			site := newTestSite(t, unreachablePool(t))
+
+			rec := site.get("/admin/login")
+			if want := `<link rel="stylesheet" href="` + tt.wantHref + `">`; !strings.Contains(rec.Body.String(), want) {
+				t.Errorf("the page doesn't contain %q:\n%s", want, rec.Body)
+			}
+			if csp := cspDirectives(rec.Header().Get("Content-Security-Policy")); !slices.Contains(csp["style-src"], tt.wantSource) {
+				t.Errorf("style-src = %v, want it to allow %s", csp["style-src"], tt.wantSource)
+			}
+		})
+	}
+}
+
+func TestStyleNonce(t *testing.T) {
+	handler := securityHeaders("", http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Write([]byte(styleNonceFrom(req.Context())))
+	}))
+
+	var nonces []string
+	for range 2 {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		nonce := rec.Body.String()
+		if nonce == "" {
+			t.Fatal("no nonce")
+		}
+		if csp := cspDirectives(rec.Header().Get("Content-Security-Policy")); !slices.Contains(csp["style-src"], "'nonce-"+nonce+"'") {
+			t.Errorf("style-src = %v, want the request's nonce %s", csp["style-src"], nonce)
+		}
+		nonces = append(nonces, nonce)
+	}
+	if nonces[0] == nonces[1] {
+		t.Errorf("two responses had the same nonce, %s", nonces[0])
+	}
+}
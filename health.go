@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/meagar/rsvp/db"
+)
+
+const readyTimeout = 2 * time.Second
+
+type HealthHandler struct {
+	db *db.Pool
+	// reads is the read replica's pool, or db if there isn't one.
+	reads *db.Pool
+}
+
+// live reports that the process is up and serving requests.
+func (h *HealthHandler) live(rw http.ResponseWriter, req *http.Request) {
+	rw.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	rw.Write([]byte("ok\n"))
+}
+
+// ready reports whether the database, and the read replica if there is one,
+// are reachable.
+func (h *HealthHandler) ready(rw http.ResponseWriter, req *http.Request) {
+	ctx, cancel := context.WithTimeout(req.Context(), readyTimeout)
+	defer cancel()
+
+	rw.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	err := h.db.Ping(ctx)
+	if err == nil && h.reads != h.db {
+		err = h.reads.Ping(ctx)
+	}
+	if err != nil {
+		loggerFrom(ctx).Warn("Readiness check failed", "error", err)
+		rw.WriteHeader(http.StatusServiceUnavailable)
+		rw.Write([]byte("database unavailable\n"))
+		return
+	}
+	rw.Write([]byte("ok\n"))
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestHealthz(t *testing.T) {
+	pool := unreachablePool(t)
+	site := newTestSite(t, pool)
+	pool.Close()
+
+	rec := site.get("/healthz")
+	if rec.Code != http.StatusOK || rec.Body.String() != "ok\n" {
+		t.Errorf("got %d %q, want %d %q", rec.Code, rec.Body, http.StatusOK, "ok\n")
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	pool := testPool(t)
+	site := newTestSite(t, pool)
+
+	if rec := site.get("/readyz"); rec.Code != http.StatusOK {
+		t.Errorf("with the pool open: status = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	pool.Close()
+	if rec := site.get("/readyz"); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("with the pool closed: status = %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+}
+
+func TestReadyzWithoutDatabase(t *testing.T) {
+	site := newTestSite(t, unreachablePool(t))
+
+	if rec := site.get("/readyz"); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+}
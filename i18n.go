@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//go:embed messages/*.json
+var messagesFS embed.FS
+
+// defaultLanguage is used when a visitor asks for no language we know, and
+// for any message missing from another language's catalog.
+const defaultLanguage = "en"
+
+// langCookie remembers a language chosen with ?lang=.
+const langCookie = "rsvp_lang"
+
+// catalogs maps each language code to its messages, keyed by message name.
+var catalogs map[string]map[string]string
+
+// loadMessages reads every messages/{lang}.json catalog into catalogs.
+func loadMessages() {
+	var err error
+	if catalogs, err = parseMessages(messagesFS); err != nil {
+		fatal("Loading messages failed", "error", err)
+	}
+	if _, ok := catalogs[defaultLanguage]; !ok {
+		fatal("No messages for the default language", "language", defaultLanguage)
+	}
+}
+
+func parseMessages(fsys fs.FS) (map[string]map[string]string, error) {
+	files, err := fs.Glob(fsys, "messages/*.json")
+	if err != nil {
+		return nil, err
+	}
+
+	parsed := map[string]map[string]string{}
+	for _, file := range files {
+		b, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+		messages := map[string]string{}
+		if err := json.Unmarshal(b, &messages); err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		parsed[strings.TrimSuffix(path.Base(file), ".json")] = messages
+	}
+	return parsed, nil
+}
+
+// languageFrom returns the language chosen for the request by
+// detectLanguage.
+func languageFrom(ctx context.Context) string {
+	if lang, ok := ctx.Value(languageKey).(string); ok {
+		return lang
+	}
+	return defaultLanguage
+}
+
+// translate looks up the named message in lang, falling back to the default
+// language and then to the key itself. Any args are formatted into the
+// message with fmt.Sprintf.
+func translate(lang, key string, args ...any) string {
+	msg, ok := catalogs[lang][key]
+	if !ok {
+		msg, ok = catalogs[defaultLanguage][key]
+	}
+	if !ok {
+		return key
+	}
+	if len(args) > 0 {
+		return fmt.Sprintf(msg, args...)
+	}
+	return msg
+}
+
+// detectLanguage picks the language to render the request in: lang in the
+// query string, which is remembered in a cookie, or else the cookie, or else
+// the best supported match in Accept-Language. Dates and numbers are
+// formatted for the locale Accept-Language prefers, which needn't have
+// messages of its own, so a de-DE browser reads English with German dates.
+// A language chosen with lang overrides the locale, unless the locale is a
+// regional variant of it.
+func detectLanguage(cfg *Config, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		header := req.Header.Get("Accept-Language")
+		lang, chosen := "", false
+		if param := req.URL.Query().Get("lang"); supportedLanguage(param) {
+			lang, chosen = param, true
+			http.SetCookie(rw, cfg.newCookie(req, langCookie, lang))
+		} else if cookie, err := req.Cookie(langCookie); err == nil && supportedLanguage(cookie.Value) {
+			lang, chosen = cookie.Value, true
+		} else {
+			lang = acceptedLanguage(header)
+		}
+
+		locale := acceptedLocale(header)
+		if base, _, _ := strings.Cut(locale, "-"); chosen && base != lang {
+			locale = lang
+		}
+
+		ctx := context.WithValue(req.Context(), languageKey, lang)
+		ctx = context.WithValue(ctx, localeKey, locale)
+		next.ServeHTTP(rw, req.WithContext(ctx))
+	})
+}
+
+func supportedLanguage(lang string) bool {
+	_, ok := catalogs[lang]
+	return ok
+}
+
+// acceptedTags returns the language tags in an Accept-Language header, most
+// preferred first, leaving out any with a weight of zero.
+func acceptedTags(header string) []string {
+	type choice struct {
+		tag string
+		q   float64
+	}
+	var choices []choice
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			var err error
+			if q, err = strconv.ParseFloat(value, 64); err != nil {
+				continue
+			}
+		}
+		if tag = strings.TrimSpace(tag); tag != "" && tag != "*" && q > 0 {
+			choices = append(choices, choice{tag: tag, q: q})
+		}
+	}
+
+	sort.SliceStable(choices, func(i, j int) bool { return choices[i].q > choices[j].q })
+	tags := make([]string, len(choices))
+	for i, c := range choices {
+		tags[i] = c.tag
+	}
+	return tags
+}
+
+// acceptedLanguage returns the supported language the Accept-Language header
+// prefers most, matching regional variants like fr-CA to their base
+// language.
+func acceptedLanguage(header string) string {
+	for _, tag := range acceptedTags(header) {
+		if base, _, _ := strings.Cut(strings.ToLower(tag), "-"); supportedLanguage(base) {
+			return base
+		}
+	}
+	return defaultLanguage
+}
+
+// acceptedLocale returns the tag the Accept-Language header prefers most out
+// of those there's a date format for, whether or not there are messages in
+// its language.
+func acceptedLocale(header string) string {
+	for _, tag := range acceptedTags(header) {
+		if hasLocaleFormat(tag) {
+			return tag
+		}
+	}
+	return defaultLanguage
+}
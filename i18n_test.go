@@ -0,0 +1,208 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/meagar/rsvp/db"
+)
+
+func TestAcceptedLanguage(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{header: "", want: "en"},
+		{header: "fr", want: "fr"},
+		{header: "fr-CA,fr;q=0.9,en;q=0.8", want: "fr"},
+		{header: "FR-ca", want: "fr"},
+		{header: "en;q=0.5,fr;q=0.9", want: "fr"},
+		{header: "de-DE,fr;q=0.7,en;q=0.8", want: "en"},
+		{header: "de-DE,ja", want: "en"},
+		{header: "fr;q=0,en", want: "en"},
+		{header: "fr;q=nonsense,en", want: "en"},
+		{header: "*", want: "en"},
+	}
+	for _, tt := range tests {
+		if got := acceptedLanguage(tt.header); got != tt.want {
+			t.Errorf("acceptedLanguage(%q) = %q, want %q", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestTranslate(t *testing.T) {
+	defer func(saved map[string]map[string]string) { catalogs = saved }(catalogs)
+	catalogs = map[string]map[string]string{
+		"en": {"greeting": "Hello, %s", "farewell": "Goodbye"},
+		"fr": {"greeting": "Bonjour, %s"},
+	}
+
+	tests := []struct {
+		lang, key string
+		args      []any
+		want      string
+	}{
+		{lang: "en", key: "greeting", args: []any{"Ada"}, want: "Hello, Ada"},
+		{lang: "fr", key: "greeting", args: []any{"Ada"}, want: "Bonjour, Ada"},
+		{lang: "fr", key: "farewell", want: "Goodbye"},
+		{lang: "de", key: "greeting", args: []any{"Ada"}, want: "Hello, Ada"},
+		{lang: "fr", key: "missing", want: "missing"},
+	}
+	for _, tt := range tests {
+		if got := translate(tt.lang, tt.key, tt.args...); got != tt.want {
+			t.Errorf("translate(%q, %q) = %q, want %q", tt.lang, tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestParseMessages(t *testing.T) {
+	fsys := fstest.MapFS{
+		"messages/en.json": {Data: []byte(`{"form.yes": "Yes"}`)},
+		"messages/fr.json": {Data: []byte(`{"form.yes": "Oui"}`)},
+	}
+	parsed, err := parseMessages(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := parsed["fr"]["form.yes"]; got != "Oui" {
+		t.Errorf(`fr "form.yes" = %q, want "Oui"`, got)
+	}
+
+	fsys["messages/de.json"] = &fstest.MapFile{Data: []byte(`{"form.yes": `)}
+	if _, err := parseMessages(fsys); err == nil || !strings.Contains(err.Error(), "messages/de.json") {
+		t.Errorf("err = %v, want an error naming messages/de.json", err)
+	}
+}
+
+// Every catalog should translate every message, rather than quietly falling
+// back to English for the ones it's missing.
+func TestCatalogsHaveEveryMessage(t *testing.T) {
+	for lang, messages := range catalogs {
+		for key := range catalogs[defaultLanguage] {
+			if _, ok := messages[key]; !ok {
+				t.Errorf("%s has no %q message", lang, key)
+			}
+		}
+		for key := range messages {
+			if _, ok := catalogs[defaultLanguage][key]; !ok {
+				t.Errorf("%s has a %q message that %s hasn't", lang, key, defaultLanguage)
+			}
+		}
+	}
+}
+
+func TestDetectLanguage(t *testing.T) {
+	handler := detectLanguage(&Config{}, http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Write([]byte(languageFrom(req.Context())))
+	}))
+
+	tests := []struct {
+		name       string
+		target     string
+		header     string
+		cookie     string
+		want       string
+		wantCookie bool
+	}{
+		{name: "default", target: "/", want: "en"},
+		{name: "Accept-Language", target: "/", header: "fr-CA,fr;q=0.9", want: "fr"},
+		{name: "cookie", target: "/", header: "en", cookie: "fr", want: "fr"},
+		{name: "unsupported cookie", target: "/", header: "fr", cookie: "xx", want: "fr"},
+		{name: "lang parameter", target: "/?lang=en", header: "fr", cookie: "fr", want: "en", wantCookie: true},
+		{name: "unsupported lang parameter", target: "/?lang=xx", header: "fr", want: "fr"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			if tt.header != "" {
+				req.Header.Set("Accept-Language", tt.header)
+			}
+			if tt.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: langCookie, Value: tt.cookie})
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if got := rec.Body.String(); got != tt.want {
+				t.Errorf("language = %q, want %q", got, tt.want)
+			}
+
+			cookie := responseCookie(rec, langCookie)
+			if tt.wantCookie {
+				if cookie == nil || cookie.Value != tt.want {
+					t.Errorf("%s cookie = %v, want %q", langCookie, cookie, tt.want)
+				}
+			} else if cookie != nil {
+				t.Errorf("set a %s cookie of %q", langCookie, cookie.Value)
+			}
+		})
+	}
+}
+
+func TestRSVPFormLanguages(t *testing.T) {
+	pool := testPool(t)
+	site := newTestSite(t, pool)
+	event := createTestEvent(t, pool, &db.Event{})
+	guest := createTestGuest(t, pool, &db.Guest{EventId: &event.Id, Name: "Ada Lovelace"})
+	path := "/rsvp?" + site.sessions.rsvpParams(guest, event)
+
+	tests := []struct {
+		name     string
+		path     string
+		header   string
+		want     []string
+		dontWant []string
+	}{
+		{
+			name:     "English",
+			path:     path,
+			header:   "en-GB,en;q=0.9",
+			want:     []string{`<html lang="en">`, "Hello, Ada Lovelace", "Send RSVP"},
+			dontWant: []string{"Bonjour"},
+		},
+		{
+			name:     "French",
+			path:     path,
+			header:   "fr-CA,fr;q=0.9,en;q=0.8",
+			want:     []string{`<html lang="fr">`, "Bonjour, Ada Lovelace", "Envoyer ma réponse", "Oui", "Non"},
+			dontWant: []string{"Hello, Ada", "Send RSVP"},
+		},
+		{
+			name:     "chosen over Accept-Language",
+			path:     path + "&lang=en",
+			header:   "fr-CA,fr;q=0.9",
+			want:     []string{`<html lang="en">`, "Hello, Ada Lovelace"},
+			dontWant: []string{"Bonjour"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.Header.Set("Accept-Language", tt.header)
+			rec := site.serve(req)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+			}
+			body := rec.Body.String()
+			for _, want := range tt.want {
+				if !strings.Contains(body, want) {
+					t.Errorf("the form doesn't contain %q:\n%s", want, body)
+				}
+			}
+			for _, dontWant := range tt.dontWant {
+				if strings.Contains(body, dontWant) {
+					t.Errorf("the form contains %q", dontWant)
+				}
+			}
+		})
+	}
+
+	t.Run("remembered", func(t *testing.T) {
+		cookie := &http.Cookie{Name: langCookie, Value: "fr"}
+		if body := site.get(path, cookie).Body.String(); !strings.Contains(body, "Bonjour, Ada Lovelace") {
+			t.Errorf("the form isn't in French with a %s cookie of fr:\n%s", langCookie, body)
+		}
+	})
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/meagar/rsvp/db"
+)
+
+// icalTimeFormat is the RFC 5545 UTC date-time form.
+const icalTimeFormat = "20060102T150405Z"
+
+// maxICalLineLength is the longest a content line may be, in octets,
+// excluding the line break.
+const maxICalLineLength = 75
+
+var icalTextEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	";", `\;`,
+	",", `\,`,
+	"\r\n", `\n`,
+	"\r", `\n`,
+	"\n", `\n`,
+)
+
+// eventICS returns an iCalendar document holding a single VEVENT for event,
+// whose page is at eventURL.
+func eventICS(event *db.Event, eventURL string, now time.Time) string {
+	host := eventURL
+	if u, err := url.Parse(eventURL); err == nil && u.Host != "" {
+		host = u.Host
+	}
+
+	var b strings.Builder
+	line := func(name, value string) {
+		b.WriteString(foldICalLine(name + ":" + value))
+	}
+
+	line("BEGIN", "VCALENDAR")
+	line("VERSION", "2.0")
+	line("PRODID", "-//meagar//rsvp//EN")
+	line("CALSCALE", "GREGORIAN")
+	line("METHOD", "PUBLISH")
+	line("BEGIN", "VEVENT")
+	line("UID", fmt.Sprintf("event-%d@%s", event.Id, host))
+	line("DTSTAMP", now.UTC().Format(icalTimeFormat))
+	line("DTSTART", event.Date.UTC().Format(icalTimeFormat))
+	line("DTEND", event.End().UTC().Format(icalTimeFormat))
+	line("SUMMARY", icalTextEscaper.Replace(event.Title))
+	if event.Location != "" {
+		line("LOCATION", icalTextEscaper.Replace(event.Location))
+	}
+	if event.Description != "" {
+		line("DESCRIPTION", icalTextEscaper.Replace(event.Description))
+	}
+	line("URL", eventURL)
+	line("END", "VEVENT")
+	line("END", "VCALENDAR")
+	return b.String()
+}
+
+// foldICalLine terminates a content line with CRLF, folding it onto
+// continuation lines (which begin with a space) so that no line exceeds
+// maxICalLineLength octets. Multi-byte characters are never split.
+func foldICalLine(s string) string {
+	var b strings.Builder
+	limit := maxICalLineLength
+	for len(s) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		b.WriteString(s[:cut])
+		b.WriteString("\r\n ")
+		s = s[cut:]
+		// The leading space counts towards the continuation line's length.
+		limit = maxICalLineLength - 1
+	}
+	b.WriteString(s)
+	b.WriteString("\r\n")
+	return b.String()
+}
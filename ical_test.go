@@ -0,0 +1,145 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/meagar/rsvp/db"
+)
+
+// parseICS unfolds an iCalendar document's lines and returns the value of
+// each property, failing t if any line is longer than RFC 5545 allows.
+func parseICS(t *testing.T, doc string) map[string]string {
+	t.Helper()
+	if !strings.HasSuffix(doc, "\r\n") {
+		t.Fatalf("document isn't terminated by CRLF:\n%q", doc)
+	}
+	var lines []string
+	for _, line := range strings.Split(strings.TrimSuffix(doc, "\r\n"), "\r\n") {
+		if len(line) > maxICalLineLength {
+			t.Errorf("line is %d octets long: %q", len(line), line)
+		}
+		if strings.HasPrefix(line, " ") && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+
+	props := make(map[string]string)
+	for _, line := range lines {
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			t.Fatalf("line has no value: %q", line)
+		}
+		if name != "BEGIN" && name != "END" {
+			props[name] = value
+		}
+	}
+	return props
+}
+
+func TestEventICS(t *testing.T) {
+	toronto, err := time.LoadLocation("America/Toronto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	event := &db.Event{
+		Id:       7,
+		Title:    "Launch party; bring friends, " + strings.Repeat("and snacks ", 10),
+		Date:     time.Date(2030, time.June, 1, 18, 30, 0, 0, toronto),
+		Location: "Café Lumière, 12 Rue Saint-Denis",
+	}
+	now := time.Date(2030, time.May, 1, 12, 0, 0, 0, time.UTC)
+	props := parseICS(t, eventICS(event, "https://rsvp.example.com/e/launch", now))
+
+	want := map[string]string{
+		"UID":      "event-7@rsvp.example.com",
+		"DTSTAMP":  "20300501T120000Z",
+		"DTSTART":  "20300601T223000Z",
+		"DTEND":    "20300602T003000Z",
+		"SUMMARY":  `Launch party\; bring friends\, ` + strings.Repeat("and snacks ", 10),
+		"LOCATION": `Café Lumière\, 12 Rue Saint-Denis`,
+		"URL":      "https://rsvp.example.com/e/launch",
+	}
+	for name, value := range want {
+		if props[name] != value {
+			t.Errorf("%s = %q, want %q", name, props[name], value)
+		}
+	}
+	if _, ok := props["DESCRIPTION"]; ok {
+		t.Error("DESCRIPTION is present for an event without one")
+	}
+}
+
+func TestEventICSEscapesLineBreaks(t *testing.T) {
+	event := &db.Event{
+		Id:          7,
+		Title:       "Launch\rX-INJECTED:title",
+		Date:        time.Date(2030, time.June, 1, 18, 30, 0, 0, time.UTC),
+		Location:    "Hall\r\nBack room",
+		Description: "One\rTwo\nThree",
+	}
+	doc := eventICS(event, "https://rsvp.example.com/e/launch", time.Now())
+	if strings.Contains(strings.ReplaceAll(doc, "\r\n", ""), "\r") {
+		t.Fatalf("document has a bare CR:\n%q", doc)
+	}
+	props := parseICS(t, doc)
+
+	want := map[string]string{
+		"SUMMARY":     `Launch\nX-INJECTED:title`,
+		"LOCATION":    `Hall\nBack room`,
+		"DESCRIPTION": `One\nTwo\nThree`,
+	}
+	for name, value := range want {
+		if props[name] != value {
+			t.Errorf("%s = %q, want %q", name, props[name], value)
+		}
+	}
+	if _, ok := props["X-INJECTED"]; ok {
+		t.Error("a CR in the title started a new property")
+	}
+}
+
+func TestFoldICalLineKeepsCharactersWhole(t *testing.T) {
+	line := "DESCRIPTION:" + strings.Repeat("é", 100)
+	folded := foldICalLine(line)
+	for _, part := range strings.Split(strings.TrimSuffix(folded, "\r\n"), "\r\n ") {
+		if len(part) > maxICalLineLength {
+			t.Errorf("line is %d octets long", len(part))
+		}
+		if !strings.HasPrefix(part, "DESCRIPTION") && !strings.HasPrefix(part, "é") {
+			t.Errorf("line starts mid-character: %q", part)
+		}
+	}
+	if unfolded := strings.ReplaceAll(strings.TrimSuffix(folded, "\r\n"), "\r\n ", ""); unfolded != line {
+		t.Errorf("unfolded line = %q, want %q", unfolded, line)
+	}
+}
+
+func TestEventICSDownload(t *testing.T) {
+	pool := testPool(t)
+	site := newTestSite(t, pool)
+	event := createTestEvent(t, pool, &db.Event{Title: "Garden Party", Location: "The Garden"})
+
+	rec := site.get("/e/" + event.Slug + "/event.ics")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	if got := rec.Header().Get("Content-Type"); !strings.HasPrefix(got, "text/calendar") {
+		t.Errorf("Content-Type = %q, want text/calendar", got)
+	}
+	props := parseICS(t, rec.Body.String())
+	if want := event.Date.UTC().Format(icalTimeFormat); props["DTSTART"] != want {
+		t.Errorf("DTSTART = %q, want %q", props["DTSTART"], want)
+	}
+	if props["SUMMARY"] != "Garden Party" || props["LOCATION"] != "The Garden" {
+		t.Errorf("SUMMARY = %q and LOCATION = %q", props["SUMMARY"], props["LOCATION"])
+	}
+
+	if rec := site.get("/e/no-such-event/event.ics"); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown event: status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/meagar/rsvp/db"
+)
+
+var importColumns = []string{"name", "email", "party_size"}
+
+// importFailure describes a row of an import that couldn't be used.
+type importFailure struct {
+	Line  int
+	Row   []string
+	Error string
+}
+
+// importGuests creates a guest, with a generated invite code, for each row of
+// an uploaded CSV with columns name, email and party_size. Rows that fail
+// validation are reported and skipped rather than aborting the import. An
+// optional household column puts the guests that share a value in the same
+// household.
+func (h *AdminHandler) importGuests(rw http.ResponseWriter, req *http.Request) {
+	event := findEvent(rw, req, h.cfg, h.db)
+	if event == nil {
+		return
+	}
+
+	if !parseUpload(rw, req, int64(h.cfg.MaxUploadSize)) {
+		return
+	}
+	file, _, err := req.FormFile("file")
+	if err != nil {
+		http.Error(rw, "Please choose a CSV file to import", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	ctx, cancel := context.WithTimeout(req.Context(), importTimeout)
+	defer cancel()
+
+	imported, failures, err := importCSV(ctx, h.db, event, file, h.cfg.InviteCodeLength)
+	var fileErr importFileError
+	if errors.As(err, &fileErr) {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		serverError(rw, req, err)
+		return
+	}
+	h.audit(req, "event.import", "event "+event.Slug, fmt.Sprintf("imported %d, skipped %d", imported, len(failures)))
+
+	renderPage(rw, req, http.StatusOK, "admin/import", struct {
+		adminPage
+		Event    *db.Event
+		Imported int
+		Failures []importFailure
+	}{adminPage: h.page(req), Event: event, Imported: imported, Failures: failures})
+}
+
+// importFileError is a problem with an import's file as a whole, as opposed
+// to one of its rows or saving it.
+type importFileError struct {
+	error
+}
+
+// importTimeout bounds a whole import through the admin site, which makes a
+// few queries for each row.
+var importTimeout = 2 * time.Minute
+
+// importCSV creates the guests listed in file for event, as described by
+// importGuests, returning how many were imported and the rows that were
+// skipped. Errors about the file itself are importFileErrors. The guests are
+// created in one transaction, so an import that fails partway creates none
+// of them and can simply be tried again.
+func importCSV(ctx context.Context, pool db.TxStarter, event *db.Event, file io.Reader, codeLength int) (imported int, failures []importFailure, err error) {
+	err = pgx.BeginFunc(ctx, pool, func(tx pgx.Tx) error {
+		imported, failures, err = importRows(ctx, tx, event, file, codeLength)
+		return err
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+	return imported, failures, nil
+}
+
+// importRows does the work of importCSV using q.
+func importRows(ctx context.Context, q db.Querier, event *db.Event, file io.Reader, codeLength int) (int, []importFailure, error) {
+	r := csv.NewReader(file)
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+
+	header, err := r.Read()
+	if err != nil {
+		return 0, nil, importFileError{errors.New("The file is empty or not a CSV")}
+	}
+	columns, err := importColumnIndexes(header)
+	if err != nil {
+		return 0, nil, importFileError{err}
+	}
+
+	defaultSize := 1
+	if event.MaxPartySize != nil {
+		defaultSize = *event.MaxPartySize
+	}
+
+	imported := 0
+	var failures []importFailure
+	households := map[string]int{}
+	for {
+		row, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			failures = append(failures, importFailure{Line: parseErr.StartLine, Error: parseErr.Err.Error()})
+			continue
+		}
+		if err != nil {
+			return imported, failures, importFileError{err}
+		}
+		line, _ := r.FieldPos(0)
+
+		guest, household, err := importRow(row, columns, defaultSize)
+		if err != nil {
+			failures = append(failures, importFailure{Line: line, Row: row, Error: err.Error()})
+			continue
+		}
+		guest.EventId = &event.Id
+		if household != "" {
+			id, ok := households[household]
+			if !ok {
+				hh, err := db.FindOrCreateHousehold(ctx, q, event.Id, household)
+				if err != nil {
+					return imported, failures, fmt.Errorf("importing line %d: %w", line, err)
+				}
+				id = hh.Id
+				households[household] = id
+			}
+			guest.HouseholdId = &id
+		}
+		if err := createGuest(ctx, q, guest, codeLength); err != nil {
+			return imported, failures, fmt.Errorf("importing line %d: %w", line, err)
+		}
+		imported++
+	}
+	return imported, failures, nil
+}
+
+// importColumnIndexes maps each expected column to its position in header.
+func importColumnIndexes(header []string) (map[string]int, error) {
+	indexes := map[string]int{}
+	for i, name := range header {
+		indexes[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range importColumns {
+		if _, ok := indexes[name]; !ok {
+			return nil, fmt.Errorf("The CSV is missing a %q column; expected columns %s", name, strings.Join(importColumns, ", "))
+		}
+	}
+	return indexes, nil
+}
+
+// importRow validates one row of a guest import, returning the guest and the
+// name of their household, if any. Guests without a party_size are invited
+// with defaultSize.
+func importRow(row []string, columns map[string]int, defaultSize int) (*db.Guest, string, error) {
+	field := func(name string) string {
+		if i, ok := columns[name]; ok && i < len(row) {
+			return strings.TrimSpace(row[i])
+		}
+		return ""
+	}
+
+	guest := &db.Guest{Name: field("name"), Email: field("email")}
+	if guest.Name == "" {
+		return nil, "", errors.New("name is required")
+	}
+	if guest.Email != "" {
+		addr, err := mail.ParseAddress(guest.Email)
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid email %q", guest.Email)
+		}
+		guest.Email = addr.Address
+	}
+
+	partySize := defaultSize
+	if s := field("party_size"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			return nil, "", fmt.Errorf("party_size must be a whole number of at least 1, got %q", s)
+		}
+		partySize = n
+	}
+	guest.PartySize = partySize
+	guest.MaxPartySize = partySize
+	return guest, field("household"), nil
+}
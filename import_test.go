@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/meagar/rsvp/db"
+)
+
+// postImport uploads csv to event's import as the admin would.
+func (s *testSite) postImport(t *testing.T, event *db.Event, csv string) *httptest.ResponseRecorder {
+	t.Helper()
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	part, err := w.CreateFormFile("file", "guests.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write([]byte(csv))
+	w.WriteField(csrfField, testCSRFToken)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/admin/events/"+event.Slug+"/import", &body)
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	req.AddCookie(&http.Cookie{Name: csrfCookie, Value: testCSRFToken})
+	req.AddCookie(s.adminSession())
+	return s.serve(req)
+}
+
+func TestImportGuests(t *testing.T) {
+	pool := testPool(t)
+	site := newTestSite(t, pool)
+	event := createTestEvent(t, pool, &db.Event{})
+
+	rec := site.postImport(t, event, "name,email,party_size\n"+
+		"Ada Lovelace,ada@example.com,2\n"+
+		"Grace Hopper,,\n"+
+		"\"Turing, Alan\",Alan Turing <alan@example.com>,1\n")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d\n%s", rec.Code, http.StatusOK, rec.Body)
+	}
+	if body := rec.Body.String(); !strings.Contains(body, "Imported 3 guests") || strings.Contains(body, "couldn't be imported") {
+		t.Errorf("the page doesn't report 3 guests imported:\n%s", body)
+	}
+
+	guests, err := db.ListEventGuests(context.Background(), pool, event.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]struct {
+		email     string
+		partySize int
+	}{
+		"Ada Lovelace": {"ada@example.com", 2},
+		"Grace Hopper": {"", 1},
+		"Turing, Alan": {"alan@example.com", 1},
+	}
+	if len(guests) != len(want) {
+		t.Fatalf("imported %d guests, want %d", len(guests), len(want))
+	}
+	codes := map[string]bool{}
+	for _, guest := range guests {
+		w, ok := want[guest.Name]
+		if !ok {
+			t.Errorf("unexpected guest %q", guest.Name)
+		} else if guest.Email != w.email || guest.MaxPartySize != w.partySize {
+			t.Errorf("%s: email %q and party size %d, want %q and %d", guest.Name, guest.Email, guest.MaxPartySize, w.email, w.partySize)
+		}
+		if guest.InviteCode == "" || codes[guest.InviteCode] {
+			t.Errorf("%s: invite code %q is empty or shared", guest.Name, guest.InviteCode)
+		}
+		codes[guest.InviteCode] = true
+	}
+}
+
+func TestImportGuestsSkipsInvalidRows(t *testing.T) {
+	pool := testPool(t)
+	site := newTestSite(t, pool)
+	event := createTestEvent(t, pool, &db.Event{})
+
+	rec := site.postImport(t, event, "name,email,party_size\n"+
+		"Ada Lovelace,ada@example.com,2\n"+
+		"Grace Hopper,not an email,1\n"+
+		"Alan Turing,,\"two\n"+
+		"")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d\n%s", rec.Code, http.StatusOK, rec.Body)
+	}
+	body := rec.Body.String()
+	for _, want := range []string{"Imported 1 guest.", `invalid email &#34;not an email&#34;`, "<td>4</td>"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("the page doesn't contain %q:\n%s", want, body)
+		}
+	}
+
+	guests, err := db.ListEventGuests(context.Background(), pool, event.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(guests) != 1 || guests[0].Name != "Ada Lovelace" {
+		t.Errorf("imported %d guests, want only Ada Lovelace", len(guests))
+	}
+}
+
+func TestImportGuestsUseEventMaxPartySize(t *testing.T) {
+	pool := testPool(t)
+	site := newTestSite(t, pool)
+	event := createTestEvent(t, pool, &db.Event{MaxPartySize: ptr(4)})
+
+	rec := site.postImport(t, event, "name,email,party_size\nAda Lovelace,,\nGrace Hopper,,2\n")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d\n%s", rec.Code, http.StatusOK, rec.Body)
+	}
+
+	guests, err := db.ListEventGuests(context.Background(), pool, event.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sizes := map[string]int{}
+	for _, guest := range guests {
+		sizes[guest.Name] = guest.MaxPartySize
+	}
+	if sizes["Ada Lovelace"] != 4 || sizes["Grace Hopper"] != 2 {
+		t.Errorf("imported party sizes %v, want the event's 4 for Ada Lovelace and 2 for Grace Hopper", sizes)
+	}
+}
+
+func TestImportGuestsMissingColumn(t *testing.T) {
+	pool := testPool(t)
+	site := newTestSite(t, pool)
+	event := createTestEvent(t, pool, &db.Event{})
+
+	rec := site.postImport(t, event, "name,party_size\nAda Lovelace,2\n")
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), `"email" column`) {
+		t.Errorf("got %d: %s, want a 400 naming the missing column", rec.Code, rec.Body)
+	}
+}
+
+func TestImportRow(t *testing.T) {
+	columns, err := importColumnIndexes([]string{"Name", " email ", "party_size", "household"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		row           []string
+		wantName      string
+		wantEmail     string
+		wantSize      int
+		wantHousehold string
+		wantErr       string
+	}{
+		{row: []string{"Ada", "ada@example.com", "3", "Lovelaces"}, wantName: "Ada", wantEmail: "ada@example.com", wantSize: 3, wantHousehold: "Lovelaces"},
+		{row: []string{" Grace ", "Grace <grace@example.com>", ""}, wantName: "Grace", wantEmail: "grace@example.com", wantSize: 2},
+		{row: []string{"Alan"}, wantName: "Alan", wantSize: 2},
+		{row: []string{"", "nobody@example.com", "1"}, wantErr: "name is required"},
+		{row: []string{"Ada", "ada@", "1"}, wantErr: "invalid email"},
+		{row: []string{"Ada", "", "0"}, wantErr: "party_size must be"},
+		{row: []string{"Ada", "", "2.5"}, wantErr: "party_size must be"},
+	}
+	for _, tt := range tests {
+		guest, household, err := importRow(tt.row, columns, 2)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("importRow(%q) returned error %v, want one containing %q", tt.row, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("importRow(%q) returned error %v", tt.row, err)
+			continue
+		}
+		if guest.Name != tt.wantName || guest.Email != tt.wantEmail || guest.PartySize != tt.wantSize || guest.MaxPartySize != tt.wantSize || household != tt.wantHousehold {
+			t.Errorf("importRow(%q) = %q, %q, %d, household %q", tt.row, guest.Name, guest.Email, guest.PartySize, household)
+		}
+	}
+}
+
+func TestImportColumnIndexesRequiresEveryColumn(t *testing.T) {
+	if _, err := importColumnIndexes([]string{"name", "email"}); err == nil || !strings.Contains(err.Error(), `"party_size"`) {
+		t.Errorf("got error %v, want one naming party_size", err)
+	}
+}
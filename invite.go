@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"fmt"
+
+	"github.com/meagar/rsvp/db"
+)
+
+// maxInviteCodeAttempts bounds how many codes are tried before giving up on
+// inserting a guest.
+const maxInviteCodeAttempts = 5
+
+// inviteCodeEncoding uses only upper-case letters and the digits 2-7, which
+// are URL-safe and hard to confuse when read off a printed invitation.
+var inviteCodeEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// generateInviteCode returns a random, URL-safe invite code of length
+// characters, each of which carries 5 bits of randomness.
+func generateInviteCode(length int) (string, error) {
+	b := make([]byte, (length*5+7)/8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return inviteCodeEncoding.EncodeToString(b)[:length], nil
+}
+
+// inviteSignatureLength is how many characters of the HMAC invite links
+// carry; 22 characters hold 128 bits.
+const inviteSignatureLength = 22
+
+// inviteSignature returns the signature for links to the invitation with the
+// given code.
+func (s signer) inviteSignature(code string) string {
+	return s.mac("invite|" + code)[:inviteSignatureLength]
+}
+
+// validInviteSignature reports whether sig is acceptable for code, which it
+// is if it's correct or, unless required is set, missing. Requiring
+// signatures means invitations can't be found by guessing codes. An
+// ephemeral signer can't check signatures made before a restart, so it
+// ignores them.
+func (s signer) validInviteSignature(code, sig string, required bool) bool {
+	if sig == "" || s.ephemeral {
+		return !required
+	}
+	return hmac.Equal([]byte(sig), []byte(s.inviteSignature(code)))
+}
+
+// createGuest inserts guest with a freshly generated invite code of
+// codeLength characters, retrying with a new code if it collides with an
+// existing one.
+func createGuest(ctx context.Context, q db.Querier, guest *db.Guest, codeLength int) error {
+	for attempt := 0; attempt < maxInviteCodeAttempts; attempt++ {
+		code, err := generateInviteCode(codeLength)
+		if err != nil {
+			return err
+		}
+		guest.InviteCode = code
+
+		err = db.CreateGuest(ctx, q, guest)
+		if !errors.Is(err, db.ErrInviteCodeTaken) {
+			return err
+		}
+	}
+	return fmt.Errorf("no unique invite code found after %d attempts", maxInviteCodeAttempts)
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/meagar/rsvp/db"
+)
+
+// base32Alphabet is every character inviteCodeEncoding uses.
+const base32Alphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZ234567"
+
+func TestValidInviteSignature(t *testing.T) {
+	sessions := signer{key: []byte(testSessionSecret)}
+	sig := sessions.inviteSignature("ABC123")
+	tampered := []byte(sig)
+	tampered[0] ^= 1
+
+	tests := []struct {
+		name      string
+		signer    signer
+		code, sig string
+		require   bool
+		want      bool
+	}{
+		{name: "valid", signer: sessions, code: "ABC123", sig: sig, want: true},
+		{name: "tampered", signer: sessions, code: "ABC123", sig: string(tampered)},
+		{name: "another code's", signer: sessions, code: "ABC124", sig: sig},
+		{name: "another key's", signer: signer{key: []byte("another secret")}, code: "ABC123", sig: sig},
+		{name: "missing", signer: sessions, code: "ABC123", want: true},
+		{name: "missing when required", signer: sessions, code: "ABC123", require: true},
+		{name: "ephemeral", signer: signer{key: []byte("restarted"), ephemeral: true}, code: "ABC123", sig: sig, want: true},
+		{name: "ephemeral when required", signer: signer{key: []byte("restarted"), ephemeral: true}, code: "ABC123", sig: sig, require: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.signer.validInviteSignature(tt.code, tt.sig, tt.require); got != tt.want {
+				t.Errorf("validInviteSignature(%q, %q, %v) = %v, want %v", tt.code, tt.sig, tt.require, got, tt.want)
+			}
+		})
+	}
+}
+
+// Signatures are checked before looking the code up, which would fail here
+// since the database is unreachable.
+func TestInvalidInviteSignaturesAreForbidden(t *testing.T) {
+	t.Setenv("REQUIRE_SIGNED_INVITES", "true")
+	site := newTestSite(t, unreachablePool(t))
+	sig := site.sessions.inviteSignature("ABC123")
+
+	for _, path := range []string{
+		"/rsvp/ABC123",
+		"/rsvp/ABC123?sig=" + sig[1:],
+		"/rsvp?code=ABC124&sig=" + sig,
+	} {
+		if rec := site.get(path); rec.Code != http.StatusForbidden {
+			t.Errorf("GET %s: status = %d, want %d", path, rec.Code, http.StatusForbidden)
+		}
+	}
+
+	rec := site.get("/api/rsvp/ABC124?sig=" + sig)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("API: status = %d, want %d", rec.Code, http.StatusForbidden)
+	}
+	if body := decodeJSON(t, rec); body["code"] != "invalid_signature" {
+		t.Errorf("API: body = %v, want an invalid_signature error", body)
+	}
+}
+
+func TestSignedInviteLinks(t *testing.T) {
+	t.Setenv("REQUIRE_SIGNED_INVITES", "true")
+	pool := testPool(t)
+	site := newTestSite(t, pool)
+	event := createTestEvent(t, pool, &db.Event{})
+	guest := createTestGuest(t, pool, &db.Guest{EventId: &event.Id, Name: "Ada Lovelace"})
+
+	path := site.sessions.rsvpPath(guest, event)
+	if !strings.Contains(path, "sig="+site.sessions.inviteSignature(guest.InviteCode)) {
+		t.Fatalf("rsvpPath = %q, want a signed link", path)
+	}
+	if rec := site.get(path); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "Hello, Ada Lovelace") {
+		t.Errorf("a signed link: got %d, want the form\n%s", rec.Code, rec.Body)
+	}
+	if rec := site.get("/rsvp/" + guest.InviteCode + "?event=" + event.Slug); rec.Code != http.StatusForbidden {
+		t.Errorf("an unsigned link: status = %d, want %d", rec.Code, http.StatusForbidden)
+	}
+}
+
+func TestGenerateInviteCode(t *testing.T) {
+	for _, length := range []int{10, 16, 32} {
+		seen := map[string]bool{}
+		for range 10000 {
+			code, err := generateInviteCode(length)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(code) != length {
+				t.Fatalf("code %q is %d characters long, want %d", code, len(code), length)
+			}
+			if strings.Trim(code, base32Alphabet) != "" || url.PathEscape(code) != code || url.QueryEscape(code) != code {
+				t.Fatalf("code %q isn't URL-safe", code)
+			}
+			if seen[code] {
+				t.Fatalf("code %q was generated twice", code)
+			}
+			seen[code] = true
+		}
+	}
+}
+
+func TestCreateGuestGivesUpWhenEveryCodeIsTaken(t *testing.T) {
+	pool := testPool(t)
+	ctx := context.Background()
+
+	// With one-character codes, taking each of them leaves none to find.
+	for _, c := range base32Alphabet {
+		if err := db.CreateGuest(ctx, pool, &db.Guest{Name: "Taken", InviteCode: string(c), PartySize: 1, MaxPartySize: 1}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := db.CreateGuest(ctx, pool, &db.Guest{Name: "Duplicate", InviteCode: "A", PartySize: 1, MaxPartySize: 1})
+	if !errors.Is(err, db.ErrInviteCodeTaken) {
+		t.Fatalf("inserting a taken code returned %v, want ErrInviteCodeTaken", err)
+	}
+
+	guest := &db.Guest{Name: "Ada Lovelace", PartySize: 1, MaxPartySize: 1}
+	if err := createGuest(ctx, pool, guest, 1); err == nil || !strings.Contains(err.Error(), "no unique invite code") {
+		t.Errorf("createGuest returned %v, want it to give up", err)
+	}
+	if guest.Id != 0 {
+		t.Errorf("the guest was inserted with id %d", guest.Id)
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+)
+
+// localeFormat is how dates are written in a locale. The layouts are Go time
+// layouts whose English month and weekday names are swapped for the locale's
+// own, so that each locale can put the day, month and year in its own order.
+type localeFormat struct {
+	date string
+	// dateTime is date with the time of day, and the zone abbreviation for
+	// guests in other time zones.
+	dateTime string
+	// months and weekdays are the names to use, from January and Sunday;
+	// nil means the English names.
+	months   []string
+	weekdays []string
+}
+
+var (
+	frenchMonths   = []string{"janvier", "février", "mars", "avril", "mai", "juin", "juillet", "août", "septembre", "octobre", "novembre", "décembre"}
+	frenchWeekdays = []string{"dimanche", "lundi", "mardi", "mercredi", "jeudi", "vendredi", "samedi"}
+	germanMonths   = []string{"Januar", "Februar", "März", "April", "Mai", "Juni", "Juli", "August", "September", "Oktober", "November", "Dezember"}
+	germanWeekdays = []string{"Sonntag", "Montag", "Dienstag", "Mittwoch", "Donnerstag", "Freitag", "Samstag"}
+)
+
+// localeFormats are keyed by language, or by language and region where a
+// region writes dates differently from the rest.
+var localeFormats = map[string]localeFormat{
+	"en":    {date: "January 2, 2006", dateTime: "Monday, January 2, 2006 at 3:04 PM MST"},
+	"en-GB": {date: "2 January 2006", dateTime: "Monday 2 January 2006 at 15:04 MST"},
+	"en-AU": {date: "2 January 2006", dateTime: "Monday 2 January 2006 at 3:04 PM MST"},
+	"fr":    {date: "2 January 2006", dateTime: "Monday 2 January 2006 à 15:04 MST", months: frenchMonths, weekdays: frenchWeekdays},
+	"fr-CA": {date: "2 January 2006", dateTime: "Monday 2 January 2006 à 15 h 04 MST", months: frenchMonths, weekdays: frenchWeekdays},
+	"de":    {date: "2. January 2006", dateTime: "Monday, 2. January 2006 um 15:04 MST", months: germanMonths, weekdays: germanWeekdays},
+	"ja":    {date: "2006年1月2日", dateTime: "2006年1月2日 15:04 MST"},
+}
+
+// localeFrom returns the locale chosen for the request by detectLanguage.
+func localeFrom(ctx context.Context) string {
+	if locale, ok := ctx.Value(localeKey).(string); ok {
+		return locale
+	}
+	return defaultLanguage
+}
+
+// parseLocale parses a BCP 47 tag like de-DE, falling back to the default
+// language if it isn't one.
+func parseLocale(locale string) language.Tag {
+	tag, err := language.Parse(locale)
+	if err != nil {
+		return language.Make(defaultLanguage)
+	}
+	return tag
+}
+
+// formatFor returns the date format for locale, preferring one for its
+// region, then its language, then the default language's.
+func formatFor(locale string) localeFormat {
+	tag := parseLocale(locale)
+	base, _ := tag.Base()
+	if region, conf := tag.Region(); conf == language.Exact {
+		if f, ok := localeFormats[base.String()+"-"+region.String()]; ok {
+			return f
+		}
+	}
+	if f, ok := localeFormats[base.String()]; ok {
+		return f
+	}
+	return localeFormats[defaultLanguage]
+}
+
+// hasLocaleFormat reports whether formatFor has a format of its own for
+// locale, rather than falling back to the default language's.
+func hasLocaleFormat(locale string) bool {
+	tag, err := language.Parse(locale)
+	if err != nil {
+		return false
+	}
+	base, _ := tag.Base()
+	_, ok := localeFormats[base.String()]
+	return ok
+}
+
+// format formats t with layout, naming months and weekdays in the locale's
+// language.
+func (f localeFormat) format(t time.Time, layout string) string {
+	s := t.Format(layout)
+	if f.months != nil && strings.Contains(layout, "January") {
+		s = strings.Replace(s, t.Month().String(), f.months[t.Month()-1], 1)
+	}
+	if f.weekdays != nil && strings.Contains(layout, "Monday") {
+		s = strings.Replace(s, t.Weekday().String(), f.weekdays[t.Weekday()], 1)
+	}
+	return s
+}
+
+// localDate formats a time.Time or *time.Time as a date in locale. A nil
+// time formats as "".
+func localDate(locale string, t any) (string, error) {
+	switch t := t.(type) {
+	case time.Time:
+		f := formatFor(locale)
+		return f.format(t, f.date), nil
+	case *time.Time:
+		if t == nil {
+			return "", nil
+		}
+		return localDate(locale, *t)
+	default:
+		return "", fmt.Errorf("localDate: can't format %T", t)
+	}
+}
+
+// localEventTime is formatEventTime for locale: t's date and time in the
+// time zone named tz.
+func localEventTime(locale string, t time.Time, tz string) string {
+	f := formatFor(locale)
+	return f.format(t.In(eventLocation(tz)), f.dateTime)
+}
+
+// localNumber formats n with locale's digit grouping, as in 1,234 or 1.234.
+func localNumber(locale string, n int) string {
+	return message.NewPrinter(parseLocale(locale)).Sprintf("%d", n)
+}
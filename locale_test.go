@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestLocalDate(t *testing.T) {
+	date := time.Date(2030, time.March, 9, 18, 0, 0, 0, time.UTC)
+	tests := []struct {
+		locale string
+		want   string
+	}{
+		{locale: "en", want: "March 9, 2030"},
+		{locale: "en-US", want: "March 9, 2030"},
+		{locale: "en-GB", want: "9 March 2030"},
+		{locale: "de-DE", want: "9. März 2030"},
+		{locale: "de-AT", want: "9. März 2030"},
+		{locale: "fr-CA", want: "9 mars 2030"},
+		{locale: "ja-JP", want: "2030年3月9日"},
+		{locale: "sv-SE", want: "March 9, 2030"},
+		{locale: "not a locale", want: "March 9, 2030"},
+	}
+	for _, tt := range tests {
+		if got, err := localDate(tt.locale, date); err != nil || got != tt.want {
+			t.Errorf("localDate(%q) = %q, %v, want %q", tt.locale, got, err, tt.want)
+		}
+	}
+
+	if got, err := localDate("de-DE", (*time.Time)(nil)); err != nil || got != "" {
+		t.Errorf("localDate(nil) = %q, %v, want an empty string", got, err)
+	}
+	if _, err := localDate("de-DE", "2030-03-09"); err == nil {
+		t.Error("localDate accepted a string")
+	}
+}
+
+func TestLocalEventTime(t *testing.T) {
+	start := time.Date(2030, time.June, 14, 22, 30, 0, 0, time.UTC)
+	tests := []struct {
+		locale, tz string
+		want       string
+	}{
+		{locale: "en-US", tz: "America/New_York", want: "Friday, June 14, 2030 at 6:30 PM EDT"},
+		{locale: "de-DE", tz: "Europe/Berlin", want: "Samstag, 15. Juni 2030 um 00:30 CEST"},
+		{locale: "fr-CA", tz: "America/Montreal", want: "vendredi 14 juin 2030 à 18 h 30 EDT"},
+		{locale: "en-GB", tz: "Europe/London", want: "Friday 14 June 2030 at 23:30 BST"},
+	}
+	for _, tt := range tests {
+		if got := localEventTime(tt.locale, start, tt.tz); got != tt.want {
+			t.Errorf("localEventTime(%q, %q) = %q, want %q", tt.locale, tt.tz, got, tt.want)
+		}
+	}
+}
+
+func TestLocalNumber(t *testing.T) {
+	tests := []struct {
+		locale string
+		want   string
+	}{
+		{locale: "en-US", want: "1,234,567"},
+		{locale: "de-DE", want: "1.234.567"},
+		{locale: "not a locale", want: "1,234,567"},
+	}
+	for _, tt := range tests {
+		if got := localNumber(tt.locale, 1234567); got != tt.want {
+			t.Errorf("localNumber(%q) = %q, want %q", tt.locale, got, tt.want)
+		}
+	}
+}
+
+func TestDetectLocale(t *testing.T) {
+	handler := detectLanguage(&Config{}, http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Write([]byte(languageFrom(req.Context()) + " " + localeFrom(req.Context())))
+	}))
+
+	tests := []struct {
+		target, header string
+		want           string
+	}{
+		{target: "/", header: "en-US,en;q=0.9", want: "en en-US"},
+		{target: "/", header: "de-DE,de;q=0.9", want: "en de-DE"},
+		{target: "/", header: "fr-CA,fr;q=0.9", want: "fr fr-CA"},
+		{target: "/", header: "sv-SE,de;q=0.5", want: "en de"},
+		{target: "/?lang=fr", header: "de-DE", want: "fr fr"},
+		{target: "/?lang=fr", header: "fr-CA", want: "fr fr-CA"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+		req.Header.Set("Accept-Language", tt.header)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if got := rec.Body.String(); got != tt.want {
+			t.Errorf("%s with Accept-Language %q: language and locale = %q, want %q", tt.target, tt.header, got, tt.want)
+		}
+	}
+
+	if got := localeFrom(context.Background()); got != defaultLanguage {
+		t.Errorf("localeFrom without a locale = %q, want %q", got, defaultLanguage)
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type contextKey int
+
+const (
+	requestIDKey contextKey = iota
+	loggerKey
+	csrfTokenKey
+	adminUserKey
+	languageKey
+	flashKey
+	styleNonceKey
+	localeKey
+	uploadBodyKey
+	staticBaseKey
+)
+
+// fatal logs msg at error level and exits.
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+// configureLogging replaces the default logger with one writing to stdout at
+// the given level ("debug", "info", "warn" or "error") and in the given format
+// ("json" or "text"). Unrecognized values fall back to info and json.
+func configureLogging(level, format string) {
+	handler, warnings := newLogHandler(os.Stdout, level, format)
+	slog.SetDefault(slog.New(handler))
+	for _, warning := range warnings {
+		slog.Warn(warning, "log_level", level, "log_format", format)
+	}
+}
+
+// newLogHandler builds the slog handler for configureLogging, returning a
+// warning for each setting it couldn't parse.
+func newLogHandler(w io.Writer, level, format string) (slog.Handler, []string) {
+	var warnings []string
+
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		warnings = append(warnings, "Invalid LOG_LEVEL, using info")
+		lvl = slog.LevelInfo
+	}
+	opts := &slog.HandlerOptions{Level: lvl}
+
+	switch strings.ToLower(format) {
+	case "json":
+		return slog.NewJSONHandler(w, opts), warnings
+	case "text":
+		return slog.NewTextHandler(w, opts), warnings
+	default:
+		warnings = append(warnings, "Invalid LOG_FORMAT, using json")
+		return slog.NewJSONHandler(w, opts), warnings
+	}
+}
+
+// loggerFrom returns the request-scoped logger stored in ctx by logRequests,
+// or the default logger outside of a request.
+func loggerFrom(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// requestIDFrom returns the ID assigned to the current request, if any.
+func requestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// statusRecorder captures the status code written by a handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// started reports whether the response's status has been written.
+func (r *statusRecorder) started() bool {
+	return r.status != 0
+}
+
+// responseStarted reports whether the response being written to rw has been
+// started, by asking rw and each writer it wraps in turn.
+func responseStarted(rw http.ResponseWriter) bool {
+	for {
+		if s, ok := rw.(interface{ started() bool }); ok && s.started() {
+			return true
+		}
+		u, ok := rw.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			return false
+		}
+		rw = u.Unwrap()
+	}
+}
+
+// logRequests assigns each request an ID, attaches a logger carrying that ID
+// to the request context, and logs the outcome of the request.
+func logRequests(cfg *Config, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		start := time.Now()
+		id := uuid.NewString()
+		logger := slog.Default().With("request_id", id)
+
+		ctx := context.WithValue(req.Context(), requestIDKey, id)
+		ctx = context.WithValue(ctx, loggerKey, logger)
+
+		rec := &statusRecorder{ResponseWriter: rw}
+		next.ServeHTTP(rec, req.WithContext(ctx))
+
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		logger.Info("Request",
+			"method", req.Method,
+			"path", req.URL.Path,
+			"ip", cfg.clientIP(req),
+			"status", rec.status,
+			"duration", time.Since(start),
+		)
+	})
+}
+
+// recoverPanics turns a panicking handler into a 500 response, logging the
+// panic and stack trace with the request's logger. It must run inside
+// logRequests so that the panic is logged with the request ID.
+func recoverPanics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		defer func() {
+			p := recover()
+			if p == nil {
+				return
+			}
+			if p == http.ErrAbortHandler {
+				panic(p)
+			}
+
+			loggerFrom(req.Context()).Error("Handler panicked", "panic", fmt.Sprint(p), "stack", string(debug.Stack()))
+			if responseStarted(rw) {
+				// The response has already started; all we can do is log.
+				return
+			}
+			serverError(rw, req, fmt.Errorf("panic: %v", p))
+		}()
+
+		next.ServeHTTP(rw, req)
+	})
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// captureLogs sends everything logged, at any level, to the returned buffer
+// as JSON for the rest of the test.
+func captureLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+	return &buf
+}
+
+// logLines decodes each JSON line in buf.
+func logLines(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var lines []map[string]any
+	scanner := bufio.NewScanner(bytes.NewReader(buf.Bytes()))
+	for scanner.Scan() {
+		line := map[string]any{}
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			t.Fatalf("log line %q isn't JSON: %v", scanner.Text(), err)
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func TestNewLogHandler(t *testing.T) {
+	tests := []struct {
+		level, format string
+		wantLevels    []string
+		wantJSON      bool
+		wantWarnings  int
+	}{
+		{level: "debug", format: "json", wantLevels: []string{"DEBUG", "INFO", "WARN", "ERROR"}, wantJSON: true},
+		{level: "info", format: "text", wantLevels: []string{"INFO", "WARN", "ERROR"}},
+		{level: "WARN", format: "TEXT", wantLevels: []string{"WARN", "ERROR"}},
+		{level: "error", format: "json", wantLevels: []string{"ERROR"}, wantJSON: true},
+		{level: "loud", format: "json", wantLevels: []string{"INFO", "WARN", "ERROR"}, wantJSON: true, wantWarnings: 1},
+		{level: "debug", format: "xml", wantLevels: []string{"DEBUG", "INFO", "WARN", "ERROR"}, wantJSON: true, wantWarnings: 1},
+		{level: "", format: "", wantLevels: []string{"INFO", "WARN", "ERROR"}, wantJSON: true, wantWarnings: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.level+"/"+tt.format, func(t *testing.T) {
+			var buf bytes.Buffer
+			handler, warnings := newLogHandler(&buf, tt.level, tt.format)
+			if len(warnings) != tt.wantWarnings {
+				t.Errorf("got warnings %q, want %d", warnings, tt.wantWarnings)
+			}
+			logger := slog.New(handler)
+			logger.Debug("debug")
+			logger.Info("info")
+			logger.Warn("warn")
+			logger.Error("error")
+
+			var levels []string
+			if tt.wantJSON {
+				for _, line := range logLines(t, &buf) {
+					levels = append(levels, line["level"].(string))
+				}
+			} else {
+				scanner := bufio.NewScanner(&buf)
+				for scanner.Scan() {
+					_, rest, _ := strings.Cut(scanner.Text(), " level=")
+					level, _, _ := strings.Cut(rest, " ")
+					levels = append(levels, level)
+				}
+			}
+			if !slices.Equal(levels, tt.wantLevels) {
+				t.Errorf("logged levels %q, want %q", levels, tt.wantLevels)
+			}
+		})
+	}
+}
+
+func TestLogRequestsAddsRequestIDs(t *testing.T) {
+	logs := captureLogs(t)
+	handler := logRequests(&Config{}, http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		loggerFrom(req.Context()).Info("Handling")
+	}))
+
+	const requests = 3
+	for range requests {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	}
+
+	lines := logLines(t, logs)
+	if len(lines) != 2*requests {
+		t.Fatalf("got %d log lines, want %d", len(lines), 2*requests)
+	}
+	seen := map[string]bool{}
+	for i := 0; i < len(lines); i += 2 {
+		handling, request := lines[i], lines[i+1]
+		id, _ := request["request_id"].(string)
+		if id == "" {
+			t.Fatalf("request log line has no request_id: %v", request)
+		}
+		if request["msg"] != "Request" || handling["request_id"] != id {
+			t.Errorf("handler's log line %v doesn't share request %v's request_id", handling, request)
+		}
+		if seen[id] {
+			t.Errorf("request_id %s is used by more than one request", id)
+		}
+		seen[id] = true
+	}
+}
+
+// panicServer serves paths that panic, before and after starting their
+// response, through the same middleware as the site.
+func panicServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/panic", func(rw http.ResponseWriter, req *http.Request) {
+		var guest map[string]*struct{ Name string }
+		io.WriteString(rw, guest["ada"].Name)
+	})
+	mux.HandleFunc("/partial", func(rw http.ResponseWriter, req *http.Request) {
+		rw.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		io.WriteString(rw, "partial")
+		panic("after writing")
+	})
+	mux.HandleFunc("/ok", func(rw http.ResponseWriter, req *http.Request) {
+		io.WriteString(rw, "ok")
+	})
+	server := httptest.NewServer(logRequests(&Config{}, gzipResponses(recoverPanics(mux))))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestRecoverPanics(t *testing.T) {
+	logs := captureLogs(t)
+	server := panicServer(t)
+
+	res, err := http.Get(server.URL + "/panic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	if res.StatusCode != http.StatusInternalServerError || !strings.Contains(string(body), "Something went wrong") {
+		t.Errorf("got %d, want %d and the error page:\n%s", res.StatusCode, http.StatusInternalServerError, body)
+	}
+
+	res, err = http.Get(server.URL + "/ok")
+	if err != nil {
+		t.Fatalf("the server didn't survive the panic: %v", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("after the panic, status = %d, want %d", res.StatusCode, http.StatusOK)
+	}
+
+	var panicked, logged map[string]any
+	for _, line := range logLines(t, logs) {
+		switch line["msg"] {
+		case "Handler panicked":
+			panicked = line
+		case "Request":
+			if logged == nil {
+				logged = line
+			}
+		}
+	}
+	if panicked == nil {
+		t.Fatal("the panic wasn't logged")
+	}
+	if stack, _ := panicked["stack"].(string); !strings.Contains(stack, "logging_test.go") {
+		t.Errorf("the logged stack doesn't reach the handler:\n%s", stack)
+	}
+	if panicked["request_id"] == nil || panicked["request_id"] != logged["request_id"] {
+		t.Errorf("the panic was logged with request_id %v, but the request with %v", panicked["request_id"], logged["request_id"])
+	}
+}
+
+func TestRecoverPanicsAfterWriting(t *testing.T) {
+	captureLogs(t)
+	server := panicServer(t)
+
+	for _, encoding := range []string{"", "gzip"} {
+		req, _ := http.NewRequest(http.MethodGet, server.URL+"/partial", nil)
+		if encoding != "" {
+			req.Header.Set("Accept-Encoding", encoding)
+		}
+		res, err := http.DefaultTransport.RoundTrip(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var body io.Reader = res.Body
+		if res.Header.Get("Content-Encoding") == "gzip" {
+			gz, err := gzip.NewReader(res.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body = gz
+		}
+		got, err := io.ReadAll(body)
+		res.Body.Close()
+		if err != nil {
+			t.Errorf("Accept-Encoding %q: reading the body: %v", encoding, err)
+		}
+		// The started response can't become an error page.
+		if res.StatusCode != http.StatusOK || string(got) != "partial" {
+			t.Errorf("Accept-Encoding %q: got %d %q, want %d %q", encoding, res.StatusCode, got, http.StatusOK, "partial")
+		}
+	}
+}
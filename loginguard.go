@@ -0,0 +1,89 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// loginFailures counts a client's recent failed admin logins.
+type loginFailures struct {
+	count       int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+// loginGuard locks a client IP out of admin login for a while after too many
+// failed attempts in a row. Failures are forgotten once the lockout period
+// has passed without another, and a successful login clears them.
+type loginGuard struct {
+	maxFailures int
+	lockout     time.Duration
+
+	mu        sync.Mutex
+	failures  map[string]*loginFailures
+	lastSweep time.Time
+}
+
+func newLoginGuard(maxFailures int, lockout time.Duration) *loginGuard {
+	return &loginGuard{
+		maxFailures: maxFailures,
+		lockout:     lockout,
+		failures:    map[string]*loginFailures{},
+		lastSweep:   time.Now(),
+	}
+}
+
+// lockedOut reports how much longer ip is locked out for, if it is.
+func (g *loginGuard) lockedOut(ip string, now time.Time) (time.Duration, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	f, ok := g.failures[ip]
+	if !ok || !now.Before(f.lockedUntil) {
+		return 0, false
+	}
+	return f.lockedUntil.Sub(now), true
+}
+
+// fail records a failed login from ip, returning the number of failures in
+// a row and whether ip is now locked out. Entries for clients that haven't
+// failed recently are dropped as it goes.
+func (g *loginGuard) fail(ip string, now time.Time) (int, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if now.Sub(g.lastSweep) > g.lockout {
+		for key, f := range g.failures {
+			if g.expired(f, now) {
+				delete(g.failures, key)
+			}
+		}
+		g.lastSweep = now
+	}
+
+	f, ok := g.failures[ip]
+	if !ok || g.expired(f, now) {
+		f = &loginFailures{}
+		g.failures[ip] = f
+	}
+	f.count++
+	f.lastFailure = now
+	if f.count >= g.maxFailures {
+		f.lockedUntil = now.Add(g.lockout)
+		f.count = 0
+		return g.maxFailures, true
+	}
+	return f.count, false
+}
+
+// expired reports whether f is old enough to forget.
+func (g *loginGuard) expired(f *loginFailures, now time.Time) bool {
+	return now.Sub(f.lastFailure) > g.lockout && !now.Before(f.lockedUntil)
+}
+
+// succeed clears ip's failures after a successful login.
+func (g *loginGuard) succeed(ip string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.failures, ip)
+}
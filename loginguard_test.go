@@ -0,0 +1,87 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoginGuard(t *testing.T) {
+	g := newLoginGuard(3, 10*time.Minute)
+	now := time.Now()
+
+	for want := 1; want <= 2; want++ {
+		if n, locked := g.fail("192.0.2.1", now); n != want || locked {
+			t.Fatalf("failure %d: fail = %d, %v, want %d, false", want, n, locked, want)
+		}
+	}
+	if _, locked := g.lockedOut("192.0.2.1", now); locked {
+		t.Fatal("locked out before reaching the maximum failures")
+	}
+	if n, locked := g.fail("192.0.2.1", now); n != 3 || !locked {
+		t.Fatalf("third failure: fail = %d, %v, want 3, true", n, locked)
+	}
+
+	if wait, locked := g.lockedOut("192.0.2.1", now.Add(4*time.Minute)); !locked || wait != 6*time.Minute {
+		t.Errorf("four minutes in: lockedOut = %v, %v, want 6m, true", wait, locked)
+	}
+	if _, locked := g.lockedOut("192.0.2.2", now); locked {
+		t.Error("another client is locked out too")
+	}
+
+	later := now.Add(10 * time.Minute)
+	if _, locked := g.lockedOut("192.0.2.1", later); locked {
+		t.Error("still locked out once the lockout has passed")
+	}
+	if n, locked := g.fail("192.0.2.1", later); n != 1 || locked {
+		t.Errorf("after the lockout: fail = %d, %v, want the count to start again", n, locked)
+	}
+}
+
+func TestLoginGuardResets(t *testing.T) {
+	g := newLoginGuard(3, 10*time.Minute)
+	now := time.Now()
+
+	g.fail("192.0.2.1", now)
+	g.fail("192.0.2.1", now)
+	g.succeed("192.0.2.1")
+	if n, _ := g.fail("192.0.2.1", now); n != 1 {
+		t.Errorf("after a successful login: fail = %d, want 1", n)
+	}
+
+	// Failures far enough apart are forgotten, and don't add up.
+	g.fail("192.0.2.3", now)
+	g.fail("192.0.2.3", now.Add(11*time.Minute))
+	if n, locked := g.fail("192.0.2.3", now.Add(22*time.Minute)); n != 1 || locked {
+		t.Errorf("spread-out failures: fail = %d, %v, want 1, false", n, locked)
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if _, ok := g.failures["192.0.2.1"]; ok {
+		t.Error("the sweep kept an expired client's failures")
+	}
+}
+
+func TestLoginLockout(t *testing.T) {
+	pool := testPool(t)
+	site := newTestSite(t, pool)
+
+	for i := 1; i < site.cfg.LoginMaxFailures; i++ {
+		if res := site.login("wrong password"); res.StatusCode != http.StatusUnauthorized {
+			t.Fatalf("failure %d: status = %d, want %d", i, res.StatusCode, http.StatusUnauthorized)
+		}
+	}
+	res := site.login("wrong password")
+	if res.StatusCode != http.StatusTooManyRequests || res.Header.Get("Retry-After") != "900" {
+		t.Fatalf("the last failure: status = %d, Retry-After = %q, want %d and 900", res.StatusCode, res.Header.Get("Retry-After"), http.StatusTooManyRequests)
+	}
+
+	// Even the right password is refused until the lockout passes.
+	res = site.login(testAdminPassword)
+	body, _ := io.ReadAll(res.Body)
+	if res.StatusCode != http.StatusTooManyRequests || !strings.Contains(string(body), "Please try again in 15 minutes.") {
+		t.Errorf("the right password while locked out: got %d, want %d\n%s", res.StatusCode, http.StatusTooManyRequests, body)
+	}
+}
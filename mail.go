@@ -0,0 +1,124 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// Mailer sends HTML email.
+type Mailer interface {
+	Send(to, subject, body string) error
+}
+
+// SMTPMailer delivers mail through an SMTP relay.
+type SMTPMailer struct {
+	addr string
+	from string
+	auth smtp.Auth
+	// timeout bounds each message, from dialing the relay to the end of
+	// the conversation.
+	timeout time.Duration
+}
+
+var _ Mailer = &SMTPMailer{}
+
+func (m *SMTPMailer) Send(to, subject, body string) error {
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "From: %s\r\n", m.from)
+	fmt.Fprintf(&msg, "To: %s\r\n", to)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/html; charset=utf-8\r\n")
+	msg.WriteString("\r\n")
+	msg.WriteString(body)
+
+	return m.send(to, msg.String())
+}
+
+// send delivers msg to one recipient the way smtp.SendMail does, but within
+// the mailer's timeout, so that a stalled relay can't hold up a request.
+func (m *SMTPMailer) send(to, msg string) error {
+	conn, err := net.DialTimeout("tcp", m.addr, m.timeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(m.timeout)); err != nil {
+		return err
+	}
+
+	host, _, _ := net.SplitHostPort(m.addr)
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if m.auth != nil {
+		if ok, _ := c.Extension("AUTH"); !ok {
+			return errors.New("smtp: server doesn't support AUTH")
+		}
+		if err := c.Auth(m.auth); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(m.from); err != nil {
+		return err
+	}
+	if err := c.Rcpt(to); err != nil {
+		return err
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// logMailer logs messages instead of sending them, for development.
+type logMailer struct{}
+
+var _ Mailer = logMailer{}
+
+func (logMailer) Send(to, subject, body string) error {
+	slog.Info("Not sending email: SMTP_HOST is unset", "to", to, "subject", subject)
+	return nil
+}
+
+// newMailer configures an SMTPMailer from SMTP_* env vars, falling back to a
+// logMailer when SMTP_HOST is unset.
+func newMailer(cfg *Config) Mailer {
+	if cfg.SMTPHost == "" {
+		slog.Warn("SMTP_HOST is unset: Emails will be logged, not sent")
+		return logMailer{}
+	}
+
+	m := &SMTPMailer{
+		addr:    net.JoinHostPort(cfg.SMTPHost, cfg.SMTPPort),
+		from:    cfg.SMTPFrom,
+		timeout: cfg.SMTPTimeout,
+	}
+	if cfg.SMTPUser != "" {
+		m.auth = smtp.PlainAuth("", cfg.SMTPUser, cfg.SMTPPass, cfg.SMTPHost)
+	}
+	return m
+}
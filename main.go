@@ -2,166 +2,393 @@ package main
 
 import (
 	"bufio"
+	"bytes"
 	"context"
-	"database/sql"
-	"embed"
+	"errors"
 	"fmt"
-	"html/template"
 	"io"
 	"io/fs"
-	"io/ioutil"
-	"log"
+	"log/slog"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
+	"slices"
+	"strconv"
 	"strings"
+	"syscall"
+	"time"
 
-	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/meagar/rsvp/db"
 )
 
-//go:embed templates
-var templateFS embed.FS
-var rootTemplate *template.Template
-var db sql.DB
-
-func init() {
-	loadEnv()
-	loadTemplates()
-	connectDB()
-}
-
+// loadEnv fills in unset ENV variables from .env, if there is one. In
+// production, configuration usually comes from the real environment alone.
 func loadEnv() {
 	file, err := os.Open(".env")
+	if errors.Is(err, fs.ErrNotExist) {
+		slog.Info("No .env file: Using ENV variables only")
+		return
+	}
 	if err != nil {
-		log.Fatal(err)
+		fatal("Opening .env failed", "error", err)
 	}
 	defer file.Close()
 
 	scanner := bufio.NewScanner(file)
 
 	for scanner.Scan() {
-		line := scanner.Text()
-		parts := strings.Split(line, "=")
-		if len(parts) != 2 {
-			log.Fatalf("Malformed line in .env: %s", line)
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
 		}
 
-		if _, ok := os.LookupEnv(parts[0]); !ok {
-			log.Printf("ENV[%s] is unset: Using .env value \"%s\"", parts[0], parts[1])
-			os.Setenv(parts[0], parts[1])
+		key, value, ok := parseEnvLine(line)
+		if !ok {
+			fatal("Malformed line in .env", "line", line)
 		}
 
-		if err := scanner.Err(); err != nil {
-			log.Fatal(err)
+		if _, ok := os.LookupEnv(key); !ok {
+			slog.Info("ENV is unset: Using .env value", "name", key, "value", value)
+			os.Setenv(key, value)
 		}
 	}
+
+	if err := scanner.Err(); err != nil {
+		fatal("Reading .env failed", "error", err)
+	}
 }
 
-func loadTemplates() {
-	rootTemplate = template.New("")
-	fs.WalkDir(templateFS, ".", func(path string, d fs.DirEntry, err error) error {
+// parseEnvLine splits a KEY=value line on the first "=", stripping a single
+// pair of matching quotes from around the value.
+func parseEnvLine(line string) (key, value string, ok bool) {
+	key, value, ok = strings.Cut(line, "=")
+	key = strings.TrimSpace(key)
+	if !ok || key == "" {
+		return "", "", false
+	}
+
+	value = strings.TrimSpace(value)
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+		value = value[1 : len(value)-1]
+	}
+
+	return key, value, true
+}
+
+// queryContext derives a context for a request's database queries, which are
+// abandoned after DB_QUERY_TIMEOUT or when the client goes away.
+func (c *Config) queryContext(req *http.Request) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(req.Context(), c.DBQueryTimeout)
+}
+
+// sslModes are the values Postgres accepts for sslmode.
+var sslModes = []string{"disable", "allow", "prefer", "require", "verify-ca", "verify-full"}
+
+// withSSLMode returns the connection string with its sslmode set to mode,
+// replacing any it already had. Both URLs and key=value strings are
+// supported.
+func withSSLMode(conn, mode string) (string, error) {
+	if !slices.Contains(sslModes, mode) {
+		return "", fmt.Errorf("invalid sslmode %q: must be one of %s", mode, strings.Join(sslModes, ", "))
+	}
+
+	if strings.HasPrefix(conn, "postgres://") || strings.HasPrefix(conn, "postgresql://") {
+		u, err := url.Parse(conn)
 		if err != nil {
-			log.Fatal(err)
+			return "", err
 		}
+		params := u.Query()
+		params.Set("sslmode", mode)
+		u.RawQuery = params.Encode()
+		return u.String(), nil
+	}
+
+	// In key=value strings, a later setting overrides an earlier one.
+	return conn + " sslmode=" + mode, nil
+}
 
-		if !d.IsDir() {
-			name := strings.TrimPrefix(path, "templates/")
-			name = strings.TrimSuffix(name, ".tmpl")
-			log.Println("Template", name)
-			f, err := templateFS.Open(path)
-			if err != nil {
-				log.Fatal(err)
-			}
-			bytes, err := ioutil.ReadAll(f)
-			if err != nil {
-				log.Fatal(err)
-			}
-
-			rootTemplate.New(name).Parse(string(bytes))
+// dbConfig parses the pool configuration from conn, the database URL held by
+// the named variable, applying the optional SSL mode, connect timeout and pool
+// size settings.
+func dbConfig(cfg *Config, name, conn string) (*pgxpool.Config, error) {
+	if cfg.DBSSLMode != "" {
+		var err error
+		if conn, err = withSSLMode(conn, cfg.DBSSLMode); err != nil {
+			return nil, fmt.Errorf("DB_SSLMODE: %w", err)
 		}
-		return nil
-	})
+	}
+
+	config, err := pgxpool.ParseConfig(conn)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	if cfg.DBConnectTimeout > 0 {
+		config.ConnConfig.ConnectTimeout = cfg.DBConnectTimeout
+	}
+	config.MaxConns = int32(cfg.DBMaxConns)
+	return config, nil
+}
 
-	log.Println(rootTemplate.DefinedTemplates())
+// initialConnectDelay is how long connectDB waits after the first failed
+// attempt. The delay doubles after each further failure.
+const initialConnectDelay = 500 * time.Millisecond
+
+// retryConnect calls connect until it succeeds or has failed attempts times,
+// sleeping between attempts with exponential backoff capped at maxDelay.
+func retryConnect(ctx context.Context, attempts int, maxDelay time.Duration, connect func(context.Context) error) error {
+	delay := initialConnectDelay
+	for attempt := 1; ; attempt++ {
+		err := connect(ctx)
+		if err == nil {
+			return nil
+		}
+		if attempt >= attempts {
+			return fmt.Errorf("giving up after %d attempts: %w", attempt, err)
+		}
+
+		slog.Warn("Connecting to database failed, retrying", "attempt", attempt, "of", attempts, "delay", delay, "error", err)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		delay = min(delay*2, maxDelay)
+	}
 }
 
-func connectDB() *pgx.Conn {
-	conn, err := pgx.Connect(context.Background(), os.Getenv("DATABASE_URL"))
+// connectDB creates the connection pool, waiting for the database to accept
+// connections. Containers are often started before their database is ready,
+// so failures are retried DB_CONNECT_ATTEMPTS times, backing off to
+// DB_CONNECT_MAX_DELAY between attempts.
+func connectDB(cfg *Config, name, conn string) *db.Pool {
+	config, err := dbConfig(cfg, name, conn)
 	if err != nil {
-		log.Fatal(err)
+		fatal("Invalid database configuration", "error", err)
 	}
 
-	return conn
+	pool, err := pgxpool.NewWithConfig(context.Background(), config)
+	if err != nil {
+		fatal("Connecting to database failed", "error", err)
+	}
+
+	// The pool connects lazily, so ping to find out whether the database is
+	// actually there.
+	err = retryConnect(context.Background(), cfg.DBConnectAttempts, cfg.DBConnectMaxDelay, func(ctx context.Context) error {
+		slog.Info("Connecting to database", "database", name)
+		return pool.Ping(ctx)
+	})
+	if err != nil {
+		pool.Close()
+		fatal("Connecting to database failed", "error", err)
+	}
+
+	return &db.Pool{Pool: pool}
 }
 
 func main() {
-	port := fetchEnv("PORT")
-	log.Println("Running on port", port)
+	slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stdout, nil)))
+	loadEnv()
 
-	db := connectDB()
-	defer db.Close(context.Background())
+	// With arguments, run the command they name instead of the server.
+	// Commands don't need the server's settings.
+	if len(os.Args) > 1 {
+		cfg, err := LoadCommandConfig()
+		if err != nil {
+			fatal("Invalid configuration", "error", err)
+		}
+		configureLogging(cfg.LogLevel, cfg.LogFormat)
 
-	// pg_addr := fetchEnv("PG_ADDR")
-	// log.Println("Connecting to database", pg_addr)
+		if err := runCommand(cfg, os.Args[1], os.Args[2:]); err != nil {
+			fatal("Command failed", "command", os.Args[1], "error", err)
+		}
+		return
+	}
 
-	adminPath := fetchEnvDef("ADMIN_PATH", "/admin/")
-	log.Printf("Serving admin site from %s", adminPath)
+	cfg, err := LoadConfig()
+	if err != nil {
+		fatal("Invalid configuration", "error", err)
+	}
+	configureLogging(cfg.LogLevel, cfg.LogFormat)
+
+	loadMessages()
+	loadTemplates(cfg.TemplateDir, cfg.TemplateReload)
+	slog.Info("Running", "addr", listenAddr(cfg))
+
+	// Every handler shares these pools. Queries that only read, and can
+	// tolerate a little replication lag, go to the replica if there is one.
+	pool := connectDB(cfg, "DATABASE_URL", cfg.DatabaseURL)
+	defer pool.Close()
+	reads := pool
+	if cfg.DatabaseReplicaURL != "" {
+		reads = connectDB(cfg, "DATABASE_REPLICA_URL", cfg.DatabaseReplicaURL)
+		defer reads.Close()
+	}
 
-	http.Handle(adminPath, &AdminHandler{})
-	http.Handle("/", &Handler{db: db})
+	if cfg.RunMigrations {
+		if err := runMigrations(context.Background(), pool.Pool); err != nil {
+			fatal("Running migrations failed", "error", err)
+		}
+	}
+
+	slog.Info("Serving admin site", "path", cfg.AdminPath)
+
+	if cfg.AdminUser == "" || cfg.AdminPasswordHash == "" {
+		slog.Warn("ADMIN_USER or ADMIN_PASSWORD_HASH is unset: Admin login is disabled")
+	}
+
+	webhook := newWebhook(cfg)
+	mailer := newMailer(cfg)
+	reminders := newReminders(cfg, pool, mailer)
+	server := newServer(cfg, newHandler(cfg, pool, reads, newSigner(cfg.SessionSecret), mailer, webhook, reminders))
+	if err := serve(server, cfg.ShutdownTimeout); err != nil {
+		fatal("Server failed", "error", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	webhook.shutdown(ctx)
+	reminders.shutdown(ctx)
+}
 
-	log.Fatal(http.ListenAndServe(fmt.Sprintf(":%s", port), nil))
+// newHandler builds the whole site: every route, wrapped in the middleware
+// that applies to all of them. Every handler shares pool and reads, the
+// replica pool, which is pool itself if there's no replica.
+func newHandler(cfg *Config, pool, reads *db.Pool, sessions signer, mailer Mailer, webhook *webhook, reminders *reminders) http.Handler {
+	mux := http.NewServeMux()
+	health := &HealthHandler{db: pool, reads: reads}
+	mux.HandleFunc("GET /healthz", health.live)
+	mux.HandleFunc("GET /readyz", health.ready)
+
+	metrics := newMetrics(pool.Pool)
+	mux.Handle("GET "+cfg.MetricsPath, metrics.handler(cfg.MetricsToken))
+
+	mux.Handle(cfg.AdminPath, newAdminHandler(cfg, pool, reads, mailer, reminders, sessions, newLoginGuard(cfg.LoginMaxFailures, cfg.LoginLockout)))
+
+	limiter := newRateLimiter(cfg)
+	uploads := newUploadRoutes("POST " + cfg.AdminPath + "events/{slug}/import")
+
+	rsvpHandler := &RSVPHandler{cfg: cfg, db: pool, reads: reads, mailer: mailer, webhook: webhook, sessions: sessions}
+	mux.Handle("/rsvp", limiter.limit(rsvpHandler))
+	mux.Handle("/rsvp/{code}", limiter.limit(rsvpHandler))
+	mux.Handle("GET /rsvp/thanks", limiter.limit(http.HandlerFunc(rsvpHandler.thanks)))
+	mux.Handle("GET /rsvp/{code}/cancel", limiter.limit(http.HandlerFunc(rsvpHandler.confirmCancel)))
+	mux.Handle("POST /rsvp/{code}/cancel", limiter.limit(http.HandlerFunc(rsvpHandler.cancel)))
+	mux.Handle("GET /verify", limiter.limit(http.HandlerFunc(rsvpHandler.verifyEmail)))
+	mux.Handle("GET /api/rsvp/{code}", limiter.limit(http.HandlerFunc(rsvpHandler.apiShow)))
+	mux.Handle("POST /api/rsvp/{code}", limiter.limit(http.HandlerFunc(rsvpHandler.apiSubmit)))
+	eventHandler := &EventHandler{cfg: cfg, db: reads}
+	mux.Handle("GET /e/{slug}", limiter.limit(http.HandlerFunc(eventHandler.show)))
+	mux.Handle("GET /e/{slug}/event.ics", limiter.limit(http.HandlerFunc(eventHandler.ics)))
+	mux.Handle("GET "+cfg.StaticPath, staticHandler(cfg.StaticPath))
+	mux.Handle("GET /favicon.ico", faviconHandler())
+	mux.HandleFunc("GET /{$}", home)
+	mux.Handle("/", methodFallback(mux))
+
+	return logRequests(cfg, gzipResponses(securityHeaders(cfg.StaticOrigin, linkStatic(cfg.StaticOrigin+cfg.StaticPath, recoverPanics(metrics.instrument(mux, limitBodies(int64(cfg.MaxBodySize), uploads, csrfProtect(cfg, detectLanguage(cfg, sessions.loadFlash(cfg, mux))))))))))
 }
 
-func fetchEnv(name string) string {
-	if value, ok := os.LookupEnv(name); !ok {
-		fmt.Printf("ENV variable %s is not set\n", name)
-		os.Exit(1)
-		return ""
-	} else {
-		return value
+// listenAddr is the address for the server to listen on: the port on
+// BIND_ADDR, or on every interface if that's unset.
+func listenAddr(cfg *Config) string {
+	host := strings.TrimSuffix(strings.TrimPrefix(cfg.BindAddr, "["), "]")
+	return net.JoinHostPort(host, strconv.Itoa(cfg.Port))
+}
+
+// newServer returns a server for handler with timeouts, so that slow or idle
+// clients can't tie up connections indefinitely.
+func newServer(cfg *Config, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              listenAddr(cfg),
+		Handler:           handler,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		ReadTimeout:       cfg.ReadTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
 	}
 }
 
-func fetchEnvDef(name string, default_value string) string {
-	if value, ok := os.LookupEnv(name); !ok {
-		return default_value
-	} else {
-		return value
+// serve runs server until it receives SIGINT or SIGTERM, then waits up to
+// timeout for in-flight requests to complete.
+func serve(server *http.Server, timeout time.Duration) error {
+	errs := make(chan error, 1)
+	go func() {
+		errs <- server.ListenAndServe()
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	select {
+	case err := <-errs:
+		return err
+	case sig := <-signals:
+		slog.Info("Shutting down", "signal", sig.String())
 	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return server.Shutdown(ctx)
 }
 
-func render(w io.Writer, name string, data any) {
-	log.Printf("Rendering template %s", name)
-	if err := rootTemplate.ExecuteTemplate(w, name, data); err != nil {
-		log.Fatal(err)
+// notFound renders the not found page, or a JSON error for clients that want
+// JSON.
+func notFound(rw http.ResponseWriter, req *http.Request) {
+	if wantsJSON(req) {
+		writeAPIError(rw, http.StatusNotFound, "not_found", "not found")
+		return
 	}
+	renderPage(rw, req, http.StatusNotFound, "not_found", nil)
 }
 
-type Handler struct {
-	db *pgx.Conn
+// errorStatus picks the response status for a failed request. Timeouts,
+// cancellations and lost database connections, which db.Pool has already
+// retried, are reported as 503 Service Unavailable, anything else as a 500.
+func errorStatus(err error) int {
+	if pgconn.Timeout(err) || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return http.StatusServiceUnavailable
+	}
+	var retry interface{ SafeToRetry() bool }
+	var netErr net.Error
+	if (errors.As(err, &retry) && retry.SafeToRetry()) || errors.As(err, &netErr) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
 }
 
-var _ http.Handler = &Handler{}
+// serverError logs err and renders the error page, or reports it as JSON to
+// clients that want JSON. If the error page itself fails to render, a plain
+// text response is sent instead.
+func serverError(rw http.ResponseWriter, req *http.Request, err error) {
+	status := errorStatus(err)
 
-func (h *Handler) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
-	type User struct {
-		Id   int
-		Name string
+	loggerFrom(req.Context()).Error("Request failed", "status", status, "error", err)
+	if wantsJSON(req) {
+		writeAPIError(rw, status, "server_error", http.StatusText(status))
+		return
 	}
 
-	u := User{}
-	err := h.db.QueryRow(context.Background(), "select * from users").Scan(&u.Id, &u.Name)
+	var buf bytes.Buffer
+	err = render(req.Context(), &buf, "error", struct {
+		Status    int
+		RequestID string
+	}{Status: status, RequestID: requestIDFrom(req.Context())})
 	if err != nil {
-		log.Fatalf("Query failed: %v", err)
+		loggerFrom(req.Context()).Error("Rendering error page failed", "error", err)
+		http.Error(rw, http.StatusText(status), status)
+		return
 	}
-
-	render(rw, "hello", struct{ Name string }{Name: u.Name})
+	writePage(rw, status, &buf)
 }
 
-type AdminHandler struct{}
-
-var _ http.Handler = &AdminHandler{}
-
-func (h *AdminHandler) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
-	fmt.Fprintf(rw, "Admin foo")
+// home renders the landing page. Guests arrive by their invitation links, so
+// it only tells anyone who comes here directly to use theirs.
+func home(rw http.ResponseWriter, req *http.Request) {
+	renderPage(rw, req, http.StatusOK, "home", nil)
 }
@@ -0,0 +1,931 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"os/exec"
+	"os/signal"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/meagar/rsvp/db"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestMain(m *testing.M) {
+	// Tests that check what's logged install their own logger.
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	loadMessages()
+	loadTemplates("", false)
+	os.Exit(m.Run())
+}
+
+const (
+	testSessionSecret = "test session secret"
+	testAdminUser     = "admin"
+	testAdminPassword = "correct horse battery"
+	testCSRFToken     = "test-csrf-token"
+)
+
+// testAdminPasswordHash is testAdminPassword hashed at bcrypt's lowest cost,
+// to keep the tests that log in quick.
+var testAdminPasswordHash = sync.OnceValue(func() string {
+	hash, err := bcrypt.GenerateFromPassword([]byte(testAdminPassword), bcrypt.MinCost)
+	if err != nil {
+		panic(err)
+	}
+	return string(hash)
+})
+
+// testConfig loads the configuration from the environment as LoadConfig does
+// at startup, with the required settings filled in and an admin account set
+// up. The rate limit is raised so that tests can make as many requests as
+// they need.
+func testConfig(t *testing.T) *Config {
+	t.Helper()
+	t.Setenv("PORT", "8080")
+	t.Setenv("DATABASE_URL", "postgres://localhost/rsvp_test")
+	t.Setenv("SESSION_SECRET", testSessionSecret)
+	t.Setenv("ADMIN_USER", testAdminUser)
+	t.Setenv("ADMIN_PASSWORD_HASH", testAdminPasswordHash())
+	t.Setenv("RATE_LIMIT", "100000")
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	return cfg
+}
+
+// testPool connects to the database named by TEST_DATABASE_URL, skipping the
+// test if it's unset. The database is migrated and every table emptied, so
+// tests that use it mustn't run in parallel.
+func testPool(t *testing.T) *db.Pool {
+	t.Helper()
+	conn := os.Getenv("TEST_DATABASE_URL")
+	if conn == "" {
+		t.Skip("TEST_DATABASE_URL is unset")
+	}
+
+	ctx := context.Background()
+	pool, err := pgxpool.New(ctx, conn)
+	if err != nil {
+		t.Fatalf("connecting to TEST_DATABASE_URL: %v", err)
+	}
+	t.Cleanup(pool.Close)
+
+	if err := runMigrations(ctx, pool); err != nil {
+		t.Fatalf("running migrations: %v", err)
+	}
+	_, err = pool.Exec(ctx, `do $$
+		declare tables text;
+		begin
+			select string_agg(quote_ident(tablename), ', ') into tables
+			from pg_tables
+			where schemaname = current_schema() and tablename <> 'schema_migrations';
+			execute 'truncate ' || tables || ' restart identity cascade';
+		end
+		$$`)
+	if err != nil {
+		t.Fatalf("emptying tables: %v", err)
+	}
+	return &db.Pool{Pool: pool}
+}
+
+// unreachablePool returns a pool for a database that isn't there, so every
+// query fails.
+func unreachablePool(t *testing.T) *db.Pool {
+	t.Helper()
+	config, err := pgxpool.ParseConfig("postgres://rsvp@127.0.0.1:1/rsvp_test?connect_timeout=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool, err := pgxpool.NewWithConfig(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(pool.Close)
+	return &db.Pool{Pool: pool}
+}
+
+// sentMail is a message sent through a fakeMailer.
+type sentMail struct {
+	To, Subject, Body string
+}
+
+// fakeMailer records the messages it's asked to send instead of sending
+// them.
+type fakeMailer struct {
+	mu   sync.Mutex
+	sent []sentMail
+}
+
+func (m *fakeMailer) Send(to, subject, body string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent = append(m.sent, sentMail{To: to, Subject: subject, Body: body})
+	return nil
+}
+
+// messages returns the messages sent so far.
+func (m *fakeMailer) messages() []sentMail {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]sentMail(nil), m.sent...)
+}
+
+// testSite is the whole site, as newHandler builds it for the server, with a
+// fake mailer.
+type testSite struct {
+	handler   http.Handler
+	pool      *db.Pool
+	sessions  signer
+	mailer    *fakeMailer
+	reminders *reminders
+	cfg       *Config
+}
+
+// newTestSite builds the site on pool with testConfig's settings.
+func newTestSite(t *testing.T, pool *db.Pool) *testSite {
+	t.Helper()
+	cfg := testConfig(t)
+	site := &testSite{pool: pool, sessions: newSigner(cfg.SessionSecret), mailer: &fakeMailer{}, cfg: cfg}
+	site.reminders = newReminders(cfg, pool, site.mailer)
+	site.handler = newHandler(cfg, pool, pool, site.sessions, site.mailer, nil, site.reminders)
+	return site
+}
+
+// serve handles req, returning the recorded response.
+func (s *testSite) serve(req *http.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	s.handler.ServeHTTP(rec, req)
+	return rec
+}
+
+// get requests path with the given cookies.
+func (s *testSite) get(path string, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	return s.serve(req)
+}
+
+// post submits form to path as a browser would, along with a CSRF token and
+// the given cookies.
+func (s *testSite) post(path string, form url.Values, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+	body := url.Values{csrfField: {testCSRFToken}}
+	for key, values := range form {
+		body[key] = values
+	}
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.AddCookie(&http.Cookie{Name: csrfCookie, Value: testCSRFToken})
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	return s.serve(req)
+}
+
+// adminSession returns a session cookie for the admin site, as if the admin
+// had logged in.
+func (s *testSite) adminSession() *http.Cookie {
+	fingerprint := s.sessions.passwordFingerprint([]byte(s.cfg.AdminPasswordHash))
+	return &http.Cookie{Name: sessionCookie, Value: s.sessions.signSession(testAdminUser, fingerprint, time.Now().Add(time.Hour))}
+}
+
+// responseCookie returns the cookie named name set by rec, or nil if there
+// isn't one.
+func responseCookie(rec *httptest.ResponseRecorder, name string) *http.Cookie {
+	var found *http.Cookie
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == name {
+			found = cookie
+		}
+	}
+	return found
+}
+
+func TestConcurrentRequestsShareThePool(t *testing.T) {
+	pool := testPool(t)
+	site := newTestSite(t, pool)
+	event := createTestEvent(t, pool, &db.Event{Title: "Launch party"})
+
+	bodies := make([]string, 50)
+	var wg sync.WaitGroup
+	for i := range bodies {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			bodies[i] = site.get("/e/" + event.Slug).Body.String()
+		}()
+	}
+	wg.Wait()
+
+	for i, body := range bodies {
+		if !strings.Contains(body, "Launch party") {
+			t.Errorf("request %d: body = %q, want the event page", i, body)
+		}
+	}
+}
+
+func TestStartupOpensOnePool(t *testing.T) {
+	conns := testPool(t)
+	cfg := testConfig(t)
+
+	// Name the connections the server opens so they can be told apart from
+	// the test's own.
+	const appName = "rsvp-startup-test"
+	t.Setenv("PGAPPNAME", appName)
+	pool := connectDB(cfg, "DATABASE_URL", os.Getenv("TEST_DATABASE_URL"))
+	defer pool.Close()
+	site := newTestSite(t, pool)
+	event := createTestEvent(t, pool, &db.Event{})
+	guest := createTestGuest(t, pool, &db.Guest{EventId: &event.Id})
+
+	var wg sync.WaitGroup
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			site.get("/rsvp?" + site.sessions.rsvpParams(guest, event))
+			site.get("/readyz")
+		}()
+	}
+	wg.Wait()
+
+	var open int
+	err := conns.QueryRow(context.Background(), "select count(*) from pg_stat_activity where application_name = $1", appName).Scan(&open)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := int(pool.Stat().TotalConns()); open != want {
+		t.Errorf("the server has %d connections open, but its pool only holds %d", open, want)
+	}
+}
+
+func TestHomePage(t *testing.T) {
+	// The home page doesn't touch the database.
+	site := newTestSite(t, unreachablePool(t))
+
+	rec := site.get("/")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	if !strings.Contains(rec.Body.String(), "follow the link") {
+		t.Errorf("body isn't the home page:\n%s", rec.Body)
+	}
+}
+
+func TestQueryErrorRendersErrorPage(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	rec := httptest.NewRecorder()
+	serverError(rec, req, &pgconn.PgError{Code: "42P01", Message: `relation "missing" does not exist`})
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusInternalServerError)
+	}
+	if !strings.Contains(rec.Body.String(), "Something went wrong") {
+		t.Errorf("body doesn't contain the error page:\n%s", rec.Body)
+	}
+}
+
+func TestTemplateErrorRendersErrorPage(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	// hello uses .Name, which this data hasn't got.
+	rec := httptest.NewRecorder()
+	renderPage(rec, req, http.StatusOK, "hello", struct{}{})
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusInternalServerError)
+	}
+	if body := rec.Body.String(); !strings.Contains(body, "Something went wrong") || strings.Contains(body, "Hello,") {
+		t.Errorf("body isn't just the error page:\n%s", body)
+	}
+
+	rec = httptest.NewRecorder()
+	renderPage(rec, req, http.StatusOK, "hello", struct{ Name string }{Name: "Ada"})
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "Hello, Ada") {
+		t.Errorf("after the failed render, got status %d and body:\n%s", rec.Code, rec.Body)
+	}
+}
+
+func TestCancelledRequestFailsPromptly(t *testing.T) {
+	pool := testPool(t)
+	site := newTestSite(t, pool)
+	event := createTestEvent(t, pool, &db.Event{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req := httptest.NewRequest(http.MethodGet, "/e/"+event.Slug, nil).WithContext(ctx)
+
+	start := time.Now()
+	rec := site.serve(req)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("the request took %v", elapsed)
+	}
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+}
+
+func TestErrorStatus(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{err: context.Canceled, want: http.StatusServiceUnavailable},
+		{err: fmt.Errorf("finding event: %w", context.DeadlineExceeded), want: http.StatusServiceUnavailable},
+		{err: &net.OpError{Op: "dial", Err: errors.New("connection refused")}, want: http.StatusServiceUnavailable},
+		{err: io.ErrUnexpectedEOF, want: http.StatusServiceUnavailable},
+		{err: errors.New("relation \"users\" does not exist"), want: http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		if got := errorStatus(tt.err); got != tt.want {
+			t.Errorf("errorStatus(%v) = %d, want %d", tt.err, got, tt.want)
+		}
+	}
+}
+
+// createTestEvent inserts e, filling in a slug, title and date if it hasn't
+// got them.
+func createTestEvent(t *testing.T, pool *db.Pool, e *db.Event) *db.Event {
+	t.Helper()
+	if e.Title == "" {
+		e.Title = "Garden Party"
+	}
+	if e.Slug == "" {
+		e.Slug = slugify(e.Title)
+	}
+	if e.Date.IsZero() {
+		e.Date = time.Now().Add(30 * 24 * time.Hour).Truncate(time.Minute)
+	}
+	if err := db.CreateEvent(context.Background(), pool, e); err != nil {
+		t.Fatalf("creating event: %v", err)
+	}
+	return e
+}
+
+// createTestGuest inserts g with a generated invite code of the default
+// length, filling in a name and party sizes if it hasn't got them.
+func createTestGuest(t *testing.T, pool *db.Pool, g *db.Guest) *db.Guest {
+	t.Helper()
+	if g.Name == "" {
+		g.Name = "Ada Lovelace"
+	}
+	g.PartySize = max(g.PartySize, 1)
+	g.MaxPartySize = max(g.MaxPartySize, g.PartySize)
+	if err := createGuest(context.Background(), pool, g, 10); err != nil {
+		t.Fatalf("creating guest: %v", err)
+	}
+	return g
+}
+
+// recordTestResponse records r as guest's response, updating guest to match.
+func recordTestResponse(t *testing.T, pool *db.Pool, guest *db.Guest, r db.Response) db.ResponseResult {
+	t.Helper()
+	result, err := db.RecordResponse(context.Background(), pool, guest.Id, r)
+	if err != nil {
+		t.Fatalf("recording %s's response: %v", guest.Name, err)
+	}
+	*guest = *reloadGuest(t, pool, guest.Id)
+	return result
+}
+
+// eventFormValues returns the admin event form's fields as the form shows
+// them for e.
+func eventFormValues(e *db.Event) url.Values {
+	f := newEventForm(e)
+	values := url.Values{
+		"title":                {f.Title},
+		"slug":                 {f.Slug},
+		"date":                 {f.Date},
+		"ends_at":              {f.EndsAt},
+		"rsvp_deadline":        {f.Deadline},
+		"location":             {f.Location},
+		"description":          {f.Description},
+		"capacity":             {f.Capacity},
+		"timezone":             {f.Timezone},
+		"max_party_size":       {f.MaxPartySize},
+		"seats_per_table":      {f.SeatsPerTable},
+		"thank_you_attending":  {f.ThankYouAttending},
+		"thank_you_declining":  {f.ThankYouDeclining},
+		"primary_color":        {f.PrimaryColor},
+		"background_image_url": {f.BackgroundImageURL},
+		"font":                 {f.Font},
+	}
+	if f.AllowMaybe {
+		values.Set("allow_maybe", "yes")
+	}
+	return values
+}
+
+// reloadGuest loads the guest with the given id as it is now.
+func reloadGuest(t *testing.T, pool *db.Pool, id int) *db.Guest {
+	t.Helper()
+	guest, err := db.FindGuestById(context.Background(), pool, id)
+	if err != nil {
+		t.Fatalf("loading guest %d: %v", id, err)
+	}
+	return guest
+}
+
+func TestParseEnvLine(t *testing.T) {
+	tests := []struct {
+		line       string
+		key, value string
+		ok         bool
+	}{
+		{line: "PORT=8080", key: "PORT", value: "8080", ok: true},
+		{line: " PORT = 8080 ", key: "PORT", value: "8080", ok: true},
+		{line: `TITLE="Garden Party"`, key: "TITLE", value: "Garden Party", ok: true},
+		{line: "TITLE='Garden Party'", key: "TITLE", value: "Garden Party", ok: true},
+		{line: `QUOTE="it's"`, key: "QUOTE", value: "it's", ok: true},
+		{line: `MISMATCHED="value'`, key: "MISMATCHED", value: `"value'`, ok: true},
+		{line: `EMPTY=""`, key: "EMPTY", value: "", ok: true},
+		{line: "EMPTY=", key: "EMPTY", value: "", ok: true},
+		{line: "DATABASE_URL=postgres://localhost/rsvp?sslmode=disable", key: "DATABASE_URL", value: "postgres://localhost/rsvp?sslmode=disable", ok: true},
+		{line: `HASH="a=b=c"`, key: "HASH", value: "a=b=c", ok: true},
+		{line: "NO_EQUALS"},
+		{line: "=value"},
+	}
+	for _, tt := range tests {
+		key, value, ok := parseEnvLine(tt.line)
+		if key != tt.key || value != tt.value || ok != tt.ok {
+			t.Errorf("parseEnvLine(%q) = %q, %q, %v, want %q, %q, %v", tt.line, key, value, ok, tt.key, tt.value, tt.ok)
+		}
+	}
+}
+
+// chdir changes to dir for the rest of the test.
+func chdir(t *testing.T, dir string) {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+}
+
+// unsetenv unsets name for the rest of the test.
+func unsetenv(t *testing.T, name string) {
+	t.Helper()
+	t.Setenv(name, "")
+	os.Unsetenv(name)
+}
+
+func TestLoadEnv(t *testing.T) {
+	dir := t.TempDir()
+	env := strings.Join([]string{
+		"# Settings for development",
+		"",
+		`RSVP_TEST_QUOTED="Garden Party"`,
+		"RSVP_TEST_EQUALS=postgres://localhost/rsvp?sslmode=disable",
+		"   ",
+		"  # RSVP_TEST_COMMENTED=yes",
+		"RSVP_TEST_SET=from .env",
+	}, "\n")
+	if err := os.WriteFile(dir+"/.env", []byte(env), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	chdir(t, dir)
+	for _, name := range []string{"RSVP_TEST_QUOTED", "RSVP_TEST_EQUALS", "RSVP_TEST_COMMENTED"} {
+		unsetenv(t, name)
+	}
+	t.Setenv("RSVP_TEST_SET", "from ENV")
+
+	loadEnv()
+
+	want := map[string]string{
+		"RSVP_TEST_QUOTED": "Garden Party",
+		"RSVP_TEST_EQUALS": "postgres://localhost/rsvp?sslmode=disable",
+		"RSVP_TEST_SET":    "from ENV",
+	}
+	for name, value := range want {
+		if got := os.Getenv(name); got != value {
+			t.Errorf("%s = %q, want %q", name, got, value)
+		}
+	}
+	if value, ok := os.LookupEnv("RSVP_TEST_COMMENTED"); ok {
+		t.Errorf("RSVP_TEST_COMMENTED = %q, want it unset", value)
+	}
+}
+
+func TestLoadEnvWithoutFile(t *testing.T) {
+	chdir(t, t.TempDir())
+	logs := captureLogs(t)
+	t.Setenv("PORT", "8080")
+	t.Setenv("DATABASE_URL", "postgres://db.internal/rsvp")
+
+	loadEnv()
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	if cfg.Port != 8080 || cfg.DatabaseURL != "postgres://db.internal/rsvp" {
+		t.Errorf("Port = %d, DatabaseURL = %q, want the values from ENV", cfg.Port, cfg.DatabaseURL)
+	}
+	lines := logLines(t, logs)
+	if len(lines) != 1 || lines[0]["level"] != "INFO" || lines[0]["msg"] != "No .env file: Using ENV variables only" {
+		t.Errorf("logged %v, want one info line saying there's no .env", lines)
+	}
+}
+
+// A malformed .env still stops startup. loadEnv exits when it finds one, so
+// the test runs it in a child process.
+func TestLoadEnvRejectsMalformedFile(t *testing.T) {
+	if os.Getenv("RSVP_TEST_LOAD_ENV") == "1" {
+		slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, nil)))
+		loadEnv()
+		return
+	}
+
+	dir := t.TempDir()
+	if err := os.WriteFile(dir+"/.env", []byte("PORT=8080\nnot a setting\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command(os.Args[0], "-test.run=^TestLoadEnvRejectsMalformedFile$")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "RSVP_TEST_LOAD_ENV=1")
+	out, err := cmd.CombinedOutput()
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 1 {
+		t.Fatalf("err = %v, want exit status 1\n%s", err, out)
+	}
+	if !strings.Contains(string(out), "Malformed line in .env") || !strings.Contains(string(out), `line="not a setting"`) {
+		t.Errorf("output doesn't report the malformed line:\n%s", out)
+	}
+}
+
+func TestWithSSLMode(t *testing.T) {
+	tests := []struct {
+		conn    string
+		mode    string
+		want    string
+		wantErr bool
+	}{
+		{conn: "postgres://db.internal/rsvp", mode: "require", want: "postgres://db.internal/rsvp?sslmode=require"},
+		{conn: "postgresql://u:p@db.internal:5433/rsvp?sslmode=disable&application_name=rsvp", mode: "verify-full", want: "postgresql://u:p@db.internal:5433/rsvp?application_name=rsvp&sslmode=verify-full"},
+		{conn: "host=db.internal dbname=rsvp sslmode=disable", mode: "require", want: "host=db.internal dbname=rsvp sslmode=disable sslmode=require"},
+		{conn: "postgres://db.internal/rsvp", mode: "always", wantErr: true},
+		{conn: "postgres://db.internal:port/rsvp", mode: "require", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := withSSLMode(tt.conn, tt.mode)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("withSSLMode(%q, %q) = %q, want an error", tt.conn, tt.mode, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("withSSLMode(%q, %q) = %q, %v, want %q", tt.conn, tt.mode, got, err, tt.want)
+		}
+	}
+}
+
+func TestDBConfig(t *testing.T) {
+	tests := []struct {
+		name        string
+		conn        string
+		env         map[string]string
+		wantTLS     bool
+		wantTimeout time.Duration
+		wantConns   int32
+	}{
+		{
+			name:        "from the URL",
+			conn:        "postgres://rsvp@db.internal/rsvp?sslmode=require&connect_timeout=30",
+			wantTLS:     true,
+			wantTimeout: 30 * time.Second,
+			wantConns:   10,
+		},
+		{
+			name:        "overridden",
+			conn:        "postgres://rsvp@db.internal/rsvp?sslmode=require&connect_timeout=30",
+			env:         map[string]string{"DB_SSLMODE": "disable", "DB_CONNECT_TIMEOUT": "3s", "DB_MAX_CONNS": "4"},
+			wantTimeout: 3 * time.Second,
+			wantConns:   4,
+		},
+		{
+			name:        "key=value string, overridden",
+			conn:        "host=db.internal user=rsvp dbname=rsvp sslmode=disable",
+			env:         map[string]string{"DB_SSLMODE": "require"},
+			wantTLS:     true,
+			wantTimeout: 0,
+			wantConns:   10,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, name := range []string{"DB_SSLMODE", "DB_CONNECT_TIMEOUT", "DB_MAX_CONNS"} {
+				unsetenv(t, name)
+			}
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+			cfg := testConfig(t)
+
+			config, err := dbConfig(cfg, "DATABASE_URL", tt.conn)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := config.ConnConfig.TLSConfig != nil; got != tt.wantTLS {
+				t.Errorf("TLS = %v, want %v", got, tt.wantTLS)
+			}
+			if got := config.ConnConfig.ConnectTimeout; got != tt.wantTimeout {
+				t.Errorf("ConnectTimeout = %v, want %v", got, tt.wantTimeout)
+			}
+			if config.MaxConns != tt.wantConns {
+				t.Errorf("MaxConns = %d, want %d", config.MaxConns, tt.wantConns)
+			}
+			if config.ConnConfig.Host != "db.internal" || config.ConnConfig.User != "rsvp" || config.ConnConfig.Database != "rsvp" {
+				t.Errorf("connecting to %s@%s/%s, want rsvp@db.internal/rsvp", config.ConnConfig.User, config.ConnConfig.Host, config.ConnConfig.Database)
+			}
+		})
+	}
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := dbConfig(testConfig(t), "DATABASE_REPLICA_URL", "postgres://db.internal/rsvp?connect_timeout=soon")
+		if err == nil || !strings.HasPrefix(err.Error(), "DATABASE_REPLICA_URL: ") {
+			t.Errorf("err = %v, want one naming DATABASE_REPLICA_URL", err)
+		}
+	})
+}
+
+func TestRetryConnect(t *testing.T) {
+	logs := captureLogs(t)
+	refused := errors.New("connection refused")
+	calls := 0
+	connect := func(ctx context.Context) error {
+		calls++
+		if calls <= 2 {
+			return refused
+		}
+		return nil
+	}
+
+	if err := retryConnect(context.Background(), 5, time.Millisecond, connect); err != nil {
+		t.Fatalf("retryConnect: %v", err)
+	}
+	if calls != 3 {
+		t.Errorf("connected %d times, want 3", calls)
+	}
+	var attempts []float64
+	for _, line := range logLines(t, logs) {
+		if line["msg"] == "Connecting to database failed, retrying" {
+			attempts = append(attempts, line["attempt"].(float64))
+		}
+	}
+	if !slices.Equal(attempts, []float64{1, 2}) {
+		t.Errorf("logged retries after attempts %v, want [1 2]", attempts)
+	}
+}
+
+func TestRetryConnectGivesUp(t *testing.T) {
+	refused := errors.New("connection refused")
+	calls := 0
+	err := retryConnect(context.Background(), 2, time.Millisecond, func(ctx context.Context) error {
+		calls++
+		return refused
+	})
+	if !errors.Is(err, refused) || !strings.Contains(err.Error(), "after 2 attempts") {
+		t.Errorf("err = %v, want %v after 2 attempts", err, refused)
+	}
+	if calls != 2 {
+		t.Errorf("connected %d times, want 2", calls)
+	}
+}
+
+func TestRetryConnectStopsWhenCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	err := retryConnect(ctx, 5, time.Hour, func(ctx context.Context) error {
+		cancel()
+		return errors.New("connection refused")
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestListenAddr(t *testing.T) {
+	tests := []struct {
+		bindAddr string
+		want     string
+	}{
+		{bindAddr: "", want: ":8080"},
+		{bindAddr: "127.0.0.1", want: "127.0.0.1:8080"},
+		{bindAddr: "localhost", want: "localhost:8080"},
+		{bindAddr: "::1", want: "[::1]:8080"},
+		{bindAddr: "[::1]", want: "[::1]:8080"},
+	}
+	for _, tt := range tests {
+		t.Setenv("BIND_ADDR", tt.bindAddr)
+		if got := newServer(testConfig(t), http.NotFoundHandler()).Addr; got != tt.want {
+			t.Errorf("BIND_ADDR=%q: Addr = %q, want %q", tt.bindAddr, got, tt.want)
+		}
+	}
+}
+
+func TestNewServerTimeouts(t *testing.T) {
+	cfg := testConfig(t)
+	server := newServer(cfg, http.NotFoundHandler())
+	if server.ReadHeaderTimeout != 5*time.Second || server.ReadTimeout != 15*time.Second ||
+		server.WriteTimeout != 30*time.Second || server.IdleTimeout != 120*time.Second {
+		t.Errorf("default timeouts are %v, %v, %v and %v", server.ReadHeaderTimeout, server.ReadTimeout, server.WriteTimeout, server.IdleTimeout)
+	}
+
+	t.Setenv("READ_HEADER_TIMEOUT", "2s")
+	t.Setenv("READ_TIMEOUT", "1m")
+	t.Setenv("WRITE_TIMEOUT", "90s")
+	t.Setenv("IDLE_TIMEOUT", "5m")
+	server = newServer(testConfig(t), http.NotFoundHandler())
+	if server.ReadHeaderTimeout != 2*time.Second || server.ReadTimeout != time.Minute ||
+		server.WriteTimeout != 90*time.Second || server.IdleTimeout != 5*time.Minute {
+		t.Errorf("configured timeouts are %v, %v, %v and %v", server.ReadHeaderTimeout, server.ReadTimeout, server.WriteTimeout, server.IdleTimeout)
+	}
+}
+
+func TestServerDropsSlowHeaders(t *testing.T) {
+	t.Setenv("READ_HEADER_TIMEOUT", "100ms")
+	server := newServer(testConfig(t), http.NotFoundHandler())
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(ln)
+	defer server.Close()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	// Start a request but never finish its headers.
+	io.WriteString(conn, "GET / HTTP/1.1\r\nHost: example.com\r\n")
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	start := time.Now()
+	_, err = io.ReadAll(conn)
+	if err != nil {
+		t.Fatalf("the connection wasn't closed: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("the connection was closed after %v", elapsed)
+	}
+}
+
+func TestServeShutsDownGracefully(t *testing.T) {
+	// Take SIGINT from here on, so that it can't stop the tests before
+	// serve is listening for it.
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt)
+	defer signal.Stop(signals)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	server := &http.Server{Addr: addr, Handler: http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		close(started)
+		<-release
+		io.WriteString(rw, "finished")
+	})}
+	shuttingDown := make(chan struct{})
+	server.RegisterOnShutdown(func() { close(shuttingDown) })
+
+	served := make(chan error, 1)
+	go func() { served <- serve(server, 5*time.Second) }()
+
+	type result struct {
+		body string
+		err  error
+	}
+	responses := make(chan result, 1)
+	go func() {
+		var resp *http.Response
+		var err error
+		for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+			if resp, err = http.Get("http://" + addr); err == nil {
+				break
+			}
+		}
+		if err != nil {
+			responses <- result{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		responses <- result{body: string(body), err: err}
+	}()
+
+	select {
+	case <-started:
+	case r := <-responses:
+		t.Fatalf("request finished before reaching the handler: %v", r.err)
+	}
+
+	process, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Keep signalling until serve has noticed, in case it wasn't listening
+	// for signals yet.
+	for noticed := false; !noticed; {
+		if err := process.Signal(os.Interrupt); err != nil {
+			t.Skipf("can't send SIGINT: %v", err)
+		}
+		select {
+		case <-shuttingDown:
+			noticed = true
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+
+	close(release)
+	if r := <-responses; r.err != nil || r.body != "finished" {
+		t.Errorf("in-flight request got %q, %v, want it to finish", r.body, r.err)
+	}
+	if err := <-served; err != nil {
+		t.Errorf("serve returned %v", err)
+	}
+	if conn, err := net.Dial("tcp", addr); err == nil {
+		conn.Close()
+		t.Errorf("%s still accepts connections after shutdown", addr)
+	}
+}
+
+func TestUnknownRoutesAreNotFound(t *testing.T) {
+	site := newTestSite(t, unreachablePool(t))
+
+	for _, path := range []string{"/no/such/page", "/rsvp/ABC/nothing", "/static/no-such-file.css"} {
+		rec := site.get(path)
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("GET %s: status = %d, want %d", path, rec.Code, http.StatusNotFound)
+			continue
+		}
+		if path == "/no/such/page" && !strings.Contains(rec.Body.String(), "<h1>Page not found</h1>") {
+			t.Errorf("GET %s: body isn't the not found page:\n%s", path, rec.Body)
+		}
+	}
+}
+
+// With a replica configured, pages that only read use it, while responses
+// are still written to the primary. The replica here is unreachable, so a
+// read from it fails.
+func TestReadsUseReplica(t *testing.T) {
+	pool := testPool(t)
+	site := newTestSite(t, pool)
+	event := createTestEvent(t, pool, &db.Event{})
+	guest := createTestGuest(t, pool, &db.Guest{EventId: &event.Id})
+
+	reads := []string{
+		site.sessions.rsvpPath(guest, event),
+		site.apiPath(guest),
+		"/e/" + event.Slug,
+		"/admin/",
+		"/admin/events/" + event.Slug + "/guests",
+	}
+	for _, path := range reads {
+		if rec := site.get(path, site.adminSession()); rec.Code != http.StatusOK {
+			t.Errorf("without a replica, GET %s: status = %d, want %d", path, rec.Code, http.StatusOK)
+		}
+	}
+
+	site.handler = newHandler(site.cfg, pool, unreachablePool(t), site.sessions, site.mailer, nil, site.reminders)
+	for _, path := range reads {
+		if rec := site.get(path, site.adminSession()); rec.Code != http.StatusServiceUnavailable {
+			t.Errorf("GET %s: status = %d, want %d from reading the replica", path, rec.Code, http.StatusServiceUnavailable)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodPost, site.apiPath(guest), strings.NewReader(`{"attending": true, "party_size": 1}`))
+	req.Header.Set("Content-Type", "application/json")
+	if rec := site.serve(req); rec.Code != http.StatusOK {
+		t.Errorf("POST %s: status = %d, want %d from writing to the primary\n%s", site.apiPath(guest), rec.Code, http.StatusOK, rec.Body)
+	}
+	if !reloadGuest(t, pool, guest.Id).IsAttending() {
+		t.Error("the response wasn't saved to the primary")
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+// routeMethods are the methods checked for when working out which ones a
+// path supports.
+var routeMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+
+// allowedMethods lists the methods mux has a route for at req's path. Only
+// routes registered with a method count; catch-all routes don't.
+func allowedMethods(mux *http.ServeMux, req *http.Request) []string {
+	var allowed []string
+	for _, method := range routeMethods {
+		probe := *req
+		probe.Method = method
+		_, pattern := mux.Handler(&probe)
+		if strings.HasPrefix(pattern, method+" ") || (method == http.MethodHead && strings.HasPrefix(pattern, "GET ")) {
+			allowed = append(allowed, method)
+		}
+	}
+	return allowed
+}
+
+// methodFallback handles requests that matched none of mux's routes for
+// their method. If the path has routes for other methods, OPTIONS requests
+// are answered with an Allow header listing them and anything else gets a
+// 405; otherwise the path doesn't exist.
+func methodFallback(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		allowed := allowedMethods(mux, req)
+		if len(allowed) == 0 {
+			notFound(rw, req)
+			return
+		}
+
+		rw.Header().Set("Allow", strings.Join(append(allowed, http.MethodOptions), ", "))
+		if req.Method == http.MethodOptions {
+			rw.WriteHeader(http.StatusNoContent)
+			return
+		}
+		statusError(rw, req, http.StatusMethodNotAllowed, "method_not_allowed")
+	})
+}
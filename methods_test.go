@@ -0,0 +1,99 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/meagar/rsvp/db"
+)
+
+func TestHeadRSVPPage(t *testing.T) {
+	pool := testPool(t)
+	site := newTestSite(t, pool)
+	event := createTestEvent(t, pool, &db.Event{})
+	guest := createTestGuest(t, pool, &db.Guest{EventId: &event.Id})
+	server := httptest.NewServer(site.handler)
+	defer server.Close()
+	url := server.URL + "/rsvp?" + site.sessions.rsvpParams(guest, event)
+
+	get, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	get.Body.Close()
+
+	res, err := http.Head(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("status = %d, want %d", res.StatusCode, http.StatusOK)
+	}
+	if got, want := res.Header.Get("Content-Type"), get.Header.Get("Content-Type"); got != want {
+		t.Errorf("Content-Type = %q, want %q as for GET", got, want)
+	}
+	if body, _ := io.ReadAll(res.Body); len(body) != 0 {
+		t.Errorf("HEAD returned a body:\n%s", body)
+	}
+}
+
+// checkAllowedMethods checks that OPTIONS on path lists wantAllow, and that
+// DELETE, which nothing allows, is refused with the same list.
+func checkAllowedMethods(t *testing.T, site *testSite, path, wantAllow string) {
+	t.Helper()
+	request := func(method string) *http.Request {
+		req := httptest.NewRequest(method, path, nil)
+		req.AddCookie(site.adminSession())
+		req.AddCookie(&http.Cookie{Name: csrfCookie, Value: testCSRFToken})
+		req.Header.Set(csrfHeader, testCSRFToken)
+		return req
+	}
+
+	rec := site.serve(request(http.MethodOptions))
+	if rec.Code != http.StatusNoContent || rec.Header().Get("Allow") != wantAllow {
+		t.Errorf("OPTIONS: status = %d, Allow = %q, want %d and %q", rec.Code, rec.Header().Get("Allow"), http.StatusNoContent, wantAllow)
+	}
+	if rec.Body.Len() != 0 {
+		t.Errorf("OPTIONS returned a body:\n%s", rec.Body)
+	}
+
+	rec = site.serve(request(http.MethodDelete))
+	if rec.Code != http.StatusMethodNotAllowed || rec.Header().Get("Allow") != wantAllow {
+		t.Errorf("DELETE: status = %d, Allow = %q, want %d and %q", rec.Code, rec.Header().Get("Allow"), http.StatusMethodNotAllowed, wantAllow)
+	}
+}
+
+func TestOptionsAndDisallowedMethods(t *testing.T) {
+	site := newTestSite(t, unreachablePool(t))
+
+	tests := []struct {
+		path      string
+		wantAllow string
+	}{
+		{path: "/rsvp", wantAllow: "GET, HEAD, POST, OPTIONS"},
+		{path: "/rsvp/ABC", wantAllow: "GET, HEAD, POST, OPTIONS"},
+		{path: "/rsvp/ABC/cancel", wantAllow: "GET, HEAD, POST, OPTIONS"},
+		{path: "/e/garden-party", wantAllow: "GET, HEAD, OPTIONS"},
+		{path: "/healthz", wantAllow: "GET, HEAD, OPTIONS"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			checkAllowedMethods(t, site, tt.path, tt.wantAllow)
+		})
+	}
+
+	req := httptest.NewRequest(http.MethodOptions, "/no/such/page", nil)
+	if rec := site.serve(req); rec.Code != http.StatusNotFound {
+		t.Errorf("OPTIONS on a missing page: status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+// The admin site checks sessions against the database before it gets as far
+// as the method.
+func TestAdminOptionsAndDisallowedMethods(t *testing.T) {
+	site := newTestSite(t, testPool(t))
+	checkAllowedMethods(t, site, "/admin/guests/1", "GET, HEAD, POST, OPTIONS")
+}
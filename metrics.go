@@ -0,0 +1,89 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// metrics records Prometheus metrics about the requests we serve.
+type metrics struct {
+	registry *prometheus.Registry
+	requests *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+}
+
+func newMetrics(pool *pgxpool.Pool) *metrics {
+	m := &metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "rsvp_http_requests_total",
+			Help: "HTTP requests handled, by route and status code.",
+		}, []string{"path", "status"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "rsvp_http_request_duration_seconds",
+			Help:    "Time taken to handle HTTP requests, by route.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"path"}),
+	}
+
+	m.registry.MustRegister(
+		m.requests,
+		m.duration,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "rsvp_db_pool_acquired_connections",
+			Help: "Database connections currently in use.",
+		}, func() float64 { return float64(pool.Stat().AcquiredConns()) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "rsvp_db_pool_total_connections",
+			Help: "Database connections currently open.",
+		}, func() float64 { return float64(pool.Stat().TotalConns()) }),
+	)
+	return m
+}
+
+// instrument records metrics for every request served by mux. Requests are
+// labelled by the pattern they matched rather than their raw path, so that
+// invite codes and slugs don't each get their own series.
+func (m *metrics) instrument(mux *http.ServeMux, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		start := time.Now()
+		_, pattern := mux.Handler(req)
+
+		rec := &statusRecorder{ResponseWriter: rw}
+		next.ServeHTTP(rec, req)
+
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		m.requests.WithLabelValues(pattern, strconv.Itoa(rec.status)).Inc()
+		m.duration.WithLabelValues(pattern).Observe(time.Since(start).Seconds())
+	})
+}
+
+// handler serves the metrics for scraping. If token is set, scrapers must
+// send it as a bearer token.
+func (m *metrics) handler(token string) http.Handler {
+	metrics := promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+	if token == "" {
+		return metrics
+	}
+
+	want := []byte("Bearer " + token)
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(req.Header.Get("Authorization")), want) != 1 {
+			rw.Header().Set("WWW-Authenticate", `Bearer realm="metrics"`)
+			http.Error(rw, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		metrics.ServeHTTP(rw, req)
+	})
+}
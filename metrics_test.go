@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bufio"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// scrapeMetric returns the value of the sample in the /metrics output whose
+// name and labels are series, or 0 if there isn't one.
+func scrapeMetric(t *testing.T, site *testSite, series string) float64 {
+	t.Helper()
+	rec := site.get(site.cfg.MetricsPath)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("scraping: status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	scanner := bufio.NewScanner(rec.Body)
+	for scanner.Scan() {
+		value, ok := strings.CutPrefix(scanner.Text(), series+" ")
+		if !ok {
+			continue
+		}
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			t.Fatalf("parsing %s: %v", series, err)
+		}
+		return n
+	}
+	return 0
+}
+
+func TestMetricsCountRequests(t *testing.T) {
+	site := newTestSite(t, unreachablePool(t))
+	const healthz = `rsvp_http_requests_total{path="GET /healthz",status="200"}`
+	const notFound = `rsvp_http_requests_total{path="/",status="404"}`
+
+	rec := site.get(site.cfg.MetricsPath)
+	if !strings.Contains(rec.Body.String(), "rsvp_db_pool_acquired_connections") {
+		t.Errorf("the pool's connections aren't reported:\n%s", rec.Body)
+	}
+
+	before := scrapeMetric(t, site, healthz)
+	for range 3 {
+		site.get("/healthz")
+	}
+	site.get("/no/such/page")
+	if got := scrapeMetric(t, site, healthz); got != before+3 {
+		t.Errorf("%s went from %v to %v, want %v", healthz, before, got, before+3)
+	}
+	if got := scrapeMetric(t, site, notFound); got != 1 {
+		t.Errorf("%s = %v, want 1", notFound, got)
+	}
+	if got := scrapeMetric(t, site, `rsvp_http_request_duration_seconds_count{path="GET /healthz"}`); got != before+3 {
+		t.Errorf("the duration of %v /healthz requests was recorded, want %v", got, before+3)
+	}
+}
+
+func TestMetricsToken(t *testing.T) {
+	t.Setenv("METRICS_PATH", "/internal/metrics")
+	t.Setenv("METRICS_TOKEN", "s3cret")
+	site := newTestSite(t, unreachablePool(t))
+
+	tests := []struct {
+		auth string
+		want int
+	}{
+		{auth: "", want: http.StatusUnauthorized},
+		{auth: "Bearer wrong", want: http.StatusUnauthorized},
+		{auth: "Bearer s3cret", want: http.StatusOK},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest(http.MethodGet, "/internal/metrics", nil)
+		if tt.auth != "" {
+			req.Header.Set("Authorization", tt.auth)
+		}
+		if rec := site.serve(req); rec.Code != tt.want {
+			t.Errorf("Authorization %q: status = %d, want %d", tt.auth, rec.Code, tt.want)
+		}
+	}
+	if rec := site.get("/metrics"); rec.Code != http.StatusNotFound {
+		t.Errorf("GET /metrics: status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migrations) == 0 {
+		t.Fatal("no migrations were loaded")
+	}
+	for i, m := range migrations {
+		if i > 0 && m.version <= migrations[i-1].version {
+			t.Errorf("migration %s comes after %s", m.name, migrations[i-1].name)
+		}
+		if m.sql == "" {
+			t.Errorf("migration %s is empty", m.name)
+		}
+	}
+}
+
+// emptySchema creates a new, empty schema in TEST_DATABASE_URL's database,
+// skipping the test if it's unset, and returns the connection string and the
+// schema. The schema is dropped when the test ends.
+func emptySchema(t *testing.T) (conn, schema string) {
+	t.Helper()
+	conn = os.Getenv("TEST_DATABASE_URL")
+	if conn == "" {
+		t.Skip("TEST_DATABASE_URL is unset")
+	}
+	ctx := context.Background()
+
+	schema = fmt.Sprintf("rsvp_test_%d", time.Now().UnixNano())
+	admin, err := pgx.Connect(ctx, conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer admin.Close(ctx)
+	if _, err := admin.Exec(ctx, "create schema "+schema); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		admin, err := pgx.Connect(ctx, conn)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer admin.Close(ctx)
+		if _, err := admin.Exec(ctx, "drop schema "+schema+" cascade"); err != nil {
+			t.Error(err)
+		}
+	})
+	return conn, schema
+}
+
+// emptySchemaPool connects to TEST_DATABASE_URL with a new, empty schema
+// first on the search path, skipping the test if it's unset. The schema is
+// dropped when the test ends.
+func emptySchemaPool(t *testing.T) *pgxpool.Pool {
+	t.Helper()
+	conn, schema := emptySchema(t)
+	config, err := pgxpool.ParseConfig(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// public stays on the path for any extensions installed there.
+	config.ConnConfig.RuntimeParams["search_path"] = schema + ", public"
+	pool, err := pgxpool.NewWithConfig(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(pool.Close)
+	return pool
+}
+
+// emptySchemaURL is like emptySchemaPool, but returns a URL to connect to,
+// for commands that open their own pool. TEST_DATABASE_URL may be a URL or
+// keyword/value pairs, so it's parsed and then written back out as a URL.
+func emptySchemaURL(t *testing.T) string {
+	t.Helper()
+	conn, schema := emptySchema(t)
+	config, err := pgconn.ParseConfig(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	params := url.Values{}
+	for name, value := range config.RuntimeParams {
+		params.Set(name, value)
+	}
+	params.Set("search_path", schema+", public")
+	if config.TLSConfig == nil {
+		params.Set("sslmode", "disable")
+	}
+	u := url.URL{
+		Scheme: "postgres",
+		User:   url.UserPassword(config.User, config.Password),
+		Path:   "/" + config.Database,
+	}
+	// A host that's a directory is a Unix socket, which a URL can only give
+	// as a parameter.
+	if strings.HasPrefix(config.Host, "/") {
+		params.Set("host", config.Host)
+		params.Set("port", strconv.Itoa(int(config.Port)))
+	} else {
+		u.Host = net.JoinHostPort(config.Host, strconv.Itoa(int(config.Port)))
+	}
+	u.RawQuery = params.Encode()
+	return u.String()
+}
+
+// appliedMigrations returns when each recorded migration was applied, by
+// version.
+func appliedMigrations(t *testing.T, pool *pgxpool.Pool) map[int]time.Time {
+	t.Helper()
+	rows, err := pool.Query(context.Background(), "select version, applied_at from schema_migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	applied := map[int]time.Time{}
+	var version int
+	var at time.Time
+	_, err = pgx.ForEachRow(rows, []any{&version, &at}, func() error {
+		applied[version] = at
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return applied
+}
+
+func TestRunMigrationsAppliesEachOnce(t *testing.T) {
+	pool := emptySchemaPool(t)
+	ctx := context.Background()
+	migrations, err := loadMigrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := runMigrations(ctx, pool); err != nil {
+		t.Fatalf("first run: %v", err)
+	}
+	first := appliedMigrations(t, pool)
+	if len(first) != len(migrations) {
+		t.Fatalf("%d migrations were recorded, want %d", len(first), len(migrations))
+	}
+	for _, m := range migrations {
+		if _, ok := first[m.version]; !ok {
+			t.Errorf("migration %s wasn't recorded", m.name)
+		}
+	}
+
+	if err := runMigrations(ctx, pool); err != nil {
+		t.Fatalf("second run: %v", err)
+	}
+	second := appliedMigrations(t, pool)
+	if len(second) != len(first) {
+		t.Errorf("the second run recorded %d migrations, want %d", len(second), len(first))
+	}
+	for version, at := range first {
+		if !second[version].Equal(at) {
+			t.Errorf("migration %d was applied again at %v", version, second[version])
+		}
+	}
+}
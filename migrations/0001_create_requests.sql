@@ -1,5 +1,5 @@
-create table if not exists requets(
+create table if not exists requests(
   id serial primary key,
   created_at timestamp with time zone default now(),
   path varchar(5000)
-);
\ No newline at end of file
+);
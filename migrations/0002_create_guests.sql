@@ -0,0 +1,10 @@
+create table if not exists guests(
+  id serial primary key,
+  invite_code varchar(64) not null unique,
+  name varchar(500) not null,
+  email varchar(500) not null default '',
+  party_size integer not null default 1,
+  max_party_size integer not null default 1,
+  responded_at timestamp with time zone,
+  attending boolean
+);
@@ -0,0 +1,11 @@
+create table if not exists events(
+  id serial primary key,
+  slug varchar(200) not null unique,
+  title varchar(500) not null,
+  date timestamp with time zone not null,
+  location varchar(1000) not null default '',
+  description text not null default ''
+);
+
+alter table guests add column if not exists event_id integer references events(id) on delete set null;
+create index if not exists guests_event_id_idx on guests(event_id);
@@ -0,0 +1,7 @@
+create table if not exists plus_ones(
+  id serial primary key,
+  guest_id integer not null references guests(id) on delete cascade,
+  position integer not null,
+  name varchar(500) not null,
+  unique (guest_id, position)
+);
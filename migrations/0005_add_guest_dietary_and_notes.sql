@@ -0,0 +1,2 @@
+alter table guests add column if not exists dietary text not null default '';
+alter table guests add column if not exists notes text not null default '';
@@ -0,0 +1 @@
+alter table events add column if not exists ends_at timestamp with time zone;
@@ -0,0 +1 @@
+alter table events add column if not exists rsvp_deadline timestamp with time zone;
@@ -0,0 +1 @@
+alter table guests add column if not exists reminder_sent_at timestamp with time zone;
@@ -0,0 +1,2 @@
+alter table events add column if not exists capacity integer check (capacity > 0);
+alter table guests add column if not exists waitlisted_at timestamp with time zone;
@@ -0,0 +1,2 @@
+alter table events add column if not exists thank_you_attending text not null default '';
+alter table events add column if not exists thank_you_declining text not null default '';
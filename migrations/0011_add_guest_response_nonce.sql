@@ -0,0 +1,2 @@
+alter table guests add column if not exists response_nonce varchar(64);
+alter table guests add column if not exists response_nonce_at timestamp with time zone;
@@ -0,0 +1 @@
+alter table guests add column if not exists deleted_at timestamp with time zone;
@@ -0,0 +1,10 @@
+create table if not exists audit_log(
+  id serial primary key,
+  admin_user varchar(200) not null,
+  action varchar(100) not null,
+  target varchar(500) not null default '',
+  details text not null default '',
+  created_at timestamp with time zone not null default now()
+);
+
+create index if not exists audit_log_created_at_idx on audit_log(created_at);
@@ -0,0 +1,13 @@
+create table if not exists rsvp_events(
+  id serial primary key,
+  guest_id integer not null references guests(id) on delete cascade,
+  attending boolean not null,
+  party_size integer not null,
+  plus_ones text[] not null default '{}',
+  dietary text not null default '',
+  notes text not null default '',
+  waitlisted boolean not null default false,
+  created_at timestamp with time zone not null default now()
+);
+
+create index if not exists rsvp_events_guest_id_idx on rsvp_events(guest_id, created_at);
@@ -0,0 +1,10 @@
+create table if not exists households(
+  id serial primary key,
+  event_id integer not null references events(id) on delete cascade,
+  name text not null,
+  unique (event_id, name)
+);
+
+alter table guests add column if not exists household_id integer references households(id) on delete set null;
+
+create index if not exists guests_household_id_idx on guests(household_id);
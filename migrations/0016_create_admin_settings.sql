@@ -0,0 +1,5 @@
+create table if not exists admin_settings(
+  key text primary key,
+  value text not null,
+  updated_at timestamp with time zone not null default now()
+);
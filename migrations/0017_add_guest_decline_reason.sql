@@ -0,0 +1,3 @@
+alter table guests add column if not exists decline_reason text not null default '';
+
+alter table rsvp_events add column if not exists decline_reason text not null default '';
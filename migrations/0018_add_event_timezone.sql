@@ -0,0 +1 @@
+alter table events add column if not exists timezone text not null default '';
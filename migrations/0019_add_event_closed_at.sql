@@ -0,0 +1 @@
+alter table events add column if not exists closed_at timestamp with time zone;
@@ -0,0 +1,4 @@
+alter table guests add column if not exists email_verified_at timestamp with time zone;
+
+-- Addresses entered by hosts before guests could change them are trusted.
+update guests set email_verified_at = now() where email <> '' and email_verified_at is null;
@@ -0,0 +1,3 @@
+alter table events add column if not exists primary_color text not null default '';
+alter table events add column if not exists background_image_url text not null default '';
+alter table events add column if not exists font text not null default '';
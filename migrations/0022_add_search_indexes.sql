@@ -0,0 +1,25 @@
+-- Trigram indexes let the admin search's "ilike '%...%'" queries use an index.
+-- Creating the pg_trgm extension needs superuser rights, or database owner on
+-- PostgreSQL 13 and later, so if it can't be created here the indexes are
+-- skipped and search falls back to scanning. Run "create extension pg_trgm" as
+-- a superuser and create these indexes by hand to get them back.
+do $$
+begin
+  create extension if not exists pg_trgm;
+exception
+  when insufficient_privilege or undefined_file then
+    raise notice 'Skipping trigram search indexes: pg_trgm can''t be created (%)', sqlerrm;
+    return;
+end
+$$;
+
+do $$
+begin
+  if exists (select from pg_extension where extname = 'pg_trgm') then
+    create index if not exists guests_name_trgm_idx on guests using gin (name gin_trgm_ops);
+    create index if not exists guests_email_trgm_idx on guests using gin (email gin_trgm_ops);
+    create index if not exists events_title_trgm_idx on events using gin (title gin_trgm_ops);
+    create index if not exists events_slug_trgm_idx on events using gin (slug gin_trgm_ops);
+  end if;
+end
+$$;
@@ -0,0 +1 @@
+alter table events add column if not exists max_party_size integer check (max_party_size > 0);
@@ -0,0 +1,2 @@
+alter table guests add column if not exists table_assignment text not null default '';
+alter table events add column if not exists seats_per_table integer check (seats_per_table > 0);
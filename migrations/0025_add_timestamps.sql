@@ -0,0 +1,19 @@
+alter table events add column if not exists created_at timestamp with time zone not null default now();
+alter table events add column if not exists updated_at timestamp with time zone not null default now();
+alter table guests add column if not exists created_at timestamp with time zone not null default now();
+alter table guests add column if not exists updated_at timestamp with time zone not null default now();
+
+create or replace function set_updated_at() returns trigger as $$
+begin
+  new.updated_at = now();
+  return new;
+end;
+$$ language plpgsql;
+
+drop trigger if exists events_set_updated_at on events;
+create trigger events_set_updated_at before update on events
+  for each row execute function set_updated_at();
+
+drop trigger if exists guests_set_updated_at on guests;
+create trigger guests_set_updated_at before update on guests
+  for each row execute function set_updated_at();
@@ -0,0 +1,9 @@
+alter table guests alter column attending type text
+  using case when attending then 'yes' when not attending then 'no' end;
+alter table guests add constraint guests_attending_check check (attending in ('yes', 'no', 'maybe'));
+
+alter table rsvp_events alter column attending type text
+  using case when attending then 'yes' else 'no' end;
+alter table rsvp_events add constraint rsvp_events_attending_check check (attending in ('yes', 'no', 'maybe'));
+
+alter table events add column if not exists allow_maybe boolean not null default false;
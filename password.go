@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/meagar/rsvp/db"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// minPasswordLength and maxPasswordLength bound the length of an admin
+// password, in bytes. bcrypt ignores anything past 72 bytes.
+const (
+	minPasswordLength = 12
+	maxPasswordLength = 72
+)
+
+type passwordFormData struct {
+	adminPage
+	Error   string
+	Changed bool
+}
+
+func (h *AdminHandler) passwordForm(rw http.ResponseWriter, req *http.Request) {
+	renderPage(rw, req, http.StatusOK, "admin/password", passwordFormData{adminPage: h.page(req)})
+}
+
+// currentPasswordHash returns the admin password hash saved in the database,
+// falling back to fallback, from ADMIN_PASSWORD_HASH, if the password has
+// never been changed.
+func currentPasswordHash(ctx context.Context, q db.Querier, fallback []byte) ([]byte, error) {
+	hash, err := db.GetAdminSetting(ctx, q, db.AdminPasswordHash)
+	if errors.Is(err, db.ErrNotFound) {
+		return fallback, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return []byte(hash), nil
+}
+
+// adminSession returns the admin user named by the request's session cookie,
+// provided the session was started with the current password, whose hash is
+// loaded from q with ADMIN_PASSWORD_HASH as the fallback.
+func adminSession(req *http.Request, cfg *Config, q db.Querier, sessions signer) (string, bool, error) {
+	user, fingerprint, ok := sessions.adminUser(req)
+	if !ok {
+		return "", false, nil
+	}
+
+	ctx, cancel := cfg.queryContext(req)
+	defer cancel()
+
+	hash, err := currentPasswordHash(ctx, q, []byte(cfg.AdminPasswordHash))
+	if err != nil {
+		return "", false, err
+	}
+	if !hmac.Equal([]byte(fingerprint), []byte(sessions.passwordFingerprint(hash))) {
+		return "", false, nil
+	}
+	return user, true, nil
+}
+
+// changePassword replaces the admin password after checking the current one.
+// The new hash is saved in the database, so it takes effect without a
+// restart. Every session started with the old password is logged out, but
+// for this one, which is renewed with the new password.
+func (h *AdminHandler) changePassword(rw http.ResponseWriter, req *http.Request) {
+	if err := req.ParseForm(); err != nil {
+		bodyError(rw, err)
+		return
+	}
+
+	invalid := func(status int, msg string) {
+		renderPage(rw, req, status, "admin/password", passwordFormData{adminPage: h.page(req), Error: msg})
+	}
+
+	page := h.page(req)
+	_, ok, err := h.checkCredentials(req, page.User, req.PostForm.Get("current_password"))
+	if err != nil {
+		serverError(rw, req, err)
+		return
+	}
+	if !ok {
+		loggerFrom(req.Context()).Warn("Admin password change refused", "user", page.User)
+		invalid(http.StatusForbidden, "Your current password is incorrect.")
+		return
+	}
+
+	password := req.PostForm.Get("new_password")
+	if len(password) < minPasswordLength || len(password) > maxPasswordLength {
+		invalid(http.StatusUnprocessableEntity, fmt.Sprintf("The new password must be between %d and %d characters long.", minPasswordLength, maxPasswordLength))
+		return
+	}
+	if password != req.PostForm.Get("confirm_password") {
+		invalid(http.StatusUnprocessableEntity, "The new passwords don't match.")
+		return
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		serverError(rw, req, err)
+		return
+	}
+
+	ctx, cancel := h.cfg.queryContext(req)
+	defer cancel()
+
+	if err := db.SetAdminSetting(ctx, h.db, db.AdminPasswordHash, string(hash)); err != nil {
+		serverError(rw, req, err)
+		return
+	}
+	h.audit(req, "admin.password", "user "+page.User, "")
+	h.startSession(rw, req, page.User, hash)
+
+	renderPage(rw, req, http.StatusOK, "admin/password", passwordFormData{adminPage: page, Changed: true})
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/meagar/rsvp/db"
+)
+
+const testNewPassword = "a much longer passphrase"
+
+// login submits the admin login form with password, returning the response.
+func (s *testSite) login(password string) *http.Response {
+	return s.post("/admin/login", url.Values{"user": {testAdminUser}, "password": {password}}).Result()
+}
+
+func TestChangePassword(t *testing.T) {
+	pool := testPool(t)
+	site := newTestSite(t, pool)
+
+	oldSession := site.adminSession()
+	rec := site.post("/admin/password", url.Values{
+		"current_password": {testAdminPassword},
+		"new_password":     {testNewPassword},
+		"confirm_password": {testNewPassword},
+	}, oldSession)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "Your password has been changed.") {
+		t.Fatalf("status = %d, want %d and a notice:\n%s", rec.Code, http.StatusOK, rec.Body)
+	}
+
+	// Sessions started with the old password are logged out, but the admin
+	// who changed it is given a new one.
+	if rec := site.get("/admin/", oldSession); rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/admin/login" {
+		t.Errorf("with a session from before the change: status = %d, Location = %q, want a redirect to the login page", rec.Code, rec.Header().Get("Location"))
+	}
+	renewed := responseCookie(rec, sessionCookie)
+	if renewed == nil {
+		t.Fatal("changing the password didn't renew the session")
+	}
+	if rec := site.get("/admin/", renewed); rec.Code != http.StatusOK {
+		t.Errorf("with the renewed session: status = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	// The new password works at once, without a restart, and the one from
+	// ADMIN_PASSWORD_HASH doesn't any more.
+	if res := site.login(testNewPassword); res.StatusCode != http.StatusSeeOther {
+		t.Errorf("logging in with the new password: status = %d, want %d", res.StatusCode, http.StatusSeeOther)
+	}
+	if res := site.login(testAdminPassword); res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("logging in with the old password: status = %d, want %d", res.StatusCode, http.StatusUnauthorized)
+	}
+
+	hash, err := db.GetAdminSetting(context.Background(), pool, db.AdminPasswordHash)
+	if err != nil || strings.Contains(hash, testNewPassword) || !strings.HasPrefix(hash, "$2") {
+		t.Errorf("saved hash %q, %v, want a bcrypt hash", hash, err)
+	}
+}
+
+func TestChangePasswordRejectsInvalidForms(t *testing.T) {
+	pool := testPool(t)
+	site := newTestSite(t, pool)
+
+	tests := []struct {
+		name       string
+		current    string
+		new        string
+		confirm    string
+		wantStatus int
+		wantError  string
+	}{
+		{name: "wrong current password", current: "wrong password", new: testNewPassword, confirm: testNewPassword, wantStatus: http.StatusForbidden, wantError: "Your current password is incorrect."},
+		{name: "too short", current: testAdminPassword, new: "short", confirm: "short", wantStatus: http.StatusUnprocessableEntity, wantError: "between 12 and 72 characters"},
+		{name: "too long", current: testAdminPassword, new: strings.Repeat("x", 73), confirm: strings.Repeat("x", 73), wantStatus: http.StatusUnprocessableEntity, wantError: "between 12 and 72 characters"},
+		{name: "mismatched", current: testAdminPassword, new: testNewPassword, confirm: testNewPassword + "!", wantStatus: http.StatusUnprocessableEntity, wantError: "The new passwords don"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := site.post("/admin/password", url.Values{
+				"current_password": {tt.current},
+				"new_password":     {tt.new},
+				"confirm_password": {tt.confirm},
+			}, site.adminSession())
+			if rec.Code != tt.wantStatus || !strings.Contains(rec.Body.String(), tt.wantError) {
+				t.Errorf("status = %d, want %d and %q:\n%s", rec.Code, tt.wantStatus, tt.wantError, rec.Body)
+			}
+		})
+	}
+
+	if _, err := db.GetAdminSetting(context.Background(), pool, db.AdminPasswordHash); !errors.Is(err, db.ErrNotFound) {
+		t.Errorf("a password hash was saved: %v", err)
+	}
+	if res := site.login(testAdminPassword); res.StatusCode != http.StatusSeeOther {
+		t.Errorf("logging in with the original password: status = %d, want %d", res.StatusCode, http.StatusSeeOther)
+	}
+}
+
+func TestChangePasswordNeedsAdmin(t *testing.T) {
+	site := newTestSite(t, unreachablePool(t))
+	rec := site.post("/admin/password", url.Values{"new_password": {testNewPassword}, "confirm_password": {testNewPassword}})
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/admin/login" {
+		t.Errorf("status = %d, Location = %q, want a redirect to the login page", rec.Code, rec.Header().Get("Location"))
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/meagar/rsvp/db"
+)
+
+// previewGuest shows a guest's RSVP form as they would see it, with their
+// current response filled in, but with the form disabled so that nothing can
+// be submitted from it.
+func (h *AdminHandler) previewGuest(rw http.ResponseWriter, req *http.Request) {
+	guest, event := h.findGuest(rw, req)
+	if guest == nil {
+		return
+	}
+
+	ctx, cancel := h.cfg.queryContext(req)
+	defer cancel()
+
+	companions, err := db.ListPlusOneNames(ctx, h.db, guest.Id)
+	if err != nil {
+		serverError(rw, req, err)
+		return
+	}
+
+	household, err := listHousehold(req, h.cfg, h.db, guest)
+	if err != nil {
+		serverError(rw, req, err)
+		return
+	}
+
+	renderPage(rw, req, http.StatusOK, "rsvp/form", rsvpFormData{
+		Guest:          guest,
+		Event:          event,
+		Companions:     companionSlots(event.PartySizeFor(guest), companions),
+		PartySizeLimit: event.PartySizeFor(guest),
+		Household:      household,
+		Preview:        true,
+	})
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/meagar/rsvp/db"
+)
+
+func TestPreviewFormIsDisabled(t *testing.T) {
+	form := func(preview bool) string {
+		return renderString(t, "rsvp/form", rsvpFormData{
+			Guest:          &db.Guest{Name: "Ada Lovelace", InviteCode: "abc123"},
+			Event:          &db.Event{Title: "Summer Picnic", Slug: "summer-picnic", Date: time.Date(2030, 6, 15, 18, 0, 0, 0, time.UTC)},
+			PartySizeLimit: 1,
+			Preview:        preview,
+		})
+	}
+
+	preview := form(true)
+	for _, want := range []string{"Ada Lovelace", "Summer Picnic", `<fieldset class="preview" disabled>`, "This is a preview of Ada Lovelace"} {
+		if !strings.Contains(preview, want) {
+			t.Errorf("the preview doesn't contain %q:\n%s", want, preview)
+		}
+	}
+	for _, dontWant := range []string{`method="post"`, `action="/rsvp"`, csrfField} {
+		if strings.Contains(preview, dontWant) {
+			t.Errorf("the preview contains %q, so it can be submitted", dontWant)
+		}
+	}
+
+	if live := form(false); !strings.Contains(live, `method="post" action="/rsvp"`) || strings.Contains(live, "disabled") {
+		t.Errorf("the guest's own form isn't submittable:\n%s", live)
+	}
+}
+
+func TestPreviewGuest(t *testing.T) {
+	pool := testPool(t)
+	site := newTestSite(t, pool)
+	event := createTestEvent(t, pool, &db.Event{Title: "Summer Picnic"})
+	guest := createTestGuest(t, pool, &db.Guest{EventId: &event.Id, Name: "Ada Lovelace"})
+	path := "/admin/guests/" + strconv.Itoa(guest.Id) + "/preview"
+
+	rec := site.get(path, site.adminSession())
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	body := rec.Body.String()
+	for _, want := range []string{"Hello, Ada Lovelace", "Summer Picnic", `<fieldset class="preview" disabled>`} {
+		if !strings.Contains(body, want) {
+			t.Errorf("the preview doesn't contain %q:\n%s", want, body)
+		}
+	}
+	if strings.Contains(body, `method="post"`) {
+		t.Error("the preview can be submitted")
+	}
+
+	if rec := site.get(path); rec.Code != http.StatusSeeOther {
+		t.Errorf("status without an admin session = %d, want %d", rec.Code, http.StatusSeeOther)
+	}
+}
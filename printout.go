@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/meagar/rsvp/db"
+)
+
+// attendee is a guest in the printout, with the companions they're bringing.
+type attendee struct {
+	Guest      *db.Guest
+	Companions []string
+}
+
+// listAttendees loads everyone attending an event, with their companions,
+// ordered by name.
+func listAttendees(ctx context.Context, q db.Querier, eventId int) ([]attendee, error) {
+	guests, err := db.ListEventAttendees(ctx, q, eventId)
+	if err != nil {
+		return nil, err
+	}
+	companions, err := db.ListEventPlusOneNames(ctx, q, eventId)
+	if err != nil {
+		return nil, err
+	}
+
+	attendees := make([]attendee, len(guests))
+	for i, g := range guests {
+		attendees[i] = attendee{Guest: g, Companions: companions[g.Id]}
+	}
+	return attendees, nil
+}
+
+// printout shows a print-friendly list of everyone attending an event, for
+// checking guests in on the day. Once guests have been seated, the list is
+// split up by table.
+func (h *AdminHandler) printout(rw http.ResponseWriter, req *http.Request) {
+	event := findEvent(rw, req, h.cfg, h.db)
+	if event == nil {
+		return
+	}
+
+	ctx, cancel := h.cfg.queryContext(req)
+	defer cancel()
+
+	attendees, err := listAttendees(ctx, h.reads, event.Id)
+	if err != nil {
+		serverError(rw, req, err)
+		return
+	}
+
+	headcount := 0
+	for _, a := range attendees {
+		headcount += a.Guest.PartySize
+	}
+
+	renderPage(rw, req, http.StatusOK, "admin/printout", struct {
+		adminPage
+		Event     *db.Event
+		Attendees []attendee
+		Tables    []table
+		Headcount int
+	}{adminPage: h.page(req), Event: event, Attendees: attendees, Tables: groupByTable(attendees, event.SeatsPerTable), Headcount: headcount})
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/meagar/rsvp/db"
+)
+
+func TestPrintoutListsAttendees(t *testing.T) {
+	pool := testPool(t)
+	site := newTestSite(t, pool)
+	event := createTestEvent(t, pool, &db.Event{AllowMaybe: true})
+
+	guest := func(name string) *db.Guest {
+		return createTestGuest(t, pool, &db.Guest{EventId: &event.Id, Name: name, MaxPartySize: 3})
+	}
+	recordTestResponse(t, pool, guest("Ada Lovelace"), db.Response{Attendance: db.AttendanceYes, PartySize: 2, PlusOnes: []string{"Charles Babbage"}, Dietary: "Vegan"})
+	recordTestResponse(t, pool, guest("Grace Hopper"), db.Response{Attendance: db.AttendanceYes, PartySize: 1})
+	recordTestResponse(t, pool, guest("Edsger Dijkstra"), db.Response{Attendance: db.AttendanceNo, PartySize: 1})
+	recordTestResponse(t, pool, guest("Barbara Liskov"), db.Response{Attendance: db.AttendanceMaybe, PartySize: 1})
+	guest("Alan Turing")
+
+	rec := site.get("/admin/events/"+event.Slug+"/printout", site.adminSession())
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	body := rec.Body.String()
+	for _, want := range []string{"3 people attending, in 2 parties.", "Ada Lovelace", "With Charles Babbage", "Vegan", "Grace Hopper"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("the printout doesn't contain %q:\n%s", want, body)
+		}
+	}
+	for _, notWant := range []string{"Edsger Dijkstra", "Barbara Liskov", "Alan Turing"} {
+		if strings.Contains(body, notWant) {
+			t.Errorf("the printout lists %s, who isn't attending", notWant)
+		}
+	}
+	if strings.Index(body, "Ada Lovelace") > strings.Index(body, "Grace Hopper") {
+		t.Error("the printout isn't ordered by name")
+	}
+}
+
+func TestPrintoutWithoutAttendees(t *testing.T) {
+	pool := testPool(t)
+	site := newTestSite(t, pool)
+	event := createTestEvent(t, pool, &db.Event{})
+	createTestGuest(t, pool, &db.Guest{EventId: &event.Id})
+
+	rec := site.get("/admin/events/"+event.Slug+"/printout", site.adminSession())
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "Nobody is attending yet.") {
+		t.Errorf("got %d, want a printout saying nobody is attending\n%s", rec.Code, rec.Body)
+	}
+}
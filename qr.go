@@ -0,0 +1,66 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/meagar/rsvp/db"
+	"github.com/skip2/go-qrcode"
+)
+
+// QR code image sizes, in pixels.
+const (
+	defaultQRSize = 256
+	minQRSize     = 64
+	maxQRSize     = 1024
+)
+
+// encodeQR renders content as a PNG QR code. Tests replace it to see what's
+// encoded.
+var encodeQR = qrcode.Encode
+
+// guestQR serves a PNG QR code linking to a guest's RSVP page, for printing
+// on invitations. The image is size pixels square.
+func (h *AdminHandler) guestQR(rw http.ResponseWriter, req *http.Request) {
+	size := defaultQRSize
+	if param := req.URL.Query().Get("size"); param != "" {
+		n, err := strconv.Atoi(param)
+		if err != nil || n < minQRSize || n > maxQRSize {
+			http.Error(rw, "size must be a number of pixels from "+strconv.Itoa(minQRSize)+" to "+strconv.Itoa(maxQRSize), http.StatusBadRequest)
+			return
+		}
+		size = n
+	}
+
+	ctx, cancel := h.cfg.queryContext(req)
+	defer cancel()
+
+	guest, err := db.FindGuestByInviteCode(ctx, h.reads, req.PathValue("code"))
+	if errors.Is(err, db.ErrNotFound) {
+		notFound(rw, req)
+		return
+	}
+	if err != nil {
+		serverError(rw, req, err)
+		return
+	}
+
+	var event *db.Event
+	if guest.EventId != nil {
+		if event, err = db.FindEventById(ctx, h.reads, *guest.EventId); err != nil {
+			serverError(rw, req, err)
+			return
+		}
+	}
+
+	png, err := encodeQR(h.cfg.absoluteURL(req, h.sessions.rsvpPath(guest, event)), qrcode.Medium, size)
+	if err != nil {
+		serverError(rw, req, err)
+		return
+	}
+
+	rw.Header().Set("Content-Type", "image/png")
+	rw.Header().Set("Content-Length", strconv.Itoa(len(png)))
+	rw.Write(png)
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"image/png"
+	"net/http"
+	"testing"
+
+	"github.com/meagar/rsvp/db"
+	"github.com/skip2/go-qrcode"
+)
+
+// captureQRContent records what encodeQR is asked to encode for the rest of
+// t, still encoding it.
+func captureQRContent(t *testing.T) *[]string {
+	t.Helper()
+	var encoded []string
+	old := encodeQR
+	encodeQR = func(content string, level qrcode.RecoveryLevel, size int) ([]byte, error) {
+		encoded = append(encoded, content)
+		return old(content, level, size)
+	}
+	t.Cleanup(func() { encodeQR = old })
+	return &encoded
+}
+
+func TestGuestQR(t *testing.T) {
+	pool := testPool(t)
+	site := newTestSite(t, pool)
+	event := createTestEvent(t, pool, &db.Event{})
+	guest := createTestGuest(t, pool, &db.Guest{EventId: &event.Id})
+	encoded := captureQRContent(t)
+
+	for _, size := range []int{defaultQRSize, 300} {
+		path := "/admin/guests/" + guest.InviteCode + "/qr.png"
+		if size != defaultQRSize {
+			path += "?size=300"
+		}
+		*encoded = nil
+		rec := site.get(path, site.adminSession())
+		if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "image/png" {
+			t.Fatalf("GET %s: got %d %q, want a PNG", path, rec.Code, rec.Header().Get("Content-Type"))
+		}
+
+		img, err := png.Decode(rec.Body)
+		if err != nil {
+			t.Fatalf("GET %s: decoding the PNG: %v", path, err)
+		}
+		if bounds := img.Bounds(); bounds.Dx() != size || bounds.Dy() != size {
+			t.Errorf("GET %s: image is %dx%d, want %dx%d", path, bounds.Dx(), bounds.Dy(), size, size)
+		}
+		if want := "http://example.com" + site.sessions.rsvpPath(guest, event); len(*encoded) != 1 || (*encoded)[0] != want {
+			t.Errorf("GET %s: encoded %q, want %q", path, *encoded, want)
+		}
+	}
+
+	if rec := site.get("/admin/guests/NOSUCHCODE/qr.png", site.adminSession()); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown guest: status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestGuestQRRejectsBadSizes(t *testing.T) {
+	site := newTestSite(t, testPool(t))
+
+	for _, size := range []string{"big", "0", "63", "1025"} {
+		rec := site.get("/admin/guests/ABC123/qr.png?size="+size, site.adminSession())
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("size %q: status = %d, want %d", size, rec.Code, http.StatusBadRequest)
+		}
+	}
+}
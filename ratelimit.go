@@ -0,0 +1,74 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// visitorTTL is how long an idle client's limiter is kept around.
+const visitorTTL = 10 * time.Minute
+
+type visitor struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// rateLimiter limits each client IP to RATE_LIMIT requests per minute.
+type rateLimiter struct {
+	cfg       *Config
+	perMinute int
+
+	mu        sync.Mutex
+	visitors  map[string]*visitor
+	lastSweep time.Time
+}
+
+func newRateLimiter(cfg *Config) *rateLimiter {
+	return &rateLimiter{
+		cfg:       cfg,
+		perMinute: cfg.RateLimit,
+		visitors:  map[string]*visitor{},
+		lastSweep: time.Now(),
+	}
+}
+
+// allow reports whether ip may make another request, dropping limiters for
+// clients that haven't been seen recently.
+func (l *rateLimiter) allow(ip string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(l.lastSweep) > visitorTTL {
+		for key, v := range l.visitors {
+			if now.Sub(v.lastSeen) > visitorTTL {
+				delete(l.visitors, key)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	v, ok := l.visitors[ip]
+	if !ok {
+		v = &visitor{limiter: rate.NewLimiter(rate.Every(time.Minute/time.Duration(l.perMinute)), l.perMinute)}
+		l.visitors[ip] = v
+	}
+	v.lastSeen = now
+	return v.limiter.Allow()
+}
+
+func (l *rateLimiter) limit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		ip := l.cfg.clientIP(req)
+		if !l.allow(ip) {
+			loggerFrom(req.Context()).Warn("Rate limit exceeded", "ip", ip)
+			rw.Header().Set("Retry-After", "60")
+			statusError(rw, req, http.StatusTooManyRequests, "rate_limited")
+			return
+		}
+		next.ServeHTTP(rw, req)
+	})
+}
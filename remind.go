@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/meagar/rsvp/db"
+)
+
+// reminder is a rendered reminder email, waiting to be sent to guest.
+type reminder struct {
+	guest   *db.Guest
+	subject string
+	body    string
+}
+
+// reminders sends reminder emails in the background, so that reminding a long
+// guest list doesn't keep the admin waiting past the server's write timeout.
+// Each event's reminders are sent one at a time, and an event can only have
+// one batch being sent at once.
+type reminders struct {
+	cfg    *Config
+	db     *db.Pool
+	mailer Mailer
+
+	ctx     context.Context
+	cancel  context.CancelFunc
+	pending sync.WaitGroup
+
+	mu      sync.Mutex
+	sending map[int]bool
+}
+
+// newReminders returns a sender for reminders that records them in pool.
+func newReminders(cfg *Config, pool *db.Pool, mailer Mailer) *reminders {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &reminders{cfg: cfg, db: pool, mailer: mailer, ctx: ctx, cancel: cancel, sending: make(map[int]bool)}
+}
+
+// queue starts sending batch, the reminders for event, without waiting for
+// them to go. It returns false, sending nothing, if the event's previous
+// batch is still being sent. Failures are logged with logger.
+func (r *reminders) queue(logger *slog.Logger, event *db.Event, batch []reminder) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.sending[event.Id] {
+		return false
+	}
+	if len(batch) == 0 {
+		return true
+	}
+	r.sending[event.Id] = true
+
+	logger = logger.With("event", event.Slug)
+	r.pending.Add(1)
+	go func() {
+		defer r.pending.Done()
+		defer func() {
+			r.mu.Lock()
+			delete(r.sending, event.Id)
+			r.mu.Unlock()
+		}()
+
+		for i, msg := range batch {
+			if r.ctx.Err() != nil {
+				logger.Warn("Abandoning unsent reminders", "unsent", len(batch)-i)
+				return
+			}
+			r.send(logger, msg)
+		}
+	}()
+	return true
+}
+
+// send delivers one reminder and records that its guest was reminded. The
+// email has gone by the time it's recorded, so a failure to record it is only
+// logged.
+func (r *reminders) send(logger *slog.Logger, msg reminder) {
+	if err := r.mailer.Send(msg.guest.Email, msg.subject, msg.body); err != nil {
+		logger.Error("Sending reminder failed", "guest", msg.guest.Id, "error", err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.ctx, r.cfg.DBQueryTimeout)
+	defer cancel()
+	if err := db.MarkReminderSent(ctx, r.db, msg.guest.Id); err != nil {
+		logger.Error("Recording reminder failed", "guest", msg.guest.Id, "error", err)
+	}
+}
+
+// shutdown waits until ctx is done for queued reminders to be sent, then
+// abandons any that are left.
+func (r *reminders) shutdown(ctx context.Context) {
+	done := make(chan struct{})
+	go func() {
+		r.pending.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		slog.Warn("Abandoning unsent reminders")
+	}
+	r.cancel()
+}
+
+// remind queues an email to every guest of an event who hasn't responded
+// yet, skipping those reminded within REMINDER_INTERVAL. The emails are
+// rendered here, but sent in the background.
+func (h *AdminHandler) remind(rw http.ResponseWriter, req *http.Request) {
+	event := findEvent(rw, req, h.cfg, h.db)
+	if event == nil {
+		return
+	}
+
+	guests, err := listGuestsToRemind(req, h.cfg, h.db, event)
+	if err != nil {
+		serverError(rw, req, err)
+		return
+	}
+
+	logger := loggerFrom(req.Context())
+	batch := make([]reminder, 0, len(guests))
+	failed := 0
+	for _, guest := range guests {
+		var body bytes.Buffer
+		err := render(req.Context(), &body, "emails/reminder", struct {
+			Guest   *db.Guest
+			Event   *db.Event
+			RSVPURL string
+		}{Guest: guest, Event: event, RSVPURL: h.cfg.absoluteURL(req, h.sessions.rsvpPath(guest, event))})
+		if err != nil {
+			logger.Error("Rendering reminder failed", "guest", guest.Id, "error", err)
+			failed++
+			continue
+		}
+		batch = append(batch, reminder{guest: guest, subject: "Reminder: Please RSVP to " + event.Title, body: body.String()})
+	}
+
+	queued := h.reminders.queue(logger, event, batch)
+	if queued {
+		h.audit(req, "event.remind", "event "+event.Slug, fmt.Sprintf("queued %d, failed %d", len(batch), failed))
+	}
+
+	renderPage(rw, req, http.StatusOK, "admin/remind", struct {
+		adminPage
+		Event  *db.Event
+		Busy   bool
+		Queued int
+		Failed int
+	}{adminPage: h.page(req), Event: event, Busy: !queued, Queued: len(batch), Failed: failed})
+}
+
+func listGuestsToRemind(req *http.Request, cfg *Config, q db.Querier, event *db.Event) ([]*db.Guest, error) {
+	ctx, cancel := cfg.queryContext(req)
+	defer cancel()
+	return db.ListGuestsToRemind(ctx, q, event.Id, time.Now().Add(-cfg.ReminderInterval))
+}
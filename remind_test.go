@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/meagar/rsvp/db"
+)
+
+func TestRemindPendingGuests(t *testing.T) {
+	pool := testPool(t)
+	site := newTestSite(t, pool)
+	ctx := context.Background()
+	event := createTestEvent(t, pool, &db.Event{})
+
+	guest := func(name, email string) *db.Guest {
+		return createTestGuest(t, pool, &db.Guest{Name: name, Email: email, EventId: &event.Id})
+	}
+	pending := guest("Ada", "ada@example.com")
+	guest("Barbara", "")
+	recordTestResponse(t, pool, guest("Grace", "grace@example.com"), db.Response{Attendance: db.AttendanceYes, PartySize: 1})
+	recordTestResponse(t, pool, guest("Edsger", "edsger@example.com"), db.Response{Attendance: db.AttendanceNo, PartySize: 1})
+	recent := guest("Alan", "alan@example.com")
+	if err := db.MarkReminderSent(ctx, pool, recent.Id); err != nil {
+		t.Fatal(err)
+	}
+	long := guest("Donald", "donald@example.com")
+	if _, err := pool.Exec(ctx, "update guests set reminder_sent_at = now() - interval '30 days' where id = $1", long.Id); err != nil {
+		t.Fatal(err)
+	}
+	other := createTestEvent(t, pool, &db.Event{Title: "Book Club"})
+	createTestGuest(t, pool, &db.Guest{Name: "Ken", Email: "ken@example.com", EventId: &other.Id})
+
+	rec := site.post("/admin/events/"+event.Slug+"/remind", url.Values{}, site.adminSession())
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "Queued 2 reminders") {
+		t.Fatalf("got %d, want a page reporting 2 reminders queued\n%s", rec.Code, rec.Body)
+	}
+	site.reminders.pending.Wait()
+
+	var to []string
+	for _, msg := range site.mailer.messages() {
+		to = append(to, msg.To)
+		if msg.Subject != "Reminder: Please RSVP to "+event.Title {
+			t.Errorf("subject = %q", msg.Subject)
+		}
+	}
+	if want := []string{"ada@example.com", "donald@example.com"}; !slices.Equal(to, want) {
+		t.Fatalf("reminded %q, want %q", to, want)
+	}
+	if body := site.mailer.messages()[0].Body; !strings.Contains(body, "/rsvp/"+pending.InviteCode) {
+		t.Errorf("the reminder doesn't link to the guest's RSVP:\n%s", body)
+	}
+
+	// Everyone pending has now been reminded recently.
+	rec = site.post("/admin/events/"+event.Slug+"/remind", url.Values{}, site.adminSession())
+	site.reminders.pending.Wait()
+	if !strings.Contains(rec.Body.String(), "Queued 0 reminders") || len(site.mailer.messages()) != 2 {
+		t.Errorf("a second round sent %d more reminders", len(site.mailer.messages())-2)
+	}
+}
+
+// blockingMailer holds each message until release is closed, reporting
+// each one it starts sending on started.
+type blockingMailer struct {
+	fakeMailer
+	started chan string
+	release chan struct{}
+}
+
+func newBlockingMailer() *blockingMailer {
+	return &blockingMailer{started: make(chan string, 10), release: make(chan struct{})}
+}
+
+func (m *blockingMailer) Send(to, subject, body string) error {
+	m.started <- to
+	<-m.release
+	return m.fakeMailer.Send(to, subject, body)
+}
+
+func testReminders(emails ...string) []reminder {
+	var batch []reminder
+	for i, email := range emails {
+		batch = append(batch, reminder{guest: &db.Guest{Id: i + 1, Email: email}, subject: "Reminder", body: "Please RSVP"})
+	}
+	return batch
+}
+
+func TestRemindersSendOneBatchPerEventAtOnce(t *testing.T) {
+	captureLogs(t)
+	mailer := newBlockingMailer()
+	r := newReminders(testConfig(t), unreachablePool(t), mailer)
+	picnic := &db.Event{Id: 1, Slug: "picnic"}
+
+	if !r.queue(slog.Default(), picnic, testReminders("ada@example.com")) {
+		t.Fatal("the first batch wasn't queued")
+	}
+	if r.queue(slog.Default(), picnic, testReminders("grace@example.com")) {
+		t.Error("a second batch was queued while the first was being sent")
+	}
+	if !r.queue(slog.Default(), &db.Event{Id: 2, Slug: "party"}, nil) {
+		t.Error("another event's batch wasn't queued")
+	}
+
+	close(mailer.release)
+	r.pending.Wait()
+	if got := mailer.messages(); len(got) != 1 || got[0].To != "ada@example.com" {
+		t.Errorf("sent %v, want only the first batch", got)
+	}
+	if !r.queue(slog.Default(), picnic, nil) {
+		t.Error("a batch wasn't queued after the previous one was sent")
+	}
+}
+
+func TestRemindersShutdownAbandonsUnsent(t *testing.T) {
+	captureLogs(t)
+	mailer := newBlockingMailer()
+	r := newReminders(testConfig(t), unreachablePool(t), mailer)
+	r.queue(slog.Default(), &db.Event{Id: 1, Slug: "picnic"}, testReminders("ada@example.com", "grace@example.com"))
+	<-mailer.started
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	r.shutdown(ctx)
+	close(mailer.release)
+	r.pending.Wait()
+
+	if got := mailer.messages(); len(got) != 1 {
+		t.Errorf("sent %d reminders after shutdown, want only the 1 already being sent", len(got))
+	}
+}
@@ -0,0 +1,673 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/meagar/rsvp/db"
+)
+
+type RSVPHandler struct {
+	cfg *Config
+	db  *db.Pool
+	// reads is used to show guests their invitations, and may lag slightly
+	// behind db when it's a read replica. Anything that goes on to write,
+	// or shows the result of one, reads db.
+	reads    *db.Pool
+	mailer   Mailer
+	webhook  *webhook
+	sessions signer
+}
+
+var _ http.Handler = &RSVPHandler{}
+
+type rsvpFormData struct {
+	Guest *db.Guest
+	Event *db.Event
+	Error string
+
+	// AdminOverride is set when an admin is editing a response after the
+	// event's RSVP deadline.
+	AdminOverride bool
+
+	// Companions has one entry per companion the guest may bring, holding
+	// the name entered so far.
+	Companions []string
+
+	// PartySizeLimit is the largest party the guest may respond with.
+	PartySizeLimit int
+
+	// Household lists every member of the guest's household, the guest
+	// included, when they respond together. Each member counts as one.
+	Household []*db.Guest
+
+	// Nonce identifies this rendering of the form, so that submitting it
+	// twice only records the response once.
+	Nonce string
+
+	// Stamp is the signed time the form was first rendered; see
+	// automatedSubmission.
+	Stamp string
+
+	// Sig is the invite link's signature, submitted along with the code.
+	Sig string
+
+	// Preview is set when an admin is looking at the form as the guest
+	// would see it. The form can't be submitted.
+	Preview bool
+}
+
+// newNonce returns a random value for rsvpFormData.Nonce.
+func newNonce() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// companionSlots pads names out to the number of companions a guest may
+// bring to a party of at most partySize.
+func companionSlots(partySize int, names []string) []string {
+	slots := make([]string, max(partySize-1, 0))
+	copy(slots, names)
+	return slots
+}
+
+// rsvpMethods are the methods the RSVP page supports.
+const rsvpMethods = "GET, HEAD, POST, OPTIONS"
+
+// ServeHTTP shows the RSVP form for GET and HEAD, and records a response for
+// POST. The server leaves out the body of responses to HEAD.
+func (h *RSVPHandler) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead:
+		h.show(rw, req)
+	case http.MethodPost:
+		h.submit(rw, req)
+	case http.MethodOptions:
+		rw.Header().Set("Allow", rsvpMethods)
+		rw.WriteHeader(http.StatusNoContent)
+	default:
+		rw.Header().Set("Allow", rsvpMethods)
+		statusError(rw, req, http.StatusMethodNotAllowed, "method_not_allowed")
+	}
+}
+
+// findGuest loads the guest whose invite code is in the path, as in
+// /rsvp/{code}, or else in params, along with the event they're invited to,
+// using q. If params names an event, the lookup is scoped to that event's
+// guests. Codes whose signature in params is invalid get a 403. It writes a
+// 404, 410 or 500 response and returns a nil guest if it can't; guests whose
+// event has been deleted get a 410.
+func (h *RSVPHandler) findGuest(rw http.ResponseWriter, req *http.Request, q db.Querier, params url.Values) (*db.Guest, *db.Event) {
+	code := cmp.Or(req.PathValue("code"), params.Get("code"))
+	if !h.sessions.validInviteSignature(code, params.Get("sig"), h.cfg.RequireSignedInvites) {
+		loggerFrom(req.Context()).Warn("Invalid invite signature", "code", code)
+		renderPage(rw, req, http.StatusForbidden, "rsvp/not_found", nil)
+		return nil, nil
+	}
+
+	guest, event, err := lookupGuest(req, h.cfg, q, code, params.Get("event"))
+	if errors.Is(err, db.ErrNoEvent) {
+		renderPage(rw, req, http.StatusGone, "rsvp/no_event", nil)
+		return nil, nil
+	}
+	if errors.Is(err, db.ErrNotFound) {
+		renderPage(rw, req, http.StatusNotFound, "rsvp/not_found", nil)
+		return nil, nil
+	}
+	if err != nil {
+		serverError(rw, req, err)
+		return nil, nil
+	}
+	return guest, event
+}
+
+// lookupGuest loads the guest with the given invite code and the event
+// they're invited to, scoped to the event with the given slug if it isn't
+// empty.
+func lookupGuest(req *http.Request, cfg *Config, q db.Querier, code, slug string) (*db.Guest, *db.Event, error) {
+	ctx, cancel := cfg.queryContext(req)
+	defer cancel()
+
+	if slug == "" {
+		return db.FindGuestWithEvent(ctx, q, code)
+	}
+	event, err := db.FindEventBySlug(ctx, q, slug)
+	if err != nil {
+		return nil, nil, err
+	}
+	guest, err := db.FindEventGuestByInviteCode(ctx, q, event.Id, code)
+	return guest, event, err
+}
+
+// rsvpPath returns the signed path of guest's RSVP page, scoped to event if
+// it isn't nil. This is the form used in invitations; /rsvp?code=... works
+// too.
+func (s signer) rsvpPath(guest *db.Guest, event *db.Event) string {
+	path := "/rsvp/" + url.PathEscape(guest.InviteCode)
+	if params := s.inviteParams(guest, event); len(params) > 0 {
+		path += "?" + params.Encode()
+	}
+	return path
+}
+
+// rsvpParams returns the signed query parameters identifying guest, scoped to
+// event if it isn't nil.
+func (s signer) rsvpParams(guest *db.Guest, event *db.Event) string {
+	params := s.inviteParams(guest, event)
+	params.Set("code", guest.InviteCode)
+	return params.Encode()
+}
+
+// inviteParams returns the query parameters that go with guest's invite
+// code: the event, if it isn't nil, and the code's signature. Ephemeral
+// signers leave the signature out, since it wouldn't survive a restart.
+func (s signer) inviteParams(guest *db.Guest, event *db.Event) url.Values {
+	params := url.Values{}
+	if !s.ephemeral {
+		params.Set("sig", s.inviteSignature(guest.InviteCode))
+	}
+	if event != nil {
+		params.Set("event", event.Slug)
+	}
+	return params
+}
+
+// responsesClosed reports whether event has stopped taking responses, in
+// which case it renders the closed page. Admins may still make changes, as
+// reported by override.
+func (h *RSVPHandler) responsesClosed(rw http.ResponseWriter, req *http.Request, event *db.Event, status int) (closed, override bool) {
+	if event == nil || !event.ResponsesClosed(time.Now()) {
+		return false, false
+	}
+	_, admin, err := adminSession(req, h.cfg, h.db, h.sessions)
+	if err != nil {
+		serverError(rw, req, err)
+		return true, false
+	}
+	if admin {
+		return false, true
+	}
+
+	renderPage(rw, req, status, "rsvp/closed", struct{ Event *db.Event }{Event: event})
+	return true, false
+}
+
+func (h *RSVPHandler) show(rw http.ResponseWriter, req *http.Request) {
+	guest, event := h.findGuest(rw, req, h.reads, req.URL.Query())
+	if guest == nil {
+		return
+	}
+
+	closed, override := h.responsesClosed(rw, req, event, http.StatusOK)
+	if closed {
+		return
+	}
+
+	ctx, cancel := h.cfg.queryContext(req)
+	defer cancel()
+
+	companions, err := db.ListPlusOneNames(ctx, h.reads, guest.Id)
+	if err != nil {
+		serverError(rw, req, err)
+		return
+	}
+
+	household, err := listHousehold(req, h.cfg, h.reads, guest)
+	if err != nil {
+		serverError(rw, req, err)
+		return
+	}
+
+	nonce, err := newNonce()
+	if err != nil {
+		serverError(rw, req, err)
+		return
+	}
+
+	renderPage(rw, req, http.StatusOK, "rsvp/form", rsvpFormData{
+		Guest:          guest,
+		Event:          event,
+		AdminOverride:  override,
+		Companions:     companionSlots(event.PartySizeFor(guest), companions),
+		PartySizeLimit: event.PartySizeFor(guest),
+		Household:      household,
+		Nonce:          nonce,
+		Stamp:          h.formStamp(time.Now()),
+		Sig:            req.FormValue("sig"),
+	})
+}
+
+// listHousehold loads the members of guest's household using q, or returns
+// nil if they aren't in one with anybody else.
+func listHousehold(req *http.Request, cfg *Config, q db.Querier, guest *db.Guest) ([]*db.Guest, error) {
+	if guest.HouseholdId == nil {
+		return nil, nil
+	}
+
+	ctx, cancel := cfg.queryContext(req)
+	defer cancel()
+
+	members, err := db.ListHouseholdMembers(ctx, q, *guest.HouseholdId)
+	if err != nil || len(members) < 2 {
+		return nil, err
+	}
+	return members, nil
+}
+
+// submit records a response from the RSVP form, redirecting to the thanks
+// page, or from a JSON rsvpRequest, reporting the resulting state as JSON.
+func (h *RSVPHandler) submit(rw http.ResponseWriter, req *http.Request) {
+	if isJSON(req) {
+		h.submitJSON(rw, req)
+		return
+	}
+
+	if err := req.ParseForm(); err != nil {
+		bodyError(rw, err)
+		return
+	}
+
+	guest, event := h.findGuest(rw, req, h.db, req.PostForm)
+	if guest == nil {
+		return
+	}
+
+	// Let bots think they succeeded, so they don't try harder.
+	if reason := h.automatedSubmission(req.PostForm, time.Now()); reason != "" {
+		loggerFrom(req.Context()).Warn("Dropping automated RSVP submission", "guest", guest.Id, "reason", reason)
+		http.Redirect(rw, req, "/rsvp/thanks?"+h.sessions.rsvpParams(guest, event), http.StatusSeeOther)
+		return
+	}
+
+	closed, override := h.responsesClosed(rw, req, event, http.StatusForbidden)
+	if closed {
+		return
+	}
+
+	household, err := listHousehold(req, h.cfg, h.db, guest)
+	if err != nil {
+		serverError(rw, req, err)
+		return
+	}
+	if household != nil {
+		h.submitHousehold(rw, req, guest, event, household, override)
+		return
+	}
+
+	sub := formSubmission(req.PostForm)
+	response, err := sub.validate(guest, event)
+	if err != nil {
+		// Redisplay what the guest entered rather than what was saved.
+		entered := *guest
+		sub.fill(&entered)
+		renderPage(rw, req, http.StatusUnprocessableEntity, "rsvp/form", rsvpFormData{
+			Guest:          &entered,
+			Event:          event,
+			Error:          err.Error(),
+			AdminOverride:  override,
+			Companions:     companionSlots(event.PartySizeFor(guest), req.PostForm["companion"]),
+			PartySizeLimit: event.PartySizeFor(guest),
+			Nonce:          sub.Nonce,
+			Stamp:          req.PostForm.Get(stampField),
+			Sig:            req.FormValue("sig"),
+		})
+		return
+	}
+
+	if err := h.record(req, guest, event, response); err != nil {
+		serverError(rw, req, err)
+		return
+	}
+
+	http.Redirect(rw, req, "/rsvp/thanks?"+h.sessions.rsvpParams(guest, event), http.StatusSeeOther)
+}
+
+// record saves a validated response, updates guest to match, and sends the
+// guest a confirmation. Any waitlisted guests given a place as a result are
+// told by email. A repeated submission of the same form is ignored, leaving
+// guest as it was.
+func (h *RSVPHandler) record(req *http.Request, guest *db.Guest, event *db.Event, response db.Response) error {
+	ctx, cancel := h.cfg.queryContext(req)
+	defer cancel()
+
+	result, err := db.RecordResponse(ctx, h.db, guest.Id, response)
+	if err != nil {
+		return err
+	}
+	h.recorded(req, guest, event, response, result)
+	return nil
+}
+
+// recorded updates guest to match a response that was just saved, as
+// described by result, and sends out the resulting emails and webhook.
+func (h *RSVPHandler) recorded(req *http.Request, guest *db.Guest, event *db.Event, response db.Response, result db.ResponseResult) {
+	if result.Duplicate {
+		loggerFrom(req.Context()).Info("Ignoring repeated RSVP submission", "guest", guest.Id)
+		return
+	}
+
+	now := time.Now()
+	guest.Attendance = &response.Attendance
+	guest.PartySize = response.PartySize
+	guest.Dietary = response.Dietary
+	guest.Notes = response.Notes
+	guest.DeclineReason = response.DeclineReason
+	guest.RespondedAt = &now
+	guest.WaitlistedAt = nil
+	if result.Waitlisted {
+		guest.WaitlistedAt = &now
+	}
+	if response.Email != nil && *response.Email != guest.Email {
+		guest.Email = *response.Email
+		guest.EmailVerifiedAt = nil
+		if guest.Email != "" {
+			h.sendVerification(req, guest)
+		}
+	}
+	h.sendConfirmation(req, guest, event)
+	h.webhook.notify(loggerFrom(req.Context()), guest, event)
+
+	for _, promoted := range result.Promoted {
+		sendPromotion(req, h.cfg, h.mailer, h.sessions, promoted, event)
+	}
+}
+
+// submitHousehold handles the household version of the RSVP form, which has
+// an attending checkbox and dietary field for each member, and notes saved
+// against the guest whose invite code was used. Every member's response is
+// recorded together.
+func (h *RSVPHandler) submitHousehold(rw http.ResponseWriter, req *http.Request, guest *db.Guest, event *db.Event, members []*db.Guest, override bool) {
+	nonce := req.PostForm.Get("nonce")
+	responses := make(map[int]db.Response, len(members))
+	entered := make([]*db.Guest, len(members))
+	var invalid error
+	for i, member := range members {
+		sub := householdSubmission(req.PostForm, member)
+		if member.Id == guest.Id {
+			sub.Notes = req.PostForm.Get("notes")
+		} else {
+			sub.Notes = member.Notes
+		}
+
+		m := *member
+		sub.fill(&m)
+		entered[i] = &m
+
+		response, err := sub.validate(member, event)
+		if err != nil {
+			invalid = cmp.Or(invalid, fmt.Errorf("%s: %w", member.Name, err))
+			continue
+		}
+		responses[member.Id] = response
+	}
+
+	if invalid != nil {
+		submitter := *guest
+		submitter.Notes = req.PostForm.Get("notes")
+		renderPage(rw, req, http.StatusUnprocessableEntity, "rsvp/form", rsvpFormData{
+			Guest:         &submitter,
+			Event:         event,
+			Error:         invalid.Error(),
+			AdminOverride: override,
+			Household:     entered,
+			Nonce:         nonce,
+			Stamp:         req.PostForm.Get(stampField),
+			Sig:           req.FormValue("sig"),
+		})
+		return
+	}
+
+	ctx, cancel := h.cfg.queryContext(req)
+	defer cancel()
+
+	results, err := db.RecordHouseholdResponse(ctx, h.db, responses)
+	if err != nil {
+		serverError(rw, req, err)
+		return
+	}
+	for _, member := range members {
+		h.recorded(req, member, event, responses[member.Id], results[member.Id])
+	}
+
+	http.Redirect(rw, req, "/rsvp/thanks?"+h.sessions.rsvpParams(guest, event), http.StatusSeeOther)
+}
+
+// maxNoteLength caps the free-text dietary and notes fields, in characters.
+const maxNoteLength = 500
+
+// rsvpSubmission is a guest's response as submitted, before validation.
+type rsvpSubmission struct {
+	// Response is yes, no or maybe. Attending is the older yes or no,
+	// used when Response is missing.
+	Response   *db.Attendance `json:"response,omitempty"`
+	Attending  *bool          `json:"attending"`
+	PartySize  int            `json:"party_size"`
+	Companions []string       `json:"companions"`
+	Dietary    string         `json:"dietary"`
+	Notes      string         `json:"notes"`
+	Nonce      string         `json:"nonce,omitempty"`
+
+	// DeclineReason is ignored unless the guest isn't attending.
+	DeclineReason string `json:"decline_reason,omitempty"`
+
+	// Email, if not nil, changes the guest's email address.
+	Email *string `json:"email,omitempty"`
+}
+
+// formSubmission reads a submission from the RSVP form's fields. Missing or
+// malformed values are left zero for validate to reject.
+func formSubmission(form url.Values) rsvpSubmission {
+	sub := rsvpSubmission{
+		Companions: form["companion"],
+		Dietary:    form.Get("dietary"),
+		Notes:      form.Get("notes"),
+		Nonce:      form.Get("nonce"),
+
+		DeclineReason: form.Get("decline_reason"),
+	}
+	if email, ok := form["email"]; ok && len(email) > 0 {
+		sub.Email = &email[0]
+	}
+
+	if answer := db.Attendance(form.Get("attending")); answer.Valid() {
+		sub.Response = &answer
+	}
+
+	sub.PartySize, _ = strconv.Atoi(form.Get("party_size"))
+	return sub
+}
+
+// householdSubmission reads one household member's submission from the
+// household RSVP form, where an unticked attending box means they're not
+// coming. Notes are left for the caller to fill in.
+func householdSubmission(form url.Values, member *db.Guest) rsvpSubmission {
+	id := strconv.Itoa(member.Id)
+	attending := form.Get("attending_"+id) == "yes"
+	return rsvpSubmission{
+		Attending: &attending,
+		PartySize: 1,
+		Dietary:   form.Get("dietary_" + id),
+		Nonce:     form.Get("nonce"),
+	}
+}
+
+// answer returns the submitted response, or nil if there isn't one.
+func (sub rsvpSubmission) answer() *db.Attendance {
+	if sub.Response != nil || sub.Attending == nil {
+		return sub.Response
+	}
+	answer := db.AttendanceNo
+	if *sub.Attending {
+		answer = db.AttendanceYes
+	}
+	return &answer
+}
+
+// fill copies the submitted values onto guest for redisplay.
+func (sub rsvpSubmission) fill(guest *db.Guest) {
+	guest.Attendance = sub.answer()
+	if sub.PartySize > 0 {
+		guest.PartySize = sub.PartySize
+	}
+	guest.Dietary = sub.Dietary
+	guest.Notes = sub.Notes
+	guest.DeclineReason = sub.DeclineReason
+	if sub.Email != nil {
+		guest.Email = *sub.Email
+	}
+}
+
+// validate checks the submission against the guest's allotment, capped by
+// event's maximum party size. The event may be nil.
+func (sub rsvpSubmission) validate(guest *db.Guest, event *db.Event) (db.Response, error) {
+	dietary := strings.TrimSpace(sub.Dietary)
+	notes := strings.TrimSpace(sub.Notes)
+	if utf8.RuneCountInString(dietary) > maxNoteLength {
+		return db.Response{}, fmt.Errorf("Dietary requirements must be at most %d characters.", maxNoteLength)
+	}
+	if utf8.RuneCountInString(notes) > maxNoteLength {
+		return db.Response{}, fmt.Errorf("Notes must be at most %d characters.", maxNoteLength)
+	}
+
+	var email *string
+	if sub.Email != nil {
+		address := strings.TrimSpace(*sub.Email)
+		if address != "" {
+			addr, err := mail.ParseAddress(address)
+			if err != nil {
+				return db.Response{}, errors.New("Please enter a valid email address, or leave it blank.")
+			}
+			address = addr.Address
+		}
+		email = &address
+	}
+
+	answer := sub.answer()
+	if answer == nil || !answer.Valid() {
+		return db.Response{}, errors.New("Please let us know whether you'll be attending.")
+	}
+	if *answer == db.AttendanceMaybe && (event == nil || !event.AllowMaybe) {
+		return db.Response{}, errors.New("Please answer yes or no.")
+	}
+	if *answer == db.AttendanceNo {
+		reason := strings.TrimSpace(sub.DeclineReason)
+		if utf8.RuneCountInString(reason) > maxNoteLength {
+			return db.Response{}, fmt.Errorf("Your reason for declining must be at most %d characters.", maxNoteLength)
+		}
+		return db.Response{Attendance: db.AttendanceNo, PartySize: guest.PartySize, Dietary: dietary, Notes: notes, DeclineReason: reason, Email: email, Nonce: sub.Nonce}, nil
+	}
+
+	if sub.PartySize < 1 {
+		return db.Response{}, errors.New("Party size must be a number of at least 1.")
+	}
+	if limit := event.PartySizeFor(guest); sub.PartySize > limit {
+		return db.Response{}, fmt.Errorf("Your invitation is for at most %d.", limit)
+	}
+
+	var companions []string
+	for _, name := range sub.Companions {
+		if name = strings.TrimSpace(name); name != "" {
+			companions = append(companions, name)
+		}
+	}
+	if len(companions) > sub.PartySize-1 {
+		return db.Response{}, fmt.Errorf("You've named %d companions but your party size is %d.", len(companions), sub.PartySize)
+	}
+
+	// A maybe keeps the party size and companions the guest expects to
+	// bring, though they don't count towards the headcount until it's a yes.
+	return db.Response{Attendance: *answer, PartySize: sub.PartySize, PlusOnes: companions, Dietary: dietary, Notes: notes, Email: email, Nonce: sub.Nonce}, nil
+}
+
+// sendConfirmation emails the guest a summary of their response, if their
+// address is verified. Failures are logged rather than reported, since the
+// response itself has been saved.
+func (h *RSVPHandler) sendConfirmation(req *http.Request, guest *db.Guest, event *db.Event) {
+	if !guest.EmailVerified() {
+		return
+	}
+
+	subject := "Your RSVP is confirmed"
+	if guest.IsWaitlisted() {
+		subject = "You're on the waitlist"
+	} else if guest.IsTentative() {
+		subject = "Thanks for letting us know you might come"
+	} else if !guest.IsAttending() {
+		subject = "Sorry you can't make it"
+	}
+	if event != nil {
+		subject += ": " + event.Title
+	}
+
+	var body bytes.Buffer
+	err := render(req.Context(), &body, "emails/confirmation", struct {
+		Guest     *db.Guest
+		Event     *db.Event
+		RSVPURL   string
+		CancelURL string
+	}{
+		Guest:     guest,
+		Event:     event,
+		RSVPURL:   h.cfg.absoluteURL(req, h.sessions.rsvpPath(guest, event)),
+		CancelURL: h.cfg.absoluteURL(req, h.sessions.cancelPath(guest, event)),
+	})
+	if err != nil {
+		loggerFrom(req.Context()).Error("Rendering confirmation email failed", "guest", guest.Id, "error", err)
+		return
+	}
+
+	if err := h.mailer.Send(guest.Email, subject, body.String()); err != nil {
+		loggerFrom(req.Context()).Error("Sending confirmation email failed", "guest", guest.Id, "error", err)
+	}
+}
+
+// sendPromotion emails a guest who has been moved off the waitlist, whether
+// by another guest's response or by an admin's change.
+func sendPromotion(req *http.Request, cfg *Config, mailer Mailer, sessions signer, guest *db.Guest, event *db.Event) {
+	logger := loggerFrom(req.Context())
+	logger.Info("Promoted guest from waitlist", "guest", guest.Id, "event", event.Slug)
+	if !guest.EmailVerified() {
+		return
+	}
+
+	var body bytes.Buffer
+	err := render(req.Context(), &body, "emails/promoted", struct {
+		Guest   *db.Guest
+		Event   *db.Event
+		RSVPURL string
+	}{Guest: guest, Event: event, RSVPURL: cfg.absoluteURL(req, sessions.rsvpPath(guest, event))})
+	if err != nil {
+		logger.Error("Rendering waitlist promotion email failed", "guest", guest.Id, "error", err)
+		return
+	}
+
+	if err := mailer.Send(guest.Email, "A place has opened up: "+event.Title, body.String()); err != nil {
+		logger.Error("Sending waitlist promotion email failed", "guest", guest.Id, "error", err)
+	}
+}
+
+func (h *RSVPHandler) thanks(rw http.ResponseWriter, req *http.Request) {
+	guest, event := h.findGuest(rw, req, h.db, req.URL.Query())
+	if guest == nil {
+		return
+	}
+
+	renderPage(rw, req, http.StatusOK, "rsvp/thanks", struct {
+		Guest *db.Guest
+		Event *db.Event
+	}{Guest: guest, Event: event})
+}
@@ -0,0 +1,859 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/meagar/rsvp/db"
+)
+
+// rsvpForm returns fields as guest's RSVP form would submit them, along with
+// the hidden fields the form carries, stamped as if it was rendered a minute
+// ago.
+func rsvpForm(site *testSite, guest *db.Guest, event *db.Event, fields url.Values) url.Values {
+	form, _ := url.ParseQuery(site.sessions.rsvpParams(guest, event))
+	form.Set(stampField, (&RSVPHandler{sessions: site.sessions}).formStamp(time.Now().Add(-time.Minute)))
+	for key, values := range fields {
+		form[key] = values
+	}
+	return form
+}
+
+func TestRSVPFormShowsGuest(t *testing.T) {
+	pool := testPool(t)
+	site := newTestSite(t, pool)
+	event := createTestEvent(t, pool, &db.Event{})
+	guest := createTestGuest(t, pool, &db.Guest{EventId: &event.Id, Name: "Ada Lovelace", PartySize: 3, MaxPartySize: 4})
+
+	rec := site.get("/rsvp?" + site.sessions.rsvpParams(guest, event))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	body := rec.Body.String()
+	for _, want := range []string{"Hello, Ada Lovelace", `name="party_size" min="1" max="4" value="3"`} {
+		if !strings.Contains(body, want) {
+			t.Errorf("form doesn't contain %q:\n%s", want, body)
+		}
+	}
+}
+
+func TestSubmitRSVP(t *testing.T) {
+	pool := testPool(t)
+	site := newTestSite(t, pool)
+	event := createTestEvent(t, pool, &db.Event{})
+
+	tests := []struct {
+		name          string
+		fields        url.Values
+		wantStatus    int
+		wantResponse  *db.Attendance
+		wantPartySize int
+	}{
+		{
+			name:          "yes",
+			fields:        url.Values{"attending": {"yes"}, "party_size": {"2"}},
+			wantStatus:    http.StatusSeeOther,
+			wantResponse:  ptr(db.AttendanceYes),
+			wantPartySize: 2,
+		},
+		{
+			name:          "no",
+			fields:        url.Values{"attending": {"no"}, "party_size": {"2"}},
+			wantStatus:    http.StatusSeeOther,
+			wantResponse:  ptr(db.AttendanceNo),
+			wantPartySize: 1,
+		},
+		{
+			name:          "party too large",
+			fields:        url.Values{"attending": {"yes"}, "party_size": {"3"}},
+			wantStatus:    http.StatusUnprocessableEntity,
+			wantPartySize: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			guest := createTestGuest(t, pool, &db.Guest{EventId: &event.Id, MaxPartySize: 2})
+
+			rec := site.post("/rsvp", rsvpForm(site, guest, event, tt.fields))
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d\n%s", rec.Code, tt.wantStatus, rec.Body)
+			}
+
+			saved := reloadGuest(t, pool, guest.Id)
+			if (saved.Attendance == nil) != (tt.wantResponse == nil) || (saved.Attendance != nil && *saved.Attendance != *tt.wantResponse) {
+				t.Errorf("attending = %v, want %v", deref(saved.Attendance), deref(tt.wantResponse))
+			}
+			if saved.PartySize != tt.wantPartySize {
+				t.Errorf("party size = %d, want %d", saved.PartySize, tt.wantPartySize)
+			}
+			if tt.wantResponse == nil && saved.RespondedAt != nil {
+				t.Errorf("responded_at is set for a rejected response")
+			}
+		})
+	}
+}
+
+func TestValidateMaybe(t *testing.T) {
+	guest := &db.Guest{PartySize: 1, MaxPartySize: 3}
+
+	tests := []struct {
+		name    string
+		sub     rsvpSubmission
+		event   *db.Event
+		wantErr string
+	}{
+		{name: "form", sub: formSubmission(url.Values{"attending": {"maybe"}, "party_size": {"2"}}), event: &db.Event{AllowMaybe: true}},
+		{name: "JSON", sub: rsvpSubmission{Response: ptr(db.AttendanceMaybe), PartySize: 2}, event: &db.Event{AllowMaybe: true}},
+		{name: "not allowed", sub: formSubmission(url.Values{"attending": {"maybe"}, "party_size": {"2"}}), event: &db.Event{}, wantErr: "Please answer yes or no."},
+		{name: "no event", sub: formSubmission(url.Values{"attending": {"maybe"}, "party_size": {"2"}}), wantErr: "Please answer yes or no."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response, err := tt.sub.validate(guest, tt.event)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Errorf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if response.Attendance != db.AttendanceMaybe || response.PartySize != 2 {
+				t.Errorf("response = %s with a party of %d, want maybe with a party of 2", response.Attendance, response.PartySize)
+			}
+		})
+	}
+}
+
+func TestSubmitRSVPMaybe(t *testing.T) {
+	pool := testPool(t)
+	site := newTestSite(t, pool)
+	event := createTestEvent(t, pool, &db.Event{AllowMaybe: true})
+	guest := createTestGuest(t, pool, &db.Guest{EventId: &event.Id, MaxPartySize: 2})
+
+	rec := site.post("/rsvp", rsvpForm(site, guest, event, url.Values{"attending": {"maybe"}, "party_size": {"2"}}))
+	if rec.Code != http.StatusSeeOther {
+		t.Fatalf("status = %d, want %d\n%s", rec.Code, http.StatusSeeOther, rec.Body)
+	}
+	saved := reloadGuest(t, pool, guest.Id)
+	if !saved.IsTentative() || saved.IsAttending() || saved.IsDeclined() {
+		t.Errorf("attendance = %v, want maybe", deref(saved.Attendance))
+	}
+	if saved.PartySize != 2 {
+		t.Errorf("party size = %d, want 2", saved.PartySize)
+	}
+
+	yesOrNo := createTestEvent(t, pool, &db.Event{Title: "Book Club"})
+	guest = createTestGuest(t, pool, &db.Guest{EventId: &yesOrNo.Id})
+	rec = site.post("/rsvp", rsvpForm(site, guest, yesOrNo, url.Values{"attending": {"maybe"}, "party_size": {"1"}}))
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("status for an event without maybe = %d, want %d", rec.Code, http.StatusUnprocessableEntity)
+	}
+	if saved := reloadGuest(t, pool, guest.Id); saved.Attendance != nil {
+		t.Errorf("saved %v for an event without maybe", *saved.Attendance)
+	}
+}
+
+// ptr returns a pointer to v.
+func ptr[T any](v T) *T {
+	return &v
+}
+
+// deref returns what p points to, or the zero value if it's nil.
+func deref[T any](p *T) T {
+	var v T
+	if p != nil {
+		v = *p
+	}
+	return v
+}
+
+func TestGuestsResolveToTheirEvent(t *testing.T) {
+	pool := testPool(t)
+	site := newTestSite(t, pool)
+	party := createTestEvent(t, pool, &db.Event{Title: "Garden Party"})
+	dinner := createTestEvent(t, pool, &db.Event{Title: "Winter Dinner"})
+	ada := createTestGuest(t, pool, &db.Guest{EventId: &party.Id, Name: "Ada Lovelace"})
+	grace := createTestGuest(t, pool, &db.Guest{EventId: &dinner.Id, Name: "Grace Hopper"})
+
+	tests := []struct {
+		name       string
+		path       string
+		wantStatus int
+		want       string
+		notWant    string
+	}{
+		{name: "first event", path: "/rsvp?" + site.sessions.rsvpParams(ada, party), wantStatus: http.StatusOK, want: "Garden Party", notWant: "Winter Dinner"},
+		{name: "second event", path: "/rsvp?" + site.sessions.rsvpParams(grace, dinner), wantStatus: http.StatusOK, want: "Winter Dinner", notWant: "Garden Party"},
+		{name: "unscoped", path: "/rsvp?" + site.sessions.rsvpParams(grace, nil), wantStatus: http.StatusOK, want: "Grace Hopper", notWant: "Garden Party"},
+		{name: "other event", path: "/rsvp?" + site.sessions.rsvpParams(ada, dinner), wantStatus: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := site.get(tt.path)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			body := rec.Body.String()
+			if !strings.Contains(body, tt.want) {
+				t.Errorf("page doesn't contain %q:\n%s", tt.want, body)
+			}
+			if tt.notWant != "" && strings.Contains(body, tt.notWant) {
+				t.Errorf("page contains %q:\n%s", tt.notWant, body)
+			}
+		})
+	}
+}
+
+func TestSubmitRSVPSendsConfirmation(t *testing.T) {
+	pool := testPool(t)
+	site := newTestSite(t, pool)
+	event := createTestEvent(t, pool, &db.Event{Title: "Garden Party"})
+
+	tests := []struct {
+		attending   string
+		wantSubject string
+	}{
+		{attending: "yes", wantSubject: "Your RSVP is confirmed: Garden Party"},
+		{attending: "no", wantSubject: "Sorry you can't make it: Garden Party"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.attending, func(t *testing.T) {
+			email := "guest-" + tt.attending + "@example.com"
+			guest := createTestGuest(t, pool, &db.Guest{EventId: &event.Id, Email: email})
+			sent := len(site.mailer.messages())
+
+			rec := site.post("/rsvp", rsvpForm(site, guest, event, url.Values{"attending": {tt.attending}, "party_size": {"1"}}))
+			if rec.Code != http.StatusSeeOther {
+				t.Fatalf("status = %d, want %d\n%s", rec.Code, http.StatusSeeOther, rec.Body)
+			}
+
+			messages := site.mailer.messages()[sent:]
+			if len(messages) != 1 {
+				t.Fatalf("sent %d emails, want 1: %v", len(messages), messages)
+			}
+			if messages[0].To != email || messages[0].Subject != tt.wantSubject {
+				t.Errorf("sent %q to %s, want %q to %s", messages[0].Subject, messages[0].To, tt.wantSubject, email)
+			}
+		})
+	}
+}
+
+func TestSubmitRSVPWithoutEmail(t *testing.T) {
+	pool := testPool(t)
+	site := newTestSite(t, pool)
+	event := createTestEvent(t, pool, &db.Event{})
+	guest := createTestGuest(t, pool, &db.Guest{EventId: &event.Id})
+
+	site.post("/rsvp", rsvpForm(site, guest, event, url.Values{"attending": {"yes"}, "party_size": {"1"}}))
+	if messages := site.mailer.messages(); len(messages) != 0 {
+		t.Errorf("sent %d emails to a guest without an address: %v", len(messages), messages)
+	}
+}
+
+func TestSubmitRSVPCompanions(t *testing.T) {
+	pool := testPool(t)
+	site := newTestSite(t, pool)
+	event := createTestEvent(t, pool, &db.Event{})
+	guest := createTestGuest(t, pool, &db.Guest{EventId: &event.Id, MaxPartySize: 3})
+
+	submissions := []struct {
+		companions []string
+		want       []string
+	}{
+		{companions: []string{"Charles Babbage", "Mary Somerville"}, want: []string{"Charles Babbage", "Mary Somerville"}},
+		{companions: []string{"Mary Somerville", " Augustus De Morgan "}, want: []string{"Mary Somerville", "Augustus De Morgan"}},
+		{companions: []string{"", "Charles Babbage"}, want: []string{"Charles Babbage"}},
+	}
+	for i, sub := range submissions {
+		form := url.Values{"attending": {"yes"}, "party_size": {"3"}, "companion": sub.companions}
+		if rec := site.post("/rsvp", rsvpForm(site, guest, event, form)); rec.Code != http.StatusSeeOther {
+			t.Fatalf("submission %d: status = %d, want %d\n%s", i+1, rec.Code, http.StatusSeeOther, rec.Body)
+		}
+
+		names, err := db.ListPlusOneNames(context.Background(), pool, guest.Id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(names, sub.want) {
+			t.Errorf("after submission %d, companions = %q, want %q", i+1, names, sub.want)
+		}
+	}
+}
+
+func TestResubmitRSVP(t *testing.T) {
+	pool := testPool(t)
+	site := newTestSite(t, pool)
+	event := createTestEvent(t, pool, &db.Event{})
+	guest := createTestGuest(t, pool, &db.Guest{EventId: &event.Id, MaxPartySize: 3})
+
+	if body := site.get("/rsvp?" + site.sessions.rsvpParams(guest, event)).Body.String(); strings.Contains(body, "You already responded") {
+		t.Error("the form says a guest who hasn't responded already has")
+	}
+
+	first := url.Values{"attending": {"yes"}, "party_size": {"3"}, "dietary": {"Vegan"}}
+	if rec := site.post("/rsvp", rsvpForm(site, guest, event, first)); rec.Code != http.StatusSeeOther {
+		t.Fatalf("first response: status = %d, want %d", rec.Code, http.StatusSeeOther)
+	}
+	body := site.get("/rsvp?" + site.sessions.rsvpParams(guest, event)).Body.String()
+	for _, want := range []string{
+		"You already responded",
+		`value="yes" checked`,
+		`name="party_size" min="1" max="3" value="3"`,
+		`name="dietary" maxlength="500" value="Vegan"`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("the form doesn't contain %q:\n%s", want, body)
+		}
+	}
+	responded := reloadGuest(t, pool, guest.Id).RespondedAt
+
+	second := url.Values{"attending": {"no"}, "party_size": {"1"}, "dietary": {""}}
+	if rec := site.post("/rsvp", rsvpForm(site, guest, event, second)); rec.Code != http.StatusSeeOther {
+		t.Fatalf("second response: status = %d, want %d", rec.Code, http.StatusSeeOther)
+	}
+	// Declining keeps the party size the guest last gave.
+	saved := reloadGuest(t, pool, guest.Id)
+	if !saved.IsDeclined() || saved.PartySize != 3 || saved.Dietary != "" {
+		t.Errorf("saved attendance %v, party size %d and dietary %q, want the second response", deref(saved.Attendance), saved.PartySize, saved.Dietary)
+	}
+	if saved.RespondedAt == nil || responded == nil || saved.RespondedAt.Before(*responded) {
+		t.Errorf("responded_at went from %v to %v", responded, saved.RespondedAt)
+	}
+}
+
+func TestSubmitRSVPDietaryAndNotes(t *testing.T) {
+	pool := testPool(t)
+	site := newTestSite(t, pool)
+	event := createTestEvent(t, pool, &db.Event{})
+	guest := createTestGuest(t, pool, &db.Guest{EventId: &event.Id})
+
+	form := url.Values{"attending": {"yes"}, "party_size": {"1"}, "dietary": {" No nuts "}, "notes": {"Arriving late"}}
+	if rec := site.post("/rsvp", rsvpForm(site, guest, event, form)); rec.Code != http.StatusSeeOther {
+		t.Fatalf("status = %d, want %d\n%s", rec.Code, http.StatusSeeOther, rec.Body)
+	}
+	saved := reloadGuest(t, pool, guest.Id)
+	if saved.Dietary != "No nuts" || saved.Notes != "Arriving late" {
+		t.Errorf("saved dietary %q and notes %q, want %q and %q", saved.Dietary, saved.Notes, "No nuts", "Arriving late")
+	}
+
+	form.Set("notes", strings.Repeat("x", maxNoteLength+1))
+	rec := site.post("/rsvp", rsvpForm(site, guest, event, form))
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("over-long notes: status = %d, want %d", rec.Code, http.StatusUnprocessableEntity)
+	}
+	if saved := reloadGuest(t, pool, guest.Id); saved.Notes != "Arriving late" {
+		t.Errorf("over-long notes replaced the saved ones with %q", saved.Notes)
+	}
+}
+
+func TestValidateNoteLengths(t *testing.T) {
+	guest := &db.Guest{PartySize: 1, MaxPartySize: 1}
+	tests := []struct {
+		name    string
+		dietary string
+		notes   string
+		wantErr bool
+	}{
+		{name: "short", dietary: "Vegan", notes: "See you there"},
+		{name: "longest notes", notes: strings.Repeat("x", maxNoteLength)},
+		{name: "longest notes in multibyte characters", notes: strings.Repeat("é", maxNoteLength)},
+		{name: "notes too long", notes: strings.Repeat("x", maxNoteLength+1), wantErr: true},
+		{name: "dietary too long", dietary: strings.Repeat("x", maxNoteLength+1), wantErr: true},
+		{name: "surrounding space doesn't count", notes: " " + strings.Repeat("x", maxNoteLength) + " "},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sub := rsvpSubmission{Attending: ptr(true), PartySize: 1, Dietary: tt.dietary, Notes: tt.notes}
+			_, err := sub.validate(guest, nil)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validate returned %v, want an error: %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRSVPDeadline(t *testing.T) {
+	pool := testPool(t)
+	site := newTestSite(t, pool)
+	open := createTestEvent(t, pool, &db.Event{Title: "Open", RSVPDeadline: ptr(time.Now().Add(time.Hour))})
+	past := createTestEvent(t, pool, &db.Event{Title: "Past", RSVPDeadline: ptr(time.Now().Add(-time.Hour))})
+	yes := url.Values{"attending": {"yes"}, "party_size": {"1"}}
+
+	t.Run("before the deadline", func(t *testing.T) {
+		guest := createTestGuest(t, pool, &db.Guest{EventId: &open.Id})
+		if rec := site.get("/rsvp?" + site.sessions.rsvpParams(guest, open)); rec.Code != http.StatusOK || strings.Contains(rec.Body.String(), "Responses are closed") {
+			t.Errorf("GET: status = %d, want the form", rec.Code)
+		}
+		if rec := site.post("/rsvp", rsvpForm(site, guest, open, yes)); rec.Code != http.StatusSeeOther {
+			t.Errorf("POST: status = %d, want %d", rec.Code, http.StatusSeeOther)
+		}
+		if saved := reloadGuest(t, pool, guest.Id); !saved.IsAttending() {
+			t.Error("the response wasn't saved")
+		}
+	})
+
+	t.Run("after the deadline", func(t *testing.T) {
+		guest := createTestGuest(t, pool, &db.Guest{EventId: &past.Id})
+		if rec := site.get("/rsvp?" + site.sessions.rsvpParams(guest, past)); !strings.Contains(rec.Body.String(), "Responses are closed") {
+			t.Errorf("GET: status = %d, want the closed page", rec.Code)
+		}
+		rec := site.post("/rsvp", rsvpForm(site, guest, past, yes))
+		if rec.Code != http.StatusForbidden || !strings.Contains(rec.Body.String(), "Responses are closed") {
+			t.Errorf("POST: status = %d, want %d and the closed page", rec.Code, http.StatusForbidden)
+		}
+		if saved := reloadGuest(t, pool, guest.Id); saved.Attendance != nil {
+			t.Errorf("the response was saved as %v", *saved.Attendance)
+		}
+	})
+
+	t.Run("admin after the deadline", func(t *testing.T) {
+		guest := createTestGuest(t, pool, &db.Guest{EventId: &past.Id})
+		session := site.adminSession()
+		if rec := site.get("/rsvp?"+site.sessions.rsvpParams(guest, past), session); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "editing as an admin") {
+			t.Errorf("GET: status = %d, want the form with the override notice", rec.Code)
+		}
+		if rec := site.post("/rsvp", rsvpForm(site, guest, past, yes), session); rec.Code != http.StatusSeeOther {
+			t.Errorf("POST: status = %d, want %d", rec.Code, http.StatusSeeOther)
+		}
+		if saved := reloadGuest(t, pool, guest.Id); !saved.IsAttending() {
+			t.Error("the admin's change wasn't saved")
+		}
+	})
+}
+
+func TestThanksPageVariants(t *testing.T) {
+	custom := &db.Event{
+		Title:             "Garden Party",
+		Slug:              "garden-party",
+		ThankYouAttending: "Can't wait! Bring <a sun hat>.",
+		ThankYouDeclining: "We'll miss you & yours.",
+	}
+	plain := &db.Event{Title: "Garden Party", Slug: "garden-party"}
+
+	tests := []struct {
+		name       string
+		event      *db.Event
+		attendance db.Attendance
+		want       string
+		dontWant   string
+	}{
+		{name: "attending, default", event: plain, attendance: db.AttendanceYes, want: "got you down for 2. See you there!", dontWant: "thank-you"},
+		{name: "attending, custom", event: custom, attendance: db.AttendanceYes, want: `<p class="thank-you">Can&#39;t wait! Bring &lt;a sun hat&gt;.</p>`, dontWant: "miss you"},
+		{name: "declining, default", event: plain, attendance: db.AttendanceNo, want: "Thanks for letting us know.", dontWant: "thank-you"},
+		{name: "declining, custom", event: custom, attendance: db.AttendanceNo, want: `<p class="thank-you">We&#39;ll miss you &amp; yours.</p>`, dontWant: "Can&#39;t wait"},
+		{name: "no event", attendance: db.AttendanceYes, want: "got you down for 2."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			guest := &db.Guest{Name: "Ada", Attendance: &tt.attendance, PartySize: 2}
+			page := renderString(t, "rsvp/thanks", struct {
+				Guest *db.Guest
+				Event *db.Event
+			}{Guest: guest, Event: tt.event})
+			if !strings.Contains(page, tt.want) {
+				t.Errorf("the page doesn't contain %q:\n%s", tt.want, page)
+			}
+			if tt.dontWant != "" && strings.Contains(page, tt.dontWant) {
+				t.Errorf("the page contains %q:\n%s", tt.dontWant, page)
+			}
+		})
+	}
+}
+
+func TestSubmitRSVPTwiceWithOneNonce(t *testing.T) {
+	pool := testPool(t)
+	site := newTestSite(t, pool)
+	event := createTestEvent(t, pool, &db.Event{})
+	guest := createTestGuest(t, pool, &db.Guest{Email: "ada@example.com", EventId: &event.Id, MaxPartySize: 2})
+
+	form := rsvpForm(site, guest, event, url.Values{"attending": {"yes"}, "party_size": {"2"}, "companion": {"Charles Babbage"}, "nonce": {"first-form"}})
+	for i := range 2 {
+		rec := site.post("/rsvp", form)
+		if rec.Code != http.StatusSeeOther {
+			t.Fatalf("submission %d: status = %d, want %d", i+1, rec.Code, http.StatusSeeOther)
+		}
+		thanks := site.get(rec.Header().Get("Location"))
+		if thanks.Code != http.StatusOK || !strings.Contains(thanks.Body.String(), "Thank you, Ada Lovelace") {
+			t.Errorf("submission %d: the thank-you page wasn't shown:\n%s", i+1, thanks.Body)
+		}
+	}
+
+	companions, err := db.ListPlusOneNames(context.Background(), pool, guest.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(companions, []string{"Charles Babbage"}) {
+		t.Errorf("companions = %q, want one Charles Babbage", companions)
+	}
+	if got := len(site.mailer.messages()); got != 1 {
+		t.Errorf("sent %d confirmations, want 1", got)
+	}
+
+	// A new form, with its own nonce, is saved.
+	form.Set("nonce", "second-form")
+	form.Set("attending", "no")
+	site.post("/rsvp", form)
+	if saved := reloadGuest(t, pool, guest.Id); !saved.IsDeclined() {
+		t.Errorf("a submission with a new nonce was ignored")
+	}
+}
+
+func TestRecordResponseIgnoresRepeatedNonce(t *testing.T) {
+	pool := testPool(t)
+	guest := createTestGuest(t, pool, &db.Guest{})
+
+	first := recordTestResponse(t, pool, guest, db.Response{Attendance: db.AttendanceYes, PartySize: 1, Nonce: "abc"})
+	repeat := recordTestResponse(t, pool, guest, db.Response{Attendance: db.AttendanceNo, PartySize: 1, Nonce: "abc"})
+	if first.Duplicate || !repeat.Duplicate {
+		t.Errorf("Duplicate = %v then %v, want false then true", first.Duplicate, repeat.Duplicate)
+	}
+	if !guest.IsAttending() {
+		t.Error("the repeated response replaced the first")
+	}
+	if result := recordTestResponse(t, pool, guest, db.Response{Attendance: db.AttendanceNo, PartySize: 1}); result.Duplicate || !guest.IsDeclined() {
+		t.Error("a response without a nonce was ignored")
+	}
+}
+
+func TestRSVPPageShowsEvent(t *testing.T) {
+	pool := testPool(t)
+	site := newTestSite(t, pool)
+	event := createTestEvent(t, pool, &db.Event{
+		Title:    "Garden Party",
+		Date:     time.Date(2030, time.June, 14, 22, 30, 0, 0, time.UTC),
+		TZ:       "America/Toronto",
+		Location: "12 Rose Lane",
+	})
+	guest := createTestGuest(t, pool, &db.Guest{EventId: &event.Id, Name: "Ada Lovelace"})
+
+	rec := site.get("/rsvp?" + site.sessions.rsvpParams(guest, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	body := rec.Body.String()
+	// The date is shown in the event's time zone, not the server's.
+	date := "Friday, June 14, 2030 at 6:30 PM EDT"
+	for _, want := range []string{"Hello, Ada Lovelace", `<a href="/e/garden-party">Garden Party</a>`, date, "12 Rose Lane"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("the page doesn't contain %q:\n%s", want, body)
+		}
+	}
+}
+
+func TestRSVPPageForDeletedEvent(t *testing.T) {
+	pool := testPool(t)
+	site := newTestSite(t, pool)
+	event := createTestEvent(t, pool, &db.Event{})
+	guest := createTestGuest(t, pool, &db.Guest{EventId: &event.Id})
+	if _, err := pool.Exec(context.Background(), "delete from events where id = $1", event.Id); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := site.get("/rsvp?" + site.sessions.rsvpParams(guest, nil))
+	if rec.Code != http.StatusGone {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusGone)
+	}
+	if want := translate(defaultLanguage, "no_event.title"); !strings.Contains(rec.Body.String(), want) {
+		t.Errorf("the page doesn't contain %q:\n%s", want, rec.Body.String())
+	}
+}
+
+func TestHouseholdRSVP(t *testing.T) {
+	pool := testPool(t)
+	site := newTestSite(t, pool)
+	event := createTestEvent(t, pool, &db.Event{})
+	household, err := db.FindOrCreateHousehold(context.Background(), pool, event.Id, "Lovelace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ada := createTestGuest(t, pool, &db.Guest{EventId: &event.Id, HouseholdId: &household.Id, Name: "Ada Lovelace"})
+	william := createTestGuest(t, pool, &db.Guest{EventId: &event.Id, HouseholdId: &household.Id, Name: "William King"})
+	byron := createTestGuest(t, pool, &db.Guest{EventId: &event.Id, HouseholdId: &household.Id, Name: "Byron King"})
+	members := []*db.Guest{ada, william, byron}
+
+	// Any member's invitation shows the whole household.
+	rec := site.get("/rsvp?" + site.sessions.rsvpParams(william, event))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	for _, member := range members {
+		id := strconv.Itoa(member.Id)
+		for _, want := range []string{`name="attending_` + id + `"`, `name="dietary_` + id + `"`, member.Name + " will attend"} {
+			if !strings.Contains(rec.Body.String(), want) {
+				t.Errorf("the form doesn't contain %q:\n%s", want, rec.Body)
+			}
+		}
+	}
+
+	// Byron's box is left unticked.
+	form := rsvpForm(site, ada, event, url.Values{
+		"attending_" + strconv.Itoa(ada.Id):     {"yes"},
+		"dietary_" + strconv.Itoa(ada.Id):       {"vegetarian"},
+		"attending_" + strconv.Itoa(william.Id): {"yes"},
+		"dietary_" + strconv.Itoa(byron.Id):     {"no nuts"},
+		"notes":                                 {"We may be late"},
+	})
+	if rec := site.post("/rsvp", form); rec.Code != http.StatusSeeOther {
+		t.Fatalf("status = %d, want %d\n%s", rec.Code, http.StatusSeeOther, rec.Body)
+	}
+
+	tests := []struct {
+		guest         *db.Guest
+		wantAttending bool
+		wantDietary   string
+		wantNotes     string
+	}{
+		{guest: ada, wantAttending: true, wantDietary: "vegetarian", wantNotes: "We may be late"},
+		{guest: william, wantAttending: true},
+		{guest: byron, wantDietary: "no nuts"},
+	}
+	for _, tt := range tests {
+		saved := reloadGuest(t, pool, tt.guest.Id)
+		if saved.Attendance == nil || saved.IsAttending() != tt.wantAttending || (!tt.wantAttending && !saved.IsDeclined()) {
+			t.Errorf("%s: attendance = %v, want attending %v", saved.Name, saved.Attendance, tt.wantAttending)
+		}
+		if saved.PartySize != 1 || saved.Dietary != tt.wantDietary || saved.Notes != tt.wantNotes {
+			t.Errorf("%s: party of %d, dietary %q, notes %q, want 1, %q, %q", saved.Name, saved.PartySize, saved.Dietary, saved.Notes, tt.wantDietary, tt.wantNotes)
+		}
+	}
+}
+
+func TestDeclineReason(t *testing.T) {
+	pool := testPool(t)
+	site := newTestSite(t, pool)
+	event := createTestEvent(t, pool, &db.Event{})
+	guest := createTestGuest(t, pool, &db.Guest{EventId: &event.Id, Name: "Ada Lovelace"})
+
+	submit := func(t *testing.T, fields url.Values) *db.Guest {
+		t.Helper()
+		if rec := site.post("/rsvp", rsvpForm(site, guest, event, fields)); rec.Code != http.StatusSeeOther {
+			t.Fatalf("status = %d, want %d\n%s", rec.Code, http.StatusSeeOther, rec.Body)
+		}
+		return reloadGuest(t, pool, guest.Id)
+	}
+
+	t.Run("declining", func(t *testing.T) {
+		saved := submit(t, url.Values{"attending": {"no"}, "decline_reason": {"  Out of town that weekend "}})
+		if !saved.IsDeclined() || saved.DeclineReason != "Out of town that weekend" {
+			t.Errorf("saved %v with reason %q", saved.Attendance, saved.DeclineReason)
+		}
+
+		rec := site.get("/admin/events/"+event.Slug+"/export.csv", site.adminSession())
+		if want := ",Out of town that weekend\n"; !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("the export doesn't contain %q:\n%s", want, rec.Body)
+		}
+	})
+
+	t.Run("switching to attending", func(t *testing.T) {
+		// The form still carries the reason typed in earlier.
+		saved := submit(t, url.Values{"attending": {"yes"}, "party_size": {"1"}, "decline_reason": {"Out of town that weekend"}})
+		if !saved.IsAttending() || saved.DeclineReason != "" {
+			t.Errorf("saved %v with reason %q, want attending with none", saved.Attendance, saved.DeclineReason)
+		}
+	})
+}
+
+func TestValidateDeclineReason(t *testing.T) {
+	guest := &db.Guest{PartySize: 1, MaxPartySize: 2}
+	event := &db.Event{AllowMaybe: true}
+
+	tests := []struct {
+		answer  string
+		reason  string
+		want    string
+		wantErr bool
+	}{
+		{answer: "no", reason: " Away ", want: "Away"},
+		{answer: "no", reason: strings.Repeat("é", maxNoteLength), want: strings.Repeat("é", maxNoteLength)},
+		{answer: "no", reason: strings.Repeat("x", maxNoteLength+1), wantErr: true},
+		{answer: "yes", reason: "Away", want: ""},
+		{answer: "maybe", reason: "Away", want: ""},
+	}
+	for _, tt := range tests {
+		sub := formSubmission(url.Values{"attending": {tt.answer}, "party_size": {"1"}, "decline_reason": {tt.reason}})
+		response, err := sub.validate(guest, event)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s with a %d character reason: no error", tt.answer, len(tt.reason))
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.answer, err)
+			continue
+		}
+		if response.DeclineReason != tt.want {
+			t.Errorf("%s with reason %.20q: saved %.20q, want %.20q", tt.answer, tt.reason, response.DeclineReason, tt.want)
+		}
+	}
+}
+
+func TestSubmitFormAndJSONAlike(t *testing.T) {
+	pool := testPool(t)
+	site := newTestSite(t, pool)
+	event := createTestEvent(t, pool, &db.Event{})
+	byForm := createTestGuest(t, pool, &db.Guest{EventId: &event.Id, Name: "Ada", MaxPartySize: 3})
+	byJSON := createTestGuest(t, pool, &db.Guest{EventId: &event.Id, Name: "Grace", MaxPartySize: 3})
+
+	rec := site.post("/rsvp", rsvpForm(site, byForm, event, url.Values{
+		"attending":  {"yes"},
+		"party_size": {"2"},
+		"companion":  {"Charles Babbage"},
+		"dietary":    {"Vegan"},
+		"notes":      {"Looking forward to it"},
+	}))
+	if rec.Code != http.StatusSeeOther || !strings.HasPrefix(rec.Header().Get("Location"), "/rsvp/thanks?") {
+		t.Fatalf("form: got %d to %q, want a redirect to the thanks page\n%s", rec.Code, rec.Header().Get("Location"), rec.Body)
+	}
+
+	params, _ := url.ParseQuery(site.sessions.rsvpParams(byJSON, event))
+	body, err := json.Marshal(map[string]any{
+		"code":       byJSON.InviteCode,
+		"event":      event.Slug,
+		"sig":        params.Get("sig"),
+		"response":   "yes",
+		"party_size": 2,
+		"companions": []string{"Charles Babbage"},
+		"dietary":    "Vegan",
+		"notes":      "Looking forward to it",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/rsvp", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec = site.serve(req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("JSON: status = %d, want %d\n%s", rec.Code, http.StatusOK, rec.Body)
+	}
+	if state := decodeJSON(t, rec); state["response"] != "yes" || state["party_size"] != 2.0 {
+		t.Errorf("JSON: body = %v, want the new response", state)
+	}
+
+	saved := func(guest *db.Guest) string {
+		g := reloadGuest(t, pool, guest.Id)
+		companions, err := db.ListPlusOneNames(context.Background(), pool, g.Id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return fmt.Sprintf("%s, party of %d with %q, dietary %q, notes %q, responded %v",
+			deref(g.Attendance), g.PartySize, companions, g.Dietary, g.Notes, g.RespondedAt != nil)
+	}
+	if fromForm, fromJSON := saved(byForm), saved(byJSON); fromForm != fromJSON {
+		t.Errorf("the form saved %s\nbut JSON saved %s", fromForm, fromJSON)
+	}
+}
+
+func TestRSVPPath(t *testing.T) {
+	guest := &db.Guest{InviteCode: "ABC123"}
+	event := &db.Event{Slug: "garden-party"}
+	sessions := signer{key: []byte(testSessionSecret)}
+	if got, want := sessions.rsvpPath(guest, event), "/rsvp/ABC123?event=garden-party&sig="+sessions.inviteSignature("ABC123"); got != want {
+		t.Errorf("rsvpPath = %q, want %q", got, want)
+	}
+	sessions.ephemeral = true
+	if got, want := sessions.rsvpPath(guest, nil), "/rsvp/ABC123"; got != want {
+		t.Errorf("ephemeral rsvpPath = %q, want %q", got, want)
+	}
+}
+
+func TestRSVPPathAndQueryAlike(t *testing.T) {
+	pool := testPool(t)
+	site := newTestSite(t, pool)
+	event := createTestEvent(t, pool, &db.Event{})
+	guest := createTestGuest(t, pool, &db.Guest{EventId: &event.Id, Name: "Ada Lovelace"})
+	params := site.sessions.inviteParams(guest, event)
+
+	paths := map[string]string{
+		"path":  "/rsvp/" + guest.InviteCode + "?" + params.Encode(),
+		"query": "/rsvp?" + site.sessions.rsvpParams(guest, event),
+	}
+	for name, path := range paths {
+		t.Run(name, func(t *testing.T) {
+			rec := site.get(path)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+			}
+			for _, want := range []string{"Hello, Ada Lovelace", `<input type="hidden" name="code" value="` + guest.InviteCode + `">`} {
+				if !strings.Contains(rec.Body.String(), want) {
+					t.Errorf("the form doesn't contain %q:\n%s", want, rec.Body)
+				}
+			}
+		})
+	}
+
+	t.Run("unknown code", func(t *testing.T) {
+		for _, path := range []string{"/rsvp/NOSUCHCODE", "/rsvp?code=NOSUCHCODE"} {
+			if rec := site.get(path); rec.Code != http.StatusNotFound {
+				t.Errorf("GET %s: status = %d, want %d", path, rec.Code, http.StatusNotFound)
+			}
+		}
+	})
+
+	t.Run("submitting to the path", func(t *testing.T) {
+		form := rsvpForm(site, guest, event, url.Values{"attending": {"yes"}, "party_size": {"1"}})
+		form.Del("code")
+		rec := site.post("/rsvp/"+guest.InviteCode, form)
+		if rec.Code != http.StatusSeeOther {
+			t.Fatalf("status = %d, want %d\n%s", rec.Code, http.StatusSeeOther, rec.Body)
+		}
+		if !reloadGuest(t, pool, guest.Id).IsAttending() {
+			t.Error("the response wasn't saved")
+		}
+	})
+}
+
+func TestPartySizeFor(t *testing.T) {
+	guest := &db.Guest{MaxPartySize: 5}
+	tests := []struct {
+		name  string
+		event *db.Event
+		want  int
+	}{
+		{name: "no event", want: 5},
+		{name: "no event maximum", event: &db.Event{}, want: 5},
+		{name: "higher event maximum", event: &db.Event{MaxPartySize: ptr(8)}, want: 5},
+		{name: "lower event maximum", event: &db.Event{MaxPartySize: ptr(2)}, want: 2},
+	}
+	for _, tt := range tests {
+		if got := tt.event.PartySizeFor(guest); got != tt.want {
+			t.Errorf("%s: PartySizeFor = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRSVPHeldToEventMaxPartySize(t *testing.T) {
+	pool := testPool(t)
+	site := newTestSite(t, pool)
+	event := createTestEvent(t, pool, &db.Event{MaxPartySize: ptr(2)})
+	guest := createTestGuest(t, pool, &db.Guest{EventId: &event.Id, MaxPartySize: 5})
+
+	if body := site.get(site.sessions.rsvpPath(guest, event)).Body.String(); !strings.Contains(body, `name="party_size" min="1" max="2"`) {
+		t.Errorf("the form doesn't offer at most the event's maximum:\n%s", body)
+	}
+
+	rec := site.post("/rsvp", rsvpForm(site, guest, event, url.Values{"attending": {"yes"}, "party_size": {"4"}}))
+	if rec.Code != http.StatusUnprocessableEntity || !strings.Contains(rec.Body.String(), "Your invitation is for at most 2.") {
+		t.Errorf("got %d, want %d and the party size error\n%s", rec.Code, http.StatusUnprocessableEntity, rec.Body)
+	}
+	if saved := reloadGuest(t, pool, guest.Id); saved.RespondedAt != nil {
+		t.Errorf("saved a response for a party of %d", saved.PartySize)
+	}
+
+	rec = site.post("/rsvp", rsvpForm(site, guest, event, url.Values{"attending": {"yes"}, "party_size": {"2"}}))
+	if rec.Code != http.StatusSeeOther {
+		t.Fatalf("a party of 2: status = %d, want %d\n%s", rec.Code, http.StatusSeeOther, rec.Body)
+	}
+}
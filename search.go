@@ -0,0 +1,51 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/meagar/rsvp/db"
+)
+
+// searchLimit caps how many events, and how many guests, a search shows.
+const searchLimit = 50
+
+type searchData struct {
+	adminPage
+	Search string
+	Events []*db.Event
+	Guests []db.GuestMatch
+}
+
+// Limited reports whether either list of results may have been cut short.
+func (d searchData) Limited() bool {
+	return len(d.Events) == searchLimit || len(d.Guests) == searchLimit
+}
+
+// search finds events by title or slug, and guests of any event by name or
+// email address, matching the text in q.
+func (h *AdminHandler) search(rw http.ResponseWriter, req *http.Request) {
+	data := searchData{
+		adminPage: h.page(req),
+		Search:    strings.TrimSpace(req.URL.Query().Get("q")),
+	}
+	if data.Search == "" {
+		renderPage(rw, req, http.StatusOK, "admin/search", data)
+		return
+	}
+
+	ctx, cancel := h.cfg.queryContext(req)
+	defer cancel()
+
+	var err error
+	if data.Events, err = db.SearchEvents(ctx, h.reads, data.Search, searchLimit); err != nil {
+		serverError(rw, req, err)
+		return
+	}
+	if data.Guests, err = db.SearchGuests(ctx, h.reads, data.Search, searchLimit); err != nil {
+		serverError(rw, req, err)
+		return
+	}
+
+	renderPage(rw, req, http.StatusOK, "admin/search", data)
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/meagar/rsvp/db"
+)
+
+func TestSearch(t *testing.T) {
+	pool := testPool(t)
+	site := newTestSite(t, pool)
+	picnic := createTestEvent(t, pool, &db.Event{Title: "Summer Picnic"})
+	gala := createTestEvent(t, pool, &db.Event{Title: "Winter Gala", Slug: "picnic-fundraiser"})
+	createTestEvent(t, pool, &db.Event{Title: "Book Club"})
+	createTestGuest(t, pool, &db.Guest{EventId: &picnic.Id, Name: "Ada Lovelace", Email: "ada@example.com"})
+	createTestGuest(t, pool, &db.Guest{EventId: &gala.Id, Name: "Grace Hopper", Email: "grace@lovelace.example"})
+	createTestGuest(t, pool, &db.Guest{EventId: &gala.Id, Name: "Alan Turing", Email: "alan@example.com"})
+	deleted := createTestGuest(t, pool, &db.Guest{EventId: &picnic.Id, Name: "Charles Lovelace"})
+	if _, _, err := db.DeleteGuest(context.Background(), pool, deleted.Id); err != nil {
+		t.Fatal(err)
+	}
+
+	// section returns the part of the page under the named heading.
+	section := func(body, heading string) string {
+		_, after, _ := strings.Cut(body, "<h2>"+heading+"</h2>")
+		before, _, _ := strings.Cut(after, "<h2>")
+		return before
+	}
+
+	tests := []struct {
+		q                      string
+		wantEvents, wantGuests []string
+		notEvents, notGuests   []string
+	}{
+		{
+			q:          "PICNIC",
+			wantEvents: []string{"Summer Picnic", "Winter Gala"},
+			notEvents:  []string{"Book Club"},
+			notGuests:  []string{"Ada Lovelace", "Grace Hopper"},
+		},
+		{
+			q:          "lovelace",
+			wantGuests: []string{"Ada Lovelace", "Grace Hopper", "Summer Picnic", "Winter Gala"},
+			notGuests:  []string{"Alan Turing", "Charles Lovelace"},
+		},
+		{
+			q:          "%",
+			wantGuests: []string{`No guests match “%”.`},
+			notGuests:  []string{"Ada Lovelace", "Grace Hopper", "Alan Turing"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.q, func(t *testing.T) {
+			rec := site.get("/admin/search?q="+url.QueryEscape(tt.q), site.adminSession())
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+			}
+			events, guests := section(rec.Body.String(), "Events"), section(rec.Body.String(), "Guests")
+			for _, want := range tt.wantEvents {
+				if !strings.Contains(events, want) {
+					t.Errorf("the events don't include %q:\n%s", want, events)
+				}
+			}
+			for _, notWant := range tt.notEvents {
+				if strings.Contains(events, notWant) {
+					t.Errorf("the events include %q", notWant)
+				}
+			}
+			for _, want := range tt.wantGuests {
+				if !strings.Contains(guests, want) {
+					t.Errorf("the guests don't include %q:\n%s", want, guests)
+				}
+			}
+			for _, notWant := range tt.notGuests {
+				if strings.Contains(guests, notWant) {
+					t.Errorf("the guests include %q", notWant)
+				}
+			}
+		})
+	}
+}
+
+func TestSearchWithoutQuery(t *testing.T) {
+	site := newTestSite(t, testPool(t))
+
+	rec := site.get("/admin/search?q=+", site.adminSession())
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `<input type="search" name="q"`) {
+		t.Errorf("got %d, want the search form\n%s", rec.Code, rec.Body)
+	}
+	if strings.Contains(rec.Body.String(), "<h2>Events</h2>") {
+		t.Errorf("an empty search shows results:\n%s", rec.Body)
+	}
+}
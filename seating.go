@@ -0,0 +1,199 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/meagar/rsvp/db"
+)
+
+// maxTableNameLength is the longest table name an admin can enter.
+const maxTableNameLength = 100
+
+// table is a group of attendees seated together. The table with an empty
+// name holds everyone who hasn't been seated yet.
+type table struct {
+	Name      string
+	Attendees []attendee
+	Headcount int
+	// Seats is how many people fit at the table, or nil if that isn't
+	// limited.
+	Seats *int
+}
+
+// Over reports whether more people are seated at the table than fit.
+func (t table) Over() bool {
+	return t.Name != "" && t.Seats != nil && t.Headcount > *t.Seats
+}
+
+// compareTableNames orders tables by name, comparing names that are plain
+// numbers numerically so that table 10 comes after table 9. The unseated
+// table comes last.
+func compareTableNames(a, b string) int {
+	if a == "" || b == "" {
+		return cmp.Compare(b, a)
+	}
+	m, errA := strconv.Atoi(a)
+	n, errB := strconv.Atoi(b)
+	switch {
+	case errA == nil && errB == nil:
+		return cmp.Compare(m, n)
+	case errA == nil:
+		return -1
+	case errB == nil:
+		return 1
+	}
+	return cmp.Compare(strings.ToLower(a), strings.ToLower(b))
+}
+
+// groupByTable splits attendees up by their table assignments, counting
+// everyone in each guest's party against their table. Attendees keep their
+// order within each table.
+func groupByTable(attendees []attendee, seats *int) []table {
+	var tables []table
+	index := map[string]int{}
+	for _, a := range attendees {
+		name := a.Guest.TableAssignment
+		i, ok := index[name]
+		if !ok {
+			i = len(tables)
+			index[name] = i
+			tables = append(tables, table{Name: name, Seats: seats})
+		}
+		tables[i].Attendees = append(tables[i].Attendees, a)
+		tables[i].Headcount += a.Guest.PartySize
+	}
+	slices.SortFunc(tables, func(a, b table) int {
+		return compareTableNames(a.Name, b.Name)
+	})
+	return tables
+}
+
+type seatingData struct {
+	adminPage
+	Event     *db.Event
+	Attendees []attendee
+	Tables    []table
+	// Form holds each attendee's table as entered, by guest id.
+	Form  map[int]string
+	Error string
+}
+
+// Names returns the names of the tables guests are seated at, for
+// suggesting as they're assigned.
+func (d seatingData) Names() []string {
+	var names []string
+	for _, t := range d.Tables {
+		if t.Name != "" {
+			names = append(names, t.Name)
+		}
+	}
+	return names
+}
+
+// Overfull counts the tables with more people than fit.
+func (d seatingData) Overfull() int {
+	n := 0
+	for _, t := range d.Tables {
+		if t.Over() {
+			n++
+		}
+	}
+	return n
+}
+
+// seating shows who is sitting at each of an event's tables, with a form to
+// move attendees between them.
+func (h *AdminHandler) seating(rw http.ResponseWriter, req *http.Request) {
+	event := findEvent(rw, req, h.cfg, h.db)
+	if event == nil {
+		return
+	}
+
+	ctx, cancel := h.cfg.queryContext(req)
+	defer cancel()
+
+	attendees, err := listAttendees(ctx, h.db, event.Id)
+	if err != nil {
+		serverError(rw, req, err)
+		return
+	}
+
+	form := make(map[int]string, len(attendees))
+	for _, a := range attendees {
+		form[a.Guest.Id] = a.Guest.TableAssignment
+	}
+	h.renderSeating(rw, req, http.StatusOK, event, attendees, form, "")
+}
+
+// assignTables saves the seating form. Only attendees whose table changed
+// are updated; invalid forms are redisplayed with the problem.
+func (h *AdminHandler) assignTables(rw http.ResponseWriter, req *http.Request) {
+	event := findEvent(rw, req, h.cfg, h.db)
+	if event == nil {
+		return
+	}
+	if err := parseBody(req); err != nil {
+		bodyError(rw, err)
+		return
+	}
+
+	ctx, cancel := h.cfg.queryContext(req)
+	defer cancel()
+
+	attendees, err := listAttendees(ctx, h.db, event.Id)
+	if err != nil {
+		serverError(rw, req, err)
+		return
+	}
+
+	form := make(map[int]string, len(attendees))
+	changes := map[int]string{}
+	tooLong := false
+	for _, a := range attendees {
+		key := "table_" + strconv.Itoa(a.Guest.Id)
+		name := a.Guest.TableAssignment
+		if req.PostForm.Has(key) {
+			name = strings.TrimSpace(req.PostForm.Get(key))
+		}
+		form[a.Guest.Id] = name
+		if utf8.RuneCountInString(name) > maxTableNameLength {
+			tooLong = true
+		}
+		if name != a.Guest.TableAssignment {
+			changes[a.Guest.Id] = name
+		}
+	}
+	if tooLong {
+		msg := fmt.Sprintf("Table names can be at most %d characters.", maxTableNameLength)
+		h.renderSeating(rw, req, http.StatusUnprocessableEntity, event, attendees, form, msg)
+		return
+	}
+
+	if len(changes) > 0 {
+		if err := db.AssignTables(ctx, h.db, event.Id, changes); err != nil {
+			serverError(rw, req, err)
+			return
+		}
+		h.audit(req, "event.seating", "event "+event.Slug, "moved "+strconv.Itoa(len(changes)))
+	}
+	h.setFlash(rw, req, "Saved the seating plan for "+event.Title+".")
+
+	http.Redirect(rw, req, h.path+"events/"+event.Slug+"/seating", http.StatusSeeOther)
+}
+
+func (h *AdminHandler) renderSeating(rw http.ResponseWriter, req *http.Request, status int, event *db.Event, attendees []attendee, form map[int]string, msg string) {
+	renderPage(rw, req, status, "admin/seating", seatingData{
+		adminPage: h.page(req),
+		Event:     event,
+		Attendees: attendees,
+		Tables:    groupByTable(attendees, event.SeatsPerTable),
+		Form:      form,
+		Error:     msg,
+	})
+}
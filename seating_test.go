@@ -0,0 +1,110 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/meagar/rsvp/db"
+)
+
+func TestGroupByTable(t *testing.T) {
+	seated := func(name, table string, partySize int) attendee {
+		return attendee{Guest: &db.Guest{Name: name, TableAssignment: table, PartySize: partySize}}
+	}
+	attendees := []attendee{
+		seated("Ada", "10", 2),
+		seated("Alan", "", 1),
+		seated("Barbara", "head table", 1),
+		seated("Charles", "2", 1),
+		seated("Edsger", "10", 1),
+		seated("Grace", "Garden", 1),
+	}
+
+	tables := groupByTable(attendees, ptr(2))
+	var names []string
+	for _, table := range tables {
+		names = append(names, table.Name)
+	}
+	if want := []string{"2", "10", "Garden", "head table", ""}; !slices.Equal(names, want) {
+		t.Fatalf("tables = %q, want %q", names, want)
+	}
+
+	ten := tables[1]
+	if ten.Headcount != 3 || len(ten.Attendees) != 2 || ten.Attendees[0].Guest.Name != "Ada" || !ten.Over() {
+		t.Errorf("table 10 has %d people in %d parties, over = %v, want 3 in 2 and over", ten.Headcount, len(ten.Attendees), ten.Over())
+	}
+	if tables[0].Over() {
+		t.Error("table 2 is over capacity with 1 of 2 seats taken")
+	}
+	if unseated := tables[4]; unseated.Over() || unseated.Headcount != 1 {
+		t.Errorf("the unseated table has %d people, over = %v", unseated.Headcount, unseated.Over())
+	}
+
+	for _, table := range groupByTable(attendees, nil) {
+		if table.Over() {
+			t.Errorf("table %q is over capacity without a limit", table.Name)
+		}
+	}
+}
+
+func TestSeating(t *testing.T) {
+	pool := testPool(t)
+	site := newTestSite(t, pool)
+	event := createTestEvent(t, pool, &db.Event{SeatsPerTable: ptr(2)})
+
+	attending := func(name string, partySize int) *db.Guest {
+		guest := createTestGuest(t, pool, &db.Guest{EventId: &event.Id, Name: name, MaxPartySize: partySize})
+		recordTestResponse(t, pool, guest, db.Response{Attendance: db.AttendanceYes, PartySize: partySize})
+		return guest
+	}
+	ada, grace, alan := attending("Ada Lovelace", 2), attending("Grace Hopper", 1), attending("Alan Turing", 1)
+
+	path := "/admin/events/" + event.Slug + "/seating"
+	form := url.Values{
+		"table_" + strconv.Itoa(ada.Id):   {"1"},
+		"table_" + strconv.Itoa(grace.Id): {" 1 "},
+	}
+	if rec := site.post(path, form, site.adminSession()); rec.Code != http.StatusSeeOther {
+		t.Fatalf("status = %d, want %d\n%s", rec.Code, http.StatusSeeOther, rec.Body)
+	}
+	if got := reloadGuest(t, pool, grace.Id).TableAssignment; got != "1" {
+		t.Errorf("Grace Hopper's table = %q, want %q", got, "1")
+	}
+	if got := reloadGuest(t, pool, alan.Id).TableAssignment; got != "" {
+		t.Errorf("Alan Turing's table = %q, want none", got)
+	}
+
+	body := site.get(path, site.adminSession()).Body.String()
+	for _, want := range []string{"1 table has more people than fit.", "3 of 2 seats taken: over capacity", "<h2>Not seated</h2>"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("the seating page doesn't contain %q:\n%s", want, body)
+		}
+	}
+
+	form = url.Values{"table_" + strconv.Itoa(grace.Id): {"2"}}
+	site.post(path, form, site.adminSession())
+	if body := site.get(path, site.adminSession()).Body.String(); strings.Contains(body, "over capacity") {
+		t.Errorf("a table is still over capacity after moving Grace Hopper:\n%s", body)
+	}
+}
+
+func TestSeatingRejectsLongTableNames(t *testing.T) {
+	pool := testPool(t)
+	site := newTestSite(t, pool)
+	event := createTestEvent(t, pool, &db.Event{})
+	guest := createTestGuest(t, pool, &db.Guest{EventId: &event.Id})
+	recordTestResponse(t, pool, guest, db.Response{Attendance: db.AttendanceYes, PartySize: 1})
+
+	form := url.Values{"table_" + strconv.Itoa(guest.Id): {strings.Repeat("x", maxTableNameLength+1)}}
+	rec := site.post("/admin/events/"+event.Slug+"/seating", form, site.adminSession())
+	if rec.Code != http.StatusUnprocessableEntity || !strings.Contains(rec.Body.String(), "Table names can be at most 100 characters.") {
+		t.Errorf("got %d, want %d and the length error\n%s", rec.Code, http.StatusUnprocessableEntity, rec.Body)
+	}
+	if got := reloadGuest(t, pool, guest.Id).TableAssignment; got != "" {
+		t.Errorf("saved table %q", got)
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// signer produces and verifies HMAC-signed string values suitable for use in
+// cookies.
+type signer struct {
+	key []byte
+	// ephemeral is set when the key was generated at startup, so anything
+	// it signed is only good until the next restart.
+	ephemeral bool
+}
+
+// newSigner returns a signer keyed by secret. If secret is empty a random key
+// is generated, which means signed values won't survive a restart.
+func newSigner(secret string) signer {
+	if secret != "" {
+		return signer{key: []byte(secret)}
+	}
+
+	slog.Warn("SESSION_SECRET is unset: Using a random key, sessions will not survive a restart")
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		fatal("Generating session key failed", "error", err)
+	}
+	return signer{key: key, ephemeral: true}
+}
+
+func (s signer) mac(payload string) string {
+	m := hmac.New(sha256.New, s.key)
+	m.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(m.Sum(nil))
+}
+
+// sign encodes value and appends its signature.
+func (s signer) sign(value string) string {
+	payload := base64.RawURLEncoding.EncodeToString([]byte(value))
+	return payload + "." + s.mac(payload)
+}
+
+// verify returns the value encoded in signed if its signature is valid.
+func (s signer) verify(signed string) (string, bool) {
+	payload, sig, ok := strings.Cut(signed, ".")
+	if !ok || !hmac.Equal([]byte(sig), []byte(s.mac(payload))) {
+		return "", false
+	}
+
+	value, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return "", false
+	}
+	return string(value), true
+}
+
+// adminUser returns the admin user named by the request's session cookie,
+// along with the fingerprint of the password they logged in with.
+func (s signer) adminUser(req *http.Request) (user, fingerprint string, ok bool) {
+	cookie, err := req.Cookie(sessionCookie)
+	if err != nil {
+		return "", "", false
+	}
+	return s.verifySession(cookie.Value)
+}
+
+// passwordFingerprint identifies the admin password hash a session was
+// started with, so that changing the password ends every session started
+// with the old one. It's a MAC rather than the hash itself, which would
+// otherwise be readable in the cookie.
+func (s signer) passwordFingerprint(hash []byte) string {
+	return s.mac("password|" + string(hash))
+}
+
+// signSession returns a signed session value for user, who logged in with
+// the password whose fingerprint is given, expiring at expires.
+func (s signer) signSession(user, fingerprint string, expires time.Time) string {
+	return s.sign(strconv.FormatInt(expires.Unix(), 10) + "|" + fingerprint + "|" + user)
+}
+
+// verifySession returns the user named by a signed session value and the
+// fingerprint of their password, provided the signature is valid and the
+// session hasn't expired.
+func (s signer) verifySession(signed string) (user, fingerprint string, ok bool) {
+	value, ok := s.verify(signed)
+	if !ok {
+		return "", "", false
+	}
+
+	parts := strings.SplitN(value, "|", 3)
+	if len(parts) != 3 {
+		return "", "", false
+	}
+	unix, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || time.Now().After(time.Unix(unix, 0)) {
+		return "", "", false
+	}
+	return parts[2], parts[1], true
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// honeypotField is a form field hidden from people, so that only bots that
+// fill in every field will submit it with a value.
+const honeypotField = "website"
+
+// stampField carries the signed time a form was rendered.
+const stampField = "form_stamp"
+
+// minSubmitTime is the least time a person could plausibly take to fill in
+// the RSVP form.
+const minSubmitTime = 2 * time.Second
+
+// formStamp returns a signed timestamp for stampField.
+func (h *RSVPHandler) formStamp(now time.Time) string {
+	return h.sessions.sign(strconv.FormatInt(now.UnixMilli(), 10))
+}
+
+// automatedSubmission reports why a form submission looks like it came from
+// a bot, or "" if it doesn't: the honeypot was filled in, or the form was
+// submitted too quickly or without a valid stamp.
+func (h *RSVPHandler) automatedSubmission(form url.Values, now time.Time) string {
+	if form.Get(honeypotField) != "" {
+		return "honeypot"
+	}
+
+	value, ok := h.sessions.verify(form.Get(stampField))
+	if !ok {
+		return "missing stamp"
+	}
+	millis, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return "missing stamp"
+	}
+	if now.Sub(time.UnixMilli(millis)) < minSubmitTime {
+		return "too fast"
+	}
+	return ""
+}
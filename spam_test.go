@@ -0,0 +1,74 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/meagar/rsvp/db"
+)
+
+func TestAutomatedSubmission(t *testing.T) {
+	h := &RSVPHandler{sessions: newSigner(testSessionSecret)}
+	now := time.Date(2030, time.May, 1, 12, 0, 0, 0, time.UTC)
+	forged := newSigner("some other secret").sign(strconv.FormatInt(now.Add(-time.Minute).UnixMilli(), 10))
+
+	tests := []struct {
+		name string
+		form url.Values
+		want string
+	}{
+		{name: "person", form: url.Values{stampField: {h.formStamp(now.Add(-time.Minute))}}, want: ""},
+		{name: "honeypot", form: url.Values{stampField: {h.formStamp(now.Add(-time.Minute))}, honeypotField: {"https://spam.example"}}, want: "honeypot"},
+		{name: "too fast", form: url.Values{stampField: {h.formStamp(now.Add(-time.Second))}}, want: "too fast"},
+		{name: "just slow enough", form: url.Values{stampField: {h.formStamp(now.Add(-minSubmitTime))}}, want: ""},
+		{name: "no stamp", form: url.Values{}, want: "missing stamp"},
+		{name: "forged stamp", form: url.Values{stampField: {forged}}, want: "missing stamp"},
+		{name: "unsigned stamp", form: url.Values{stampField: {strconv.FormatInt(now.Add(-time.Minute).UnixMilli(), 10)}}, want: "missing stamp"},
+		{name: "signed nonsense", form: url.Values{stampField: {h.sessions.sign("yesterday")}}, want: "missing stamp"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := h.automatedSubmission(tt.form, now); got != tt.want {
+				t.Errorf("automatedSubmission() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAutomatedRSVPIsIgnored(t *testing.T) {
+	pool := testPool(t)
+	site := newTestSite(t, pool)
+	event := createTestEvent(t, pool, &db.Event{})
+	yes := url.Values{"attending": {"yes"}, "party_size": {"1"}}
+
+	tests := []struct {
+		name      string
+		change    func(form url.Values)
+		wantSaved bool
+	}{
+		{name: "empty honeypot", change: func(form url.Values) { form.Set(honeypotField, "") }, wantSaved: true},
+		{name: "filled honeypot", change: func(form url.Values) { form.Set(honeypotField, "https://spam.example") }},
+		{name: "too fast", change: func(form url.Values) {
+			form.Set(stampField, (&RSVPHandler{sessions: site.sessions}).formStamp(time.Now()))
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			guest := createTestGuest(t, pool, &db.Guest{EventId: &event.Id})
+			form := rsvpForm(site, guest, event, yes)
+			tt.change(form)
+
+			// Bots are thanked like anyone else.
+			rec := site.post("/rsvp", form)
+			if want := "/rsvp/thanks?" + site.sessions.rsvpParams(guest, event); rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != want {
+				t.Errorf("status = %d, Location = %q, want a redirect to %s", rec.Code, rec.Header().Get("Location"), want)
+			}
+			if saved := reloadGuest(t, pool, guest.Id); saved.IsAttending() != tt.wantSaved {
+				t.Errorf("saved = %v, want %v", saved.IsAttending(), tt.wantSaved)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"errors"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+//go:embed static
+var staticFS embed.FS
+
+// defaultStaticPath is the URL path static assets are linked from when the
+// request didn't pass through linkStatic.
+const defaultStaticPath = "/static/"
+
+// parseStaticOrigin validates a STATIC_ORIGIN value, returning it without a
+// trailing slash.
+func parseStaticOrigin(value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	u, err := url.Parse(value)
+	if err != nil {
+		return "", err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", errors.New("must be an absolute http or https URL")
+	}
+	if strings.TrimSuffix(u.Path, "/") != "" || u.RawQuery != "" || u.Fragment != "" {
+		return "", errors.New("must be an origin, without a path, query or fragment")
+	}
+	return u.Scheme + "://" + u.Host, nil
+}
+
+// linkStatic has pages rendered for the request link static assets from
+// base: STATIC_ORIGIN, the CDN in front of the app if there is one, followed
+// by STATIC_PATH.
+func linkStatic(base string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		next.ServeHTTP(rw, req.WithContext(context.WithValue(req.Context(), staticBaseKey, base)))
+	})
+}
+
+// staticURL returns the URL of the named static asset, as linked from pages
+// rendered with ctx.
+func staticURL(ctx context.Context, name string) string {
+	base, ok := ctx.Value(staticBaseKey).(string)
+	if !ok {
+		base = defaultStaticPath
+	}
+	return base + strings.TrimPrefix(name, "/")
+}
+
+// staticHandler serves the embedded static directory, which is mounted at
+// path. Assets are cacheable for a day; directory listings are not served.
+func staticHandler(path string) http.Handler {
+	sub, err := fs.Sub(staticFS, "static")
+	if err != nil {
+		fatal("Opening static assets failed", "error", err)
+	}
+
+	files := http.StripPrefix(path, http.FileServerFS(sub))
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if strings.HasSuffix(req.URL.Path, "/") {
+			notFound(rw, req)
+			return
+		}
+		rw.Header().Set("Cache-Control", "public, max-age=86400")
+		files.ServeHTTP(rw, req)
+	})
+}
+
+// faviconHandler serves the embedded favicon at /favicon.ico, where browsers
+// look for it unasked.
+func faviconHandler() http.Handler {
+	icon, err := staticFS.ReadFile("static/favicon.ico")
+	if err != nil {
+		fatal("Opening favicon failed", "error", err)
+	}
+
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Header().Set("Content-Type", "image/x-icon")
+		rw.Header().Set("Cache-Control", "public, max-age=86400")
+		http.ServeContent(rw, req, "favicon.ico", time.Time{}, bytes.NewReader(icon))
+	})
+}
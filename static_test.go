@@ -0,0 +1,52 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestStaticAssets(t *testing.T) {
+	site := newTestSite(t, unreachablePool(t))
+	style, err := staticFS.ReadFile("static/css/style.css")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := site.get("/static/css/style.css")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	if got, want := rec.Header().Get("Content-Type"), "text/css; charset=utf-8"; got != want {
+		t.Errorf("Content-Type = %q, want %q", got, want)
+	}
+	if rec.Body.String() != string(style) {
+		t.Errorf("body isn't static/css/style.css")
+	}
+
+	if rec := site.get("/static/css/"); rec.Code != http.StatusNotFound {
+		t.Errorf("directory listing: status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+// The favicon is served without touching the database, so it works even
+// while the database is down.
+func TestFavicon(t *testing.T) {
+	site := newTestSite(t, unreachablePool(t))
+	icon, err := staticFS.ReadFile("static/favicon.ico")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := site.get("/favicon.ico")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	for header, want := range map[string]string{"Content-Type": "image/x-icon", "Cache-Control": "public, max-age=86400"} {
+		if got := rec.Header().Get(header); got != want {
+			t.Errorf("%s = %q, want %q", header, got, want)
+		}
+	}
+	if rec.Body.String() != string(icon) {
+		t.Errorf("body isn't static/favicon.ico")
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// poolStats is a snapshot of the database connection pool's usage.
+type poolStats struct {
+	MaxConns          int32
+	TotalConns        int32
+	IdleConns         int32
+	AcquiredConns     int32
+	ConstructingConns int32
+
+	AcquireCount         int64
+	EmptyAcquireCount    int64
+	CanceledAcquireCount int64
+	AcquireDuration      time.Duration
+	AverageAcquire       time.Duration
+}
+
+func newPoolStats(s *pgxpool.Stat) poolStats {
+	stats := poolStats{
+		MaxConns:          s.MaxConns(),
+		TotalConns:        s.TotalConns(),
+		IdleConns:         s.IdleConns(),
+		AcquiredConns:     s.AcquiredConns(),
+		ConstructingConns: s.ConstructingConns(),
+
+		AcquireCount:         s.AcquireCount(),
+		EmptyAcquireCount:    s.EmptyAcquireCount(),
+		CanceledAcquireCount: s.CanceledAcquireCount(),
+		AcquireDuration:      s.AcquireDuration(),
+	}
+	if stats.AcquireCount > 0 {
+		stats.AverageAcquire = stats.AcquireDuration / time.Duration(stats.AcquireCount)
+	}
+	return stats
+}
+
+// stats shows how the database connection pools are being used.
+func (h *AdminHandler) stats(rw http.ResponseWriter, req *http.Request) {
+	var replica *poolStats
+	if h.reads != h.db {
+		stats := newPoolStats(h.reads.Stat())
+		replica = &stats
+	}
+
+	renderPage(rw, req, http.StatusOK, "admin/stats", struct {
+		adminPage
+		Pool    poolStats
+		Replica *poolStats
+	}{adminPage: h.page(req), Pool: newPoolStats(h.db.Stat()), Replica: replica})
+}
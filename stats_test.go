@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestStatsPage(t *testing.T) {
+	pool := testPool(t)
+	site := newTestSite(t, pool)
+
+	// Hold a connection, so that there's one in use while the page renders.
+	conn, err := pool.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Release()
+
+	rec := site.get("/admin/stats", site.adminSession())
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	stat := pool.Stat()
+	body := rec.Body.String()
+	for _, want := range []string{
+		fmt.Sprintf("<tr><th>Open</th><td>%d of %d</td></tr>", stat.TotalConns(), stat.MaxConns()),
+		"<tr><th>In use</th><td>1</td></tr>",
+		fmt.Sprintf("<tr><th>Total</th><td>%d</td></tr>", stat.AcquireCount()),
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("the page doesn't contain %q:\n%s", want, body)
+		}
+	}
+	if stat.AcquireCount() < 1 {
+		t.Errorf("AcquireCount = %d, want the acquire above counted", stat.AcquireCount())
+	}
+	if strings.Contains(body, "Read replica") {
+		t.Error("the page shows a replica, but there isn't one")
+	}
+}
+
+func TestStatsPageShowsReplica(t *testing.T) {
+	site := newTestSite(t, testPool(t))
+	replica := unreachablePool(t)
+	site.handler = newHandler(site.cfg, site.pool, replica, site.sessions, site.mailer, nil, site.reminders)
+
+	rec := site.get("/admin/stats", site.adminSession())
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	body := rec.Body.String()
+	_, replicaStats, _ := strings.Cut(body, "<h2>Read replica</h2>")
+	open := fmt.Sprintf("<tr><th>Open</th><td>0 of %d</td></tr>", replica.Stat().MaxConns())
+	if !strings.Contains(replicaStats, open) {
+		t.Errorf("the page doesn't show the replica with %q:\n%s", open, body)
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// templateFuncs are available to every template. They're registered before
+// the templates are parsed, by parseTemplates.
+var templateFuncs = template.FuncMap{
+	"formatEventTime": formatEventTime,
+	"formatDate":      formatDate,
+	"pluralize":       pluralize,
+	"json":            jsonValue,
+	"title":           titleCase,
+}
+
+// defaultDateFormat is used by formatDate when no layout is given.
+const defaultDateFormat = "2006-01-02 15:04"
+
+// formatDate formats a time.Time or *time.Time with layout, or with
+// defaultDateFormat if layout is omitted. A nil time formats as "".
+func formatDate(t any, layout ...string) (string, error) {
+	var tm time.Time
+	switch t := t.(type) {
+	case time.Time:
+		tm = t
+	case *time.Time:
+		if t == nil {
+			return "", nil
+		}
+		tm = *t
+	default:
+		return "", fmt.Errorf("formatDate: can't format %T", t)
+	}
+
+	switch len(layout) {
+	case 0:
+		return tm.Format(defaultDateFormat), nil
+	case 1:
+		return tm.Format(layout[0]), nil
+	default:
+		return "", fmt.Errorf("formatDate: expected at most one layout, got %d", len(layout))
+	}
+}
+
+// pluralize returns n followed by singular if n is 1, or by plural otherwise,
+// as in "1 guest" or "3 guests".
+func pluralize(n int, singular, plural string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, singular)
+	}
+	return fmt.Sprintf("%d %s", n, plural)
+}
+
+// jsonValue encodes v as JSON that's safe to include in a script.
+func jsonValue(v any) (template.JS, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return template.JS(b), nil
+}
+
+// titleCase upper-cases the first letter of each word in s.
+func titleCase(s string) string {
+	words := strings.Fields(s)
+	for i, w := range words {
+		r, size := utf8.DecodeRuneInString(w)
+		words[i] = string(unicode.ToUpper(r)) + w[size:]
+	}
+	return strings.Join(words, " ")
+}
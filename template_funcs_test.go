@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestFormatDate(t *testing.T) {
+	at := time.Date(2030, time.June, 14, 18, 5, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		t       any
+		layout  []string
+		want    string
+		wantErr bool
+	}{
+		{name: "default layout", t: at, want: "2030-06-14 18:05"},
+		{name: "layout", t: at, layout: []string{"Jan 2, 2006"}, want: "Jun 14, 2030"},
+		{name: "pointer", t: &at, layout: []string{time.Kitchen}, want: "6:05PM"},
+		{name: "nil pointer", t: (*time.Time)(nil), want: ""},
+		{name: "not a time", t: "2030-06-14", wantErr: true},
+		{name: "two layouts", t: at, layout: []string{time.Kitchen, time.RFC3339}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := formatDate(tt.t, tt.layout...)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("formatDate = %q, want an error", got)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("formatDate = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestPluralize(t *testing.T) {
+	for n, want := range map[int]string{0: "0 guests", 1: "1 guest", 2: "2 guests", -1: "-1 guests"} {
+		if got := pluralize(n, "guest", "guests"); got != want {
+			t.Errorf("pluralize(%d) = %q, want %q", n, got, want)
+		}
+	}
+}
+
+func TestTitleCase(t *testing.T) {
+	for s, want := range map[string]string{
+		"garden party":        "Garden Party",
+		"  élan   vital  ":    "Élan Vital",
+		"already Title Cased": "Already Title Cased",
+		"":                    "",
+	} {
+		if got := titleCase(s); got != want {
+			t.Errorf("titleCase(%q) = %q, want %q", s, got, want)
+		}
+	}
+}
+
+func TestTemplateFuncs(t *testing.T) {
+	set, err := parseTemplates(fstest.MapFS{
+		"summary.tmpl": {Data: []byte(`{{title .Title}} on {{formatDate .Date "January 2"}}: {{pluralize .Attending "guest" "guests"}}, {{pluralize .Declined "decline" "declines"}}.` +
+			`<script>var event = {{json .}};</script>`)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := struct {
+		Title               string
+		Date                time.Time
+		Attending, Declined int
+	}{Title: "garden party </script>", Date: time.Date(2030, time.June, 14, 18, 0, 0, 0, time.UTC), Attending: 3, Declined: 1}
+	var buf bytes.Buffer
+	if err := set["summary"].ExecuteTemplate(&buf, "summary", data); err != nil {
+		t.Fatal(err)
+	}
+	// json escapes the </script> that would otherwise end the script early.
+	want := `Garden Party &lt;/script&gt; on June 14: 3 guests, 1 decline.` +
+		`<script>var event = {"Title":"garden party \u003c/script\u003e","Date":"2030-06-14T18:00:00Z","Attending":3,"Declined":1};</script>`
+	if got := buf.String(); got != want {
+		t.Errorf("rendered:\n%s\nwant:\n%s", got, want)
+	}
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+//go:embed templates
+var templateFS embed.FS
+
+// sharedTemplateDirs hold layouts and partials that are made available to
+// every other template.
+var sharedTemplateDirs = []string{"layouts", "partials"}
+
+// templateExtensions are the file extensions recognized as templates. They
+// are stripped when naming templates.
+var templateExtensions = []string{".tmpl", ".html"}
+
+// altDelimsSuffix marks templates, as in emails/welcome.alt.tmpl, that are
+// written with altDelims instead of {{ and }}, which HTML emails sometimes
+// need to pass through untouched to the systems that send them on. It's
+// stripped from the template's name along with the extension.
+const altDelimsSuffix = ".alt"
+
+// altDelims are the left and right action delimiters for templates marked
+// with altDelimsSuffix.
+var altDelims = [2]string{"[[", "]]"}
+
+// templateSet maps each template name to its own template tree, containing
+// the template itself plus every shared layout and partial. Keeping pages
+// apart lets each one define its own "title" and "content" blocks for the
+// layout to pull in.
+type templateSet map[string]*template.Template
+
+// loadedTemplates holds the current templateSet. Reloading swaps in a whole
+// new set, so requests rendering concurrently each see either the old set or
+// the new one, never a mixture.
+var loadedTemplates atomic.Pointer[templateSet]
+
+// templateDir, when set, is a directory on disk that templates are read from
+// instead of using the embedded copies.
+var templateDir string
+
+// templateReload re-parses the templates from templateDir on every render, so
+// that edits show up without a restart. It's much slower than rendering the
+// cached set and is meant for development only.
+var templateReload bool
+
+// loadTemplates parses the templates into loadedTemplates, from dir if it's
+// non-empty or the embedded copies otherwise. If reload is set, they're parsed
+// again from dir on each render.
+func loadTemplates(dir string, reload bool) {
+	templateDir, templateReload = dir, reload && dir != ""
+	fsys, err := templateSource()
+	if err != nil {
+		fatal("Opening templates failed", "error", err)
+	}
+
+	set, err := parseTemplates(fsys)
+	if err != nil {
+		fatal("Loading templates failed", "error", err)
+	}
+	loadedTemplates.Store(&set)
+
+	if templateReload {
+		slog.Info("Reloading templates from disk on every render", "dir", templateDir)
+	} else if templateDir != "" {
+		slog.Info("Using templates from disk", "dir", templateDir)
+	}
+	slog.Info("Loaded templates", "templates", set.names())
+}
+
+// reloadTemplates parses the templates in templateDir again and swaps them in
+// for the loaded ones. If they fail to parse, the loaded ones are kept.
+func reloadTemplates() (templateSet, error) {
+	set, err := parseTemplates(os.DirFS(templateDir))
+	if err != nil {
+		return nil, err
+	}
+	loadedTemplates.Store(&set)
+	return set, nil
+}
+
+func templateSource() (fs.FS, error) {
+	if templateDir != "" {
+		return os.DirFS(templateDir), nil
+	}
+	return fs.Sub(templateFS, "templates")
+}
+
+func isSharedTemplate(name string) bool {
+	for _, dir := range sharedTemplateDirs {
+		if strings.HasPrefix(name, dir+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// templateName returns the name of the template in file, which is its path
+// relative to the template root without the extension, or false if file
+// isn't a template.
+func templateName(file string) (string, bool) {
+	ext := path.Ext(file)
+	for _, e := range templateExtensions {
+		if ext == e {
+			return strings.TrimSuffix(strings.TrimSuffix(file, ext), altDelimsSuffix), true
+		}
+	}
+	return "", false
+}
+
+// parseTemplate parses the template from file into a new template named name
+// in t, with altDelims if the file name asks for them.
+func parseTemplate(t *template.Template, name, file, source string) error {
+	nt := t.New(name)
+	if strings.HasSuffix(strings.TrimSuffix(file, path.Ext(file)), altDelimsSuffix) {
+		nt.Delims(altDelims[0], altDelims[1])
+	}
+	_, err := nt.Parse(source)
+	return err
+}
+
+// parseTemplates reads every template file in fsys, naming each one with
+// templateName. Shared templates are parsed first so that each remaining
+// template can be parsed into a copy of them. Every template is parsed even if
+// some fail, so that all of the parse errors are reported together.
+func parseTemplates(fsys fs.FS) (templateSet, error) {
+	sources := map[string]string{}
+	files := map[string]string{}
+	err := fs.WalkDir(fsys, ".", func(file string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		name, ok := templateName(file)
+		if !ok {
+			slog.Debug("Skipping non-template file", "file", file)
+			return nil
+		}
+		if other, ok := files[name]; ok {
+			slog.Warn("Duplicate template name, ignoring file", "name", name, "file", file, "using", other)
+			return nil
+		}
+
+		slog.Debug("Loading template", "name", name)
+		bytes, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return err
+		}
+		sources[name] = string(bytes)
+		files[name] = file
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(sources))
+	for name := range sources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var errs []error
+	base := template.New("").Funcs(templateFuncs).Funcs(requestFuncs(context.Background()))
+	for _, name := range names {
+		if isSharedTemplate(name) {
+			if err := parseTemplate(base, name, files[name], sources[name]); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", files[name], err))
+			}
+		}
+	}
+
+	set := templateSet{}
+	for _, name := range names {
+		if isSharedTemplate(name) {
+			continue
+		}
+		t, err := base.Clone()
+		if err != nil {
+			return nil, err
+		}
+		if err := parseTemplate(t, name, files[name], sources[name]); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", files[name], err))
+			continue
+		}
+		set[name] = t
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return set, nil
+}
+
+func (s templateSet) names() []string {
+	names := make([]string, 0, len(s))
+	for name := range s {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// requestFuncs returns the template functions whose output depends on the
+// current request. They are registered with placeholder values before parsing
+// and rebound to the request in render.
+func requestFuncs(ctx context.Context) template.FuncMap {
+	lang := languageFrom(ctx)
+	locale := localeFrom(ctx)
+	return template.FuncMap{
+		"csrfField": func() template.HTML {
+			return csrfInput(ctx)
+		},
+		"lang": func() string {
+			return lang
+		},
+		"flash": func() string {
+			return flashFrom(ctx)
+		},
+		"styleNonce": func() string {
+			return styleNonceFrom(ctx)
+		},
+		"static": func(name string) string {
+			return staticURL(ctx, name)
+		},
+		"t": func(key string, args ...any) string {
+			return translate(lang, key, args...)
+		},
+		"localDate": func(t any) (string, error) {
+			return localDate(locale, t)
+		},
+		"localEventTime": func(t time.Time, tz string) string {
+			return localEventTime(locale, t, tz)
+		},
+		"localNumber": func(n int) string {
+			return localNumber(locale, n)
+		},
+	}
+}
+
+// lookup returns a fresh copy of the named template bound to the request's
+// template functions. Executing a template prevents it from being cloned, so
+// the loaded templates are never executed directly.
+func (s templateSet) lookup(ctx context.Context, name string) (*template.Template, error) {
+	t, ok := s[name]
+	if !ok {
+		return nil, fmt.Errorf("no template named %q", name)
+	}
+	t, err := t.Clone()
+	if err != nil {
+		return nil, err
+	}
+	return t.Funcs(requestFuncs(ctx)), nil
+}
+
+// render executes the named template. Pages wrap themselves in the shared
+// layout with {{template "layout" .}}, defining "title" and "content" blocks.
+// Errors are returned for the caller to handle, usually with serverError.
+func render(ctx context.Context, w io.Writer, name string, data any) error {
+	loggerFrom(ctx).Debug("Rendering template", "template", name)
+
+	set := *loadedTemplates.Load()
+	if templateReload {
+		start := time.Now()
+		var err error
+		if set, err = reloadTemplates(); err != nil {
+			return fmt.Errorf("reloading templates: %w", err)
+		}
+		loggerFrom(ctx).Debug("Reloaded templates", "dir", templateDir, "duration", time.Since(start))
+	}
+
+	t, err := set.lookup(ctx, name)
+	if err != nil {
+		return fmt.Errorf("preparing template %q: %w", name, err)
+	}
+
+	if err := t.ExecuteTemplate(w, name, data); err != nil {
+		return fmt.Errorf("rendering template %q: %w", name, err)
+	}
+	return nil
+}
+
+// renderPage renders the named template as the response with the given
+// status. The page is rendered into a buffer first, so a template that fails
+// partway through produces a clean error page instead of a truncated one.
+func renderPage(rw http.ResponseWriter, req *http.Request, status int, name string, data any) {
+	var buf bytes.Buffer
+	if err := render(req.Context(), &buf, name, data); err != nil {
+		serverError(rw, req, err)
+		return
+	}
+	writePage(rw, status, &buf)
+}
+
+func writePage(rw http.ResponseWriter, status int, buf *bytes.Buffer) {
+	rw.Header().Set("Content-Type", "text/html; charset=utf-8")
+	rw.WriteHeader(status)
+	buf.WriteTo(rw)
+}
@@ -0,0 +1,332 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+
+	"github.com/meagar/rsvp/db"
+)
+
+// useTemplateDir loads templates from dir, reloading them on every render if
+// reload is set, until the end of the test.
+func useTemplateDir(t *testing.T, dir string, reload bool) {
+	t.Helper()
+	loadTemplates(dir, reload)
+	t.Cleanup(func() { loadTemplates("", false) })
+}
+
+// writeTemplate writes source to the named file under dir, creating any
+// directories it's in.
+func writeTemplate(t *testing.T, dir, file, source string) {
+	t.Helper()
+	path := filepath.Join(dir, filepath.FromSlash(file))
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(source), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// renderString renders the named template with data.
+func renderString(t *testing.T, name string, data any) string {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := render(context.Background(), &buf, name, data); err != nil {
+		t.Fatalf("rendering %s: %v", name, err)
+	}
+	return buf.String()
+}
+
+func TestTemplateReload(t *testing.T) {
+	dir := t.TempDir()
+	writeTemplate(t, dir, "greeting.tmpl", "Hello, {{.}}")
+	useTemplateDir(t, dir, true)
+
+	if got := renderString(t, "greeting", "Ada"); got != "Hello, Ada" {
+		t.Fatalf("first render = %q, want %q", got, "Hello, Ada")
+	}
+
+	writeTemplate(t, dir, "greeting.tmpl", "Welcome back, {{.}}")
+	if got := renderString(t, "greeting", "Ada"); got != "Welcome back, Ada" {
+		t.Errorf("render after editing = %q, want %q", got, "Welcome back, Ada")
+	}
+}
+
+func TestTemplatesCachedWithoutReload(t *testing.T) {
+	dir := t.TempDir()
+	writeTemplate(t, dir, "greeting.tmpl", "Hello, {{.}}")
+	useTemplateDir(t, dir, false)
+
+	writeTemplate(t, dir, "greeting.tmpl", "Welcome back, {{.}}")
+	if got := renderString(t, "greeting", "Ada"); got != "Hello, Ada" {
+		t.Errorf("render after editing = %q, want the cached %q", got, "Hello, Ada")
+	}
+}
+
+func TestPagesUseLayout(t *testing.T) {
+	page := renderString(t, "rsvp/form", rsvpFormData{
+		Guest:          &db.Guest{Name: "Ada Lovelace", InviteCode: "ABC123", PartySize: 1, MaxPartySize: 1},
+		PartySizeLimit: 1,
+	})
+
+	if !strings.HasPrefix(page, "<!DOCTYPE html>") {
+		t.Errorf("page doesn't start with the layout's doctype:\n%s", page)
+	}
+	if !strings.Contains(page, "<title>Ada Lovelace&#39;s invitation</title>") {
+		t.Errorf("the layout's title isn't the page's:\n%s", page)
+	}
+	_, main, ok := strings.Cut(page, "<main>")
+	main, _, closed := strings.Cut(main, "</main>")
+	if !ok || !closed || !strings.Contains(main, "<h1>Hello, Ada Lovelace</h1>") || !strings.Contains(main, "<form") {
+		t.Errorf("the page's content isn't inside the layout's <main>:\n%s", page)
+	}
+	if !strings.HasSuffix(strings.TrimSpace(page), "</html>") {
+		t.Errorf("page doesn't end with the layout's </html>:\n%s", page)
+	}
+}
+
+func TestTemplateName(t *testing.T) {
+	tests := []struct {
+		file   string
+		want   string
+		wantOK bool
+	}{
+		{file: "index.tmpl", want: "index", wantOK: true},
+		{file: "admin/guests.html", want: "admin/guests", wantOK: true},
+		{file: "emails/rsvp/confirm.tmpl", want: "emails/rsvp/confirm", wantOK: true},
+		{file: "emails/welcome.alt.tmpl", want: "emails/welcome", wantOK: true},
+		{file: "README.md", wantOK: false},
+		{file: "admin/guests.tmpl.bak", wantOK: false},
+	}
+	for _, tt := range tests {
+		got, ok := templateName(tt.file)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("templateName(%q) = %q, %v, want %q, %v", tt.file, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestParseTemplatesNames(t *testing.T) {
+	logs := captureLogs(t)
+	set, err := parseTemplates(fstest.MapFS{
+		"partials/sig.tmpl":         {Data: []byte(`{{define "sig"}}-- The hosts{{end}}`)},
+		"emails/rsvp/confirm.html":  {Data: []byte(`Thanks, {{.}} {{template "sig"}}`)},
+		"greeting.html":             {Data: []byte(`Hello from the HTML file`)},
+		"greeting.tmpl":             {Data: []byte(`Hello from the tmpl file`)},
+		"notes.txt":                 {Data: []byte(`not a template`)},
+		"emails/rsvp/reminder.tmpl": {Data: []byte(`Reminder`)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"emails/rsvp/confirm", "emails/rsvp/reminder", "greeting"}
+	if got := set.names(); !slices.Equal(got, want) {
+		t.Errorf("templates = %q, want %q", got, want)
+	}
+
+	var buf bytes.Buffer
+	if err := set["emails/rsvp/confirm"].ExecuteTemplate(&buf, "emails/rsvp/confirm", "Ada"); err != nil || buf.String() != "Thanks, Ada -- The hosts" {
+		t.Errorf("nested template rendered %q, %v", buf.String(), err)
+	}
+
+	var duplicate map[string]any
+	for _, line := range logLines(t, logs) {
+		if line["msg"] == "Duplicate template name, ignoring file" {
+			duplicate = line
+		}
+	}
+	if duplicate == nil || duplicate["name"] != "greeting" || duplicate["file"] != "greeting.tmpl" || duplicate["using"] != "greeting.html" {
+		t.Errorf("the duplicate wasn't reported: %v", duplicate)
+	}
+	buf.Reset()
+	if err := set["greeting"].ExecuteTemplate(&buf, "greeting", nil); err != nil || buf.String() != "Hello from the HTML file" {
+		t.Errorf("greeting rendered %q, %v, want the first file found", buf.String(), err)
+	}
+}
+
+func TestParseTemplatesReportsErrors(t *testing.T) {
+	_, err := parseTemplates(fstest.MapFS{
+		"partials/broken.tmpl": {Data: []byte(`{{define "broken"}}{{if .}}{{end}}`)},
+		"admin/guests.tmpl":    {Data: []byte(`{{range .Guests}}{{.Name}}`)},
+		"rsvp/form.tmpl":       {Data: []byte(`{{nosuchfunc .}}`)},
+		"rsvp/thanks.tmpl":     {Data: []byte(`Thanks!`)},
+	})
+	if err == nil {
+		t.Fatal("parseTemplates succeeded")
+	}
+	for _, want := range []string{
+		"partials/broken.tmpl: ",
+		"admin/guests.tmpl: template: admin/guests:1: unexpected EOF",
+		`rsvp/form.tmpl: template: rsvp/form:1: function "nosuchfunc" not defined`,
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("the error doesn't contain %q:\n%v", want, err)
+		}
+	}
+	if strings.Contains(err.Error(), "thanks") {
+		t.Errorf("the error mentions the valid template:\n%v", err)
+	}
+}
+
+func TestAltDelims(t *testing.T) {
+	dir := t.TempDir()
+	writeTemplate(t, dir, "partials/sig.tmpl", `{{define "sig"}}-- The hosts{{end}}`)
+	writeTemplate(t, dir, "emails/welcome.alt.tmpl", `<p>Hello, [[.]]! Reply to {{list.reply_to}}.</p>[[template "sig"]]`)
+	writeTemplate(t, dir, "emails/goodbye.tmpl", `Goodbye, {{.}} [[.]]`)
+	useTemplateDir(t, dir, false)
+
+	if got, want := renderString(t, "emails/welcome", "Ada"), "<p>Hello, Ada! Reply to {{list.reply_to}}.</p>-- The hosts"; got != want {
+		t.Errorf("emails/welcome = %q, want %q", got, want)
+	}
+	if got, want := renderString(t, "emails/goodbye", "Ada"), "Goodbye, Ada [[.]]"; got != want {
+		t.Errorf("emails/goodbye = %q, want %q", got, want)
+	}
+}
+
+func TestRenderReturnsErrors(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("missing field", func(t *testing.T) {
+		// hello uses .Name, which this data hasn't got.
+		err := render(ctx, &bytes.Buffer{}, "hello", struct{ Title string }{Title: "Ada"})
+		if err == nil || !strings.Contains(err.Error(), `rendering template "hello"`) || !strings.Contains(err.Error(), "Name") {
+			t.Errorf("err = %v, want one naming the template and the field", err)
+		}
+	})
+
+	t.Run("unknown template", func(t *testing.T) {
+		err := render(ctx, &bytes.Buffer{}, "no/such/page", nil)
+		if err == nil || !strings.Contains(err.Error(), `"no/such/page"`) {
+			t.Errorf("err = %v, want one naming the template", err)
+		}
+	})
+
+	t.Run("reload fails", func(t *testing.T) {
+		dir := t.TempDir()
+		writeTemplate(t, dir, "layouts/base.tmpl", `{{define "layout"}}{{template "content" .}}{{end}}`)
+		writeTemplate(t, dir, "hello.tmpl", `{{template "layout" .}}{{define "content"}}Hello, {{.Name}}{{end}}`)
+		useTemplateDir(t, dir, true)
+		writeTemplate(t, dir, "hello.tmpl", `{{template "layout" .}}{{define "content"}}Hello, {{.Name}{{end}}`)
+
+		err := render(ctx, &bytes.Buffer{}, "hello", struct{ Name string }{Name: "Ada"})
+		if err == nil || !strings.Contains(err.Error(), "reloading templates") {
+			t.Errorf("err = %v, want a reload error", err)
+		}
+	})
+}
+
+func TestRenderPageDiscardsPartialOutput(t *testing.T) {
+	dir := t.TempDir()
+	writeTemplate(t, dir, "layouts/base.tmpl", `{{define "layout"}}<html><body>{{template "content" .}}</body></html>{{end}}`)
+	writeTemplate(t, dir, "error.tmpl", `{{template "layout" .}}{{define "content"}}<h1>Error {{.Status}}</h1>{{end}}`)
+	// The page fails only after writing far more than any writer buffers.
+	writeTemplate(t, dir, "report.tmpl", `{{template "layout" .}}{{define "content"}}<h1>Report</h1>{{range .Rows}}<p>{{.}}</p>{{end}}{{.Missing}}{{end}}`)
+	useTemplateDir(t, dir, false)
+
+	rows := make([]string, 10000)
+	for i := range rows {
+		rows[i] = "row"
+	}
+	rec := httptest.NewRecorder()
+	renderPage(rec, httptest.NewRequest(http.MethodGet, "/report", nil), http.StatusOK, "report", struct{ Rows []string }{Rows: rows})
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusInternalServerError)
+	}
+	if got, want := rec.Body.String(), "<html><body><h1>Error 500</h1></body></html>"; got != want {
+		t.Errorf("body = %.200q, want only the error page %q", got, want)
+	}
+	if got := rec.Header().Get("Content-Type"); got != "text/html; charset=utf-8" {
+		t.Errorf("Content-Type = %q", got)
+	}
+}
+
+// BenchmarkRender compares rendering a page from the cached templates with
+// parsing them from disk first, as TEMPLATE_RELOAD does.
+func BenchmarkRender(b *testing.B) {
+	for _, bm := range []struct {
+		name   string
+		dir    string
+		reload bool
+	}{
+		{name: "cached"},
+		{name: "reload", dir: "templates", reload: true},
+	} {
+		b.Run(bm.name, func(b *testing.B) {
+			loadTemplates(bm.dir, bm.reload)
+			b.Cleanup(func() { loadTemplates("", false) })
+			data := struct{ Email string }{Email: "ada@example.com"}
+			b.ResetTimer()
+			for range b.N {
+				if err := render(context.Background(), io.Discard, "rsvp/verified", data); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// TestConcurrentReload renders templates from many goroutines while they're
+// being reloaded, for the race detector to check.
+func TestConcurrentReload(t *testing.T) {
+	for _, reload := range []bool{false, true} {
+		t.Run(fmt.Sprintf("reload=%v", reload), func(t *testing.T) {
+			dir := t.TempDir()
+			writeTemplate(t, dir, "greeting.tmpl", "Hello, {{.}}")
+			useTemplateDir(t, dir, reload)
+
+			var wg sync.WaitGroup
+			done := make(chan struct{})
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for {
+					select {
+					case <-done:
+						return
+					default:
+					}
+					if _, err := reloadTemplates(); err != nil {
+						t.Error(err)
+						return
+					}
+				}
+			}()
+
+			var renders sync.WaitGroup
+			for range 8 {
+				renders.Add(1)
+				go func() {
+					defer renders.Done()
+					for range 50 {
+						var buf bytes.Buffer
+						if err := render(context.Background(), &buf, "greeting", "Ada"); err != nil {
+							t.Error(err)
+							return
+						}
+						if got := buf.String(); got != "Hello, Ada" {
+							t.Errorf("rendered %q, want %q", got, "Hello, Ada")
+							return
+						}
+					}
+				}()
+			}
+			renders.Wait()
+			close(done)
+			wg.Wait()
+		})
+	}
+}
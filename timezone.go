@@ -0,0 +1,36 @@
+package main
+
+import (
+	"sync"
+	"time"
+	_ "time/tzdata" // so that event time zones work where the OS has no zoneinfo
+)
+
+// eventTimeFormat is how event times are shown to guests.
+const eventTimeFormat = "Monday, January 2, 2006 at 3:04 PM MST"
+
+var locations sync.Map // time zone name -> *time.Location
+
+// eventLocation returns the time zone named tz, or the server's own if tz is
+// empty or unknown. Events' time zones are checked when they're saved, so an
+// unknown one only turns up if the name stops being recognized.
+func eventLocation(tz string) *time.Location {
+	if tz == "" {
+		return time.Local
+	}
+	if loc, ok := locations.Load(tz); ok {
+		return loc.(*time.Location)
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return time.Local
+	}
+	locations.Store(tz, loc)
+	return loc
+}
+
+// formatEventTime formats t in the time zone named tz, including the zone's
+// abbreviation so that guests elsewhere know which time is meant.
+func formatEventTime(t time.Time, tz string) string {
+	return t.In(eventLocation(tz)).Format(eventTimeFormat)
+}
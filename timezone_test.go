@@ -0,0 +1,56 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/meagar/rsvp/db"
+)
+
+func TestFormatEventTime(t *testing.T) {
+	at := time.Date(2030, time.June, 14, 22, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		tz   string
+		want string
+	}{
+		{tz: "America/Toronto", want: "Friday, June 14, 2030 at 6:30 PM EDT"},
+		{tz: "Asia/Tokyo", want: "Saturday, June 15, 2030 at 7:30 AM JST"},
+		{tz: "UTC", want: "Friday, June 14, 2030 at 10:30 PM UTC"},
+		{tz: "", want: at.In(time.Local).Format(eventTimeFormat)},
+		{tz: "Mars/Olympus_Mons", want: at.In(time.Local).Format(eventTimeFormat)},
+	}
+	for _, tt := range tests {
+		if got := formatEventTime(at, tt.tz); got != tt.want {
+			t.Errorf("formatEventTime(%v, %q) = %q, want %q", at, tt.tz, got, tt.want)
+		}
+	}
+
+	// Daylight saving time is applied for the date, not for now.
+	winter := time.Date(2030, time.January, 10, 23, 0, 0, 0, time.UTC)
+	if got, want := formatEventTime(winter, "America/Toronto"), "Thursday, January 10, 2030 at 6:00 PM EST"; got != want {
+		t.Errorf("in winter, formatEventTime = %q, want %q", got, want)
+	}
+}
+
+func TestEventTimeInTemplates(t *testing.T) {
+	at := time.Date(2030, time.June, 14, 22, 30, 0, 0, time.UTC)
+	guest := &db.Guest{Name: "Ada Lovelace"}
+
+	for tz, want := range map[string]string{
+		"America/Vancouver": "Friday, June 14, 2030 at 3:30 PM PDT",
+		"Europe/Paris":      "Saturday, June 15, 2030 at 12:30 AM CEST",
+	} {
+		t.Run(tz, func(t *testing.T) {
+			email := renderString(t, "emails/reminder", struct {
+				Guest   *db.Guest
+				Event   *db.Event
+				RSVPURL string
+			}{Guest: guest, Event: &db.Event{Title: "Garden Party", Date: at, TZ: tz}, RSVPURL: "https://rsvp.example.com/rsvp/ABC"})
+			if !strings.Contains(email, "about Garden Party on "+want) {
+				t.Errorf("the reminder doesn't give the time as %q:\n%s", want, email)
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// parseBaseURL validates a BASE_URL value, returning it without a trailing
+// slash.
+func parseBaseURL(value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	u, err := url.Parse(value)
+	if err != nil {
+		return "", err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", errors.New("must be an absolute http or https URL")
+	}
+	if u.RawQuery != "" || u.Fragment != "" {
+		return "", errors.New("must not have a query or fragment")
+	}
+	return strings.TrimSuffix(value, "/"), nil
+}
+
+// absoluteURL turns a path on this site into a full URL, for links that leave
+// the site in emails, QR codes and calendar files. It uses BASE_URL, the
+// app's external address, if that's set, or else the scheme and host req was
+// made to. Behind a TLS-terminating proxy the scheme comes from
+// X-Forwarded-Proto, which isHTTPS only believes from TRUSTED_PROXIES.
+func (c *Config) absoluteURL(req *http.Request, path string) string {
+	if c.BaseURL != "" {
+		return c.BaseURL + path
+	}
+	scheme := "http"
+	if c.isHTTPS(req) {
+		scheme = "https"
+	}
+	return scheme + "://" + req.Host + path
+}
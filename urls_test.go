@@ -0,0 +1,165 @@
+package main
+
+import (
+	"crypto/tls"
+	"html"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/meagar/rsvp/db"
+)
+
+func TestParseBaseURL(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{value: "", want: ""},
+		{value: "https://rsvp.example.com", want: "https://rsvp.example.com"},
+		{value: "https://rsvp.example.com/", want: "https://rsvp.example.com"},
+		{value: "http://localhost:8080/party/", want: "http://localhost:8080/party"},
+		{value: "rsvp.example.com", wantErr: true},
+		{value: "/rsvp", wantErr: true},
+		{value: "ftp://rsvp.example.com", wantErr: true},
+		{value: "https://rsvp.example.com/?x=1", wantErr: true},
+		{value: "https://rsvp.example.com/#top", wantErr: true},
+		{value: "https://rsvp.example.com/%zz", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseBaseURL(tt.value)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseBaseURL(%q) = %q, want an error", tt.value, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("parseBaseURL(%q) = %q, %v, want %q", tt.value, got, err, tt.want)
+		}
+	}
+}
+
+func TestAbsoluteURL(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "http://internal:8080/rsvp", nil)
+
+	t.Run("from the request", func(t *testing.T) {
+		cfg := &Config{}
+		if got, want := cfg.absoluteURL(req, "/rsvp/ABC"), "http://internal:8080/rsvp/ABC"; got != want {
+			t.Errorf("absoluteURL = %q, want %q", got, want)
+		}
+	})
+
+	t.Run("BASE_URL", func(t *testing.T) {
+		cfg := &Config{BaseURL: "https://rsvp.example.com/party"}
+		if got, want := cfg.absoluteURL(req, "/rsvp/ABC"), "https://rsvp.example.com/party/rsvp/ABC"; got != want {
+			t.Errorf("absoluteURL = %q, want %q", got, want)
+		}
+	})
+
+	cfg := &Config{TrustedProxies: testProxies(t, "10.0.0.0/8")}
+	proxied := []struct {
+		name  string
+		peer  string
+		tls   bool
+		proto string
+		want  string
+	}{
+		{name: "TLS", peer: "203.0.113.9:1234", tls: true, want: "https://internal:8080/rsvp/ABC"},
+		{name: "trusted proxy over HTTPS", peer: "10.0.0.1:1234", proto: "https", want: "https://internal:8080/rsvp/ABC"},
+		{name: "trusted proxy over HTTP", peer: "10.0.0.1:1234", proto: "http", want: "http://internal:8080/rsvp/ABC"},
+		{name: "untrusted peer claiming HTTPS", peer: "203.0.113.9:1234", proto: "https", want: "http://internal:8080/rsvp/ABC"},
+	}
+	for _, tt := range proxied {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "http://internal:8080/rsvp", nil)
+			req.RemoteAddr = tt.peer
+			if tt.tls {
+				req.TLS = &tls.ConnectionState{}
+			}
+			if tt.proto != "" {
+				req.Header.Set("X-Forwarded-Proto", tt.proto)
+			}
+			if got := cfg.absoluteURL(req, "/rsvp/ABC"); got != tt.want {
+				t.Errorf("absoluteURL = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLinksUseBaseURL(t *testing.T) {
+	pool := testPool(t)
+	t.Setenv("BASE_URL", "https://rsvp.example.com")
+	site := newTestSite(t, pool)
+	event := createTestEvent(t, pool, &db.Event{})
+	guest := createTestGuest(t, pool, &db.Guest{EventId: &event.Id, Email: "ada@example.com"})
+
+	if rec := site.post("/rsvp", rsvpForm(site, guest, event, url.Values{"attending": {"yes"}, "party_size": {"1"}})); rec.Code != http.StatusSeeOther {
+		t.Fatalf("status = %d, want %d\n%s", rec.Code, http.StatusSeeOther, rec.Body)
+	}
+	messages := site.mailer.messages()
+	if len(messages) != 1 {
+		t.Fatalf("sent %d emails, want 1", len(messages))
+	}
+	body := messages[0].Body
+	for _, link := range []string{
+		"https://rsvp.example.com" + site.sessions.rsvpPath(guest, event),
+		"https://rsvp.example.com" + site.sessions.cancelPath(guest, event),
+	} {
+		if want := `href="` + html.EscapeString(link) + `"`; !strings.Contains(body, want) {
+			t.Errorf("the confirmation doesn't contain %q:\n%s", want, body)
+		}
+	}
+	// httptest requests are made to example.com.
+	if strings.Contains(body, "http://example.com") {
+		t.Errorf("the confirmation links to the request's host:\n%s", body)
+	}
+}
+
+func TestLinksFollowForwardedProto(t *testing.T) {
+	pool := testPool(t)
+	t.Setenv("TRUSTED_PROXIES", "10.0.0.0/8")
+	site := newTestSite(t, pool)
+	event := createTestEvent(t, pool, &db.Event{})
+
+	tests := []struct {
+		name  string
+		peer  string
+		email string
+		want  string
+	}{
+		{name: "trusted proxy", peer: "10.0.0.1:1234", email: "ada@example.com", want: "https://rsvp.example.com"},
+		{name: "untrusted peer", peer: "203.0.113.9:1234", email: "grace@example.com", want: "http://rsvp.example.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			guest := createTestGuest(t, pool, &db.Guest{EventId: &event.Id, Email: tt.email})
+			body := url.Values{csrfField: {testCSRFToken}}
+			for key, values := range rsvpForm(site, guest, event, url.Values{"attending": {"yes"}, "party_size": {"1"}}) {
+				body[key] = values
+			}
+			req := httptest.NewRequest(http.MethodPost, "http://rsvp.example.com/rsvp", strings.NewReader(body.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.Header.Set("X-Forwarded-Proto", "https")
+			req.AddCookie(&http.Cookie{Name: csrfCookie, Value: testCSRFToken})
+			req.RemoteAddr = tt.peer
+			if rec := site.serve(req); rec.Code != http.StatusSeeOther {
+				t.Fatalf("status = %d, want %d\n%s", rec.Code, http.StatusSeeOther, rec.Body)
+			}
+
+			messages := site.mailer.messages()
+			if len(messages) == 0 {
+				t.Fatal("no confirmation was sent")
+			}
+			confirmation := messages[len(messages)-1].Body
+			for _, path := range []string{site.sessions.rsvpPath(guest, event), site.sessions.cancelPath(guest, event)} {
+				if want := `href="` + html.EscapeString(tt.want+path) + `"`; !strings.Contains(confirmation, want) {
+					t.Errorf("the confirmation doesn't contain %q:\n%s", want, confirmation)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/meagar/rsvp/db"
+)
+
+// verificationTTL is how long an email verification link stays valid.
+const verificationTTL = 7 * 24 * time.Hour
+
+// verificationToken returns a signed token confirming that guest's current
+// email address belongs to them, valid until expires.
+func (s signer) verificationToken(guest *db.Guest, expires time.Time) string {
+	return s.sign(strings.Join([]string{"verify", strconv.FormatInt(expires.Unix(), 10), strconv.Itoa(guest.Id), guest.Email}, "|"))
+}
+
+// verifyVerificationToken returns the guest id and email address named by a
+// verification token, provided its signature is valid and it hasn't expired.
+func (s signer) verifyVerificationToken(token string, now time.Time) (int, string, bool) {
+	value, ok := s.verify(token)
+	if !ok {
+		return 0, "", false
+	}
+
+	parts := strings.SplitN(value, "|", 4)
+	if len(parts) != 4 || parts[0] != "verify" {
+		return 0, "", false
+	}
+	unix, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || now.After(time.Unix(unix, 0)) {
+		return 0, "", false
+	}
+	id, err := strconv.Atoi(parts[2])
+	if err != nil {
+		return 0, "", false
+	}
+	return id, parts[3], true
+}
+
+// sendVerification emails the guest a link confirming their address. Until
+// they follow it, they get no other email. Failures are logged rather than
+// reported, since the guest's response has been saved.
+func (h *RSVPHandler) sendVerification(req *http.Request, guest *db.Guest) {
+	token := h.sessions.verificationToken(guest, time.Now().Add(verificationTTL))
+
+	var body bytes.Buffer
+	err := render(req.Context(), &body, "emails/verify", struct {
+		Guest     *db.Guest
+		VerifyURL string
+	}{Guest: guest, VerifyURL: h.cfg.absoluteURL(req, "/verify?"+url.Values{"token": {token}}.Encode())})
+	if err != nil {
+		loggerFrom(req.Context()).Error("Rendering verification email failed", "guest", guest.Id, "error", err)
+		return
+	}
+
+	if err := h.mailer.Send(guest.Email, "Please confirm your email address", body.String()); err != nil {
+		loggerFrom(req.Context()).Error("Sending verification email failed", "guest", guest.Id, "error", err)
+	}
+}
+
+// verifyEmail marks a guest's email address verified when they follow the
+// link from sendVerification. Links for an address the guest has since
+// changed no longer work.
+func (h *RSVPHandler) verifyEmail(rw http.ResponseWriter, req *http.Request) {
+	id, email, ok := h.sessions.verifyVerificationToken(req.URL.Query().Get("token"), time.Now())
+	if !ok {
+		renderPage(rw, req, http.StatusBadRequest, "rsvp/verify_failed", nil)
+		return
+	}
+
+	ctx, cancel := h.cfg.queryContext(req)
+	defer cancel()
+
+	verified, err := db.VerifyGuestEmail(ctx, h.db, id, email)
+	if err != nil {
+		serverError(rw, req, err)
+		return
+	}
+	if !verified {
+		renderPage(rw, req, http.StatusBadRequest, "rsvp/verify_failed", nil)
+		return
+	}
+
+	loggerFrom(req.Context()).Info("Verified guest email", "guest", id)
+	renderPage(rw, req, http.StatusOK, "rsvp/verified", struct{ Email string }{Email: email})
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"html"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/meagar/rsvp/db"
+)
+
+func TestVerificationToken(t *testing.T) {
+	sessions := signer{key: []byte(testSessionSecret)}
+	guest := &db.Guest{Id: 42, Email: "ada@example.com", InviteCode: "ABC123"}
+	now := time.Now()
+	token := sessions.verificationToken(guest, now.Add(time.Hour))
+
+	id, email, ok := sessions.verifyVerificationToken(token, now)
+	if !ok || id != guest.Id || email != guest.Email {
+		t.Errorf("verifyVerificationToken = %d, %q, %v, want %d, %q, true", id, email, ok, guest.Id, guest.Email)
+	}
+	if _, _, ok := sessions.verifyVerificationToken(token, now.Add(2*time.Hour)); ok {
+		t.Error("an expired token was accepted")
+	}
+	if _, _, ok := sessions.verifyVerificationToken(token+"x", now); ok {
+		t.Error("a tampered token was accepted")
+	}
+	if _, _, ok := sessions.verifyVerificationToken(sessions.cancelToken(guest), now); ok {
+		t.Error("a cancel token was accepted as a verification token")
+	}
+}
+
+var verifyLink = regexp.MustCompile(`href="([^"]*/verify\?[^"]*)"`)
+
+func TestVerifyEmail(t *testing.T) {
+	pool := testPool(t)
+	site := newTestSite(t, pool)
+	event := createTestEvent(t, pool, &db.Event{})
+	guest := createTestGuest(t, pool, &db.Guest{EventId: &event.Id})
+
+	rec := site.post("/rsvp", rsvpForm(site, guest, event, url.Values{"attending": {"yes"}, "party_size": {"1"}, "email": {"ada@example.com"}}))
+	if rec.Code != http.StatusSeeOther {
+		t.Fatalf("status = %d, want %d\n%s", rec.Code, http.StatusSeeOther, rec.Body)
+	}
+	if reloadGuest(t, pool, guest.Id).EmailVerified() {
+		t.Fatal("the address was verified before the guest confirmed it")
+	}
+
+	// The only email an unverified address gets is the request to verify it.
+	messages := site.mailer.messages()
+	if len(messages) != 1 || messages[0].To != "ada@example.com" {
+		t.Fatalf("sent %+v, want one verification email to ada@example.com", messages)
+	}
+	match := verifyLink.FindStringSubmatch(messages[0].Body)
+	if match == nil {
+		t.Fatalf("the verification email has no link:\n%s", messages[0].Body)
+	}
+	link, err := url.Parse(html.UnescapeString(match[1]))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec = site.get(link.RequestURI())
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "ada@example.com") {
+		t.Fatalf("got %d, want the verified page\n%s", rec.Code, rec.Body)
+	}
+	if !reloadGuest(t, pool, guest.Id).EmailVerified() {
+		t.Fatal("following the link didn't verify the address")
+	}
+
+	// Changing the address again revokes the link for the old one.
+	site.post("/rsvp", rsvpForm(site, guest, event, url.Values{"attending": {"yes"}, "party_size": {"1"}, "email": {"ada@example.org"}}))
+	if rec := site.get(link.RequestURI()); rec.Code != http.StatusBadRequest {
+		t.Errorf("a link for a replaced address: status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+	if reloadGuest(t, pool, guest.Id).EmailVerified() {
+		t.Error("the new address is verified by the old address's link")
+	}
+}
+
+func TestRemindersSkipUnverifiedAddresses(t *testing.T) {
+	pool := testPool(t)
+	site := newTestSite(t, pool)
+	event := createTestEvent(t, pool, &db.Event{})
+	createTestGuest(t, pool, &db.Guest{EventId: &event.Id, Name: "Ada", Email: "ada@example.com"})
+	unverified := createTestGuest(t, pool, &db.Guest{EventId: &event.Id, Name: "Grace", Email: "grace@example.com"})
+	if _, err := pool.Exec(context.Background(), "update guests set email_verified_at = null where id = $1", unverified.Id); err != nil {
+		t.Fatal(err)
+	}
+
+	remind := func() []string {
+		before := len(site.mailer.messages())
+		site.post("/admin/events/"+event.Slug+"/remind", url.Values{}, site.adminSession())
+		var to []string
+		for _, msg := range site.mailer.messages()[before:] {
+			to = append(to, msg.To)
+		}
+		return to
+	}
+	if to, want := remind(), []string{"ada@example.com"}; !slices.Equal(to, want) {
+		t.Fatalf("reminded %q, want %q", to, want)
+	}
+
+	token := site.sessions.verificationToken(unverified, time.Now().Add(time.Hour))
+	if rec := site.get("/verify?" + url.Values{"token": {token}}.Encode()); rec.Code != http.StatusOK {
+		t.Fatalf("verifying: status = %d, want %d\n%s", rec.Code, http.StatusOK, rec.Body)
+	}
+	if to, want := remind(), []string{"grace@example.com"}; !slices.Equal(to, want) {
+		t.Errorf("once verified, reminded %q, want %q", to, want)
+	}
+}
+
+func TestVerifyEmailRejectsInvalidTokens(t *testing.T) {
+	site := newTestSite(t, unreachablePool(t))
+	expired := site.sessions.verificationToken(&db.Guest{Id: 1, Email: "ada@example.com"}, time.Now().Add(-time.Minute))
+
+	for _, token := range []string{"", "nonsense", expired} {
+		rec := site.get("/verify?" + url.Values{"token": {token}}.Encode())
+		if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "This link doesn&#39;t work") {
+			t.Errorf("token %q: got %d, want the verification failed page\n%s", token, rec.Code, rec.Body)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/meagar/rsvp/db"
+)
+
+// mailSubjects returns the subjects of the messages site has sent to each
+// address.
+func mailSubjects(site *testSite) map[string][]string {
+	subjects := map[string][]string{}
+	for _, msg := range site.mailer.messages() {
+		subjects[msg.To] = append(subjects[msg.To], msg.Subject)
+	}
+	return subjects
+}
+
+func TestWaitlist(t *testing.T) {
+	pool := testPool(t)
+	site := newTestSite(t, pool)
+	event := createTestEvent(t, pool, &db.Event{Capacity: ptr(4)})
+	guest := func(name string) *db.Guest {
+		return createTestGuest(t, pool, &db.Guest{Name: name, Email: strings.ToLower(name) + "@example.com", EventId: &event.Id, MaxPartySize: 2})
+	}
+	respond := func(guest *db.Guest, attending string, partySize int) string {
+		t.Helper()
+		form := url.Values{"attending": {attending}, "party_size": {strconv.Itoa(partySize)}}
+		rec := site.post("/rsvp", rsvpForm(site, guest, event, form))
+		if rec.Code != http.StatusSeeOther {
+			t.Fatalf("%s's response: status = %d, want %d", guest.Name, rec.Code, http.StatusSeeOther)
+		}
+		return site.get(rec.Header().Get("Location")).Body.String()
+	}
+
+	ada, grace, alan, edsger := guest("Ada"), guest("Grace"), guest("Alan"), guest("Edsger")
+	respond(ada, "yes", 2)
+	if page := respond(grace, "yes", 2); strings.Contains(page, "on the waitlist") {
+		t.Error("Grace, who took the last places, was told she's on the waitlist")
+	}
+	if page := respond(alan, "yes", 1); !strings.Contains(page, "on the waitlist") {
+		t.Errorf("Alan, over capacity, wasn't told he's on the waitlist:\n%s", page)
+	}
+	respond(edsger, "yes", 2)
+	for _, g := range []*db.Guest{ada, grace, alan, edsger} {
+		*g = *reloadGuest(t, pool, g.Id)
+	}
+	if ada.IsWaitlisted() || grace.IsWaitlisted() || !alan.IsWaitlisted() || !edsger.IsWaitlisted() {
+		t.Fatalf("waitlisted: Ada %v, Grace %v, Alan %v, Edsger %v; want only Alan and Edsger",
+			ada.IsWaitlisted(), grace.IsWaitlisted(), alan.IsWaitlisted(), edsger.IsWaitlisted())
+	}
+	if got := mailSubjects(site)[alan.Email]; !slices.Equal(got, []string{"You're on the waitlist: " + event.Title}) {
+		t.Errorf("Alan was sent %q", got)
+	}
+
+	// Ada's two places go to Alan, who was first in line. Edsger's party of
+	// two won't fit in the one place left.
+	respond(ada, "no", 2)
+	if reloadGuest(t, pool, alan.Id).IsWaitlisted() {
+		t.Error("Alan wasn't promoted when Ada cancelled")
+	}
+	if !reloadGuest(t, pool, edsger.Id).IsWaitlisted() {
+		t.Error("Edsger was promoted past the event's capacity")
+	}
+	subjects := mailSubjects(site)
+	if got := subjects[alan.Email]; len(got) != 2 || got[1] != "A place has opened up: "+event.Title {
+		t.Errorf("Alan was sent %q, want a promotion email", got)
+	}
+	if got := subjects[edsger.Email]; len(got) != 1 {
+		t.Errorf("Edsger was sent %q, want only the waitlist email", got)
+	}
+}
+
+func TestAdminChangesPromoteWaitlist(t *testing.T) {
+	pool := testPool(t)
+	site := newTestSite(t, pool)
+	session := site.adminSession()
+	event := createTestEvent(t, pool, &db.Event{Capacity: ptr(2)})
+	ada := createTestGuest(t, pool, &db.Guest{Name: "Ada", Email: "ada@example.com", EventId: &event.Id, MaxPartySize: 2})
+	grace := createTestGuest(t, pool, &db.Guest{Name: "Grace", Email: "grace@example.com", EventId: &event.Id})
+	recordTestResponse(t, pool, ada, db.Response{Attendance: db.AttendanceYes, PartySize: 2})
+	if result := recordTestResponse(t, pool, grace, db.Response{Attendance: db.AttendanceYes, PartySize: 1}); !result.Waitlisted {
+		t.Fatal("Grace wasn't waitlisted")
+	}
+
+	post := func(path string, form url.Values) {
+		t.Helper()
+		if rec := site.post(path, form, session); rec.Code != http.StatusSeeOther {
+			t.Fatalf("POST %s: status = %d, want %d\n%s", path, rec.Code, http.StatusSeeOther, rec.Body)
+		}
+	}
+	editAda := func(response string) {
+		post("/admin/guests/"+strconv.Itoa(ada.Id), url.Values{"name": {"Ada"}, "email": {ada.Email}, "max_party_size": {"2"}, "response": {response}})
+	}
+	waitlisted := func() []string {
+		var names []string
+		for _, g := range []*db.Guest{ada, grace} {
+			if reloadGuest(t, pool, g.Id).IsWaitlisted() {
+				names = append(names, g.Name)
+			}
+		}
+		return names
+	}
+
+	steps := []struct {
+		name   string
+		change func()
+		want   []string
+	}{
+		{name: "Ada declines", change: func() { editAda("no") }, want: nil},
+		{name: "Ada attends again", change: func() { editAda("yes") }, want: []string{"Ada"}},
+		{name: "Grace is deleted", change: func() { post("/admin/guests/"+strconv.Itoa(grace.Id)+"/delete", nil) }, want: nil},
+		{name: "Grace is restored", change: func() { post("/admin/guests/"+strconv.Itoa(grace.Id)+"/restore", nil) }, want: []string{"Grace"}},
+		{name: "capacity is raised", change: func() {
+			form := eventFormValues(event)
+			form.Set("capacity", "3")
+			post("/admin/events/"+event.Slug+"/edit", form)
+		}, want: nil},
+	}
+	for _, step := range steps {
+		step.change()
+		if got := waitlisted(); !slices.Equal(got, step.want) {
+			t.Fatalf("after %s, waitlisted %q, want %q", step.name, got, step.want)
+		}
+	}
+
+	promotion := "A place has opened up: " + event.Title
+	subjects := mailSubjects(site)
+	if got := subjects[grace.Email]; !slices.Equal(got, []string{promotion, promotion}) {
+		t.Errorf("Grace was sent %q, want two promotions", got)
+	}
+	if got := subjects[ada.Email]; !slices.Equal(got, []string{promotion}) {
+		t.Errorf("Ada was sent %q, want one promotion", got)
+	}
+}
+
+func TestHouseholdWaitlistsInOrder(t *testing.T) {
+	pool := testPool(t)
+	event := createTestEvent(t, pool, &db.Event{Capacity: ptr(1)})
+	household, err := db.FindOrCreateHousehold(context.Background(), pool, event.Id, "Lovelace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var members []*db.Guest
+	responses := map[int]db.Response{}
+	for _, name := range []string{"Ada", "William", "Byron", "Annabella"} {
+		guest := createTestGuest(t, pool, &db.Guest{Name: name, EventId: &event.Id, HouseholdId: &household.Id})
+		members = append(members, guest)
+		responses[guest.Id] = db.Response{Attendance: db.AttendanceYes, PartySize: 1}
+	}
+
+	results, err := db.RecordHouseholdResponse(context.Background(), pool, responses)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The one place goes to the member added first, whatever order the map
+	// is read in.
+	for i, guest := range members {
+		if want := i > 0; results[guest.Id].Waitlisted != want {
+			t.Errorf("%s: waitlisted = %v, want %v", guest.Name, results[guest.Id].Waitlisted, want)
+		}
+	}
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/meagar/rsvp/db"
+)
+
+// webhookSignatureHeader carries the hex HMAC-SHA256 of a webhook's body,
+// keyed with WEBHOOK_SECRET, so that receivers can check it came from us.
+const webhookSignatureHeader = "X-RSVP-Signature"
+
+// webhookDeliveryHeader identifies a notification. Retries of the same
+// notification share it, so receivers can ignore ones they've already seen.
+const webhookDeliveryHeader = "X-RSVP-Delivery"
+
+// webhookMaxDelay caps the wait between retries.
+const webhookMaxDelay = time.Minute
+
+// webhookGuest and webhookEvent describe who responded to what in a webhook
+// notification.
+type webhookGuest struct {
+	Id    int    `json:"id"`
+	Code  string `json:"code"`
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+type webhookEvent struct {
+	Slug  string    `json:"slug"`
+	Title string    `json:"title"`
+	Date  time.Time `json:"date"`
+}
+
+// webhookPayload is the body of a notification that a guest responded.
+type webhookPayload struct {
+	Type        string        `json:"type"`
+	Guest       webhookGuest  `json:"guest"`
+	Event       *webhookEvent `json:"event"`
+	Response    db.Attendance `json:"response"`
+	Attending   bool          `json:"attending"`
+	PartySize   int           `json:"party_size"`
+	Waitlisted  bool          `json:"waitlisted"`
+	RespondedAt *time.Time    `json:"responded_at"`
+}
+
+func newWebhookPayload(guest *db.Guest, event *db.Event) webhookPayload {
+	p := webhookPayload{
+		Type:        "rsvp",
+		Guest:       webhookGuest{Id: guest.Id, Code: guest.InviteCode, Name: guest.Name, Email: guest.Email},
+		Response:    *guest.Attendance,
+		Attending:   guest.IsAttending(),
+		PartySize:   guest.PartySize,
+		Waitlisted:  guest.IsWaitlisted(),
+		RespondedAt: guest.RespondedAt,
+	}
+	if event != nil {
+		p.Event = &webhookEvent{Slug: event.Slug, Title: event.Title, Date: event.Date}
+	}
+	return p
+}
+
+// webhook posts a notification to an integrator's URL whenever a guest
+// responds. Notifications are sent in the background, so that guests aren't
+// kept waiting, and retried with backoff until they're accepted or attempts
+// run out. A nil *webhook sends nothing.
+type webhook struct {
+	url      string
+	secret   []byte
+	client   *http.Client
+	attempts int
+	// delay is the wait before the first retry; it doubles for each one
+	// after.
+	delay time.Duration
+
+	ctx     context.Context
+	cancel  context.CancelFunc
+	pending sync.WaitGroup
+}
+
+// parseWebhookURL checks that value, if set, is an absolute http or https
+// URL.
+func parseWebhookURL(value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	u, err := url.Parse(value)
+	if err != nil {
+		return "", err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", errors.New("must be an absolute http or https URL")
+	}
+	return value, nil
+}
+
+// newWebhook configures a webhook from WEBHOOK_* env vars, returning nil when
+// WEBHOOK_URL is unset.
+func newWebhook(cfg *Config) *webhook {
+	if cfg.WebhookURL == "" {
+		return nil
+	}
+	// The URL may have a token in it, so only its host is logged.
+	u, _ := url.Parse(cfg.WebhookURL)
+	slog.Info("Sending RSVP notifications by webhook", "host", u.Host)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &webhook{
+		url:      cfg.WebhookURL,
+		secret:   []byte(cfg.WebhookSecret),
+		client:   &http.Client{Timeout: cfg.WebhookTimeout},
+		attempts: cfg.WebhookAttempts,
+		delay:    time.Second,
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+}
+
+// sign returns the value of webhookSignatureHeader for body.
+func (w *webhook) sign(body []byte) string {
+	m := hmac.New(sha256.New, w.secret)
+	m.Write(body)
+	return "sha256=" + hex.EncodeToString(m.Sum(nil))
+}
+
+// notify sends guest's response to event, which may be nil, without waiting
+// for it to be delivered. Failures are logged with logger.
+func (w *webhook) notify(logger *slog.Logger, guest *db.Guest, event *db.Event) {
+	if w == nil {
+		return
+	}
+
+	body, err := json.Marshal(newWebhookPayload(guest, event))
+	if err != nil {
+		logger.Error("Encoding webhook failed", "guest", guest.Id, "error", err)
+		return
+	}
+	id, err := newNonce()
+	if err != nil {
+		logger.Error("Generating webhook delivery id failed", "guest", guest.Id, "error", err)
+		return
+	}
+
+	logger = logger.With("guest", guest.Id, "delivery", id)
+	w.pending.Add(1)
+	go func() {
+		defer w.pending.Done()
+		if err := w.deliver(id, body); err != nil {
+			logger.Error("Sending webhook failed", "error", err)
+		}
+	}()
+}
+
+// deliver posts body until the receiver accepts it, attempts run out, or the
+// webhook is shut down. Network errors, 429s and 5xx responses are retried;
+// any other error status is reported straight away.
+func (w *webhook) deliver(id string, body []byte) error {
+	delay := w.delay
+	var err error
+	for attempt := 1; ; attempt++ {
+		var retry bool
+		retry, err = w.post(id, body)
+		if err == nil || !retry || attempt >= w.attempts {
+			break
+		}
+
+		select {
+		case <-time.After(delay):
+		case <-w.ctx.Done():
+			return fmt.Errorf("shut down after %d attempts: %w", attempt, err)
+		}
+		delay = min(delay*2, webhookMaxDelay)
+	}
+	return err
+}
+
+// post makes a single delivery attempt, reporting whether a failure is worth
+// retrying.
+func (w *webhook) post(id string, body []byte) (retry bool, err error) {
+	req, err := http.NewRequestWithContext(w.ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "rsvp-webhook")
+	req.Header.Set(webhookSignatureHeader, w.sign(body))
+	req.Header.Set(webhookDeliveryHeader, id)
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	retry = resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+	return retry, fmt.Errorf("receiver responded %s", resp.Status)
+}
+
+// shutdown waits until ctx is done for pending notifications to be
+// delivered, then abandons any that are left.
+func (w *webhook) shutdown(ctx context.Context) {
+	if w == nil {
+		return
+	}
+
+	done := make(chan struct{})
+	go func() {
+		w.pending.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		slog.Warn("Abandoning undelivered webhooks")
+	}
+	w.cancel()
+}
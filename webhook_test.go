@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/meagar/rsvp/db"
+)
+
+// webhookReceiver is a stub integrator that answers each delivery attempt
+// with the next of its statuses, repeating the last one once they run out.
+type webhookReceiver struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	statuses []int
+	received []*http.Request
+	bodies   [][]byte
+}
+
+func newWebhookReceiver(t *testing.T, statuses ...int) *webhookReceiver {
+	t.Helper()
+	r := &webhookReceiver{statuses: statuses}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.received = append(r.received, req)
+		r.bodies = append(r.bodies, body)
+		status := r.statuses[min(len(r.received), len(r.statuses))-1]
+		rw.WriteHeader(status)
+	}))
+	t.Cleanup(r.Close)
+	return r
+}
+
+func (r *webhookReceiver) requests() ([]*http.Request, [][]byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.received, r.bodies
+}
+
+// testWebhook returns a webhook posting to url that retries quickly.
+func testWebhook(t *testing.T, url string, attempts int) *webhook {
+	t.Helper()
+	w := newWebhook(&Config{WebhookURL: url, WebhookSecret: "webhook secret", WebhookAttempts: attempts, WebhookTimeout: time.Second})
+	w.delay = 10 * time.Millisecond
+	return w
+}
+
+// waitForWebhooks waits for w's pending notifications to be delivered.
+func waitForWebhooks(t *testing.T, w *webhook) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	w.shutdown(ctx)
+}
+
+func TestWebhookDelivery(t *testing.T) {
+	receiver := newWebhookReceiver(t, http.StatusInternalServerError, http.StatusOK)
+	w := testWebhook(t, receiver.URL, 3)
+	respondedAt := time.Date(2030, time.May, 1, 12, 0, 0, 0, time.UTC)
+	guest := &db.Guest{Id: 7, InviteCode: "ABC123", Name: "Ada Lovelace", Email: "ada@example.com", Attendance: ptr(db.AttendanceYes), PartySize: 2, RespondedAt: &respondedAt}
+	event := &db.Event{Slug: "garden-party", Title: "Garden Party", Date: respondedAt.Add(30 * 24 * time.Hour)}
+
+	w.notify(slog.Default(), guest, event)
+	waitForWebhooks(t, w)
+
+	requests, bodies := receiver.requests()
+	if len(requests) != 2 {
+		t.Fatalf("the receiver got %d requests, want 2: one failed and one retried", len(requests))
+	}
+	if requests[0].Header.Get(webhookDeliveryHeader) == "" || requests[1].Header.Get(webhookDeliveryHeader) != requests[0].Header.Get(webhookDeliveryHeader) {
+		t.Errorf("delivery ids %q and %q, want the same id for the retry", requests[0].Header.Get(webhookDeliveryHeader), requests[1].Header.Get(webhookDeliveryHeader))
+	}
+
+	mac := hmac.New(sha256.New, []byte("webhook secret"))
+	mac.Write(bodies[1])
+	if got, want := requests[1].Header.Get(webhookSignatureHeader), "sha256="+hex.EncodeToString(mac.Sum(nil)); got != want {
+		t.Errorf("%s = %q, want %q", webhookSignatureHeader, got, want)
+	}
+	if got := requests[1].Header.Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", got)
+	}
+
+	var payload webhookPayload
+	if err := json.Unmarshal(bodies[1], &payload); err != nil {
+		t.Fatal(err)
+	}
+	want := newWebhookPayload(guest, event)
+	if payload.Type != "rsvp" || payload.Guest != want.Guest || *payload.Event != *want.Event || payload.Response != db.AttendanceYes ||
+		!payload.Attending || payload.PartySize != 2 || payload.Waitlisted || !payload.RespondedAt.Equal(respondedAt) {
+		t.Errorf("payload = %+v, want %+v", payload, want)
+	}
+}
+
+func TestWebhookRetries(t *testing.T) {
+	tests := []struct {
+		name         string
+		status       int
+		wantRequests int
+	}{
+		{name: "server error", status: http.StatusServiceUnavailable, wantRequests: 3},
+		{name: "rate limited", status: http.StatusTooManyRequests, wantRequests: 3},
+		{name: "rejected", status: http.StatusBadRequest, wantRequests: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs := captureLogs(t)
+			receiver := newWebhookReceiver(t, tt.status)
+			w := testWebhook(t, receiver.URL, 3)
+
+			w.notify(slog.Default(), &db.Guest{Id: 7, Attendance: ptr(db.AttendanceNo)}, nil)
+			waitForWebhooks(t, w)
+
+			if requests, _ := receiver.requests(); len(requests) != tt.wantRequests {
+				t.Errorf("the receiver got %d requests, want %d", len(requests), tt.wantRequests)
+			}
+			var failed bool
+			for _, line := range logLines(t, logs) {
+				failed = failed || line["msg"] == "Sending webhook failed"
+			}
+			if !failed {
+				t.Error("the failure wasn't logged")
+			}
+		})
+	}
+}
+
+func TestParseWebhookURL(t *testing.T) {
+	for _, value := range []string{"", "https://example.com/hooks/rsvp?token=secret", "http://localhost:9000/"} {
+		if got, err := parseWebhookURL(value); err != nil || got != value {
+			t.Errorf("parseWebhookURL(%q) = %q, %v, want it unchanged", value, got, err)
+		}
+	}
+	for _, value := range []string{"example.com/hooks", "ftp://example.com/hooks", "https:///hooks", "https://exa mple.com/"} {
+		if _, err := parseWebhookURL(value); err == nil {
+			t.Errorf("parseWebhookURL(%q) accepted it", value)
+		}
+	}
+}
+
+func TestRSVPSendsWebhook(t *testing.T) {
+	pool := testPool(t)
+	site := newTestSite(t, pool)
+	receiver := newWebhookReceiver(t, http.StatusOK)
+	w := testWebhook(t, receiver.URL, 1)
+	site.handler = newHandler(site.cfg, pool, pool, site.sessions, site.mailer, w, site.reminders)
+	event := createTestEvent(t, pool, &db.Event{})
+	guest := createTestGuest(t, pool, &db.Guest{EventId: &event.Id})
+
+	site.post("/rsvp", rsvpForm(site, guest, event, url.Values{"attending": {"yes"}, "party_size": {"1"}}))
+	waitForWebhooks(t, w)
+
+	_, bodies := receiver.requests()
+	if len(bodies) != 1 {
+		t.Fatalf("the receiver got %d notifications, want 1", len(bodies))
+	}
+	var payload webhookPayload
+	if err := json.Unmarshal(bodies[0], &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.Guest.Code != guest.InviteCode || payload.Event == nil || payload.Event.Slug != event.Slug || payload.Response != db.AttendanceYes {
+		t.Errorf("payload = %+v, want %s's yes to %s", payload, guest.InviteCode, event.Slug)
+	}
+}